@@ -0,0 +1,59 @@
+/*
+ * Copyright 2018 Florent Biville (@fbiville)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"regexp"
+)
+
+// HeaderOptions tune how ApplyHeader detects and places headers
+// the zero value only detects the given header, years aside, at the top of the contents
+type HeaderOptions struct {
+	HeaderRegex              *regexp.Regexp // matches the existing headers to replace, if set
+	InsertAfter              *regexp.Regexp // headers are inserted after the line matching it, if any
+	HeaderSearchLines        int            // headers starting within this many leading lines stay below the lines above them, if positive
+	AddOnly                  bool           // contents with a header are left untouched, even if outdated
+	AddHeaderToEmptyContents bool           // empty contents are left untouched otherwise
+	LineEnding               string         // line breaks the header is written with, LF if empty
+}
+
+// ApplyHeader returns the contents with the given rendered header, and whether they changed
+// the header is inserted at the top of contents without header, after the byte order mark and the lines kept above
+// it, or replaces the existing headers, stale years being updated in place
+// up-to-date contents, as well as empty and binary contents, are returned as they are
+// neither the file system nor the version control system are involved, the header being expected to be valid, as
+// ValidateRenderedHeader checks
+func ApplyHeader(contents []byte, header string, style CommentStyle, options HeaderOptions) ([]byte, bool) {
+	headerRegex := options.HeaderRegex
+	if headerRegex == nil {
+		headerRegex = yearAgnosticRegex(header)
+	}
+	result, _ := applyHeader(contents, header, &ChangeSet{
+		HeaderRegex:           headerRegex,
+		TopHeaderRegex:        anchor(headerRegex),
+		CommentStyle:          style,
+		InsertAfter:           options.InsertAfter,
+		AddOnly:               options.AddOnly,
+		HeaderSearchLines:     options.HeaderSearchLines,
+		LineEnding:            options.LineEnding,
+		AddHeaderToEmptyFiles: options.AddHeaderToEmptyContents,
+	})
+	if result == nil {
+		return contents, false
+	}
+	return result, true
+}
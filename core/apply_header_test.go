@@ -0,0 +1,168 @@
+/*
+ * Copyright 2018 Florent Biville (@fbiville)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core_test
+
+import (
+	"fmt"
+	. "github.com/fbiville/headache/core"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"regexp"
+	"runtime"
+)
+
+var _ = Describe("Header application", func() {
+
+	const header = "// Copyright 2018-2020 ACME"
+
+	It("inserts the header at the top of contents without header", func() {
+		result, changed := ApplyHeader([]byte("package foo\n"), header, SlashSlash{}, HeaderOptions{})
+
+		Expect(changed).To(BeTrue())
+		Expect(string(result)).To(Equal("// Copyright 2018-2020 ACME\n\npackage foo\n"))
+	})
+
+	It("inserts the header after the byte order mark", func() {
+		result, changed := ApplyHeader([]byte("\uFEFFpackage foo\n"), header, SlashSlash{}, HeaderOptions{})
+
+		Expect(changed).To(BeTrue())
+		Expect(string(result)).To(Equal("\uFEFF// Copyright 2018-2020 ACME\n\npackage foo\n"))
+	})
+
+	It("inserts the header after the line matching the insertion pattern", func() {
+		options := HeaderOptions{InsertAfter: regexp.MustCompile(`^#!.*`)}
+
+		result, changed := ApplyHeader([]byte("#!/bin/sh\necho hello\n"), "# Copyright 2018-2020 ACME", Hash{}, options)
+
+		Expect(changed).To(BeTrue())
+		Expect(string(result)).To(Equal("#!/bin/sh\n# Copyright 2018-2020 ACME\n\necho hello\n"))
+	})
+
+	It("inserts the header with the configured line breaks", func() {
+		options := HeaderOptions{LineEnding: CrlfLineEnding}
+
+		result, changed := ApplyHeader([]byte("package foo\r\n"), "/*\n * Copyright 2018-2020 ACME\n */", SlashStar{}, options)
+
+		Expect(changed).To(BeTrue())
+		Expect(string(result)).To(Equal("/*\r\n * Copyright 2018-2020 ACME\r\n */\r\n\r\npackage foo\r\n"))
+	})
+
+	It("updates the stale years of the header in place", func() {
+		result, changed := ApplyHeader([]byte("// Copyright 2018 ACME\n\npackage foo\n"), header, SlashSlash{}, HeaderOptions{})
+
+		Expect(changed).To(BeTrue())
+		Expect(string(result)).To(Equal("// Copyright 2018-2020 ACME\n\npackage foo\n"))
+	})
+
+	It("replaces the headers matched by the detection regex", func() {
+		options := HeaderOptions{HeaderRegex: regexp.MustCompile(`(?m)^// Copyright .*\n?`)}
+
+		result, changed := ApplyHeader([]byte("// Copyright 2018 Someone Else\n\npackage foo\n"), header, SlashSlash{}, options)
+
+		Expect(changed).To(BeTrue())
+		Expect(string(result)).To(Equal("// Copyright 2018-2020 ACME\n\npackage foo\n"))
+	})
+
+	It("moves headers found below other contents to the top", func() {
+		result, changed := ApplyHeader([]byte("package foo\n\n// Copyright 2018-2020 ACME\n"), header, SlashSlash{}, HeaderOptions{
+			HeaderRegex: regexp.MustCompile(`(?m)^// Copyright .* ACME\n?`),
+		})
+
+		Expect(changed).To(BeTrue())
+		Expect(string(result)).To(Equal("// Copyright 2018-2020 ACME\n\npackage foo\n\n"))
+	})
+
+	It("leaves contents with an up-to-date header as they are", func() {
+		contents := []byte("// Copyright 2018-2020 ACME\n\npackage foo\n")
+
+		result, changed := ApplyHeader(contents, header, SlashSlash{}, HeaderOptions{})
+
+		Expect(changed).To(BeFalse())
+		Expect(result).To(Equal(contents))
+	})
+
+	It("leaves contents with a header as they are in add-only mode", func() {
+		contents := []byte("// Copyright 2018 ACME\n\npackage foo\n")
+
+		result, changed := ApplyHeader(contents, header, SlashSlash{}, HeaderOptions{AddOnly: true})
+
+		Expect(changed).To(BeFalse())
+		Expect(result).To(Equal(contents))
+	})
+
+	It("inserts the header in add-only mode when there is none", func() {
+		result, changed := ApplyHeader([]byte("package foo\n"), header, SlashSlash{}, HeaderOptions{AddOnly: true})
+
+		Expect(changed).To(BeTrue())
+		Expect(string(result)).To(Equal("// Copyright 2018-2020 ACME\n\npackage foo\n"))
+	})
+
+	It("skips empty contents by default", func() {
+		result, changed := ApplyHeader([]byte{}, header, SlashSlash{}, HeaderOptions{})
+
+		Expect(changed).To(BeFalse())
+		Expect(result).To(BeEmpty())
+	})
+
+	It("inserts the header in empty contents when asked to", func() {
+		result, changed := ApplyHeader([]byte{}, header, SlashSlash{}, HeaderOptions{AddHeaderToEmptyContents: true})
+
+		Expect(changed).To(BeTrue())
+		Expect(string(result)).To(Equal("// Copyright 2018-2020 ACME\n\n"))
+	})
+
+	It("skips binary contents", func() {
+		contents := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+		result, changed := ApplyHeader(contents, header, SlashSlash{}, HeaderOptions{})
+
+		Expect(changed).To(BeFalse())
+		Expect(result).To(Equal(contents))
+	})
+
+	It("leaves the given contents untouched", func() {
+		contents := []byte("// Copyright 2018 ACME\n\npackage foo\n")
+
+		_, changed := ApplyHeader(contents, header, SlashSlash{}, HeaderOptions{})
+
+		Expect(changed).To(BeTrue())
+		Expect(string(contents)).To(Equal("// Copyright 2018 ACME\n\npackage foo\n"))
+	})
+
+	It("does not retain anything across calls", func() {
+		contents := []byte("// Copyright 2018 ACME\n\npackage foo\n")
+		applyHeaders := func(count int) {
+			for i := 0; i < count; i++ {
+				ApplyHeader(contents, fmt.Sprintf("// Copyright 2018-2020 ACME %d", i), SlashSlash{}, HeaderOptions{})
+			}
+		}
+		applyHeaders(10)
+		before := liveHeapBytes()
+
+		applyHeaders(2000)
+
+		Expect(liveHeapBytes()).To(BeNumerically("<", before+1024*1024))
+	})
+})
+
+// returns the number of bytes of reachable heap objects
+func liveHeapBytes() uint64 {
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.HeapAlloc
+}
@@ -0,0 +1,68 @@
+/*
+ * Copyright 2018 Florent Biville (@fbiville)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"log"
+)
+
+// CI variables exposing the base of the pull or merge request under test, by order of precedence
+// GitLab exposes the merge base itself, or the target branch tip in merged results pipelines, whose HEAD merges the
+// source branch into it, while GitHub Actions only exposes the target branch name
+var ciBaseRevisionVariables = []string{
+	"CI_MERGE_REQUEST_DIFF_BASE_SHA",
+	"CI_MERGE_REQUEST_TARGET_BRANCH_SHA",
+}
+var ciBaseBranchVariables = []string{
+	"CI_MERGE_REQUEST_TARGET_BRANCH_NAME",
+	"GITHUB_BASE_REF",
+}
+
+// the remote CI checkouts fetch branches from
+const ciRemote = "origin"
+
+// returns whether the base should be resolved from the CI environment, the configured base taking precedence over it
+func requiresCiBase(config *Configuration) bool {
+	return config.CiBase && config.BaseRevision == "" && config.BaseBranch == ""
+}
+
+// the base revision defaults to the one exposed by the CI environment, or else the base branch to the target branch
+// of the pull or merge request, the configuration being copied rather than altered
+// the configuration is returned as is outside pull and merge request pipelines
+func withCiBase(config *Configuration, environment func(string) string) *Configuration {
+	if environment == nil {
+		return config
+	}
+	result := *config
+	for _, variable := range ciBaseRevisionVariables {
+		if revision := environment(variable); revision != "" {
+			log.Printf("Using base revision %s from %s", revision, variable)
+			result.BaseRevision = revision
+			return &result
+		}
+	}
+	for _, variable := range ciBaseBranchVariables {
+		if branch := environment(variable); branch != "" {
+			branch = ciRemote + "/" + branch
+			log.Printf("Using base branch %s from %s", branch, variable)
+			result.BaseBranch = branch
+			return &result
+		}
+	}
+	log.Print("No pull or merge request base found in the CI environment, ignoring ciBase")
+	return config
+}
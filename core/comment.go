@@ -20,8 +20,10 @@ import (
 	"fmt"
 	tpl "html/template"
 	"log"
+	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
 )
 
 type CommentStyle interface {
@@ -31,6 +33,119 @@ type CommentStyle interface {
 	GetClosingString() string
 }
 
+// NestingCommentStyle is implemented by the block comment styles whose comments nest, as in Scala, Kotlin, Swift or
+// Rust, where /* outer /* inner */ outer */ is a single comment
+type NestingCommentStyle interface {
+	CommentStyle
+	NestsComments() bool
+}
+
+// NestedComments returns the block comment style with nesting comments
+func NestedComments(style CommentStyle) CommentStyle {
+	return nestingStyle{style}
+}
+
+type nestingStyle struct {
+	CommentStyle
+}
+
+func (nestingStyle) NestsComments() bool {
+	return true
+}
+
+func nestsComments(style CommentStyle) bool {
+	switch style := style.(type) {
+	case NestingCommentStyle:
+		return style.NestsComments()
+	case extensionsStyle:
+		return nestsComments(style.CommentStyle)
+	}
+	return false
+}
+
+// ExtensionsCommentStyle is implemented by the comment styles declaring the extensions of the files they apply to,
+// such as ".go", files whose extension no registered style declares being skipped or reported as unknown
+type ExtensionsCommentStyle interface {
+	CommentStyle
+	GetExtensions() []string
+}
+
+// WithExtensions returns the comment style also applying to the files with the given extensions
+func WithExtensions(style CommentStyle, extensions ...string) CommentStyle {
+	var allExtensions []string
+	allExtensions = append(allExtensions, styleExtensions(style)...)
+	return extensionsStyle{style, append(allExtensions, extensions...)}
+}
+
+type extensionsStyle struct {
+	CommentStyle
+	extensions []string
+}
+
+func (style extensionsStyle) GetExtensions() []string {
+	return style.extensions
+}
+
+func styleExtensions(style CommentStyle) []string {
+	switch style := style.(type) {
+	case ExtensionsCommentStyle:
+		return style.GetExtensions()
+	case nestingStyle:
+		return styleExtensions(style.CommentStyle)
+	}
+	return nil
+}
+
+// files without extension, such as Makefile, cannot be told apart and are assumed to be known
+func isKnownExtension(path string, configuredStyle CommentStyle) bool {
+	extension := filepath.Ext(path)
+	if extension == "" || isNotebook(path) {
+		return true
+	}
+	styles := extractValues(supportedStyles())
+	if configuredStyle != nil {
+		styles = append(styles, configuredStyle)
+	}
+	for _, style := range styles {
+		for _, styleExtension := range styleExtensions(style) {
+			if strings.EqualFold(styleExtension, extension) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// returns the index following the closing token of the block comment the contents start with, or -1 if it is not
+// closed, the comments it contains being skipped when the style nests them
+func blockCommentEnd(contents string, style CommentStyle) int {
+	opening := strings.TrimSpace(style.GetOpeningString())
+	closing := strings.TrimSpace(style.GetClosingString())
+	if !nestsComments(style) {
+		end := strings.Index(contents, closing)
+		if end == -1 {
+			return -1
+		}
+		return end + len(closing)
+	}
+	depth := 0
+	for i := 0; i < len(contents); {
+		if strings.HasPrefix(contents[i:], opening) {
+			depth++
+			i += len(opening)
+		} else if strings.HasPrefix(contents[i:], closing) {
+			depth--
+			i += len(closing)
+			if depth == 0 {
+				return i
+			}
+		} else {
+			i++
+		}
+	}
+	return -1
+}
+
 type SlashStar struct{}
 
 func (SlashStar) GetName() string {
@@ -45,6 +160,9 @@ func (SlashStar) GetString() string {
 func (SlashStar) GetClosingString() string {
 	return " */"
 }
+func (SlashStar) GetExtensions() []string {
+	return cStyleExtensions
+}
 
 type SlashSlash struct{}
 
@@ -60,6 +178,9 @@ func (SlashSlash) GetString() string {
 func (SlashSlash) GetClosingString() string {
 	return ""
 }
+func (SlashSlash) GetExtensions() []string {
+	return cStyleExtensions
+}
 
 type Hash struct{}
 
@@ -75,6 +196,18 @@ func (Hash) GetString() string {
 func (Hash) GetClosingString() string {
 	return ""
 }
+func (Hash) GetExtensions() []string {
+	return hashExtensions
+}
+
+// extensions of the languages with C-like comments, as the ones SlashStar and SlashSlash apply to
+var cStyleExtensions = []string{".c", ".cc", ".cpp", ".cs", ".css", ".cxx", ".dart", ".go", ".gradle", ".groovy", ".h",
+	".hh", ".hpp", ".java", ".js", ".jsx", ".kt", ".kts", ".less", ".m", ".mjs", ".mm", ".php", ".proto", ".rs", ".sc",
+	".scala", ".scss", ".swift", ".ts", ".tsx"}
+
+// extensions of the languages with hash comments, as the ones Hash applies to
+var hashExtensions = []string{".bash", ".cfg", ".cmake", ".conf", ".dockerfile", ".ex", ".exs", ".mk", ".nix", ".php",
+	".pl", ".pm", ".properties", ".ps1", ".py", ".r", ".rb", ".sh", ".tf", ".toml", ".yaml", ".yml", ".zsh"}
 
 func ParseCommentStyle(str string) CommentStyle {
 	styles := supportedStyles()
@@ -88,11 +221,87 @@ func ParseCommentStyle(str string) CommentStyle {
 	return nil
 }
 
+// ValidateRenderedHeader returns an error reporting the first line which breaks the comment of the header
+// block comments must not be closed before their last line and every line of line comments must be commented
+// the comments nested in the header must be closed before its last line, for styles nesting comments
+func ValidateRenderedHeader(header string, style CommentStyle) error {
+	if style == nil {
+		return nil
+	}
+	lines := strings.Split(header, "\n")
+	if style.GetOpeningString() == "" {
+		prefix := strings.TrimRight(style.GetString(), " ")
+		for i, line := range lines {
+			if !strings.HasPrefix(line, prefix) {
+				return fmt.Errorf("line %d of header is not commented with %q: %q", i+1, prefix, line)
+			}
+		}
+		return nil
+	}
+	closing := strings.TrimSpace(style.GetClosingString())
+	if nestsComments(style) && closing != "" {
+		end := blockCommentEnd(header, style)
+		if end == -1 {
+			return fmt.Errorf("header does not close the comments it nests with %q", closing)
+		}
+		if line := strings.Count(header[:end], "\n"); line < len(lines)-1 {
+			return fmt.Errorf("line %d of header closes the comment with %q too early: %q", line+1, closing, lines[line])
+		}
+		return nil
+	}
+	for i, line := range lines[:len(lines)-1] {
+		if closing != "" && strings.Contains(line, closing) {
+			return fmt.Errorf("line %d of header closes the comment with %q too early: %q", i+1, closing, line)
+		}
+	}
+	return nil
+}
+
 func ComputeDetectionRegex(lines []string, data map[string]string) (string, error) {
 	regex := computeRegex(lines)
 	return injectDataRegex(strings.Join(regex, ""), data)
 }
 
+// ComputeMarkerRegex returns the regex matching any header of the given style whose last line is the marker, whatever
+// its other lines
+// block comments containing the marker are matched as well, whatever their line breaks, as when minifiers join their
+// lines
+func ComputeMarkerRegex(marker string, style CommentStyle) string {
+	linePrefix := escape(style.GetString())
+	builder := strings.Builder{}
+	builder.WriteString(`(?m:^`)
+	if opening := style.GetOpeningString(); opening != "" {
+		builder.WriteString(escape(opening) + `[ \t]*\n`)
+		// the closing line must not be mistaken for another line of the header
+		builder.WriteString(fmt.Sprintf(`(?:%s(?:[^\/\n][^\n]*)?\n)*?`, linePrefix))
+	} else {
+		builder.WriteString(fmt.Sprintf(`(?:%s[^\n]*\n)*?`, linePrefix))
+	}
+	builder.WriteString(fmt.Sprintf(`%s[ \t]*%s[ \t]*`, linePrefix, regexp.QuoteMeta(marker)))
+	if closing := style.GetClosingString(); closing != "" {
+		builder.WriteString(`\n` + escape(closing))
+	}
+	builder.WriteString(`\n?)`)
+	if blockRegex := markedBlockRegex(marker, style); blockRegex != "" {
+		builder.WriteString("|" + blockRegex)
+	}
+	return builder.String()
+}
+
+// returns the regex matching block comments containing the marker, anchored on the comment tokens only, or an empty
+// string for styles without two-character closing tokens
+func markedBlockRegex(marker string, style CommentStyle) string {
+	opening := strings.TrimSpace(style.GetOpeningString())
+	closing := strings.TrimSpace(style.GetClosingString())
+	if opening == "" || len(closing) != 2 {
+		return ""
+	}
+	first, second := regexp.QuoteMeta(closing[:1]), regexp.QuoteMeta(closing[1:])
+	// any text but the closing token
+	unclosedText := fmt.Sprintf(`(?:[^%[1]s]|%[1]s+[^%[1]s%[2]s])*?`, first, second)
+	return fmt.Sprintf(`(?:%s%s%s%s%s+%s\n?)`, escape(opening), unclosedText, regexp.QuoteMeta(marker), unclosedText, first, second)
+}
+
 func computeRegex(lines []string) []string {
 	styles := extractValues(supportedStyles())
 	emptyCommentedLine := func(style CommentStyle) string {
@@ -100,18 +309,21 @@ func computeRegex(lines []string) []string {
 	}
 
 	result := make([]string, 0)
-	result = append(result, fmt.Sprintf(`(?im)(?:%s\n)?`, combineRegexes(styles,
+	result = append(result, fmt.Sprintf(`(?im)(?:%s\r?\n)?`, combineRegexes(styles,
 		func(style CommentStyle) string {
 			return style.GetOpeningString()
 		})))
+	// headers may be formatted with leading blank lines
+	result = append(result, fmt.Sprintf(`(?:(?:%s) ?\r?\n)*`, combineRegexes(styles, emptyCommentedLine)))
 	for _, line := range lines {
-		result = append(result, fmt.Sprintf(`(?:%s)[ \t]*\Q%s\E[ \t\.]*\n?`, combineRegexes(styles,
+		// trailing whitespace is optional, editors often strip it, and lines may end with CRLF
+		result = append(result, fmt.Sprintf(`(?:%s)[ \t]*\Q%s\E[ \t\.]*\r?\n?`, combineRegexes(styles,
 			func(style CommentStyle) string {
 				return style.GetString()
 			}),
-			line))
+			strings.TrimRight(line, " \t\r")))
 	}
-	result = append(result, fmt.Sprintf(`(?:(?:%s) ?\n)*`, combineRegexes(styles, emptyCommentedLine)))
+	result = append(result, fmt.Sprintf(`(?:(?:%s) ?\r?\n)*`, combineRegexes(styles, emptyCommentedLine)))
 	result = append(result, fmt.Sprintf(`(?:%s)?`, combineRegexes(styles,
 		func(style CommentStyle) string {
 			return style.GetClosingString()
@@ -153,13 +365,41 @@ func regexValues(data *map[string]string) *map[string]string {
 	return data
 }
 
-func supportedStyles() map[string]CommentStyle {
-	return map[string]CommentStyle{
-		"SlashStar":  SlashStar{},
-		"SlashSlash": SlashSlash{},
-		"Hash": Hash{},
+var (
+	registeredStyles     = map[string]CommentStyle{}
+	registeredStylesLock sync.RWMutex
+)
 
+func init() {
+	RegisterCommentStyle("SlashStar", SlashStar{})
+	RegisterCommentStyle("SlashSlash", SlashSlash{})
+	RegisterCommentStyle("Hash", Hash{})
+}
+
+// RegisterCommentStyle makes the style available under the given name, replacing any style registered under it
+// embedders register their own styles before parsing configurations, built-in styles being registered the same way
+func RegisterCommentStyle(name string, style CommentStyle) {
+	registeredStylesLock.Lock()
+	defer registeredStylesLock.Unlock()
+	registeredStyles[name] = style
+}
+
+// UnregisterCommentStyle removes the style registered under the given name, if any, as when tests clean up the styles
+// they register
+func UnregisterCommentStyle(name string) {
+	registeredStylesLock.Lock()
+	defer registeredStylesLock.Unlock()
+	delete(registeredStyles, name)
+}
+
+func supportedStyles() map[string]CommentStyle {
+	registeredStylesLock.RLock()
+	defer registeredStylesLock.RUnlock()
+	result := make(map[string]CommentStyle, len(registeredStyles))
+	for name, style := range registeredStyles {
+		result[name] = style
 	}
+	return result
 }
 
 func extractKeys(myMap map[string]CommentStyle) []string {
@@ -4,10 +4,15 @@ import (
 	. "github.com/fbiville/headache/core"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"regexp"
 )
 
 var _ = Describe("Comment", func() {
 
+	AfterEach(func() {
+		UnregisterCommentStyle("SemiColons")
+	})
+
 	It("matches Dash comment style", func() {
 		style := ParseCommentStyle("Hash")
 
@@ -16,4 +21,118 @@ var _ = Describe("Comment", func() {
 		Expect(style.GetOpeningString()).To(Equal(""))
 		Expect(style.GetString()).To(Equal("# "))
 	})
+
+	It("validates rendered headers", func() {
+		Expect(ValidateRenderedHeader("/*\n * Copyright 2019 ACME\n */", SlashStar{})).To(Succeed())
+		Expect(ValidateRenderedHeader("// Copyright 2019 ACME\n//\n// Some license", SlashSlash{})).To(Succeed())
+	})
+
+	It("rejects block comment headers closed too early", func() {
+		err := ValidateRenderedHeader("/*\n * Copyright 2019 ACME */\n * Some license\n */", SlashStar{})
+
+		Expect(err).To(MatchError(`line 2 of header closes the comment with "*/" too early: " * Copyright 2019 ACME */"`))
+	})
+
+	It("accepts block comment headers nesting closed comments when comments nest", func() {
+		header := "/*\n * Copyright 2019 ACME\n * Licensed under /* see LICENSE */ Apache 2\n */"
+
+		Expect(ValidateRenderedHeader(header, NestedComments(SlashStar{}))).To(Succeed())
+		Expect(ValidateRenderedHeader(header, SlashStar{})).To(MatchError(
+			`line 3 of header closes the comment with "*/" too early: " * Licensed under /* see LICENSE */ Apache 2"`))
+	})
+
+	It("rejects block comment headers closed too early even when comments nest", func() {
+		err := ValidateRenderedHeader("/*\n * Copyright 2019 ACME /* */ */\n * Some license\n */", NestedComments(SlashStar{}))
+
+		Expect(err).To(MatchError(`line 2 of header closes the comment with "*/" too early: " * Copyright 2019 ACME /* */ */"`))
+	})
+
+	It("rejects block comment headers with unclosed nested comments when comments nest", func() {
+		err := ValidateRenderedHeader("/*\n * Copyright 2019 ACME /* see LICENSE\n */", NestedComments(SlashStar{}))
+
+		Expect(err).To(MatchError(`header does not close the comments it nests with "*/"`))
+	})
+
+	It("rejects line comment headers with uncommented lines", func() {
+		err := ValidateRenderedHeader("# Copyright 2019 ACME\nCorp.", Hash{})
+
+		Expect(err).To(MatchError(`line 2 of header is not commented with "#": "Corp."`))
+	})
+
+	It("detects block comment headers ending with the marker whatever their wording", func() {
+		regex := regexp.MustCompile(ComputeMarkerRegex("managed by headache", SlashStar{}))
+
+		Expect(regex.FindString("/*\n * Copyright 2015 Someone\n *\n * Old license\n * managed by headache\n */\n\npackage foo")).
+			To(Equal("/*\n * Copyright 2015 Someone\n *\n * Old license\n * managed by headache\n */\n"))
+		Expect(regex.FindString("/*\n * Copyright 2015 Someone\n */\n/*\n * managed by headache\n */\n")).
+			To(Equal("/*\n * managed by headache\n */\n"), "closed comments are not part of the header")
+		Expect(regex.MatchString("/*\n * Copyright 2015 Someone\n */\n\npackage foo")).To(BeFalse())
+	})
+
+	It("detects block comment headers containing the marker whatever their line breaks", func() {
+		regex := regexp.MustCompile(ComputeMarkerRegex("managed by headache", SlashStar{}))
+
+		Expect(regex.FindString("/*! Copyright 2015 Someone | managed by headache */var a=1;")).
+			To(Equal("/*! Copyright 2015 Someone | managed by headache */"))
+		Expect(regex.FindString("/* Copyright 2015 Someone */var a=1;/* managed by headache */")).
+			To(Equal("/* managed by headache */"), "closed comments are not part of the header")
+	})
+
+	It("detects line comment headers ending with the marker whatever their wording", func() {
+		regex := regexp.MustCompile(ComputeMarkerRegex("managed by headache", SlashSlash{}))
+
+		Expect(regex.FindString("// Copyright 2015 Someone\n//\n// managed by headache\n\npackage foo")).
+			To(Equal("// Copyright 2015 Someone\n//\n// managed by headache\n"))
+		Expect(regex.MatchString("// Copyright 2015 Someone\n\npackage foo")).To(BeFalse())
+	})
+
+	It("detects headers regardless of their trailing whitespace", func() {
+		regex, err := ComputeDetectionRegex([]string{"Copyright {{.Owner}}  ", "Some license"}, map[string]string{"Owner": "ACME"})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(regexp.MustCompile(regex).FindString("/*\n * Copyright ACME\n * Some license\n */\n")).
+			To(Equal("/*\n * Copyright ACME\n * Some license\n */"))
+		Expect(regexp.MustCompile(regex).FindString("/*\n * Copyright ACME \t\n * Some license\n */\n")).
+			To(Equal("/*\n * Copyright ACME \t\n * Some license\n */"))
+	})
+
+	It("matches registered comment styles", func() {
+		RegisterCommentStyle("SemiColons", semiColons{})
+
+		style := ParseCommentStyle("SemiColons")
+
+		Expect(style).To(Equal(semiColons{}))
+	})
+
+	It("keeps nesting comments when declaring extensions", func() {
+		style := WithExtensions(NestedComments(SlashStar{}), ".sc")
+
+		Expect(ValidateRenderedHeader("/*\n * Copyright 2019 ACME /* */\n */", style)).To(Succeed())
+		Expect(style.(ExtensionsCommentStyle).GetExtensions()).To(ContainElement(".scala"))
+		Expect(style.(ExtensionsCommentStyle).GetExtensions()).To(ContainElement(".sc"))
+	})
+
+	It("detects headers commented with registered styles", func() {
+		RegisterCommentStyle("SemiColons", semiColons{})
+
+		regex, err := ComputeDetectionRegex([]string{"Copyright {{.Owner}}"}, map[string]string{"Owner": "ACME"})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(regexp.MustCompile(regex).FindString(";; Copyright ACME\n\n(defun foo ())")).To(Equal(";; Copyright ACME\n"))
+	})
 })
+
+type semiColons struct{}
+
+func (semiColons) GetName() string {
+	return "SemiColons"
+}
+func (semiColons) GetOpeningString() string {
+	return ""
+}
+func (semiColons) GetString() string {
+	return ";; "
+}
+func (semiColons) GetClosingString() string {
+	return ""
+}
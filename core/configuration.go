@@ -17,42 +17,203 @@
 package core
 
 import (
+	"fmt"
 	"github.com/fbiville/headache/fs"
 	"github.com/fbiville/headache/helper"
 	"github.com/fbiville/headache/vcs"
 	"log"
+	"os"
+	"path"
+	"reflect"
 	"regexp"
+	"strings"
 )
 
 func DefaultSystemConfiguration() *SystemConfiguration {
 	return &SystemConfiguration{
 		VersioningClient: &vcs.Client{
-			Vcs: &vcs.Git{},
+			Vcs:   &vcs.Git{},
+			Bases: &vcs.BaseCache{},
 		},
-		FileSystem: fs.DefaultFileSystem(),
-		Clock:      helper.SystemClock{},
+		NestedVersioningClient: func(root string) vcs.VersioningClient {
+			return &vcs.Client{Vcs: &vcs.Git{Dir: root}, Bases: &vcs.BaseCache{}}
+		},
+		FileSystem:  fs.DefaultFileSystem(),
+		Clock:       helper.SystemClock{},
+		Environment: os.Getenv,
 	}
 }
 
 type SystemConfiguration struct {
-	VersioningClient vcs.VersioningClient
-	FileSystem       *fs.FileSystem
-	Clock            helper.Clock
+	VersioningClient       vcs.VersioningClient
+	NestedVersioningClient func(root string) vcs.VersioningClient // creates the client of a nested repository
+	FileSystem             *fs.FileSystem
+	Clock                  helper.Clock
+	Environment            func(key string) string // looks environment variables up, none being set if nil
 }
 
 type Configuration struct {
-	HeaderFile   string            `json:"headerFile"`
-	CommentStyle string            `json:"style"`
-	Includes     []string          `json:"includes"`
-	Excludes     []string          `json:"excludes"`
-	TemplateData map[string]string `json:"data"`
-	Path         *string
+	HeaderFile                string                  `json:"headerFile"`
+	HeaderChecksum            string                  `json:"headerChecksum"`
+	CommentStyle              string                  `json:"style"`
+	Includes                  []string                `json:"includes"`
+	Excludes                  []string                `json:"excludes"`
+	TemplateData              map[string]string       `json:"data"`
+	MinYear                   int                     `json:"minYear"`
+	MaxYear                   int                     `json:"maxYear"`
+	ExcludeHeaderOnlyChanges  bool                    `json:"excludeHeaderOnlyChanges"`
+	Touch                     bool                    `json:"touch"`
+	NestedIgnoreFiles         bool                    `json:"nestedIgnoreFiles"`
+	RenameThreshold           int                     `json:"renameThreshold"`
+	CopyThreshold             int                     `json:"copyThreshold"`
+	InsertAfter               string                  `json:"insertAfter"`
+	HeaderSearchLines         int                     `json:"headerSearchLines"`
+	ReleaseYears              bool                    `json:"releaseYears"`
+	PathRewrite               *PathRewrite            `json:"pathRewrite"`
+	BaseRevision              string                  `json:"baseRevision"`
+	BaseBranch                string                  `json:"baseBranch"`
+	DiffMode                  string                  `json:"diffMode"`
+	VcsRoots                  []string                `json:"vcsRoots"`
+	DiscoverVcsRoots          bool                    `json:"discoverVcsRoots"`
+	Statuses                  []string                `json:"statuses"`
+	RenameResetsCreation      bool                    `json:"renameResetsCreation"`
+	Holders                   []string                `json:"holders"`
+	HolderOverrides           map[string]string       `json:"holderOverrides"`
+	RangeEditionYears         bool                    `json:"rangeEditionYears"`
+	KeepUnchangedEditionYears bool                    `json:"keepUnchangedEditionYears"`
+	IncludeModeOnlyChanges    bool                    `json:"includeModeOnlyChanges"`
+	AddedLinesOnly            bool                    `json:"addedLinesOnly"`
+	Pathspecs                 []string                `json:"pathspecs"`
+	LegalFiles                []string                `json:"legalFiles"`
+	SkipVanishedFiles         bool                    `json:"skipVanishedFiles"`
+	SinceYear                 int                     `json:"sinceYear"`
+	UpstreamBase              bool                    `json:"upstreamBase"`
+	LazyHistory               bool                    `json:"lazyHistory"` // histories are only computed for processed files
+	CiBase                    bool                    `json:"ciBase"`
+	AddOnly                   bool                    `json:"addOnly"`
+	DirectoryHistoryThreshold int                     `json:"directoryHistoryThreshold"`
+	HistorySince              string                  `json:"historySince"`
+	FormerPaths               map[string][]string     `json:"formerPaths"`            // former paths of files, by current path
+	EditionExcludedAuthors    []string                `json:"editionExcludedAuthors"` // author name patterns whose commits are no editions
+	Marker                    string                  `json:"marker"`
+	YearRangeFormat           string                  `json:"yearRangeFormat"`
+	DateFormat                string                  `json:"dateFormat"`
+	LineEnding                string                  `json:"lineEnding"`
+	SkipUnknownStyles         bool                    `json:"skipUnknownStyles"` // defaults to true when loaded
+	PostWriteCommands         map[string][]string     `json:"postWriteCommands"` // commands run on written files, by extension
+	MaxFiles                  int                     `json:"maxFiles"`
+	WorkingTreeEditionYears   bool                    `json:"workingTreeEditionYears"`
+	AddHeaderToEmptyFiles     bool                    `json:"addHeaderToEmptyFiles"`
+	NestedComments            bool                    `json:"nestedComments"` // block comments nest, as in Scala, Kotlin, Swift or Rust
+	CreationYearPolicy        string                  `json:"creationYearPolicy"`
+	HeaderFormats             map[string]HeaderFormat `json:"headerFormats"` // keyed by comment style name
+	Staged                    bool                    `json:"-"`
+	TrackedFiles              bool                    `json:"-"`
+	Force                     bool                    `json:"-"` // hand-edited headers are overwritten
+	Paths                     []string                `json:"-"` // files to process instead of the changed ones, if any
+	ShardIndex                int                     `json:"-"` // index of the shard of changes to process, from 0
+	ShardCount                int                     `json:"-"` // number of shards changes are split into, if positive
+	Path                      *string
+}
+
+// PathRewrite changes the paths exposed to templates and reports, files are still read and written at their actual path
+// the replacement can reference the pattern groups, as in $1
+type PathRewrite struct {
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"`
 }
 
+const (
+	EndpointsDiffMode = "endpoints" // changes between the last execution revision and HEAD
+	MergeBaseDiffMode = "mergeBase" // changes between the merge base of the last execution revision and HEAD, and HEAD
+	ForkPointDiffMode = "forkPoint" // changes between the last execution revision and HEAD also made since HEAD forked from the base branch
+)
+
+const (
+	AuthorDateCreationYearPolicy        = "authorDate"        // creation years are the years of the earliest commits
+	FirstSeenOnBranchCreationYearPolicy = "firstSeenOnBranch" // creation years are the years files got into the base branch
+)
+
+const (
+	CollapsedYearRangeFormat = "collapsed" // single years are rendered alone, as in 2020
+	ExpandedYearRangeFormat  = "expanded"  // single years are rendered as ranges too, as in 2020-2020
+	ListYearRangeFormat      = "list"      // years are listed, those of existing headers included, as in 2018, 2020
+)
+
+const (
+	LfLineEnding   = "lf"   // headers are written with LF line breaks
+	CrlfLineEnding = "crlf" // headers are written with CRLF line breaks
+	AutoLineEnding = "auto" // headers are written with the line breaks of the first line of their file
+)
+
+// DefaultDateFormat renders dates as ISO 8601 calendar dates, as in 2024-03-15
+const DefaultDateFormat = "2006-01-02"
+
 type ChangeSet struct {
-	HeaderContents string
-	HeaderRegex    *regexp.Regexp
-	Files          []vcs.FileChange
+	HeaderContents        string
+	HeaderRegex           *regexp.Regexp
+	TopHeaderRegex        *regexp.Regexp   // HeaderRegex only matching at the start of contents, derived from it if nil
+	HolderOverrides       []HolderOverride // headers of the files of other copyright holders, sorted by pattern
+	CommentStyle          CommentStyle
+	InsertAfter           *regexp.Regexp // headers are inserted after the line matching it, if any
+	Files                 []vcs.FileChange
+	HeaderOnlyFiles       []vcs.FileChange    // files already managed by headache, only populated when excluded
+	HistoryLoader         HistoryLoader       // computes the years of files once processed, if set, their years being unset until then
+	AddOnly               bool                // only files without header are processed, existing headers are left untouched
+	YearRangeFormat       string              // how years are rendered, collapsed if empty
+	DateFormat            string              // Go layout dates are rendered with, DefaultDateFormat if empty
+	LineEnding            string              // line breaks headers are written with, LF if empty
+	SkipUnknownStyles     bool                // files no comment style applies to are skipped instead of reported as an error
+	PostWriteCommands     map[string][]string // commands run on written files, by extension, the file path being appended
+	CommandRunner         CommandRunner       // runs actual commands if nil
+	MaxFiles              int                 // maximum number of files written per run, if positive
+	AddHeaderToEmptyFiles bool                // empty files are skipped otherwise
+	Confirmer             Confirmer           // files are written without asking if nil
+	DetectHandEdits       bool                // headers were last written with the current template, any other wording being a hand edit
+	Force                 bool                // hand-edited headers are overwritten instead of skipped
+	HeaderSearchLines     int                 // headers starting within this many leading lines stay below the lines above them, if positive
+}
+
+// HistoryLoader computes the copyright years of the given changes
+type HistoryLoader func(changes []vcs.FileChange) ([]vcs.FileChange, error)
+
+// LoadHistory computes the years of all the files whose history is loaded lazily, as when reporting them all
+func (changeSet *ChangeSet) LoadHistory() error {
+	if changeSet.HistoryLoader == nil {
+		return nil
+	}
+	changes, err := changeSet.HistoryLoader(changeSet.Files)
+	if err != nil {
+		return err
+	}
+	changeSet.Files = changes
+	changeSet.HistoryLoader = nil
+	return nil
+}
+
+// returns the change along with its copyright years, computing them first if they are loaded lazily
+func (changeSet *ChangeSet) withHistory(change vcs.FileChange) (vcs.FileChange, error) {
+	if changeSet.HistoryLoader == nil {
+		return change, nil
+	}
+	changes, err := changeSet.HistoryLoader([]vcs.FileChange{change})
+	if err != nil {
+		return change, err
+	}
+	return changes[0], nil
+}
+
+// returns the header regex only matching at the start of contents, compiled again on every call if not set
+func (changeSet *ChangeSet) topHeaderRegex() *regexp.Regexp {
+	if changeSet.TopHeaderRegex == nil {
+		return anchor(changeSet.HeaderRegex)
+	}
+	return changeSet.TopHeaderRegex
+}
+
+// IsEmpty returns whether there is no file to process, in which case there is nothing to do
+func (changeSet *ChangeSet) IsEmpty() bool {
+	return len(changeSet.Files) == 0
 }
 
 func ParseConfiguration(
@@ -66,53 +227,653 @@ func ParseConfiguration(
 		return nil, err
 	}
 
-	contents, err := ParseTemplate(versionedTemplate, ParseCommentStyle(currentConfig.CommentStyle))
+	changeSet, err := newChangeSet(currentConfig, versionedTemplate)
+	if err != nil {
+		return nil, err
+	}
+	pathRewrite, err := pathRewriteRegex(currentConfig)
 	if err != nil {
 		return nil, err
 	}
 
-	changes, err := getAffectedFiles(currentConfig, system, versionedTemplate, pathMatcher)
+	if requiresCiBase(currentConfig) {
+		currentConfig = withCiBase(currentConfig, system.Environment)
+	}
+	if requiresDefaultBaseBranch(currentConfig) {
+		currentConfig, err = withDefaultBaseBranch(currentConfig, system.VersioningClient.GetClient())
+		if err != nil {
+			return nil, err
+		}
+	}
+	if currentConfig.DiffMode == ForkPointDiffMode && currentConfig.BaseBranch == "" {
+		return nil, fmt.Errorf("diffMode %s requires baseBranch to be set", ForkPointDiffMode)
+	}
+	if currentConfig.CreationYearPolicy == FirstSeenOnBranchCreationYearPolicy && currentConfig.BaseBranch == "" {
+		return nil, fmt.Errorf("creationYearPolicy %s requires baseBranch to be set", FirstSeenOnBranchCreationYearPolicy)
+	}
+	if err := validateShard(currentConfig); err != nil {
+		return nil, err
+	}
+
+	changes, headerOnlyChanges, historyLoader, err := getAffectedFiles(currentConfig, system, versionedTemplate, changeSet.HeaderRegex, pathMatcher)
+	if err != nil {
+		return nil, err
+	}
+	if pathRewrite != nil {
+		changes = rewritePaths(changes, pathRewrite, currentConfig.PathRewrite.Replacement)
+	}
+	changeSet.Files = changes
+	changeSet.HeaderOnlyFiles = headerOnlyChanges
+	changeSet.HistoryLoader = historyLoader
+	return changeSet, nil
+}
+
+// returns the change set of the configuration, without any file
+// all the ways files are processed start from it, so that they all honor the same settings
+func newChangeSet(config *Configuration, versionedTemplate *VersionedHeaderTemplate) (*ChangeSet, error) {
+	commentStyle := configuredCommentStyle(config)
+	holderOverrides, err := parseHolderOverrides(config, versionedTemplate, commentStyle)
+	if err != nil {
+		return nil, err
+	}
+	contents, err := ParseTemplate(versionedTemplate, commentStyle, config.HeaderFormats[commentStyle.GetName()])
+	if err != nil {
+		return nil, err
+	}
+
+	var insertAfter *regexp.Regexp
+	if config.InsertAfter != "" {
+		insertAfter, err = regexp.Compile(config.InsertAfter)
+		if err != nil {
+			return nil, fmt.Errorf("invalid insertAfter pattern %q\n\t%v", config.InsertAfter, err)
+		}
+	}
+
+	headerRegex, err := detectionRegex(config, versionedTemplate.Previous, contents, commentStyle)
+	if err != nil {
+		return nil, err
+	}
+	headerRegex, err = withHolderOverrides(headerRegex, holderOverrides)
 	if err != nil {
 		return nil, err
 	}
 
 	return &ChangeSet{
-		HeaderContents: contents.ActualContent,
-		HeaderRegex:    contents.DetectionRegex,
-		Files:          changes,
+		HeaderContents:        contents.ActualContent,
+		HeaderRegex:           headerRegex,
+		TopHeaderRegex:        anchor(headerRegex),
+		HolderOverrides:       holderOverrides,
+		CommentStyle:          commentStyle,
+		InsertAfter:           insertAfter,
+		AddOnly:               config.AddOnly,
+		YearRangeFormat:       config.YearRangeFormat,
+		DateFormat:            config.DateFormat,
+		LineEnding:            config.LineEnding,
+		SkipUnknownStyles:     config.SkipUnknownStyles,
+		PostWriteCommands:     config.PostWriteCommands,
+		MaxFiles:              config.MaxFiles,
+		AddHeaderToEmptyFiles: config.AddHeaderToEmptyFiles,
+		HeaderSearchLines:     config.HeaderSearchLines,
+		DetectHandEdits:       isTemplateUnchanged(versionedTemplate),
+		Force:                 config.Force,
 	}, nil
 }
 
+// returns the compiled pattern of the path rewrite, nil if there is none
+func pathRewriteRegex(config *Configuration) (*regexp.Regexp, error) {
+	rewrite := config.PathRewrite
+	if rewrite == nil {
+		return nil, nil
+	}
+	result, err := regexp.Compile(rewrite.Pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pathRewrite pattern %q\n\t%v", rewrite.Pattern, err)
+	}
+	return result, nil
+}
+
+// headers ending with the configured marker are detected whatever their wording, others are still detected when
+// matching the template, with or without the marker
+func detectionRegex(config *Configuration,
+	previous *HeaderTemplate,
+	contents *ParsedTemplate,
+	style CommentStyle) (*regexp.Regexp, error) {
+
+	if config.Marker == "" {
+		return contents.DetectionRegex, nil
+	}
+	pattern := fmt.Sprintf(`%s|(?:%s)`, ComputeMarkerRegex(config.Marker, style), contents.DetectionRegex)
+	if lineCount := len(previous.Lines); lineCount > 1 && previous.Lines[lineCount-1] == config.Marker {
+		unmarkedRegex, err := ComputeDetectionRegex(previous.Lines[:lineCount-1], injectReservedParameters(previous.Data))
+		if err != nil {
+			return nil, err
+		}
+		pattern = fmt.Sprintf(`%s|(?:%s)`, pattern, unmarkedRegex)
+	}
+	result, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid marker %q\n\t%v", config.Marker, err)
+	}
+	return result, nil
+}
+
+// returns whether the last execution used the very same template, data included
+func isTemplateUnchanged(versionedTemplate *VersionedHeaderTemplate) bool {
+	return versionedTemplate.Revision != "" && reflect.DeepEqual(versionedTemplate.Current, versionedTemplate.Previous)
+}
+
+func validateShard(config *Configuration) error {
+	if config.ShardCount == 0 && config.ShardIndex == 0 {
+		return nil
+	}
+	if config.ShardCount <= 0 {
+		return fmt.Errorf("shard count must be positive, got %d", config.ShardCount)
+	}
+	if config.ShardIndex < 0 || config.ShardIndex >= config.ShardCount {
+		return fmt.Errorf("shard index must be between 0 and %d, got %d", config.ShardCount-1, config.ShardIndex)
+	}
+	return nil
+}
+
+// returns the configured comment style, whose block comments nest if configured so
+func configuredCommentStyle(config *Configuration) CommentStyle {
+	style := ParseCommentStyle(config.CommentStyle)
+	if config.NestedComments && style.GetOpeningString() != "" {
+		return NestedComments(style)
+	}
+	return style
+}
+
+// returns whether the diff mode or the creation year policy requires a base branch and none is configured
+func requiresDefaultBaseBranch(config *Configuration) bool {
+	return config.BaseBranch == "" &&
+		(config.DiffMode == ForkPointDiffMode || config.CreationYearPolicy == FirstSeenOnBranchCreationYearPolicy)
+}
+
+// the base branch defaults to the headache.baseBranch git configuration, or to the init.defaultBranch one, of the
+// checkout.defaultRemote remote if set, the configuration being copied rather than altered
+func withDefaultBaseBranch(config *Configuration, versioning vcs.Vcs) (*Configuration, error) {
+	baseBranch, err := versioning.ConfigValue("headache.baseBranch")
+	if err != nil {
+		return nil, err
+	}
+	if baseBranch == "" {
+		baseBranch, err = versioning.ConfigValue("init.defaultBranch")
+		if err != nil {
+			return nil, err
+		}
+		remote, err := versioning.ConfigValue("checkout.defaultRemote")
+		if err != nil {
+			return nil, err
+		}
+		if baseBranch != "" && remote != "" {
+			baseBranch = remote + "/" + baseBranch
+		}
+	}
+	if baseBranch == "" {
+		return config, nil
+	}
+	log.Printf("Using base branch %s from the git configuration", baseBranch)
+	result := *config
+	result.BaseBranch = baseBranch
+	return &result, nil
+}
+
+// returns the given paths, those of symlinks being replaced by the paths of their targets
+func resolveSymlinkedPaths(paths []string) ([]string, error) {
+	changes := make([]vcs.FileChange, len(paths))
+	for i, path := range paths {
+		changes[i] = vcs.FileChange{Path: path}
+	}
+	resolvedChanges, err := fs.ResolveSymlinks(changes, ".")
+	if err != nil {
+		return nil, err
+	}
+	result := make([]string, len(resolvedChanges))
+	for i, change := range resolvedChanges {
+		result[i] = change.Path
+	}
+	return result, nil
+}
+
 func getAffectedFiles(config *Configuration,
 	sysConfig *SystemConfiguration,
 	versionedTemplate *VersionedHeaderTemplate,
-	pathMatcher fs.PathMatcher) ([]vcs.FileChange, error) {
+	headerRegex *regexp.Regexp,
+	pathMatcher fs.PathMatcher) ([]vcs.FileChange, []vcs.FileChange, HistoryLoader, error) {
 
-	versioningClient := sysConfig.VersioningClient
+	versioningClient, err := withNestedRoots(config, sysConfig)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(config.Paths) > 0 {
+		log.Print("Processing the given files only")
+		paths, err := resolveSymlinkedPaths(config.Paths)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		options, err := historyOptions(config, sysConfig.Clock)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		changes, err := vcs.ChangesForPaths(versioningClient, paths, sysConfig.Clock, options)
+		return changes, nil, nil, err
+	}
 	fileSystem := sysConfig.FileSystem
 	var (
-		changes []vcs.FileChange
-		err     error
+		changes           []vcs.FileChange
+		headerOnlyChanges []vcs.FileChange
 	)
 
-	if versionedTemplate.RequiresFullScan() {
-		if versionedTemplate.Revision == "" {
+	revision := versionedTemplate.Revision
+	fullScan := versionedTemplate.RequiresFullScan()
+	if revision == "" && !config.Staged && !config.TrackedFiles {
+		revision, err = resolveBaseRevision(config, versioningClient.GetClient())
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		fullScan = revision == ""
+	}
+
+	if config.Staged {
+		log.Print("Scanning staged changes")
+		fileChanges, err := versioningClient.GetChanges("", changeOptions(config))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		changes = pathMatcher.MatchFiles(fileChanges, config.Includes, config.Excludes, fileSystem)
+	} else if config.TrackedFiles {
+		log.Print("Scanning all tracked files")
+		trackedFiles, err := vcs.GetTrackedFiles(versioningClient.GetClient())
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		changes = pathMatcher.MatchFiles(trackedFiles, config.Includes, config.Excludes, fileSystem)
+	} else if fullScan {
+		if revision == "" {
 			log.Print("Unable to get last execution revision, triggering a full scan")
 		} else {
 			log.Printf("Configuration changed since last execution (%s), triggering a full scan", versionedTemplate.Revision)
 		}
 		changes, err = pathMatcher.ScanAllFiles(config.Includes, config.Excludes, fileSystem)
 		if err != nil {
-			return nil, err
+			return nil, nil, nil, err
 		}
 	} else {
-		revision := versionedTemplate.Revision
 		log.Printf("Scanning changes since revision %s", revision)
-		fileChanges, err := versioningClient.GetChanges(revision)
+		fileChanges, err := versioningClient.GetChanges(revision, changeOptions(config))
 		if err != nil {
-			return nil, err
+			return nil, nil, nil, err
 		}
 		changes = pathMatcher.MatchFiles(fileChanges, config.Includes, config.Excludes, fileSystem)
 	}
-	return versioningClient.AddMetadata(changes, sysConfig.Clock)
+	changes, err = fs.RemoveIgnoredFiles(changes, config.NestedIgnoreFiles, fileSystem.FileReader)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	changes = fs.RemoveLegalFiles(changes, config.LegalFiles)
+	// headers and years of symlinks are the ones of their targets, copyright being about contents
+	changes, err = fs.ResolveSymlinks(changes, ".")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if config.ShardCount > 0 {
+		// sharding precedes the history retrieval, each shard only paying for its own files
+		changes = fs.SelectShard(changes, config.ShardIndex, config.ShardCount)
+	}
+	if config.TrackedFiles {
+		// tracked files are only audited for missing headers, their history is not needed
+		return changes, nil, nil, nil
+	}
+	if config.ExcludeHeaderOnlyChanges && !config.Staged && !versionedTemplate.RequiresFullScan() {
+		changes, headerOnlyChanges, err = partitionHeaderOnlyChanges(changes, versionedTemplate.Revision, headerRegex, versioningClient, sysConfig)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	if len(changes) == 0 {
+		return changes, headerOnlyChanges, nil, nil
+	}
+	options, err := historyOptions(config, sysConfig.Clock)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if config.RangeEditionYears && !fullScan {
+		options.EditionRevision = revision
+	}
+	if config.KeepUnchangedEditionYears && !fullScan {
+		options.ReferenceRevision = revision
+	}
+	// filtering files by year requires the years of all of them
+	lazy := config.LazyHistory && config.SinceYear == 0
+	if !lazy {
+		changes, err = withoutFailedChanges(versioningClient.AddMetadata(changes, sysConfig.Clock, options))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	var workingTreePaths map[string]struct{}
+	if !config.Staged {
+		// staged files are read from the index, whatever happens to the working tree
+		changes, err = removeVanishedFiles(changes, config.SkipVanishedFiles, fileSystem)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if config.WorkingTreeEditionYears {
+			workingTreePaths, err = uncommittedPaths(versioningClient.GetClient())
+			if err != nil {
+				return nil, nil, nil, err
+			}
+		}
+	}
+	if lazy {
+		return changes, headerOnlyChanges, historyLoader(versioningClient, sysConfig, options, workingTreePaths), nil
+	}
+	if workingTreePaths != nil {
+		changes, err = addWorkingTreeEditionYears(changes, workingTreePaths, fileSystem, options.MaxYear)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	if config.SinceYear != 0 {
+		changes = removeFilesEditedBefore(changes, config.SinceYear)
+	}
+	return changes, headerOnlyChanges, nil, nil
+}
+
+// returns the loader of the history of changes, along with their working tree edition years if asked to
+func historyLoader(versioningClient vcs.VersioningClient,
+	sysConfig *SystemConfiguration,
+	options vcs.HistoryOptions,
+	workingTreePaths map[string]struct{}) HistoryLoader {
+
+	return func(changes []vcs.FileChange) ([]vcs.FileChange, error) {
+		changes, err := versioningClient.AddMetadata(changes, sysConfig.Clock, options)
+		if err != nil || workingTreePaths == nil {
+			return changes, err
+		}
+		return addWorkingTreeEditionYears(changes, workingTreePaths, sysConfig.FileSystem, options.MaxYear)
+	}
+}
+
+// files whose history cannot be computed are reported and left out, so that they do not stop the others from being
+// processed
+func withoutFailedChanges(changes []vcs.FileChange, err error) ([]vcs.FileChange, error) {
+	multiError, partial := err.(*vcs.MultiError)
+	if err != nil && !partial {
+		return nil, err
+	}
+	if !partial {
+		return changes, nil
+	}
+	failedPaths := make(map[string]struct{}, len(multiError.Failures))
+	for _, failure := range multiError.Failures {
+		log.Printf("Skipping %s, its history cannot be computed\n\t%v", failure.Path, failure.Err)
+		failedPaths[failure.Path] = struct{}{}
+	}
+	result := make([]vcs.FileChange, 0, len(changes))
+	for _, change := range changes {
+		if _, failed := failedPaths[change.Path]; !failed {
+			result = append(result, change)
+		}
+	}
+	return result, nil
+}
+
+func removeFilesEditedBefore(changes []vcs.FileChange, year int) []vcs.FileChange {
+	result := make([]vcs.FileChange, 0, len(changes))
+	for _, change := range changes {
+		if change.LastEditionYear >= year {
+			result = append(result, change)
+		}
+	}
+	return result
+}
+
+// the history of files with uncommitted modifications does not reflect them yet, their last edition year is bumped to
+// the year they were last modified in the working tree, if later
+func addWorkingTreeEditionYears(changes []vcs.FileChange, uncommittedPaths map[string]struct{}, fileSystem *fs.FileSystem, maxYear int) ([]vcs.FileChange, error) {
+	result := make([]vcs.FileChange, len(changes))
+	for i, change := range changes {
+		change, err := withWorkingTreeEditionYear(change, uncommittedPaths, fileSystem, maxYear)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = change
+	}
+	return result, nil
+}
+
+// returns the paths of the files with uncommitted modifications
+func uncommittedPaths(versioning vcs.Vcs) (map[string]struct{}, error) {
+	uncommittedChanges, err := vcs.GetUncommittedChanges(versioning, vcs.ChangeOptions{})
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]struct{}, len(uncommittedChanges))
+	for _, change := range uncommittedChanges {
+		result[change.Path] = struct{}{}
+	}
+	return result, nil
+}
+
+func withWorkingTreeEditionYear(change vcs.FileChange, uncommittedPaths map[string]struct{}, fileSystem *fs.FileSystem, maxYear int) (vcs.FileChange, error) {
+	if _, found := uncommittedPaths[change.Path]; !found {
+		return change, nil
+	}
+	info, err := fileSystem.FileReader.Stat(change.Path)
+	if err != nil {
+		return change, err
+	}
+	modTime := info.ModTime()
+	year := modTime.Year()
+	if year > maxYear {
+		year = maxYear
+	}
+	if year > change.LastEditionYear {
+		change.LastEditionYear = year
+	}
+	// capped years leave the date of the last commit
+	if year == modTime.Year() && modTime.After(change.LastEditionTime) {
+		change.LastEditionTime = modTime
+	}
+	return change, nil
+}
+
+// files can be deleted while their history is retrieved, as when other jobs share the same checkout
+// such vanished files are either skipped or reported as an error
+func removeVanishedFiles(changes []vcs.FileChange, skip bool, fileSystem *fs.FileSystem) ([]vcs.FileChange, error) {
+	result := make([]vcs.FileChange, 0, len(changes))
+	for _, change := range changes {
+		if fileSystem.IsFile(change.Path) {
+			result = append(result, change)
+			continue
+		}
+		if !skip {
+			return nil, fmt.Errorf("file %s vanished after its changes were computed, set skipVanishedFiles to skip such files", change.Path)
+		}
+		log.Printf("Skipping %s, it vanished after its changes were computed", change.Path)
+	}
+	return result, nil
+}
+
+// returns the revision to scan changes from when there is no previous execution
+// if HEAD is detached, as in most CI checkouts: the configured base revision or else the merge base with the configured
+// base branch
+// if HEAD is attached and asked to: the merge base with the branch tracked by the current branch
+// an empty revision means a full scan is needed
+func resolveBaseRevision(config *Configuration, versioning vcs.Vcs) (string, error) {
+	if config.BaseRevision == "" && config.BaseBranch == "" && !config.UpstreamBase {
+		return "", nil
+	}
+	detached, err := versioning.IsDetachedHead()
+	if err != nil {
+		return "", err
+	}
+	if !detached {
+		if config.UpstreamBase {
+			return resolveUpstreamBase(versioning)
+		}
+		return "", nil
+	}
+	if config.BaseRevision == "" && config.BaseBranch == "" {
+		return "", nil
+	}
+	if config.BaseRevision != "" {
+		log.Printf("HEAD is detached and there is no previous execution, scanning changes since base revision %s", config.BaseRevision)
+		return config.BaseRevision, nil
+	}
+	mergeBase, err := versioning.MergeBase(config.BaseBranch)
+	if err != nil {
+		return "", fmt.Errorf("HEAD is detached and its merge base with base branch %s cannot be found, is the branch fetched?\n\t%v", config.BaseBranch, err)
+	}
+	log.Printf("HEAD is detached and there is no previous execution, scanning changes since merge base %s with %s", mergeBase, config.BaseBranch)
+	return mergeBase, nil
+}
+
+func resolveUpstreamBase(versioning vcs.Vcs) (string, error) {
+	remote, branch, err := versioning.CurrentRef()
+	if err != nil {
+		return "", err
+	}
+	if branch == "" {
+		log.Print("Current branch does not track any branch, ignoring upstreamBase")
+		return "", nil
+	}
+	upstream := remote + "/" + branch
+	mergeBase, err := versioning.MergeBase(upstream)
+	if err != nil {
+		return "", fmt.Errorf("merge base of HEAD with tracked branch %s cannot be found, is the branch fetched?\n\t%v", upstream, err)
+	}
+	log.Printf("There is no previous execution, scanning changes since merge base %s with tracked branch %s", mergeBase, upstream)
+	return mergeBase, nil
+}
+
+// returns a client aggregating the changes of the configured or discovered nested repositories, if any
+func withNestedRoots(config *Configuration, sysConfig *SystemConfiguration) (vcs.VersioningClient, error) {
+	roots := config.VcsRoots
+	if config.DiscoverVcsRoots {
+		discoveredRoots, err := vcs.DiscoverNestedRoots(".")
+		if err != nil {
+			return nil, err
+		}
+		roots = append(roots, discoveredRoots...)
+	}
+	if len(roots) == 0 {
+		return sysConfig.VersioningClient, nil
+	}
+	client := &vcs.MultiRootClient{Main: sysConfig.VersioningClient}
+	seenRoots := make(map[string]struct{}, len(roots))
+	for _, root := range roots {
+		root = path.Clean(root)
+		if _, seen := seenRoots[root]; seen {
+			continue
+		}
+		seenRoots[root] = struct{}{}
+		client.Roots = append(client.Roots, vcs.NestedRoot{Path: root, Client: sysConfig.NestedVersioningClient(root)})
+	}
+	return client, nil
+}
+
+// splits changes between the ones with actual content changes since the given revision and the ones only differing by
+// their header
+func partitionHeaderOnlyChanges(changes []vcs.FileChange,
+	revision string,
+	headerRegex *regexp.Regexp,
+	versioningClient vcs.VersioningClient,
+	sysConfig *SystemConfiguration) ([]vcs.FileChange, []vcs.FileChange, error) {
+
+	showContentAtRevision := versioningClient.GetClient().ShowContentAtRevision
+	if multiRootClient, ok := versioningClient.(*vcs.MultiRootClient); ok {
+		// files of nested repositories are versioned by their own repository
+		showContentAtRevision = multiRootClient.ShowContentAtRevision
+	}
+	fileReader := sysConfig.FileSystem.FileReader
+	topHeaderRegex := anchor(headerRegex)
+	contentChanges := make([]vcs.FileChange, 0)
+	headerOnlyChanges := make([]vcs.FileChange, 0)
+	for _, change := range changes {
+		currentBytes, err := fileReader.Read(change.Path)
+		if err != nil {
+			return nil, nil, err
+		}
+		previousContents, err := showContentAtRevision(change.Path, revision)
+		if err != nil && vcs.Cause(err) == vcs.ErrFileNotTracked {
+			// the file did not exist at that revision
+			contentChanges = append(contentChanges, change)
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		currentBody, _ := splitHeaders(string(currentBytes), headerRegex, topHeaderRegex)
+		previousBody, _ := splitHeaders(previousContents, headerRegex, topHeaderRegex)
+		if currentBody == previousBody {
+			headerOnlyChanges = append(headerOnlyChanges, change)
+		} else {
+			contentChanges = append(contentChanges, change)
+		}
+	}
+	return contentChanges, headerOnlyChanges, nil
+}
+
+func rewritePaths(changes []vcs.FileChange, pattern *regexp.Regexp, replacement string) []vcs.FileChange {
+	result := make([]vcs.FileChange, len(changes))
+	for i, change := range changes {
+		if rewrittenPath := pattern.ReplaceAllString(change.Path, replacement); rewrittenPath != change.Path {
+			change.DisplayPath = rewrittenPath
+		}
+		result[i] = change
+	}
+	return result
+}
+
+func changeOptions(config *Configuration) vcs.ChangeOptions {
+	options := vcs.ChangeOptions{
+		RenameThreshold: config.RenameThreshold,
+		CopyThreshold:   config.CopyThreshold,
+		Staged:          config.Staged,
+		MergeBase:       config.DiffMode == MergeBaseDiffMode,
+		Statuses:        config.Statuses,
+		// changes of the executable bit, for instance, leave headers as they are
+		ExcludeModeOnlyChanges: !config.IncludeModeOnlyChanges,
+		AddedLinesOnly:         config.AddedLinesOnly,
+		Pathspecs:              config.Pathspecs,
+	}
+	if config.DiffMode == ForkPointDiffMode {
+		options.ForkPointBranch = config.BaseBranch
+	}
+	return options
+}
+
+// defaults to commit years in the [vcs.DefaultMinYear, current year + 1] range
+func historyOptions(config *Configuration, clock helper.Clock) (vcs.HistoryOptions, error) {
+	options := vcs.HistoryOptions{
+		MinYear:                   config.MinYear,
+		MaxYear:                   config.MaxYear,
+		Touch:                     config.Touch,
+		ReleaseYears:              config.ReleaseYears,
+		RenameResetsCreation:      config.RenameResetsCreation,
+		DirectoryHistoryThreshold: config.DirectoryHistoryThreshold,
+		Since:                     config.HistorySince,
+		FormerPaths:               config.FormerPaths,
+	}
+	if config.CreationYearPolicy == FirstSeenOnBranchCreationYearPolicy {
+		options.CreationBranch = config.BaseBranch
+	}
+	if options.MinYear == 0 {
+		options.MinYear = vcs.DefaultMinYear
+	}
+	if options.MaxYear == 0 {
+		options.MaxYear = clock.Now().Year() + 1
+	}
+	if len(config.EditionExcludedAuthors) > 0 {
+		pattern := "(?:" + strings.Join(config.EditionExcludedAuthors, ")|(?:") + ")"
+		excludedAuthors, err := regexp.Compile(pattern)
+		if err != nil {
+			return options, fmt.Errorf("invalid editionExcludedAuthors patterns %q\n\t%v", config.EditionExcludedAuthors, err)
+		}
+		options.EditionExcludedAuthors = excludedAuthors
+	}
+	return options, nil
 }
@@ -2,25 +2,39 @@ package core
 
 import (
 	"encoding/json"
+	"fmt"
+	"github.com/BurntSushi/toml"
 	"github.com/fbiville/headache/fs"
 	jsonsch "github.com/xeipuuv/gojsonschema"
 	"log"
+	"path/filepath"
+	"strings"
 )
 
+// ConfigurationReader reads the configuration file at the given path
+type ConfigurationReader func(path string) ([]byte, error)
+
 type ConfigurationLoader struct {
 	Reader fs.FileReader
+	Schema *jsonsch.Schema // configurations are validated against it, the published schema being loaded if nil
+}
+
+// IsTomlConfiguration returns whether the configuration file is written in TOML rather than JSON
+func IsTomlConfiguration(path string) bool {
+	return strings.HasSuffix(strings.ToLower(path), ".toml")
 }
 
 func (cl *ConfigurationLoader) ReadConfiguration(configFile *string) (*Configuration, error) {
-	err := cl.validateConfiguration(configFile)
+	payload, err := ResolveConfiguration(*configFile, cl.Reader.Read)
 	if err != nil {
 		return nil, err
 	}
 
-	payload, err := cl.Reader.Read(*configFile)
+	err = cl.validateConfiguration(payload)
 	if err != nil {
 		return nil, err
 	}
+
 	configuration, err := cl.UnmarshallConfiguration(payload)
 	if err != nil {
 		return nil, err
@@ -30,7 +44,7 @@ func (cl *ConfigurationLoader) ReadConfiguration(configFile *string) (*Configura
 }
 
 func (cl *ConfigurationLoader) UnmarshallConfiguration(configurationPayload []byte) (*Configuration, error) {
-	result := Configuration{}
+	result := Configuration{SkipUnknownStyles: true}
 	err := json.Unmarshal(configurationPayload, &result)
 	if err != nil {
 		return nil, err
@@ -38,8 +52,119 @@ func (cl *ConfigurationLoader) UnmarshallConfiguration(configurationPayload []by
 	return &result, nil
 }
 
-func (cl *ConfigurationLoader) validateConfiguration(configFile *string) error {
-	schema := loadSchema()
+// UnmarshallConfigurationFile decodes the configuration according to the extension of its file
+func (cl *ConfigurationLoader) UnmarshallConfigurationFile(path string, configurationPayload []byte) (*Configuration, error) {
+	payload, err := toJsonPayload(path, configurationPayload)
+	if err != nil {
+		return nil, err
+	}
+	return cl.UnmarshallConfiguration(payload)
+}
+
+// TOML configurations are converted to their JSON equivalent, so that they are validated and decoded the same way
+func toJsonPayload(path string, payload []byte) ([]byte, error) {
+	if !IsTomlConfiguration(path) {
+		return payload, nil
+	}
+	document := make(map[string]interface{})
+	if _, err := toml.Decode(string(payload), &document); err != nil {
+		return nil, fmt.Errorf("invalid TOML configuration %s\n\t%v", path, err)
+	}
+	return json.Marshal(document)
+}
+
+// ResolveConfiguration returns the JSON equivalent of the configuration, merged with the configurations it extends
+// settings of extending configurations override the extended ones, except for objects, which are merged, and for
+// arrays containing "...", which is replaced by the elements of the extended array
+// relative extends paths are resolved against the directory of the extending configuration
+func ResolveConfiguration(path string, read ConfigurationReader) ([]byte, error) {
+	document, err := resolveExtends(path, read, nil)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(document)
+}
+
+func resolveExtends(path string, read ConfigurationReader, visitedPaths []string) (map[string]interface{}, error) {
+	visitedPaths = append(visitedPaths, filepath.Clean(path))
+	payload, err := read(path)
+	if err != nil {
+		return nil, err
+	}
+	payload, err = toJsonPayload(path, payload)
+	if err != nil {
+		return nil, err
+	}
+	document := make(map[string]interface{})
+	if err := json.Unmarshal(payload, &document); err != nil {
+		return nil, err
+	}
+	extends, found := document["extends"]
+	if !found {
+		return document, nil
+	}
+	delete(document, "extends")
+	parentPath, isString := extends.(string)
+	if !isString {
+		return nil, fmt.Errorf("extends setting of configuration %s must be a path, got %v", path, extends)
+	}
+	if !filepath.IsAbs(parentPath) {
+		parentPath = filepath.Join(filepath.Dir(path), parentPath)
+	}
+	for _, visitedPath := range visitedPaths {
+		if visitedPath == filepath.Clean(parentPath) {
+			cycle := strings.Join(append(visitedPaths, visitedPath), " -> ")
+			return nil, fmt.Errorf("configuration extends itself: %s", cycle)
+		}
+	}
+	parentDocument, err := resolveExtends(parentPath, read, visitedPaths)
+	if err != nil {
+		return nil, err
+	}
+	return mergeDocuments(parentDocument, document), nil
+}
+
+func mergeDocuments(parent map[string]interface{}, child map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(parent)+len(child))
+	for key, value := range parent {
+		result[key] = value
+	}
+	for key, childValue := range child {
+		switch value := childValue.(type) {
+		case map[string]interface{}:
+			if parentValue, isObject := parent[key].(map[string]interface{}); isObject {
+				result[key] = mergeDocuments(parentValue, value)
+				continue
+			}
+		case []interface{}:
+			if parentValue, isArray := parent[key].([]interface{}); isArray {
+				result[key] = mergeArrays(parentValue, value)
+				continue
+			}
+		}
+		result[key] = childValue
+	}
+	return result
+}
+
+// "..." elements of the child array are replaced by the elements of the parent array
+func mergeArrays(parent []interface{}, child []interface{}) []interface{} {
+	result := make([]interface{}, 0, len(parent)+len(child))
+	for _, element := range child {
+		if element == "..." {
+			result = append(result, parent...)
+			continue
+		}
+		result = append(result, element)
+	}
+	return result
+}
+
+func (cl *ConfigurationLoader) validateConfiguration(payload []byte) error {
+	schema := cl.Schema
+	if schema == nil {
+		schema = loadSchema()
+	}
 	if schema == nil {
 		return nil
 	}
@@ -47,7 +172,7 @@ func (cl *ConfigurationLoader) validateConfiguration(configFile *string) error {
 		Schema:     schema,
 		FileReader: cl.Reader,
 	}
-	return jsonSchemaValidator.Validate("file://" + *configFile)
+	return jsonSchemaValidator.ValidatePayload(payload)
 }
 
 func loadSchema() *jsonsch.Schema {
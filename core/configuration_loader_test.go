@@ -0,0 +1,279 @@
+/*
+ * Copyright 2018 Florent Biville (@fbiville)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core_test
+
+import (
+	. "github.com/fbiville/headache/core"
+	"github.com/fbiville/headache/fs_mocks"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	json "github.com/xeipuuv/gojsonschema"
+	"os"
+)
+
+var _ = Describe("Configuration loader", func() {
+
+	var loader *ConfigurationLoader
+
+	BeforeEach(func() {
+		loader = &ConfigurationLoader{}
+	})
+
+	It("decodes TOML configuration like its JSON equivalent", func() {
+		jsonConfiguration, err := loader.UnmarshallConfigurationFile("headache.json", []byte(`{
+  "headerFile": "license-header.txt",
+  "style": "SlashStar",
+  "includes": ["**/*.go", "**/*.java"],
+  "excludes": ["vendor/**/*"],
+  "minYear": 2009,
+  "touch": true,
+  "pathRewrite": {"pattern": "^packages/([^/]+)/src/", "replacement": "$1/"},
+  "data": {
+    "Owner": "ACME Labs",
+    "Project": "Road Runner \"Beep Beep\""
+  }
+}`))
+		Expect(err).NotTo(HaveOccurred())
+
+		tomlConfiguration, err := loader.UnmarshallConfigurationFile("headache.toml", []byte(`# headache settings
+headerFile = "license-header.txt"
+style = 'SlashStar'
+includes = [
+  "**/*.go",
+  "**/*.java", # trailing commas are allowed
+]
+excludes = ["vendor/**/*"]
+minYear = 2_009
+touch = true
+pathRewrite = { pattern = '^packages/([^/]+)/src/', replacement = "$1/" }
+
+[data]
+Owner = "ACME Labs"
+"Project" = "Road Runner \"Beep Beep\""
+`))
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tomlConfiguration).To(Equal(jsonConfiguration))
+	})
+
+	It("decodes dotted keys", func() {
+		configuration, err := loader.UnmarshallConfigurationFile("headache.toml", []byte(`data.Owner = "ACME Labs"
+data.Year-Format = "long"`))
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(configuration.TemplateData).To(Equal(map[string]string{"Owner": "ACME Labs", "Year-Format": "long"}))
+	})
+
+	It("skips the files no comment style applies to by default", func() {
+		configuration, err := loader.UnmarshallConfiguration([]byte(`{"headerFile": "license-header.txt"}`))
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(configuration.SkipUnknownStyles).To(BeTrue())
+	})
+
+	It("decodes disabled skipping of the files no comment style applies to", func() {
+		configuration, err := loader.UnmarshallConfiguration([]byte(`{"skipUnknownStyles": false}`))
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(configuration.SkipUnknownStyles).To(BeFalse())
+	})
+
+	It("decodes multi-line strings", func() {
+		configuration, err := loader.UnmarshallConfigurationFile("headache.toml", []byte(`insertAfter = """
+^<\\?php \
+  $"""
+headerFile = '''
+license.txt'''`))
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(configuration.InsertAfter).To(Equal(`^<\?php $`))
+		Expect(configuration.HeaderFile).To(Equal("license.txt"))
+	})
+
+	It("detects TOML configuration files by their extension", func() {
+		Expect(IsTomlConfiguration("headache.toml")).To(BeTrue())
+		Expect(IsTomlConfiguration("config/HEADACHE.TOML")).To(BeTrue())
+		Expect(IsTomlConfiguration("headache.json")).To(BeFalse())
+	})
+
+	It("reports the line of invalid TOML", func() {
+		_, err := loader.UnmarshallConfigurationFile("headache.toml", []byte(`headerFile = "license.txt"
+style = SlashStar`))
+
+		Expect(err).To(MatchError("invalid TOML configuration headache.toml\n\t" +
+			`toml: line 2 (last key "style"): expected value but found "SlashStar" instead`))
+	})
+
+	It("rejects duplicated TOML keys", func() {
+		_, err := loader.UnmarshallConfigurationFile("headache.toml", []byte(`style = "SlashStar"
+style = "SlashSlash"`))
+
+		Expect(err).To(MatchError("invalid TOML configuration headache.toml\n\t" +
+			`toml: line 2 (last key "style"): Key 'style' has already been defined.`))
+	})
+
+	It("rejects duplicated TOML tables", func() {
+		_, err := loader.UnmarshallConfigurationFile("headache.toml", []byte(`[data]
+Owner = "ACME Labs"
+[data]
+Project = "Road Runner"`))
+
+		Expect(err).To(MatchError("invalid TOML configuration headache.toml\n\t" +
+			`toml: line 3: Key 'data' has already been defined.`))
+	})
+
+	It("decodes TOML integers of any base", func() {
+		configuration, err := loader.UnmarshallConfigurationFile("headache.toml", []byte(`minYear = 0x7E3
+maxYear = 0o3744`))
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(configuration.MinYear).To(Equal(2019))
+		Expect(configuration.MaxYear).To(Equal(2020))
+	})
+
+	It("decodes TOML with CRLF line breaks", func() {
+		configuration, err := loader.UnmarshallConfigurationFile("headache.toml",
+			[]byte("headerFile = \"license.txt\"\r\n[data]\r\nOwner = \"ACME Labs\"\r\n"))
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(configuration.HeaderFile).To(Equal("license.txt"))
+		Expect(configuration.TemplateData).To(Equal(map[string]string{"Owner": "ACME Labs"}))
+	})
+
+	It("rejects fractional years", func() {
+		_, err := loader.UnmarshallConfigurationFile("headache.toml", []byte(`minYear = 2019.5`))
+
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("reads configurations whose comment style is registered by the embedding program", func() {
+		RegisterCommentStyle("SemiColons", semiColons{})
+		defer UnregisterCommentStyle("SemiColons")
+		fileReader := new(fs_mocks.FileReader)
+		fileReader.On("Read", "headache.json").
+			Return([]byte(`{"headerFile": "license-header.txt", "style": "SemiColons", "includes": ["**/*.lisp"]}`), nil)
+		loader = &ConfigurationLoader{
+			Reader: fileReader,
+			Schema: schemaFrom(json.NewReferenceLoader("file://../docs/schema.json")),
+		}
+		path := "headache.json"
+
+		configuration, err := loader.ReadConfiguration(&path)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ParseCommentStyle(configuration.CommentStyle)).To(Equal(semiColons{}))
+		fileReader.AssertExpectations(GinkgoT())
+	})
+})
+
+var _ = Describe("Configuration resolution", func() {
+
+	var files map[string]string
+
+	BeforeEach(func() {
+		files = make(map[string]string)
+	})
+
+	read := func(path string) ([]byte, error) {
+		contents, found := files[path]
+		if !found {
+			return nil, os.ErrNotExist
+		}
+		return []byte(contents), nil
+	}
+
+	It("leaves configurations without extends untouched", func() {
+		files["headache.json"] = `{"headerFile": "license.txt", "minYear": 2009}`
+
+		payload, err := ResolveConfiguration("headache.json", read)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(payload).To(MatchJSON(`{"headerFile": "license.txt", "minYear": 2009}`))
+	})
+
+	It("overrides the extended settings", func() {
+		files["base.json"] = `{"headerFile": "license.txt", "style": "SlashStar", "includes": ["**/*.go"], "touch": true}`
+		files["project/headache.json"] = `{"extends": "../base.json", "style": "SlashSlash", "includes": ["**/*.java"]}`
+
+		payload, err := ResolveConfiguration("project/headache.json", read)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(payload).To(MatchJSON(`{
+  "headerFile": "license.txt",
+  "style": "SlashSlash",
+  "includes": ["**/*.java"],
+  "touch": true
+}`))
+	})
+
+	It("merges the extended objects", func() {
+		files["base.json"] = `{"data": {"Owner": "ACME", "Project": "Road Runner"}}`
+		files["headache.json"] = `{"extends": "base.json", "data": {"Project": "Coyote"}}`
+
+		payload, err := ResolveConfiguration("headache.json", read)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(payload).To(MatchJSON(`{"data": {"Owner": "ACME", "Project": "Coyote"}}`))
+	})
+
+	It("splices the extended arrays in place of ...", func() {
+		files["base.json"] = `{"excludes": ["vendor/**/*", "**/*.pb.go"]}`
+		files["headache.json"] = `{"extends": "base.json", "excludes": ["generated/**/*", "..."]}`
+
+		payload, err := ResolveConfiguration("headache.json", read)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(payload).To(MatchJSON(`{"excludes": ["generated/**/*", "vendor/**/*", "**/*.pb.go"]}`))
+	})
+
+	It("resolves extends chains, closest configurations taking precedence", func() {
+		files["headache-base.json"] = `{"headerFile": "license.txt", "minYear": 2009, "maxYear": 2020}`
+		files["services/headache.toml"] = `extends = "../headache-base.json"
+minYear = 2012`
+		files["services/api/headache.json"] = `{"extends": "../headache.toml", "maxYear": 2019}`
+
+		payload, err := ResolveConfiguration("services/api/headache.json", read)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(payload).To(MatchJSON(`{"headerFile": "license.txt", "minYear": 2012, "maxYear": 2019}`))
+	})
+
+	It("rejects cyclic extends", func() {
+		files["a/headache.json"] = `{"extends": "../b/headache.json"}`
+		files["b/headache.json"] = `{"extends": "../a/./headache.json"}`
+
+		_, err := ResolveConfiguration("a/headache.json", read)
+
+		Expect(err).To(MatchError("configuration extends itself: a/headache.json -> b/headache.json -> a/headache.json"))
+	})
+
+	It("rejects configurations extending themselves", func() {
+		files["headache.json"] = `{"extends": "headache.json"}`
+
+		_, err := ResolveConfiguration("headache.json", read)
+
+		Expect(err).To(MatchError("configuration extends itself: headache.json -> headache.json"))
+	})
+
+	It("fails if the extended configuration cannot be read", func() {
+		files["headache.json"] = `{"extends": "missing.json"}`
+
+		_, err := ResolveConfiguration("headache.json", read)
+
+		Expect(err).To(MatchError(os.ErrNotExist))
+	})
+})
@@ -17,16 +17,22 @@
 package core_test
 
 import (
+	"errors"
+	"fmt"
 	"github.com/fbiville/headache/core"
 	"github.com/fbiville/headache/core_mocks"
 	"github.com/fbiville/headache/fs"
 	"github.com/fbiville/headache/fs_mocks"
+	"github.com/fbiville/headache/helper"
 	"github.com/fbiville/headache/helper_mocks"
 	. "github.com/fbiville/headache/vcs"
 	"github.com/fbiville/headache/vcs_mocks"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+	"os"
 	"strings"
+	"time"
 )
 
 var _ = Describe("Configuration parser", func() {
@@ -46,6 +52,9 @@ var _ = Describe("Configuration parser", func() {
 		systemConfiguration *core.SystemConfiguration
 		data                map[string]string
 		revision            string
+		historyOptions      HistoryOptions
+		changeOptions       ChangeOptions
+		ignoreFileRead      *mock.Call
 	)
 
 	BeforeEach(func() {
@@ -70,6 +79,11 @@ var _ = Describe("Configuration parser", func() {
 			"Owner": "ACME Labs",
 		}
 		revision = "some-sha"
+		clock.On("Now").Return(time.Date(2019, time.March, 4, 0, 0, 0, 0, time.UTC))
+		historyOptions = HistoryOptions{MinYear: 1971, MaxYear: 2020}
+		changeOptions = ChangeOptions{ExcludeModeOnlyChanges: true}
+		ignoreFileRead = fileReader.On("Read", ".headacheignore").Return(nil, os.ErrNotExist).Once()
+		fileReader.On("Stat", mock.Anything).Return(&fs.FakeFileInfo{FileMode: 0644}, nil).Maybe()
 	})
 
 	AfterEach(func() {
@@ -91,9 +105,9 @@ var _ = Describe("Configuration parser", func() {
 		}
 		tracker.On("RetrieveVersionedTemplate", configuration).
 			Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}\n\nSome fictional license", data, revision), nil)
-		versioningClient.On("GetChanges", revision).Return(initialChanges, nil)
+		versioningClient.On("GetChanges", revision, changeOptions).Return(initialChanges, nil)
 		pathMatcher.On("MatchFiles", initialChanges, includes, excludes, fileSystem).Return(resultingChanges)
-		versioningClient.On("AddMetadata", resultingChanges, clock).Return(resultingChanges, nil)
+		versioningClient.On("AddMetadata", resultingChanges, clock, historyOptions).Return(resultingChanges, nil)
 
 		changeSet, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
 
@@ -112,9 +126,9 @@ var _ = Describe("Configuration parser", func() {
 		}
 		tracker.On("RetrieveVersionedTemplate", configuration).
 			Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}\n\nSome fictional license", data, revision), nil)
-		versioningClient.On("GetChanges", revision).Return(initialChanges, nil)
+		versioningClient.On("GetChanges", revision, changeOptions).Return(initialChanges, nil)
 		pathMatcher.On("MatchFiles", initialChanges, includes, excludes, fileSystem).Return(resultingChanges)
-		versioningClient.On("AddMetadata", resultingChanges, clock).Return(resultingChanges, nil)
+		versioningClient.On("AddMetadata", resultingChanges, clock, historyOptions).Return(resultingChanges, nil)
 
 		changeSet, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
 
@@ -133,9 +147,9 @@ var _ = Describe("Configuration parser", func() {
 		}
 		tracker.On("RetrieveVersionedTemplate", configuration).
 			Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}\n\nSome fictional license", data, revision), nil)
-		versioningClient.On("GetChanges", revision).Return(initialChanges, nil)
+		versioningClient.On("GetChanges", revision, changeOptions).Return(initialChanges, nil)
 		pathMatcher.On("MatchFiles", initialChanges, includes, excludes, fileSystem).Return(resultingChanges)
-		versioningClient.On("AddMetadata", resultingChanges, clock).Return(resultingChanges, nil)
+		versioningClient.On("AddMetadata", resultingChanges, clock, historyOptions).Return(resultingChanges, nil)
 
 		changeSet, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
 
@@ -158,9 +172,9 @@ var _ = Describe("Configuration parser", func() {
 		}
 		tracker.On("RetrieveVersionedTemplate", configuration).
 			Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}", data, revision), nil)
-		versioningClient.On("GetChanges", revision).Return(initialChanges, nil)
+		versioningClient.On("GetChanges", revision, changeOptions).Return(initialChanges, nil)
 		pathMatcher.On("MatchFiles", initialChanges, includes, excludes, fileSystem).Return(resultingChanges)
-		versioningClient.On("AddMetadata", resultingChanges, clock).Return(resultingChanges, nil)
+		versioningClient.On("AddMetadata", resultingChanges, clock, historyOptions).Return(resultingChanges, nil)
 
 		changeSet, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
 
@@ -183,6 +197,1529 @@ var _ = Describe("Configuration parser", func() {
 			"Regex should match contents with different data and comment style")
 	})
 
+	It("forwards the configured year bounds, defaulting the missing ones", func() {
+		configuration := &core.Configuration{
+			HeaderFile:   "some-header",
+			CommentStyle: "SlashSlash",
+			Includes:     includes,
+			Excludes:     excludes,
+			TemplateData: data,
+			MinYear:      2004,
+		}
+		tracker.On("RetrieveVersionedTemplate", configuration).
+			Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}", data, revision), nil)
+		versioningClient.On("GetChanges", revision, changeOptions).Return(initialChanges, nil)
+		pathMatcher.On("MatchFiles", initialChanges, includes, excludes, fileSystem).Return(resultingChanges)
+		versioningClient.On("AddMetadata", resultingChanges, clock, HistoryOptions{MinYear: 2004, MaxYear: 2020}).
+			Return(resultingChanges, nil)
+
+		_, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+		Expect(err).To(BeNil())
+	})
+
+	It("forwards the rename and copy detection thresholds", func() {
+		configuration := &core.Configuration{
+			HeaderFile:      "some-header",
+			CommentStyle:    "SlashSlash",
+			Includes:        includes,
+			Excludes:        excludes,
+			TemplateData:    data,
+			RenameThreshold: 30,
+			CopyThreshold:   90,
+		}
+		tracker.On("RetrieveVersionedTemplate", configuration).
+			Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}", data, revision), nil)
+		versioningClient.On("GetChanges", revision, ChangeOptions{RenameThreshold: 30, CopyThreshold: 90, ExcludeModeOnlyChanges: true}).
+			Return(initialChanges, nil)
+		pathMatcher.On("MatchFiles", initialChanges, includes, excludes, fileSystem).Return(resultingChanges)
+		versioningClient.On("AddMetadata", resultingChanges, clock, historyOptions).Return(resultingChanges, nil)
+
+		_, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+		Expect(err).To(BeNil())
+	})
+
+	It("only computes the changes adding lines when asked to", func() {
+		configuration := &core.Configuration{
+			HeaderFile:     "some-header",
+			CommentStyle:   "SlashSlash",
+			Includes:       includes,
+			Excludes:       excludes,
+			TemplateData:   data,
+			AddedLinesOnly: true,
+		}
+		tracker.On("RetrieveVersionedTemplate", configuration).
+			Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}", data, revision), nil)
+		versioningClient.On("GetChanges", revision, ChangeOptions{ExcludeModeOnlyChanges: true, AddedLinesOnly: true}).
+			Return(initialChanges, nil)
+		pathMatcher.On("MatchFiles", initialChanges, includes, excludes, fileSystem).Return(resultingChanges)
+		versioningClient.On("AddMetadata", resultingChanges, clock, historyOptions).Return(resultingChanges, nil)
+
+		_, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+		Expect(err).To(BeNil())
+	})
+
+	It("only computes the changes of the given pathspecs", func() {
+		configuration := &core.Configuration{
+			HeaderFile:   "some-header",
+			CommentStyle: "SlashSlash",
+			Includes:     includes,
+			Excludes:     excludes,
+			TemplateData: data,
+			Pathspecs:    []string{"services/payments"},
+		}
+		tracker.On("RetrieveVersionedTemplate", configuration).
+			Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}", data, revision), nil)
+		versioningClient.On("GetChanges", revision, ChangeOptions{ExcludeModeOnlyChanges: true, Pathspecs: []string{"services/payments"}}).
+			Return(initialChanges, nil)
+		pathMatcher.On("MatchFiles", initialChanges, includes, excludes, fileSystem).Return(resultingChanges)
+		versioningClient.On("AddMetadata", resultingChanges, clock, historyOptions).Return(resultingChanges, nil)
+
+		_, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+		Expect(err).To(BeNil())
+	})
+
+	It("includes the changes of file modes when asked to", func() {
+		configuration := &core.Configuration{
+			HeaderFile:             "some-header",
+			CommentStyle:           "SlashSlash",
+			Includes:               includes,
+			Excludes:               excludes,
+			TemplateData:           data,
+			IncludeModeOnlyChanges: true,
+		}
+		tracker.On("RetrieveVersionedTemplate", configuration).
+			Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}", data, revision), nil)
+		versioningClient.On("GetChanges", revision, ChangeOptions{}).Return(initialChanges, nil)
+		pathMatcher.On("MatchFiles", initialChanges, includes, excludes, fileSystem).Return(resultingChanges)
+		versioningClient.On("AddMetadata", resultingChanges, clock, historyOptions).Return(resultingChanges, nil)
+
+		_, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+		Expect(err).To(BeNil())
+	})
+
+	It("computes changes from the merge base in merge base diff mode", func() {
+		configuration := &core.Configuration{
+			HeaderFile:   "some-header",
+			CommentStyle: "SlashSlash",
+			Includes:     includes,
+			Excludes:     excludes,
+			TemplateData: data,
+			DiffMode:     core.MergeBaseDiffMode,
+		}
+		tracker.On("RetrieveVersionedTemplate", configuration).
+			Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}", data, revision), nil)
+		versioningClient.On("GetChanges", revision, ChangeOptions{MergeBase: true, ExcludeModeOnlyChanges: true}).
+			Return(initialChanges, nil)
+		pathMatcher.On("MatchFiles", initialChanges, includes, excludes, fileSystem).Return(resultingChanges)
+		versioningClient.On("AddMetadata", resultingChanges, clock, historyOptions).Return(resultingChanges, nil)
+
+		_, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+		Expect(err).To(BeNil())
+	})
+
+	It("computes changes made since HEAD forked from the base branch in fork point mode", func() {
+		configuration := &core.Configuration{
+			HeaderFile:   "some-header",
+			CommentStyle: "SlashSlash",
+			Includes:     includes,
+			Excludes:     excludes,
+			TemplateData: data,
+			DiffMode:     core.ForkPointDiffMode,
+			BaseBranch:   "origin/main",
+		}
+		tracker.On("RetrieveVersionedTemplate", configuration).
+			Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}", data, revision), nil)
+		versioningClient.On("GetChanges", revision, ChangeOptions{ForkPointBranch: "origin/main", ExcludeModeOnlyChanges: true}).
+			Return(initialChanges, nil)
+		pathMatcher.On("MatchFiles", initialChanges, includes, excludes, fileSystem).Return(resultingChanges)
+		versioningClient.On("AddMetadata", resultingChanges, clock, historyOptions).Return(resultingChanges, nil)
+
+		_, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+		Expect(err).To(BeNil())
+	})
+
+	It("derives creation years from the first appearance of files on the base branch when asked to", func() {
+		configuration := &core.Configuration{
+			HeaderFile:         "some-header",
+			CommentStyle:       "SlashSlash",
+			Includes:           includes,
+			Excludes:           excludes,
+			TemplateData:       data,
+			BaseBranch:         "origin/main",
+			CreationYearPolicy: core.FirstSeenOnBranchCreationYearPolicy,
+		}
+		tracker.On("RetrieveVersionedTemplate", configuration).
+			Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}", data, revision), nil)
+		versioningClient.On("GetChanges", revision, changeOptions).Return(initialChanges, nil)
+		pathMatcher.On("MatchFiles", initialChanges, includes, excludes, fileSystem).Return(resultingChanges)
+		options := historyOptions
+		options.CreationBranch = "origin/main"
+		versioningClient.On("AddMetadata", resultingChanges, clock, options).Return(resultingChanges, nil)
+
+		_, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+		Expect(err).To(BeNil())
+	})
+
+	Describe("without base branch", func() {
+
+		var configuration *core.Configuration
+
+		BeforeEach(func() {
+			configuration = &core.Configuration{
+				HeaderFile:   "some-header",
+				CommentStyle: "SlashSlash",
+				Includes:     includes,
+				Excludes:     excludes,
+				TemplateData: data,
+				DiffMode:     core.ForkPointDiffMode,
+			}
+			tracker.On("RetrieveVersionedTemplate", configuration).
+				Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}", data, revision), nil)
+		})
+
+		It("defaults the base branch to the default branch of the default remote from the git configuration", func() {
+			versioningClient.On("GetClient").Return(&FixtureVcs{Config: map[string]string{
+				"init.defaultBranch":     "trunk",
+				"checkout.defaultRemote": "upstream",
+			}})
+			versioningClient.On("GetChanges", revision, ChangeOptions{ForkPointBranch: "upstream/trunk", ExcludeModeOnlyChanges: true}).
+				Return(initialChanges, nil)
+			pathMatcher.On("MatchFiles", initialChanges, includes, excludes, fileSystem).Return(resultingChanges)
+			versioningClient.On("AddMetadata", resultingChanges, clock, historyOptions).Return(resultingChanges, nil)
+
+			_, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+			Expect(err).To(BeNil())
+			Expect(configuration.BaseBranch).To(BeEmpty(), "the given configuration is left untouched")
+		})
+
+		It("defaults the base branch to the local default branch without default remote", func() {
+			versioningClient.On("GetClient").Return(&FixtureVcs{Config: map[string]string{"init.defaultBranch": "trunk"}})
+			versioningClient.On("GetChanges", revision, ChangeOptions{ForkPointBranch: "trunk", ExcludeModeOnlyChanges: true}).
+				Return(initialChanges, nil)
+			pathMatcher.On("MatchFiles", initialChanges, includes, excludes, fileSystem).Return(resultingChanges)
+			versioningClient.On("AddMetadata", resultingChanges, clock, historyOptions).Return(resultingChanges, nil)
+
+			_, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+			Expect(err).To(BeNil())
+		})
+
+		It("prefers the base branch configured for headache in the git configuration", func() {
+			versioningClient.On("GetClient").Return(&FixtureVcs{Config: map[string]string{
+				"headache.baseBranch":    "origin/release",
+				"init.defaultBranch":     "trunk",
+				"checkout.defaultRemote": "upstream",
+			}})
+			versioningClient.On("GetChanges", revision, ChangeOptions{ForkPointBranch: "origin/release", ExcludeModeOnlyChanges: true}).
+				Return(initialChanges, nil)
+			pathMatcher.On("MatchFiles", initialChanges, includes, excludes, fileSystem).Return(resultingChanges)
+			versioningClient.On("AddMetadata", resultingChanges, clock, historyOptions).Return(resultingChanges, nil)
+
+			_, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+			Expect(err).To(BeNil())
+		})
+	})
+
+	Describe("with lazy history", func() {
+
+		var (
+			configuration *core.Configuration
+			versioning    *CountingVcs
+		)
+
+		BeforeEach(func() {
+			configuration = &core.Configuration{
+				HeaderFile:   "some-header",
+				CommentStyle: "SlashSlash",
+				Includes:     []string{"src/**/*.go"},
+				Excludes:     []string{"src/vendor/**"},
+				TemplateData: data,
+				LazyHistory:  true,
+			}
+			versioning = NewCountingVcs(&FixtureVcs{
+				DiffOutputs: map[string]string{
+					"--raw --no-abbrev -z --ignore-submodules some-sha..HEAD": ":100644 100644 aaaa bbbb M\x00src/main.go\x00" +
+						":100644 100644 cccc dddd M\x00src/vendor/lib.go\x00",
+				},
+				StatusOutputs: map[string]string{"--porcelain -z --ignore-submodules": ""},
+				LogOutputs: map[string]string{
+					"--follow --name-status --use-mailmap --format=%at%x00%aN -- src/main.go": "",
+				},
+			})
+			systemConfiguration.VersioningClient = &Client{Vcs: versioning}
+			tracker.On("RetrieveVersionedTemplate", configuration).
+				Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}", data, revision), nil)
+		})
+
+		It("defers the history of the matched files until it is loaded", func() {
+			changeSet, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, &fs.ZglobPathMatcher{})
+
+			Expect(err).To(BeNil())
+			Expect(changeSet.Files).To(Equal([]FileChange{{Path: "src/main.go"}}))
+			Expect(versioning.Count("Log")).To(Equal(0))
+		})
+
+		It("only computes the history of the files matched by globs", func() {
+			changeSet, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, &fs.ZglobPathMatcher{})
+			Expect(err).To(BeNil())
+
+			err = changeSet.LoadHistory()
+
+			Expect(err).To(BeNil())
+			Expect(onlyPaths(changeSet.Files)).To(Equal([]FileChange{{Path: "src/main.go"}}))
+			Expect(changeSet.Files[0].CreationYear).To(Equal(2019))
+			Expect(changeSet.Files[0].LastEditionYear).To(Equal(2019))
+			Expect(versioning.Count("Log")).To(Equal(1), "only the history of src/main.go is computed")
+		})
+
+		It("computes the history of all files upfront when filtering them by year", func() {
+			configuration.SinceYear = 2019
+
+			changeSet, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, &fs.ZglobPathMatcher{})
+
+			Expect(err).To(BeNil())
+			Expect(changeSet.HistoryLoader).To(BeNil())
+			Expect(changeSet.Files[0].LastEditionYear).To(Equal(2019))
+			Expect(versioning.Count("Log")).To(Equal(1))
+		})
+	})
+
+	It("rejects the first seen on branch creation year policy without base branch, even in the git configuration", func() {
+		configuration := &core.Configuration{
+			HeaderFile:         "some-header",
+			CommentStyle:       "SlashSlash",
+			Includes:           includes,
+			Excludes:           excludes,
+			TemplateData:       data,
+			CreationYearPolicy: core.FirstSeenOnBranchCreationYearPolicy,
+		}
+		tracker.On("RetrieveVersionedTemplate", configuration).
+			Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}", data, revision), nil)
+		versioningClient.On("GetClient").Return(&FixtureVcs{})
+		fileReader.ExpectedCalls = nil
+		clock.ExpectedCalls = nil
+
+		_, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+		Expect(err).To(MatchError("creationYearPolicy firstSeenOnBranch requires baseBranch to be set"))
+	})
+
+	It("splits the changes into disjoint shards covering them all", func() {
+		configuration := &core.Configuration{
+			HeaderFile:   "some-header",
+			CommentStyle: "SlashSlash",
+			Includes:     includes,
+			Excludes:     excludes,
+			TemplateData: data,
+			ShardCount:   3,
+		}
+		changes := make([]FileChange, 0, 30)
+		for i := 0; i < 30; i++ {
+			changes = append(changes, FileChange{Path: fmt.Sprintf("file%d.go", i)})
+		}
+		tracker.On("RetrieveVersionedTemplate", configuration).
+			Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}", data, revision), nil)
+		versioningClient.On("GetChanges", revision, changeOptions).Return(changes, nil)
+		pathMatcher.On("MatchFiles", changes, includes, excludes, fileSystem).Return(changes)
+		versioningClient.On("AddMetadata", mock.Anything, clock, historyOptions).
+			Return(func(changes []FileChange, _ helper.Clock, _ HistoryOptions) []FileChange { return changes }, nil)
+		ignoreFileRead.Times(3)
+
+		union := make([]FileChange, 0, len(changes))
+		for index := 0; index < 3; index++ {
+			configuration.ShardIndex = index
+			changeSet, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(changeSet.Files).NotTo(BeEmpty())
+			Expect(len(changeSet.Files)).To(BeNumerically("<", len(changes)))
+			union = append(union, changeSet.Files...)
+		}
+		Expect(union).To(HaveLen(len(changes)))
+		Expect(union).To(ConsistOf(changes))
+	})
+
+	It("rejects shard indices out of the shard count", func() {
+		configuration := &core.Configuration{
+			HeaderFile:   "some-header",
+			CommentStyle: "SlashSlash",
+			Includes:     includes,
+			Excludes:     excludes,
+			TemplateData: data,
+			ShardIndex:   3,
+			ShardCount:   3,
+		}
+		tracker.On("RetrieveVersionedTemplate", configuration).
+			Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}", data, revision), nil)
+		fileReader.ExpectedCalls = nil
+		clock.ExpectedCalls = nil
+
+		_, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+		Expect(err).To(MatchError("shard index must be between 0 and 2, got 3"))
+	})
+
+	It("rejects the fork point mode without base branch, even in the git configuration", func() {
+		configuration := &core.Configuration{
+			HeaderFile:   "some-header",
+			CommentStyle: "SlashSlash",
+			Includes:     includes,
+			Excludes:     excludes,
+			TemplateData: data,
+			DiffMode:     core.ForkPointDiffMode,
+		}
+		tracker.On("RetrieveVersionedTemplate", configuration).
+			Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}", data, revision), nil)
+		versioningClient.On("GetClient").Return(&FixtureVcs{})
+		fileReader.ExpectedCalls = nil
+		clock.ExpectedCalls = nil
+
+		_, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+		Expect(err).To(MatchError("diffMode forkPoint requires baseBranch to be set"))
+	})
+
+	It("aggregates the changes of the configured nested repositories", func() {
+		configuration := &core.Configuration{
+			HeaderFile:   "some-header",
+			CommentStyle: "SlashSlash",
+			Includes:     includes,
+			Excludes:     excludes,
+			TemplateData: data,
+			VcsRoots:     []string{"vendor/lib/"},
+		}
+		mainVcs := new(vcs_mocks.Vcs)
+		nestedVcs := new(vcs_mocks.Vcs)
+		nestedClient := new(vcs_mocks.VersioningClient)
+		systemConfiguration.NestedVersioningClient = func(root string) VersioningClient {
+			Expect(root).To(Equal("vendor/lib"))
+			return nestedClient
+		}
+		tracker.On("RetrieveVersionedTemplate", configuration).
+			Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}", data, revision), nil)
+		versioningClient.On("GetChanges", revision, changeOptions).Return(initialChanges, nil)
+		versioningClient.On("GetClient").Return(mainVcs)
+		mainVcs.On("Log", "-1", "--format=%ct", revision).Return("1551657600\n", nil)
+		nestedClient.On("GetClient").Return(nestedVcs)
+		nestedVcs.On("Log", "-1", "--format=%H", "--before=1551657600").Return("deadbeef\n", nil)
+		nestedClient.On("GetChanges", "deadbeef", changeOptions).Return([]FileChange{{Path: "lib.go"}}, nil)
+		allChanges := append(initialChanges, FileChange{Path: "vendor/lib/lib.go"})
+		pathMatcher.On("MatchFiles", allChanges, includes, excludes, fileSystem).Return(resultingChanges)
+		versioningClient.On("AddMetadata", resultingChanges, clock, historyOptions).Return(resultingChanges, nil)
+
+		changeSet, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+		Expect(err).To(BeNil())
+		Expect(changeSet.Files).To(Equal(resultingChanges))
+		mainVcs.AssertExpectations(t)
+		nestedVcs.AssertExpectations(t)
+		nestedClient.AssertExpectations(t)
+	})
+
+	It("leaves out the files whose history cannot be computed and keeps the others", func() {
+		configuration := &core.Configuration{
+			HeaderFile:   "some-header",
+			CommentStyle: "SlashSlash",
+			Includes:     includes,
+			Excludes:     excludes,
+			TemplateData: data,
+		}
+		matchedChanges := []FileChange{{Path: "hello-world.go"}, {Path: "broken.go"}, {Path: "hello-moon.go"}}
+		tracker.On("RetrieveVersionedTemplate", configuration).
+			Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}", data, revision), nil)
+		versioningClient.On("GetChanges", revision, changeOptions).Return(initialChanges, nil)
+		pathMatcher.On("MatchFiles", initialChanges, includes, excludes, fileSystem).Return(matchedChanges)
+		versioningClient.On("AddMetadata", matchedChanges, clock, historyOptions).Return([]FileChange{
+			{Path: "hello-world.go", CreationYear: 2018, LastEditionYear: 2019},
+			{Path: "broken.go"},
+			{Path: "hello-moon.go", CreationYear: 2017, LastEditionYear: 2017},
+		}, &MultiError{Failures: []*FileError{{Path: "broken.go", Err: errors.New("log error")}}})
+
+		changeSet, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+		Expect(err).To(BeNil())
+		Expect(changeSet.Files).To(Equal([]FileChange{
+			{Path: "hello-world.go", CreationYear: 2018, LastEditionYear: 2019},
+			{Path: "hello-moon.go", CreationYear: 2017, LastEditionYear: 2017},
+		}))
+	})
+
+	It("fails if the history of the files cannot be computed at all", func() {
+		configuration := &core.Configuration{
+			HeaderFile:   "some-header",
+			CommentStyle: "SlashSlash",
+			Includes:     includes,
+			Excludes:     excludes,
+			TemplateData: data,
+		}
+		historyError := errors.New("history error")
+		tracker.On("RetrieveVersionedTemplate", configuration).
+			Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}", data, revision), nil)
+		versioningClient.On("GetChanges", revision, changeOptions).Return(initialChanges, nil)
+		pathMatcher.On("MatchFiles", initialChanges, includes, excludes, fileSystem).Return(resultingChanges)
+		versioningClient.On("AddMetadata", resultingChanges, clock, historyOptions).Return(nil, historyError)
+
+		_, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+		Expect(err).To(MatchError(historyError))
+	})
+
+	It("only scans staged changes when asked to", func() {
+		configuration := &core.Configuration{
+			HeaderFile:   "some-header",
+			CommentStyle: "SlashSlash",
+			Includes:     includes,
+			Excludes:     excludes,
+			TemplateData: data,
+			Staged:       true,
+		}
+		tracker.On("RetrieveVersionedTemplate", configuration).
+			Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}", data, revision), nil)
+		versioningClient.On("GetChanges", "", ChangeOptions{Staged: true, ExcludeModeOnlyChanges: true}).Return(initialChanges, nil)
+		pathMatcher.On("MatchFiles", initialChanges, includes, excludes, fileSystem).Return(resultingChanges)
+		versioningClient.On("AddMetadata", resultingChanges, clock, historyOptions).Return(resultingChanges, nil)
+
+		changeSet, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+		Expect(err).To(BeNil())
+		Expect(changeSet.Files).To(Equal(resultingChanges))
+	})
+
+	It("rewrites the displayed paths while leaving the actual paths intact", func() {
+		configuration := &core.Configuration{
+			HeaderFile:   "some-header",
+			CommentStyle: "SlashSlash",
+			Includes:     includes,
+			Excludes:     excludes,
+			TemplateData: data,
+			PathRewrite:  &core.PathRewrite{Pattern: "^packages/([^/]+)/src/", Replacement: "$1/"},
+		}
+		tracker.On("RetrieveVersionedTemplate", configuration).
+			Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}", data, revision), nil)
+		versioningClient.On("GetChanges", revision, changeOptions).Return(initialChanges, nil)
+		monorepoChanges := []FileChange{{Path: "packages/foo/src/main.go"}, {Path: "tools/build.go"}}
+		pathMatcher.On("MatchFiles", initialChanges, includes, excludes, fileSystem).Return(monorepoChanges)
+		versioningClient.On("AddMetadata", monorepoChanges, clock, historyOptions).Return(monorepoChanges, nil)
+
+		changeSet, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+		Expect(err).To(BeNil())
+		Expect(changeSet.Files).To(Equal([]FileChange{
+			{Path: "packages/foo/src/main.go", DisplayPath: "foo/main.go"},
+			{Path: "tools/build.go"},
+		}))
+	})
+
+	It("forwards the touch setting", func() {
+		configuration := &core.Configuration{
+			HeaderFile:   "some-header",
+			CommentStyle: "SlashSlash",
+			Includes:     includes,
+			Excludes:     excludes,
+			TemplateData: data,
+			Touch:        true,
+		}
+		tracker.On("RetrieveVersionedTemplate", configuration).
+			Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}", data, revision), nil)
+		versioningClient.On("GetChanges", revision, changeOptions).Return(initialChanges, nil)
+		pathMatcher.On("MatchFiles", initialChanges, includes, excludes, fileSystem).Return(resultingChanges)
+		versioningClient.On("AddMetadata", resultingChanges, clock, HistoryOptions{MinYear: 1971, MaxYear: 2020, Touch: true}).
+			Return(resultingChanges, nil)
+
+		_, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+		Expect(err).To(BeNil())
+	})
+
+	It("forwards the release years setting", func() {
+		configuration := &core.Configuration{
+			HeaderFile:   "some-header",
+			CommentStyle: "SlashSlash",
+			Includes:     includes,
+			Excludes:     excludes,
+			TemplateData: data,
+			ReleaseYears: true,
+		}
+		tracker.On("RetrieveVersionedTemplate", configuration).
+			Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}", data, revision), nil)
+		versioningClient.On("GetChanges", revision, changeOptions).Return(initialChanges, nil)
+		pathMatcher.On("MatchFiles", initialChanges, includes, excludes, fileSystem).Return(resultingChanges)
+		versioningClient.On("AddMetadata", resultingChanges, clock, HistoryOptions{MinYear: 1971, MaxYear: 2020, ReleaseYears: true}).
+			Return(resultingChanges, nil)
+
+		_, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+		Expect(err).To(BeNil())
+	})
+
+	It("does not retrieve any file metadata nor content when there are no changes", func() {
+		configuration := &core.Configuration{
+			HeaderFile:               "some-header",
+			CommentStyle:             "SlashSlash",
+			Includes:                 includes,
+			Excludes:                 excludes,
+			TemplateData:             data,
+			ExcludeHeaderOnlyChanges: true,
+		}
+		vcs := new(vcs_mocks.Vcs)
+		versioningClient.On("GetClient").Return(vcs)
+		tracker.On("RetrieveVersionedTemplate", configuration).
+			Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}", data, revision), nil)
+		versioningClient.On("GetChanges", revision, changeOptions).Return([]FileChange{}, nil)
+		pathMatcher.On("MatchFiles", []FileChange{}, includes, excludes, fileSystem).Return([]FileChange{})
+		fileReader.ExpectedCalls = nil
+		clock.ExpectedCalls = nil
+
+		changeSet, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+		Expect(err).To(BeNil())
+		Expect(changeSet.IsEmpty()).To(BeTrue())
+		vcs.AssertExpectations(t)
+	})
+
+	It("scans all tracked files when asked to", func() {
+		configuration := &core.Configuration{
+			HeaderFile:   "some-header",
+			CommentStyle: "SlashSlash",
+			Includes:     includes,
+			Excludes:     excludes,
+			TemplateData: data,
+			TrackedFiles: true,
+		}
+		vcs := new(vcs_mocks.Vcs)
+		versioningClient.On("GetClient").Return(vcs)
+		vcs.On("LsFiles", "-z").Return("hello-world.go\x00license.txt\x00", nil)
+		tracker.On("RetrieveVersionedTemplate", configuration).
+			Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}", data, revision), nil)
+		pathMatcher.On("MatchFiles", initialChanges, includes, excludes, fileSystem).Return(resultingChanges)
+		clock.ExpectedCalls = nil
+
+		changeSet, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+		Expect(err).To(BeNil())
+		Expect(changeSet.Files).To(Equal(resultingChanges))
+		vcs.AssertExpectations(t)
+	})
+
+	It("forwards the rename policy", func() {
+		configuration := &core.Configuration{
+			HeaderFile:           "some-header",
+			CommentStyle:         "SlashSlash",
+			Includes:             includes,
+			Excludes:             excludes,
+			TemplateData:         data,
+			RenameResetsCreation: true,
+		}
+		tracker.On("RetrieveVersionedTemplate", configuration).
+			Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}", data, revision), nil)
+		versioningClient.On("GetChanges", revision, changeOptions).Return(initialChanges, nil)
+		pathMatcher.On("MatchFiles", initialChanges, includes, excludes, fileSystem).Return(resultingChanges)
+		versioningClient.On("AddMetadata", resultingChanges, clock, HistoryOptions{MinYear: 1971, MaxYear: 2020, RenameResetsCreation: true}).
+			Return(resultingChanges, nil)
+
+		_, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+		Expect(err).To(BeNil())
+	})
+
+	Describe("with files vanishing after their changes are computed", func() {
+
+		var (
+			configuration *core.Configuration
+			changes       []FileChange
+		)
+
+		BeforeEach(func() {
+			configuration = &core.Configuration{
+				HeaderFile:   "some-header",
+				CommentStyle: "SlashSlash",
+				Includes:     includes,
+				Excludes:     excludes,
+				TemplateData: data,
+			}
+			changes = []FileChange{{Path: "kept.go"}, {Path: "vanished.go"}}
+			tracker.On("RetrieveVersionedTemplate", configuration).
+				Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}", data, revision), nil)
+			versioningClient.On("GetChanges", revision, changeOptions).Return(changes, nil)
+			pathMatcher.On("MatchFiles", changes, includes, excludes, fileSystem).Return(changes)
+			versioningClient.On("AddMetadata", changes, clock, historyOptions).Return(changes, nil)
+			fileReader.ExpectedCalls = nil
+			fileReader.On("Read", ".headacheignore").Return(nil, os.ErrNotExist).Once()
+			fileReader.On("Stat", "kept.go").Return(&fs.FakeFileInfo{FileMode: 0644}, nil)
+			fileReader.On("Stat", "vanished.go").Return(nil, os.ErrNotExist)
+		})
+
+		It("fails by default", func() {
+			_, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+			Expect(err).To(MatchError("file vanished.go vanished after its changes were computed, set skipVanishedFiles to skip such files"))
+		})
+
+		It("skips them when asked to", func() {
+			configuration.SkipVanishedFiles = true
+
+			changeSet, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(changeSet.Files).To(Equal([]FileChange{{Path: "kept.go"}}))
+		})
+	})
+
+	It("fails rather than defaulting copyright years when git is not installed", func() {
+		configuration := &core.Configuration{
+			HeaderFile:   "some-header",
+			CommentStyle: "SlashSlash",
+			Includes:     includes,
+			Excludes:     excludes,
+			TemplateData: data,
+		}
+		tracker.On("RetrieveVersionedTemplate", configuration).
+			Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}", data, revision), nil)
+		versioningClient.On("GetChanges", revision, changeOptions).Return(initialChanges, nil)
+		pathMatcher.On("MatchFiles", initialChanges, includes, excludes, fileSystem).Return(resultingChanges)
+		versioningClient.On("AddMetadata", resultingChanges, clock, historyOptions).Return(nil, ErrVcsNotInstalled)
+
+		_, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+		Expect(err).To(Equal(ErrVcsNotInstalled))
+	})
+
+	It("bumps the edition years of files with uncommitted modifications to their modification year", func() {
+		configuration := &core.Configuration{
+			HeaderFile:              "some-header",
+			CommentStyle:            "SlashSlash",
+			Includes:                includes,
+			Excludes:                excludes,
+			TemplateData:            data,
+			WorkingTreeEditionYears: true,
+		}
+		changes := []FileChange{{Path: "committed.go"}, {Path: "modified.go"}}
+		changesWithHistory := []FileChange{
+			{Path: "committed.go", CreationYear: 2016, LastEditionYear: 2017},
+			{Path: "modified.go", CreationYear: 2016, LastEditionYear: 2017},
+		}
+		vcs := new(vcs_mocks.Vcs)
+		versioningClient.On("GetClient").Return(vcs)
+		vcs.On("Status", "--porcelain", "-z", "--ignore-submodules").Return(" M modified.go\x00", nil)
+		tracker.On("RetrieveVersionedTemplate", configuration).
+			Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}", data, revision), nil)
+		versioningClient.On("GetChanges", revision, changeOptions).Return(changes, nil)
+		pathMatcher.On("MatchFiles", changes, includes, excludes, fileSystem).Return(changes)
+		versioningClient.On("AddMetadata", changes, clock, historyOptions).Return(changesWithHistory, nil)
+		fileReader.ExpectedCalls = nil
+		fileReader.On("Read", ".headacheignore").Return(nil, os.ErrNotExist).Once()
+		fileReader.On("Stat", "committed.go").Return(&fs.FakeFileInfo{FileMode: 0644}, nil)
+		fileReader.On("Stat", "modified.go").Return(&fs.FakeFileInfo{
+			FileMode:         0644,
+			ModificationTime: time.Date(2019, time.March, 3, 0, 0, 0, 0, time.UTC),
+		}, nil)
+
+		changeSet, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changeSet.Files).To(Equal([]FileChange{
+			{Path: "committed.go", CreationYear: 2016, LastEditionYear: 2017},
+			{Path: "modified.go", CreationYear: 2016, LastEditionYear: 2019,
+				LastEditionTime: time.Date(2019, time.March, 3, 0, 0, 0, 0, time.UTC)},
+		}))
+		vcs.AssertExpectations(t)
+	})
+
+	It("only processes the given files, whether they changed or not", func() {
+		configuration := &core.Configuration{
+			HeaderFile:   "some-header",
+			CommentStyle: "SlashSlash",
+			Includes:     includes,
+			Excludes:     excludes,
+			TemplateData: data,
+			Paths:        []string{"docs/unchanged.md"},
+		}
+		versioningClient.On("AddMetadata", []FileChange{{Path: "docs/unchanged.md"}}, clock, historyOptions).
+			Return([]FileChange{{Path: "docs/unchanged.md", CreationYear: 2017, LastEditionYear: 2017}}, nil)
+		tracker.On("RetrieveVersionedTemplate", configuration).
+			Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}", data, revision), nil)
+		fileReader.ExpectedCalls = nil
+
+		changeSet, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+		Expect(err).To(BeNil())
+		Expect(changeSet.Files).To(Equal([]FileChange{{Path: "docs/unchanged.md", CreationYear: 2017, LastEditionYear: 2017}}))
+	})
+
+	It("retrieves the history of the given files of nested repositories from their own root", func() {
+		configuration := &core.Configuration{
+			HeaderFile:   "some-header",
+			CommentStyle: "SlashSlash",
+			Includes:     includes,
+			Excludes:     excludes,
+			TemplateData: data,
+			VcsRoots:     []string{"vendor/lib"},
+			Paths:        []string{"main.go", "vendor/lib/lib.go"},
+		}
+		nestedClient := new(vcs_mocks.VersioningClient)
+		systemConfiguration.NestedVersioningClient = func(root string) VersioningClient {
+			return nestedClient
+		}
+		versioningClient.On("AddMetadata", []FileChange{{Path: "main.go"}}, clock, historyOptions).
+			Return([]FileChange{{Path: "main.go", CreationYear: 2017, LastEditionYear: 2019}}, nil)
+		nestedClient.On("AddMetadata", []FileChange{{Path: "lib.go"}}, clock, historyOptions).
+			Return([]FileChange{{Path: "lib.go", CreationYear: 2012, LastEditionYear: 2014}}, nil)
+		tracker.On("RetrieveVersionedTemplate", configuration).
+			Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}", data, revision), nil)
+		fileReader.ExpectedCalls = nil
+
+		changeSet, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+		Expect(err).To(BeNil())
+		Expect(changeSet.Files).To(Equal([]FileChange{
+			{Path: "main.go", CreationYear: 2017, LastEditionYear: 2019},
+			{Path: "vendor/lib/lib.go", CreationYear: 2012, LastEditionYear: 2014},
+		}))
+		nestedClient.AssertExpectations(t)
+	})
+
+	It("detects the headers ending with the marker whatever their wording and the unmarked ones matching the template", func() {
+		configuration := &core.Configuration{
+			HeaderFile:   "some-header",
+			CommentStyle: "SlashSlash",
+			Includes:     includes,
+			Excludes:     excludes,
+			TemplateData: data,
+			Marker:       "managed by headache",
+		}
+		tracker.On("RetrieveVersionedTemplate", configuration).
+			Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}\nmanaged by headache", data, revision), nil)
+		versioningClient.On("GetChanges", revision, changeOptions).Return(initialChanges, nil)
+		pathMatcher.On("MatchFiles", initialChanges, includes, excludes, fileSystem).Return(resultingChanges)
+		versioningClient.On("AddMetadata", resultingChanges, clock, historyOptions).Return(resultingChanges, nil)
+
+		changeSet, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+		Expect(err).To(BeNil())
+		Expect(changeSet.HeaderContents).To(Equal("// Copyright {{.YearRange}} ACME Labs\n// managed by headache"))
+		Expect(changeSet.HeaderRegex.FindString("// Licensed under MIT\n// by Someone\n// managed by headache\n\npackage main")).
+			To(Equal("// Licensed under MIT\n// by Someone\n// managed by headache\n"))
+		Expect(changeSet.HeaderRegex.FindString("// Copyright 2018 ACME Labs\n\npackage main")).
+			To(Equal("// Copyright 2018 ACME Labs\n"))
+	})
+
+	It("renders and detects the headers of the holder overrides", func() {
+		holderData := map[string]string{"Holder": "ACME Labs"}
+		configuration := &core.Configuration{
+			HeaderFile:      "some-header",
+			CommentStyle:    "SlashSlash",
+			Includes:        includes,
+			Excludes:        excludes,
+			TemplateData:    holderData,
+			HolderOverrides: map[string]string{"vendor/**/*.go": "Third Party"},
+		}
+		tracker.On("RetrieveVersionedTemplate", configuration).
+			Return(unchangedHeaderContents("Copyright {{.Year}} {{.Holder}}", holderData, revision), nil)
+		versioningClient.On("GetChanges", revision, changeOptions).Return(initialChanges, nil)
+		pathMatcher.On("MatchFiles", initialChanges, includes, excludes, fileSystem).Return(resultingChanges)
+		versioningClient.On("AddMetadata", resultingChanges, clock, historyOptions).Return(resultingChanges, nil)
+
+		changeSet, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+		Expect(err).To(BeNil())
+		Expect(changeSet.HeaderContents).To(Equal("// Copyright {{.YearRange}} ACME Labs"))
+		Expect(changeSet.HolderOverrides).To(HaveLen(1))
+		Expect(changeSet.HolderOverrides[0].Pattern).To(Equal("vendor/**/*.go"))
+		Expect(changeSet.HolderOverrides[0].HeaderContents).To(Equal("// Copyright {{.YearRange}} Third Party"))
+		Expect(changeSet.HeaderRegex.FindString("// Copyright 2018 Third Party\n\npackage lib")).
+			To(Equal("// Copyright 2018 Third Party\n"))
+		Expect(changeSet.HeaderRegex.FindString("// Copyright 2018 ACME Labs\n\npackage main")).
+			To(Equal("// Copyright 2018 ACME Labs\n"))
+	})
+
+	It("forwards the maximum number of files written per run", func() {
+		configuration := &core.Configuration{
+			HeaderFile:   "some-header",
+			CommentStyle: "SlashSlash",
+			Includes:     includes,
+			Excludes:     excludes,
+			TemplateData: data,
+			MaxFiles:     500,
+		}
+		tracker.On("RetrieveVersionedTemplate", configuration).
+			Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}", data, revision), nil)
+		versioningClient.On("GetChanges", revision, changeOptions).Return(initialChanges, nil)
+		pathMatcher.On("MatchFiles", initialChanges, includes, excludes, fileSystem).Return(resultingChanges)
+		versioningClient.On("AddMetadata", resultingChanges, clock, historyOptions).Return(resultingChanges, nil)
+
+		changeSet, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+		Expect(err).To(BeNil())
+		Expect(changeSet.MaxFiles).To(Equal(500))
+	})
+
+	It("forwards the number of leading lines headers are searched in", func() {
+		configuration := &core.Configuration{
+			HeaderFile:        "some-header",
+			CommentStyle:      "SlashSlash",
+			Includes:          includes,
+			Excludes:          excludes,
+			TemplateData:      data,
+			HeaderSearchLines: 10,
+		}
+		tracker.On("RetrieveVersionedTemplate", configuration).
+			Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}", data, revision), nil)
+		versioningClient.On("GetChanges", revision, changeOptions).Return(initialChanges, nil)
+		pathMatcher.On("MatchFiles", initialChanges, includes, excludes, fileSystem).Return(resultingChanges)
+		versioningClient.On("AddMetadata", resultingChanges, clock, historyOptions).Return(resultingChanges, nil)
+
+		changeSet, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+		Expect(err).To(BeNil())
+		Expect(changeSet.HeaderSearchLines).To(Equal(10))
+	})
+
+	It("detects hand edits of headers written with the same template by the last execution", func() {
+		configuration := &core.Configuration{
+			HeaderFile:   "some-header",
+			CommentStyle: "SlashSlash",
+			Includes:     includes,
+			Excludes:     excludes,
+			TemplateData: data,
+			Force:        true,
+		}
+		tracker.On("RetrieveVersionedTemplate", configuration).
+			Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}", data, revision), nil)
+		versioningClient.On("GetChanges", revision, changeOptions).Return(initialChanges, nil)
+		pathMatcher.On("MatchFiles", initialChanges, includes, excludes, fileSystem).Return(resultingChanges)
+		versioningClient.On("AddMetadata", resultingChanges, clock, historyOptions).Return(resultingChanges, nil)
+
+		changeSet, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+		Expect(err).To(BeNil())
+		Expect(changeSet.DetectHandEdits).To(BeTrue())
+		Expect(changeSet.Force).To(BeTrue())
+	})
+
+	It("does not detect hand edits once the template changed", func() {
+		configuration := &core.Configuration{
+			HeaderFile:   "some-header",
+			CommentStyle: "SlashSlash",
+			Includes:     includes,
+			Excludes:     excludes,
+			TemplateData: data,
+		}
+		tracker.On("RetrieveVersionedTemplate", configuration).
+			Return(&core.VersionedHeaderTemplate{
+				Current:  template("Copyright {{.Year}} {{.Owner}}", map[string]string{"Owner": "Someone"}),
+				Revision: revision,
+				Previous: template("Copyright {{.Year}} {{.Owner}}", map[string]string{"Owner": "Someone else"}),
+			}, nil)
+		versioningClient.On("GetChanges", revision, changeOptions).Return(initialChanges, nil)
+		pathMatcher.On("MatchFiles", initialChanges, includes, excludes, fileSystem).Return(resultingChanges)
+		versioningClient.On("AddMetadata", resultingChanges, clock, historyOptions).Return(resultingChanges, nil)
+
+		changeSet, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+		Expect(err).To(BeNil())
+		Expect(changeSet.DetectHandEdits).To(BeFalse())
+	})
+
+	It("expands the year ranges of single years when configured to", func() {
+		configuration := &core.Configuration{
+			HeaderFile:      "some-header",
+			CommentStyle:    "SlashSlash",
+			Includes:        includes,
+			Excludes:        excludes,
+			TemplateData:    data,
+			YearRangeFormat: core.ExpandedYearRangeFormat,
+		}
+		tracker.On("RetrieveVersionedTemplate", configuration).
+			Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}", data, revision), nil)
+		versioningClient.On("GetChanges", revision, changeOptions).Return(initialChanges, nil)
+		pathMatcher.On("MatchFiles", initialChanges, includes, excludes, fileSystem).Return(resultingChanges)
+		versioningClient.On("AddMetadata", resultingChanges, clock, historyOptions).Return(resultingChanges, nil)
+
+		changeSet, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+		Expect(err).To(BeNil())
+		Expect(changeSet.YearRangeFormat).To(Equal(core.ExpandedYearRangeFormat))
+	})
+
+	It("formats headers as configured for their comment style", func() {
+		configuration := &core.Configuration{
+			HeaderFile:   "some-header",
+			CommentStyle: "SlashSlash",
+			Includes:     includes,
+			Excludes:     excludes,
+			TemplateData: data,
+			HeaderFormats: map[string]core.HeaderFormat{
+				"SlashStar":  {BlankLines: true},
+				"SlashSlash": {Padding: 2},
+			},
+		}
+		tracker.On("RetrieveVersionedTemplate", configuration).
+			Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}", data, revision), nil)
+		versioningClient.On("GetChanges", revision, changeOptions).Return(initialChanges, nil)
+		pathMatcher.On("MatchFiles", initialChanges, includes, excludes, fileSystem).Return(resultingChanges)
+		versioningClient.On("AddMetadata", resultingChanges, clock, historyOptions).Return(resultingChanges, nil)
+
+		changeSet, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+		Expect(err).To(BeNil())
+		Expect(changeSet.HeaderContents).To(Equal("//   Copyright {{.YearRange}} ACME Labs"))
+	})
+
+	It("forwards the directory history threshold", func() {
+		configuration := &core.Configuration{
+			HeaderFile:                "some-header",
+			CommentStyle:              "SlashSlash",
+			Includes:                  includes,
+			Excludes:                  excludes,
+			TemplateData:              data,
+			DirectoryHistoryThreshold: 2,
+		}
+		tracker.On("RetrieveVersionedTemplate", configuration).
+			Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}", data, revision), nil)
+		versioningClient.On("GetChanges", revision, changeOptions).Return(initialChanges, nil)
+		pathMatcher.On("MatchFiles", initialChanges, includes, excludes, fileSystem).Return(resultingChanges)
+		versioningClient.On("AddMetadata", resultingChanges, clock, HistoryOptions{MinYear: 1971, MaxYear: 2020, DirectoryHistoryThreshold: 2}).
+			Return(resultingChanges, nil)
+
+		_, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+		Expect(err).To(BeNil())
+	})
+
+	It("forwards the history cutoff date", func() {
+		configuration := &core.Configuration{
+			HeaderFile:   "some-header",
+			CommentStyle: "SlashSlash",
+			Includes:     includes,
+			Excludes:     excludes,
+			TemplateData: data,
+			HistorySince: "2 years ago",
+		}
+		tracker.On("RetrieveVersionedTemplate", configuration).
+			Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}", data, revision), nil)
+		versioningClient.On("GetChanges", revision, changeOptions).Return(initialChanges, nil)
+		pathMatcher.On("MatchFiles", initialChanges, includes, excludes, fileSystem).Return(resultingChanges)
+		versioningClient.On("AddMetadata", resultingChanges, clock, HistoryOptions{MinYear: 1971, MaxYear: 2020, Since: "2 years ago"}).
+			Return(resultingChanges, nil)
+
+		_, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+		Expect(err).To(BeNil())
+	})
+
+	It("forwards the former paths of files", func() {
+		formerPaths := map[string][]string{"hello-world.go": {"hello.go", "legacy/hello.go"}}
+		configuration := &core.Configuration{
+			HeaderFile:   "some-header",
+			CommentStyle: "SlashSlash",
+			Includes:     includes,
+			Excludes:     excludes,
+			TemplateData: data,
+			FormerPaths:  formerPaths,
+		}
+		tracker.On("RetrieveVersionedTemplate", configuration).
+			Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}", data, revision), nil)
+		versioningClient.On("GetChanges", revision, changeOptions).Return(initialChanges, nil)
+		pathMatcher.On("MatchFiles", initialChanges, includes, excludes, fileSystem).Return(resultingChanges)
+		versioningClient.On("AddMetadata", resultingChanges, clock, HistoryOptions{MinYear: 1971, MaxYear: 2020, FormerPaths: formerPaths}).
+			Return(resultingChanges, nil)
+
+		_, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+		Expect(err).To(BeNil())
+	})
+
+	It("forwards the authors whose commits are left out of edition years", func() {
+		configuration := &core.Configuration{
+			HeaderFile:             "some-header",
+			CommentStyle:           "SlashSlash",
+			Includes:               includes,
+			Excludes:               excludes,
+			TemplateData:           data,
+			EditionExcludedAuthors: []string{`\[bot\]$`, "^vendor-sync$"},
+		}
+		tracker.On("RetrieveVersionedTemplate", configuration).
+			Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}", data, revision), nil)
+		versioningClient.On("GetChanges", revision, changeOptions).Return(initialChanges, nil)
+		pathMatcher.On("MatchFiles", initialChanges, includes, excludes, fileSystem).Return(resultingChanges)
+		versioningClient.On("AddMetadata", resultingChanges, clock, mock.MatchedBy(func(options HistoryOptions) bool {
+			excludedAuthors := options.EditionExcludedAuthors
+			return excludedAuthors != nil && excludedAuthors.MatchString("dependabot[bot]") &&
+				excludedAuthors.MatchString("vendor-sync") && !excludedAuthors.MatchString("Jane")
+		})).Return(resultingChanges, nil)
+
+		_, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+		Expect(err).To(BeNil())
+	})
+
+	It("rejects invalid patterns of authors left out of edition years", func() {
+		configuration := &core.Configuration{
+			HeaderFile:             "some-header",
+			CommentStyle:           "SlashSlash",
+			Includes:               includes,
+			Excludes:               excludes,
+			TemplateData:           data,
+			EditionExcludedAuthors: []string{"bot("},
+		}
+		tracker.On("RetrieveVersionedTemplate", configuration).
+			Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}", data, revision), nil)
+		versioningClient.On("GetChanges", revision, changeOptions).Return(initialChanges, nil)
+		pathMatcher.On("MatchFiles", initialChanges, includes, excludes, fileSystem).Return(resultingChanges)
+
+		_, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+		Expect(err).To(MatchError(HavePrefix(`invalid editionExcludedAuthors patterns ["bot("]`)))
+	})
+
+	It("only keeps the files edited since the configured year", func() {
+		configuration := &core.Configuration{
+			HeaderFile:   "some-header",
+			CommentStyle: "SlashSlash",
+			Includes:     includes,
+			Excludes:     excludes,
+			TemplateData: data,
+			SinceYear:    2019,
+		}
+		changes := []FileChange{{Path: "hello-world.go"}, {Path: "goodbye-world.go"}}
+		tracker.On("RetrieveVersionedTemplate", configuration).
+			Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}", data, revision), nil)
+		versioningClient.On("GetChanges", revision, changeOptions).Return(changes, nil)
+		pathMatcher.On("MatchFiles", changes, includes, excludes, fileSystem).Return(changes)
+		versioningClient.On("AddMetadata", changes, clock, historyOptions).Return([]FileChange{
+			{Path: "hello-world.go", CreationYear: 2015, LastEditionYear: 2019},
+			{Path: "goodbye-world.go", CreationYear: 2015, LastEditionYear: 2018},
+		}, nil)
+
+		changeSet, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+		Expect(err).To(BeNil())
+		Expect(changeSet.Files).To(Equal([]FileChange{{Path: "hello-world.go", CreationYear: 2015, LastEditionYear: 2019}}))
+	})
+
+	It("bounds last edition years to the changes since the last execution when asked to", func() {
+		configuration := &core.Configuration{
+			HeaderFile:        "some-header",
+			CommentStyle:      "SlashSlash",
+			Includes:          includes,
+			Excludes:          excludes,
+			TemplateData:      data,
+			RangeEditionYears: true,
+		}
+		tracker.On("RetrieveVersionedTemplate", configuration).
+			Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}", data, revision), nil)
+		versioningClient.On("GetChanges", revision, changeOptions).Return(initialChanges, nil)
+		pathMatcher.On("MatchFiles", initialChanges, includes, excludes, fileSystem).Return(resultingChanges)
+		versioningClient.On("AddMetadata", resultingChanges, clock, HistoryOptions{MinYear: 1971, MaxYear: 2020, EditionRevision: revision}).
+			Return(resultingChanges, nil)
+
+		_, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+		Expect(err).To(BeNil())
+	})
+
+	It("keeps the edition years of files unchanged since the last execution when asked to", func() {
+		configuration := &core.Configuration{
+			HeaderFile:                "some-header",
+			CommentStyle:              "SlashSlash",
+			Includes:                  includes,
+			Excludes:                  excludes,
+			TemplateData:              data,
+			KeepUnchangedEditionYears: true,
+		}
+		tracker.On("RetrieveVersionedTemplate", configuration).
+			Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}", data, revision), nil)
+		versioningClient.On("GetChanges", revision, changeOptions).Return(initialChanges, nil)
+		pathMatcher.On("MatchFiles", initialChanges, includes, excludes, fileSystem).Return(resultingChanges)
+		versioningClient.On("AddMetadata", resultingChanges, clock, HistoryOptions{MinYear: 1971, MaxYear: 2020, ReferenceRevision: revision}).
+			Return(resultingChanges, nil)
+
+		_, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+		Expect(err).To(BeNil())
+	})
+
+	It("classifies files whose only change since the last execution is their header", func() {
+		configuration := &core.Configuration{
+			HeaderFile:               "some-header",
+			CommentStyle:             "SlashSlash",
+			Includes:                 includes,
+			Excludes:                 excludes,
+			TemplateData:             data,
+			ExcludeHeaderOnlyChanges: true,
+		}
+		vcs := new(vcs_mocks.Vcs)
+		matchedChanges := []FileChange{{Path: "header-only.go"}, {Path: "modified.go"}, {Path: "added.go"}}
+		contentChanges := []FileChange{{Path: "modified.go"}, {Path: "added.go"}}
+		tracker.On("RetrieveVersionedTemplate", configuration).
+			Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}", data, revision), nil)
+		versioningClient.On("GetChanges", revision, changeOptions).Return(initialChanges, nil)
+		pathMatcher.On("MatchFiles", initialChanges, includes, excludes, fileSystem).Return(matchedChanges)
+		versioningClient.On("GetClient").Return(vcs)
+		fileReader.On("Read", "header-only.go").Return([]byte("// Copyright 2018-2019 ACME Labs\n\npackage foo"), nil)
+		vcs.On("ShowContentAtRevision", "header-only.go", revision).Return("// Copyright 2018 ACME Labs\n\npackage foo", nil)
+		fileReader.On("Read", "modified.go").Return([]byte("// Copyright 2018-2019 ACME Labs\n\npackage bar"), nil)
+		vcs.On("ShowContentAtRevision", "modified.go", revision).Return("// Copyright 2018 ACME Labs\n\npackage foo", nil)
+		fileReader.On("Read", "added.go").Return([]byte("package baz"), nil)
+		vcs.On("ShowContentAtRevision", "added.go", revision).Return("", &GitError{
+			Args:     []string{"cat-file", "-p", revision + ":added.go"},
+			ExitCode: 128,
+			Stderr:   "fatal: path 'added.go' does not exist in '" + revision + "'",
+		})
+		versioningClient.On("AddMetadata", contentChanges, clock, historyOptions).Return(contentChanges, nil)
+
+		changeSet, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+		Expect(err).To(BeNil())
+		Expect(changeSet.Files).To(Equal(contentChanges))
+		Expect(changeSet.HeaderOnlyFiles).To(Equal([]FileChange{{Path: "header-only.go"}}))
+		vcs.AssertExpectations(t)
+	})
+
+	It("fails if the contents of a changed file cannot be shown at the last execution revision", func() {
+		configuration := &core.Configuration{
+			HeaderFile:               "some-header",
+			CommentStyle:             "SlashSlash",
+			Includes:                 includes,
+			Excludes:                 excludes,
+			TemplateData:             data,
+			ExcludeHeaderOnlyChanges: true,
+		}
+		vcs := new(vcs_mocks.Vcs)
+		showError := errors.New("show error")
+		tracker.On("RetrieveVersionedTemplate", configuration).
+			Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}", data, revision), nil)
+		versioningClient.On("GetChanges", revision, changeOptions).Return(initialChanges, nil)
+		pathMatcher.On("MatchFiles", initialChanges, includes, excludes, fileSystem).Return([]FileChange{{Path: "modified.go"}})
+		versioningClient.On("GetClient").Return(vcs)
+		fileReader.On("Read", "modified.go").Return([]byte("package bar"), nil)
+		vcs.On("ShowContentAtRevision", "modified.go", revision).Return("", showError)
+		clock.ExpectedCalls = nil
+
+		_, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+		Expect(err).To(MatchError(showError))
+		vcs.AssertExpectations(t)
+	})
+
+	It("classifies files of nested repositories whose only change is their header from their own repository", func() {
+		configuration := &core.Configuration{
+			HeaderFile:               "some-header",
+			CommentStyle:             "SlashSlash",
+			Includes:                 includes,
+			Excludes:                 excludes,
+			TemplateData:             data,
+			VcsRoots:                 []string{"vendor/lib"},
+			ExcludeHeaderOnlyChanges: true,
+		}
+		mainVcs := new(vcs_mocks.Vcs)
+		nestedVcs := new(vcs_mocks.Vcs)
+		nestedClient := new(vcs_mocks.VersioningClient)
+		systemConfiguration.NestedVersioningClient = func(root string) VersioningClient {
+			return nestedClient
+		}
+		matchedChanges := []FileChange{{Path: "vendor/lib/lib.go"}}
+		tracker.On("RetrieveVersionedTemplate", configuration).
+			Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}", data, revision), nil)
+		versioningClient.On("GetChanges", revision, changeOptions).Return([]FileChange{}, nil)
+		versioningClient.On("GetClient").Return(mainVcs)
+		mainVcs.On("Log", "-1", "--format=%ct", revision).Return("1551657600\n", nil)
+		nestedClient.On("GetClient").Return(nestedVcs)
+		nestedVcs.On("Log", "-1", "--format=%H", "--before=1551657600").Return("deadbeef\n", nil)
+		nestedClient.On("GetChanges", "deadbeef", changeOptions).Return([]FileChange{{Path: "lib.go"}}, nil)
+		pathMatcher.On("MatchFiles", matchedChanges, includes, excludes, fileSystem).Return(matchedChanges)
+		fileReader.On("Read", "vendor/lib/lib.go").Return([]byte("// Copyright 2018-2019 ACME Labs\n\npackage lib"), nil)
+		nestedVcs.On("ShowContentAtRevision", "lib.go", "deadbeef").Return("// Copyright 2018 ACME Labs\n\npackage lib", nil)
+		clock.ExpectedCalls = nil
+
+		changeSet, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+		Expect(err).To(BeNil())
+		Expect(changeSet.Files).To(BeEmpty())
+		Expect(changeSet.HeaderOnlyFiles).To(Equal(matchedChanges))
+		mainVcs.AssertExpectations(t)
+		nestedVcs.AssertExpectations(t)
+	})
+
+	It("excludes files ignored by the ignore file", func() {
+		configuration := &core.Configuration{
+			HeaderFile:   "some-header",
+			CommentStyle: "SlashSlash",
+			Includes:     includes,
+			Excludes:     excludes,
+			TemplateData: data,
+		}
+		matchedChanges := []FileChange{{Path: "vendor/lib.go"}, {Path: "main.go"}}
+		ignoreFileRead.Return([]byte("vendor/"), nil)
+		tracker.On("RetrieveVersionedTemplate", configuration).
+			Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}", data, revision), nil)
+		versioningClient.On("GetChanges", revision, changeOptions).Return(initialChanges, nil)
+		pathMatcher.On("MatchFiles", initialChanges, includes, excludes, fileSystem).Return(matchedChanges)
+		versioningClient.On("AddMetadata", []FileChange{{Path: "main.go"}}, clock, historyOptions).
+			Return([]FileChange{{Path: "main.go"}}, nil)
+
+		changeSet, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+		Expect(err).To(BeNil())
+		Expect(changeSet.Files).To(Equal([]FileChange{{Path: "main.go"}}))
+	})
+
+	It("excludes legal files", func() {
+		configuration := &core.Configuration{
+			HeaderFile:   "some-header",
+			CommentStyle: "SlashSlash",
+			Includes:     includes,
+			Excludes:     excludes,
+			TemplateData: data,
+			LegalFiles:   []string{"AUTHORS", "!README.go"},
+		}
+		matchedChanges := []FileChange{{Path: "LICENSE"}, {Path: "AUTHORS"}, {Path: "README.go"}, {Path: "main.go"}}
+		tracker.On("RetrieveVersionedTemplate", configuration).
+			Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}", data, revision), nil)
+		versioningClient.On("GetChanges", revision, changeOptions).Return(initialChanges, nil)
+		pathMatcher.On("MatchFiles", initialChanges, includes, excludes, fileSystem).Return(matchedChanges)
+		versioningClient.On("AddMetadata", []FileChange{{Path: "README.go"}, {Path: "main.go"}}, clock, historyOptions).
+			Return([]FileChange{{Path: "README.go"}, {Path: "main.go"}}, nil)
+
+		changeSet, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+		Expect(err).To(BeNil())
+		Expect(changeSet.Files).To(Equal([]FileChange{{Path: "README.go"}, {Path: "main.go"}}))
+	})
+
+	Describe("without previous execution", func() {
+
+		var (
+			configuration *core.Configuration
+			vcs           *vcs_mocks.Vcs
+		)
+
+		BeforeEach(func() {
+			configuration = &core.Configuration{
+				HeaderFile:   "some-header",
+				CommentStyle: "SlashSlash",
+				Includes:     includes,
+				Excludes:     excludes,
+				TemplateData: data,
+				BaseBranch:   "origin/master",
+			}
+			vcs = new(vcs_mocks.Vcs)
+			versioningClient.On("GetClient").Return(vcs)
+			tracker.On("RetrieveVersionedTemplate", configuration).
+				Return(unchangedHeaderContents("Copyright {{.Year}} {{.Owner}}", data, ""), nil)
+		})
+
+		AfterEach(func() {
+			vcs.AssertExpectations(t)
+		})
+
+		It("scans changes since the merge base with the base branch when HEAD is detached", func() {
+			vcs.On("IsDetachedHead").Return(true, nil)
+			vcs.On("MergeBase", "origin/master").Return("cafebabe", nil)
+			versioningClient.On("GetChanges", "cafebabe", changeOptions).Return(initialChanges, nil)
+			pathMatcher.On("MatchFiles", initialChanges, includes, excludes, fileSystem).Return(resultingChanges)
+			versioningClient.On("AddMetadata", resultingChanges, clock, historyOptions).Return(resultingChanges, nil)
+
+			changeSet, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+			Expect(err).To(BeNil())
+			Expect(changeSet.Files).To(Equal(resultingChanges))
+		})
+
+		It("scans changes since the base revision when HEAD is detached", func() {
+			configuration.BaseRevision = "v1.0.0"
+			vcs.On("IsDetachedHead").Return(true, nil)
+			versioningClient.On("GetChanges", "v1.0.0", changeOptions).Return(initialChanges, nil)
+			pathMatcher.On("MatchFiles", initialChanges, includes, excludes, fileSystem).Return(resultingChanges)
+			versioningClient.On("AddMetadata", resultingChanges, clock, historyOptions).Return(resultingChanges, nil)
+
+			changeSet, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+			Expect(err).To(BeNil())
+			Expect(changeSet.Files).To(Equal(resultingChanges))
+		})
+
+		It("triggers a full scan when HEAD is attached", func() {
+			vcs.On("IsDetachedHead").Return(false, nil)
+			pathMatcher.On("ScanAllFiles", includes, excludes, fileSystem).Return(resultingChanges, nil)
+			versioningClient.On("AddMetadata", resultingChanges, clock, historyOptions).Return(resultingChanges, nil)
+
+			changeSet, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+			Expect(err).To(BeNil())
+			Expect(changeSet.Files).To(Equal(resultingChanges))
+		})
+
+		It("fails with a clear message when the base branch cannot be found", func() {
+			fileReader.ExpectedCalls = nil
+			clock.ExpectedCalls = nil
+			vcs.On("IsDetachedHead").Return(true, nil)
+			vcs.On("MergeBase", "origin/master").Return("", &GitError{
+				Args:     []string{"merge-base", "HEAD", "origin/master"},
+				ExitCode: 128,
+				Stderr:   "fatal: Not a valid object name origin/master",
+			})
+
+			_, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+			Expect(err).To(MatchError("HEAD is detached and its merge base with base branch origin/master cannot be found, is the branch fetched?\n\t" +
+				"git merge-base HEAD origin/master failed with exit code 128\n\tfatal: Not a valid object name origin/master"))
+		})
+
+		It("scans changes since the merge base with the tracked branch when HEAD is attached and asked to", func() {
+			configuration.BaseBranch = ""
+			configuration.UpstreamBase = true
+			vcs.On("IsDetachedHead").Return(false, nil)
+			vcs.On("CurrentRef").Return("upstream", "main", nil)
+			vcs.On("MergeBase", "upstream/main").Return("cafebabe", nil)
+			versioningClient.On("GetChanges", "cafebabe", changeOptions).Return(initialChanges, nil)
+			pathMatcher.On("MatchFiles", initialChanges, includes, excludes, fileSystem).Return(resultingChanges)
+			versioningClient.On("AddMetadata", resultingChanges, clock, historyOptions).Return(resultingChanges, nil)
+
+			changeSet, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+			Expect(err).To(BeNil())
+			Expect(changeSet.Files).To(Equal(resultingChanges))
+		})
+
+		It("triggers a full scan when the current branch does not track any branch", func() {
+			configuration.BaseBranch = ""
+			configuration.UpstreamBase = true
+			vcs.On("IsDetachedHead").Return(false, nil)
+			vcs.On("CurrentRef").Return("", "", nil)
+			pathMatcher.On("ScanAllFiles", includes, excludes, fileSystem).Return(resultingChanges, nil)
+			versioningClient.On("AddMetadata", resultingChanges, clock, historyOptions).Return(resultingChanges, nil)
+
+			changeSet, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+			Expect(err).To(BeNil())
+			Expect(changeSet.Files).To(Equal(resultingChanges))
+		})
+
+		It("scans changes since the merge base with the target branch of GitHub pull requests when asked to", func() {
+			configuration.BaseBranch = ""
+			configuration.CiBase = true
+			systemConfiguration.Environment = environment(map[string]string{"GITHUB_BASE_REF": "main"})
+			vcs.On("IsDetachedHead").Return(true, nil)
+			vcs.On("MergeBase", "origin/main").Return("cafebabe", nil)
+			versioningClient.On("GetChanges", "cafebabe", changeOptions).Return(initialChanges, nil)
+			pathMatcher.On("MatchFiles", initialChanges, includes, excludes, fileSystem).Return(resultingChanges)
+			versioningClient.On("AddMetadata", resultingChanges, clock, historyOptions).Return(resultingChanges, nil)
+
+			changeSet, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+			Expect(err).To(BeNil())
+			Expect(changeSet.Files).To(Equal(resultingChanges))
+			Expect(configuration.BaseBranch).To(BeEmpty(), "the given configuration is left untouched")
+		})
+
+		It("scans changes since the diff base of GitLab merge requests when asked to", func() {
+			configuration.BaseBranch = ""
+			configuration.CiBase = true
+			systemConfiguration.Environment = environment(map[string]string{
+				"CI_MERGE_REQUEST_DIFF_BASE_SHA":      "cafebabe",
+				"CI_MERGE_REQUEST_TARGET_BRANCH_SHA":  "deadbeef",
+				"CI_MERGE_REQUEST_TARGET_BRANCH_NAME": "main",
+			})
+			vcs.On("IsDetachedHead").Return(true, nil)
+			versioningClient.On("GetChanges", "cafebabe", changeOptions).Return(initialChanges, nil)
+			pathMatcher.On("MatchFiles", initialChanges, includes, excludes, fileSystem).Return(resultingChanges)
+			versioningClient.On("AddMetadata", resultingChanges, clock, historyOptions).Return(resultingChanges, nil)
+
+			changeSet, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+			Expect(err).To(BeNil())
+			Expect(changeSet.Files).To(Equal(resultingChanges))
+		})
+
+		It("scans changes since the target branch tip of GitLab merged results pipelines when asked to", func() {
+			configuration.BaseBranch = ""
+			configuration.CiBase = true
+			systemConfiguration.Environment = environment(map[string]string{
+				"CI_MERGE_REQUEST_TARGET_BRANCH_SHA":  "deadbeef",
+				"CI_MERGE_REQUEST_TARGET_BRANCH_NAME": "main",
+			})
+			vcs.On("IsDetachedHead").Return(true, nil)
+			versioningClient.On("GetChanges", "deadbeef", changeOptions).Return(initialChanges, nil)
+			pathMatcher.On("MatchFiles", initialChanges, includes, excludes, fileSystem).Return(resultingChanges)
+			versioningClient.On("AddMetadata", resultingChanges, clock, historyOptions).Return(resultingChanges, nil)
+
+			changeSet, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+			Expect(err).To(BeNil())
+			Expect(changeSet.Files).To(Equal(resultingChanges))
+		})
+
+		It("scans changes since the merge base with the target branch of GitLab merge requests when asked to", func() {
+			configuration.BaseBranch = ""
+			configuration.CiBase = true
+			systemConfiguration.Environment = environment(map[string]string{"CI_MERGE_REQUEST_TARGET_BRANCH_NAME": "main"})
+			vcs.On("IsDetachedHead").Return(true, nil)
+			vcs.On("MergeBase", "origin/main").Return("cafebabe", nil)
+			versioningClient.On("GetChanges", "cafebabe", changeOptions).Return(initialChanges, nil)
+			pathMatcher.On("MatchFiles", initialChanges, includes, excludes, fileSystem).Return(resultingChanges)
+			versioningClient.On("AddMetadata", resultingChanges, clock, historyOptions).Return(resultingChanges, nil)
+
+			changeSet, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+			Expect(err).To(BeNil())
+			Expect(changeSet.Files).To(Equal(resultingChanges))
+		})
+
+		It("prefers the configured base over the one of the CI environment", func() {
+			configuration.CiBase = true
+			systemConfiguration.Environment = environment(map[string]string{
+				"GITHUB_BASE_REF":                "main",
+				"CI_MERGE_REQUEST_DIFF_BASE_SHA": "deadbeef",
+			})
+			vcs.On("IsDetachedHead").Return(true, nil)
+			vcs.On("MergeBase", "origin/master").Return("cafebabe", nil)
+			versioningClient.On("GetChanges", "cafebabe", changeOptions).Return(initialChanges, nil)
+			pathMatcher.On("MatchFiles", initialChanges, includes, excludes, fileSystem).Return(resultingChanges)
+			versioningClient.On("AddMetadata", resultingChanges, clock, historyOptions).Return(resultingChanges, nil)
+
+			changeSet, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+			Expect(err).To(BeNil())
+			Expect(changeSet.Files).To(Equal(resultingChanges))
+		})
+
+		It("ignores the base of the CI environment unless asked to", func() {
+			configuration.BaseBranch = ""
+			systemConfiguration.Environment = environment(map[string]string{"GITHUB_BASE_REF": "main"})
+			pathMatcher.On("ScanAllFiles", includes, excludes, fileSystem).Return(resultingChanges, nil)
+			versioningClient.On("AddMetadata", resultingChanges, clock, historyOptions).Return(resultingChanges, nil)
+
+			changeSet, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+			Expect(err).To(BeNil())
+			Expect(changeSet.Files).To(Equal(resultingChanges))
+		})
+
+		It("triggers a full scan outside pull and merge request pipelines", func() {
+			configuration.BaseBranch = ""
+			configuration.CiBase = true
+			systemConfiguration.Environment = environment(map[string]string{})
+			pathMatcher.On("ScanAllFiles", includes, excludes, fileSystem).Return(resultingChanges, nil)
+			versioningClient.On("AddMetadata", resultingChanges, clock, historyOptions).Return(resultingChanges, nil)
+
+			changeSet, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
+
+			Expect(err).To(BeNil())
+			Expect(changeSet.Files).To(Equal(resultingChanges))
+		})
+	})
+
 	It("computes the header regex based on previous configuration", func() {
 		configuration := &core.Configuration{
 			HeaderFile:   "some-header",
@@ -198,7 +1735,7 @@ var _ = Describe("Configuration parser", func() {
 				Previous: template("{{.Notice}} - old\nheader", map[string]string{"Notice": "Redding"}),
 			}, nil)
 		pathMatcher.On("ScanAllFiles", includes, excludes, fileSystem).Return(resultingChanges, nil)
-		versioningClient.On("AddMetadata", resultingChanges, clock).Return(resultingChanges, nil)
+		versioningClient.On("AddMetadata", resultingChanges, clock, historyOptions).Return(resultingChanges, nil)
 
 		changeSet, err := core.ParseConfiguration(configuration, systemConfiguration, tracker, pathMatcher)
 
@@ -235,3 +1772,10 @@ func onlyPaths(changes []FileChange) []FileChange {
 	}
 	return result
 }
+
+// returns a lookup of the given environment variables, the others being unset
+func environment(variables map[string]string) func(string) string {
+	return func(key string) string {
+		return variables[key]
+	}
+}
@@ -33,7 +33,15 @@ type JsonSchemaValidator struct {
 }
 
 func (validator *JsonSchemaValidator) Validate(path string) error {
-	documentLoader := json.NewReferenceLoaderFileSystem(path, validator.FileReader)
+	return validator.validate(json.NewReferenceLoaderFileSystem(path, validator.FileReader))
+}
+
+// ValidatePayload validates an in-memory JSON document
+func (validator *JsonSchemaValidator) ValidatePayload(payload []byte) error {
+	return validator.validate(json.NewBytesLoader(payload))
+}
+
+func (validator *JsonSchemaValidator) validate(documentLoader json.JSONLoader) error {
 	result, err := validator.Schema.Validate(documentLoader)
 	if err != nil {
 		return err
@@ -58,7 +66,7 @@ func report(errors []json.ResultError) string {
 }
 
 func description(field interface{}, validationError json.ResultError) string {
-	for _, name := range []string{"Year", "YearRange", "StartYear", "EndYear"} {
+	for _, name := range []string{"Year", "YearRange", "StartYear", "EndYear", "CreationDate", "LastEditionDate", "Path"} {
 		if field == fmt.Sprintf("data.%s", name) {
 			return fmt.Sprintf("%s is a reserved data parameter and cannot be used", name)
 		}
@@ -155,6 +155,36 @@ var _ = Describe("Configuration validator", func() {
 		Expect(validationError.Error()).To(HaveSuffix("EndYear is a reserved data parameter and cannot be used"))
 	})
 
+	It("rejects configuration with reserved last edition date parameter", func() {
+		fileReader.On("Open", "docs.json").
+			Return(inMemoryFile(`{"headerFile": "some-header.txt", "style": "SlashSlash", "includes": ["**/*.*"], "data": {"LastEditionDate": "2019-01-01"}}`), nil)
+
+		validationError := validator.Validate("file://docs.json")
+
+		Expect(validationError.Error()).To(HaveSuffix("LastEditionDate is a reserved data parameter and cannot be used"))
+	})
+
+	It("rejects configuration with reserved path parameter", func() {
+		fileReader.On("Open", "docs.json").
+			Return(inMemoryFile(`{"headerFile": "some-header.txt", "style": "SlashSlash", "includes": ["**/*.*"], "data": {"Path": "foo"}}`), nil)
+
+		validationError := validator.Validate("file://docs.json")
+
+		Expect(validationError.Error()).To(HaveSuffix("Path is a reserved data parameter and cannot be used"))
+	})
+
+	It("validates in-memory configuration", func() {
+		validationError := validator.ValidatePayload([]byte(`{"headerFile": "some-header.txt", "headerChecksum": "abc", "style": "SlashSlash", "includes": ["**/*.*"]}`))
+
+		Expect(validationError.Error()).To(HavePrefix("Error with field 'headerChecksum'"))
+	})
+
+	It("accepts the names of comment styles registered by embedding programs", func() {
+		validationError := validator.ValidatePayload([]byte(`{"headerFile": "some-header.txt", "style": "SemiColons", "includes": ["**/*.lisp"]}`))
+
+		Expect(validationError).To(BeNil())
+	})
+
 })
 
 func schemaFrom(loader json.JSONLoader) *json.Schema {
@@ -0,0 +1,66 @@
+/*
+ * Copyright 2018 Florent Biville (@fbiville)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type Answer int
+
+const (
+	No  Answer = iota // the file is left untouched
+	Yes               // the file is written
+	All               // the file and all the subsequent ones are written without asking again
+)
+
+// Confirmer decides whether the planned header change of a file is written
+type Confirmer interface {
+	Confirm(path string, reason UpdateReason) (Answer, error)
+}
+
+// PromptConfirmer asks for each file, answers being read line by line
+type PromptConfirmer struct {
+	reader *bufio.Reader
+	writer io.Writer
+}
+
+func NewPromptConfirmer(reader io.Reader, writer io.Writer) *PromptConfirmer {
+	return &PromptConfirmer{reader: bufio.NewReader(reader), writer: writer}
+}
+
+// Confirm prints the planned change and reads the answer, anything but yes or all declining the change
+func (confirmer *PromptConfirmer) Confirm(path string, reason UpdateReason) (Answer, error) {
+	if _, err := fmt.Fprintf(confirmer.writer, "Update the header of %s (%s)? [y/n/a] ", path, reason); err != nil {
+		return No, err
+	}
+	line, err := confirmer.reader.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return No, err
+	}
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return Yes, nil
+	case "a", "all":
+		return All, nil
+	default:
+		return No, nil
+	}
+}
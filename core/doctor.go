@@ -0,0 +1,197 @@
+/*
+ * Copyright 2018 Florent Biville (@fbiville)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"fmt"
+	"github.com/fbiville/headache/vcs"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CheckStatus is the outcome of an environment check
+type CheckStatus string
+
+const (
+	CheckPassed  CheckStatus = "pass"
+	CheckWarning CheckStatus = "warn"
+	CheckFailed  CheckStatus = "fail"
+)
+
+// EnvironmentCheck is the outcome of one of the checks run by Doctor, along with the message explaining it
+type EnvironmentCheck struct {
+	Name    string
+	Status  CheckStatus
+	Message string
+}
+
+// the upstream remote name format of git for-each-ref appeared in git 2.16
+var minimumGitVersion = []int{2, 16}
+
+// Doctor checks that headache can run in the current environment with the given configuration
+// warnings point at setups headache runs in but produces less accurate headers with
+func Doctor(config *Configuration, system *SystemConfiguration) []EnvironmentCheck {
+	versioning := system.VersioningClient.GetClient()
+	return []EnvironmentCheck{
+		checkGitVersion(versioning),
+		checkHistoryDepth(versioning),
+		checkBase(config, versioning, system.Environment),
+		checkHeaderFile(config, system),
+		checkCommentStyle(config),
+	}
+}
+
+// IsHealthy returns whether none of the given checks failed
+func IsHealthy(checks []EnvironmentCheck) bool {
+	for _, check := range checks {
+		if check.Status == CheckFailed {
+			return false
+		}
+	}
+	return true
+}
+
+func checkGitVersion(versioning vcs.Vcs) EnvironmentCheck {
+	name := "git version"
+	version, err := versioning.Version()
+	if err != nil {
+		return failedCheck(name, err)
+	}
+	minimumVersion := joinVersion(minimumGitVersion)
+	if !isVersionAtLeast(version, minimumGitVersion) {
+		return EnvironmentCheck{
+			Name:    name,
+			Status:  CheckFailed,
+			Message: fmt.Sprintf("git %s is installed, headache requires git %s or later", version, minimumVersion),
+		}
+	}
+	return EnvironmentCheck{Name: name, Status: CheckPassed, Message: fmt.Sprintf("git %s is installed", version)}
+}
+
+func checkHistoryDepth(versioning vcs.Vcs) EnvironmentCheck {
+	name := "history depth"
+	shallow, err := versioning.IsShallow()
+	if err != nil {
+		return failedCheck(name, err)
+	}
+	if shallow {
+		return EnvironmentCheck{
+			Name:   name,
+			Status: CheckWarning,
+			Message: "the repository is a shallow clone, creation years may be too recent, " +
+				"run git fetch --unshallow to retrieve its full history",
+		}
+	}
+	return EnvironmentCheck{Name: name, Status: CheckPassed, Message: "the full history of the repository is available"}
+}
+
+func checkBase(config *Configuration, versioning vcs.Vcs, environment func(string) string) EnvironmentCheck {
+	name := "base revision"
+	var err error
+	if requiresCiBase(config) {
+		config = withCiBase(config, environment)
+	}
+	if requiresDefaultBaseBranch(config) {
+		config, err = withDefaultBaseBranch(config, versioning)
+		if err != nil {
+			return failedCheck(name, err)
+		}
+	}
+	if config.BaseRevision != "" {
+		if _, err := versioning.Log("-1", "--format=%H", config.BaseRevision, "--"); err != nil {
+			return failedCheck(name, fmt.Errorf("base revision %s cannot be resolved\n\t%v", config.BaseRevision, err))
+		}
+		return EnvironmentCheck{Name: name, Status: CheckPassed, Message: fmt.Sprintf("base revision %s resolves", config.BaseRevision)}
+	}
+	if config.BaseBranch != "" {
+		mergeBase, err := versioning.MergeBase(config.BaseBranch)
+		if err != nil {
+			return failedCheck(name, fmt.Errorf("merge base with base branch %s cannot be found, is the branch fetched?\n\t%v", config.BaseBranch, err))
+		}
+		return EnvironmentCheck{
+			Name:    name,
+			Status:  CheckPassed,
+			Message: fmt.Sprintf("merge base %s with base branch %s resolves", mergeBase, config.BaseBranch),
+		}
+	}
+	return EnvironmentCheck{Name: name, Status: CheckPassed, Message: "no base revision nor base branch is configured"}
+}
+
+func checkHeaderFile(config *Configuration, system *SystemConfiguration) EnvironmentCheck {
+	name := "header file"
+	if config.HeaderFile == "" {
+		return EnvironmentCheck{Name: name, Status: CheckFailed, Message: "no header file is configured"}
+	}
+	headerBytes, err := system.FileSystem.FileReader.Read(config.HeaderFile)
+	if err != nil {
+		return failedCheck(name, fmt.Errorf("header file %s cannot be read\n\t%v", config.HeaderFile, err))
+	}
+	if err := verifyChecksum(config.HeaderFile, headerBytes, config.HeaderChecksum); err != nil {
+		return failedCheck(name, err)
+	}
+	return EnvironmentCheck{Name: name, Status: CheckPassed, Message: fmt.Sprintf("header file %s is readable", config.HeaderFile)}
+}
+
+func checkCommentStyle(config *Configuration) EnvironmentCheck {
+	name := "comment style"
+	styles := supportedStyles()
+	if _, found := styles[config.CommentStyle]; !found {
+		names := extractKeys(styles)
+		sort.Strings(names)
+		return EnvironmentCheck{
+			Name:    name,
+			Status:  CheckFailed,
+			Message: fmt.Sprintf("comment style %q is unknown, must be one of: %s", config.CommentStyle, strings.Join(names, ",")),
+		}
+	}
+	return EnvironmentCheck{Name: name, Status: CheckPassed, Message: fmt.Sprintf("comment style %s is known", config.CommentStyle)}
+}
+
+func failedCheck(name string, err error) EnvironmentCheck {
+	return EnvironmentCheck{Name: name, Status: CheckFailed, Message: err.Error()}
+}
+
+// compares the leading numeric components of the version, e.g. 2.39 in 2.39.2.windows.1 or 2.24.3 (Apple Git-128)
+func isVersionAtLeast(version string, minimum []int) bool {
+	fields := strings.Fields(version)
+	if len(fields) == 0 {
+		return false
+	}
+	components := strings.Split(fields[0], ".")
+	for i, expected := range minimum {
+		if i >= len(components) {
+			return false
+		}
+		actual, err := strconv.Atoi(components[i])
+		if err != nil {
+			return false
+		}
+		if actual != expected {
+			return actual > expected
+		}
+	}
+	return true
+}
+
+func joinVersion(version []int) string {
+	result := make([]string, len(version))
+	for i, component := range version {
+		result[i] = strconv.Itoa(component)
+	}
+	return strings.Join(result, ".")
+}
@@ -0,0 +1,183 @@
+/*
+ * Copyright 2018 Florent Biville (@fbiville)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core_test
+
+import (
+	"errors"
+	. "github.com/fbiville/headache/core"
+	"github.com/fbiville/headache/fs"
+	"github.com/fbiville/headache/fs_mocks"
+	"github.com/fbiville/headache/vcs"
+	"github.com/fbiville/headache/vcs_mocks"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"os"
+)
+
+var _ = Describe("Doctor", func() {
+
+	var (
+		t                GinkgoTInterface
+		versioning       *vcs_mocks.Vcs
+		versioningClient *vcs_mocks.VersioningClient
+		fileReader       *fs_mocks.FileReader
+		configuration    *Configuration
+		system           *SystemConfiguration
+	)
+
+	BeforeEach(func() {
+		t = GinkgoT()
+		versioning = new(vcs_mocks.Vcs)
+		versioningClient = new(vcs_mocks.VersioningClient)
+		versioningClient.On("GetClient").Return(versioning)
+		fileReader = new(fs_mocks.FileReader)
+		configuration = &Configuration{
+			HeaderFile:   "header.txt",
+			CommentStyle: "SlashSlash",
+			BaseBranch:   "origin/main",
+		}
+		system = &SystemConfiguration{
+			FileSystem:       &fs.FileSystem{FileReader: fileReader},
+			VersioningClient: versioningClient,
+		}
+	})
+
+	AfterEach(func() {
+		versioning.AssertExpectations(t)
+		fileReader.AssertExpectations(t)
+	})
+
+	It("passes all checks in a healthy environment", func() {
+		versioning.On("Version").Return("2.39.2", nil)
+		versioning.On("IsShallow").Return(false, nil)
+		versioning.On("MergeBase", "origin/main").Return("cafebabe", nil)
+		fileReader.On("Read", "header.txt").Return([]byte("Copyright {{.Year}} ACME"), nil)
+
+		checks := Doctor(configuration, system)
+
+		Expect(checks).To(Equal([]EnvironmentCheck{
+			{Name: "git version", Status: CheckPassed, Message: "git 2.39.2 is installed"},
+			{Name: "history depth", Status: CheckPassed, Message: "the full history of the repository is available"},
+			{Name: "base revision", Status: CheckPassed, Message: "merge base cafebabe with base branch origin/main resolves"},
+			{Name: "header file", Status: CheckPassed, Message: "header file header.txt is readable"},
+			{Name: "comment style", Status: CheckPassed, Message: "comment style SlashSlash is known"},
+		}))
+		Expect(IsHealthy(checks)).To(BeTrue())
+	})
+
+	It("only warns about shallow clones", func() {
+		versioning.On("Version").Return("2.24.3 (Apple Git-128)", nil)
+		versioning.On("IsShallow").Return(true, nil)
+		versioning.On("MergeBase", "origin/main").Return("cafebabe", nil)
+		fileReader.On("Read", "header.txt").Return([]byte("Copyright {{.Year}} ACME"), nil)
+
+		checks := Doctor(configuration, system)
+
+		Expect(checks[0].Status).To(Equal(CheckPassed))
+		Expect(checks[1].Name).To(Equal("history depth"))
+		Expect(checks[1].Status).To(Equal(CheckWarning))
+		Expect(checks[1].Message).To(ContainSubstring("git fetch --unshallow"))
+		Expect(IsHealthy(checks)).To(BeTrue())
+	})
+
+	It("reports every failing condition", func() {
+		configuration.BaseBranch = ""
+		configuration.BaseRevision = "v1.0.0"
+		configuration.CommentStyle = "Semicolons"
+		versioning.On("Version").Return("", vcs.ErrVcsNotInstalled)
+		versioning.On("IsShallow").Return(false, vcs.ErrVcsNotInstalled)
+		versioning.On("Log", "-1", "--format=%H", "v1.0.0", "--").Return("", vcs.ErrBadRevision)
+		fileReader.On("Read", "header.txt").Return(nil, os.ErrNotExist)
+
+		checks := Doctor(configuration, system)
+
+		Expect(checks).To(HaveLen(5))
+		for _, check := range checks {
+			Expect(check.Status).To(Equal(CheckFailed), check.Name)
+		}
+		Expect(checks[0].Message).To(Equal("git is not installed"))
+		Expect(checks[2].Message).To(HavePrefix("base revision v1.0.0 cannot be resolved"))
+		Expect(checks[3].Message).To(HavePrefix("header file header.txt cannot be read"))
+		Expect(checks[4].Message).To(Equal(`comment style "Semicolons" is unknown, must be one of: Hash,SlashSlash,SlashStar`))
+		Expect(IsHealthy(checks)).To(BeFalse())
+	})
+
+	It("fails with an outdated git", func() {
+		versioning.On("Version").Return("2.7.4", nil)
+		versioning.On("IsShallow").Return(false, nil)
+		versioning.On("MergeBase", "origin/main").Return("", errors.New("no merge base"))
+		fileReader.On("Read", "header.txt").Return([]byte("Copyright {{.Year}} ACME"), nil)
+
+		checks := Doctor(configuration, system)
+
+		Expect(checks[0]).To(Equal(EnvironmentCheck{
+			Name:    "git version",
+			Status:  CheckFailed,
+			Message: "git 2.7.4 is installed, headache requires git 2.16 or later",
+		}))
+		Expect(checks[2].Status).To(Equal(CheckFailed))
+		Expect(checks[2].Message).To(HavePrefix("merge base with base branch origin/main cannot be found"))
+	})
+
+	It("fails without header file", func() {
+		configuration.HeaderFile = ""
+		versioning.On("Version").Return("2.39.2", nil)
+		versioning.On("IsShallow").Return(false, nil)
+		versioning.On("MergeBase", "origin/main").Return("cafebabe", nil)
+
+		checks := Doctor(configuration, system)
+
+		Expect(checks[3]).To(Equal(EnvironmentCheck{Name: "header file", Status: CheckFailed, Message: "no header file is configured"}))
+	})
+
+	It("resolves the base branch defaulting to the git configuration", func() {
+		configuration.BaseBranch = ""
+		configuration.DiffMode = ForkPointDiffMode
+		versioning.On("Version").Return("2.39.2", nil)
+		versioning.On("IsShallow").Return(false, nil)
+		versioning.On("ConfigValue", "headache.baseBranch").Return("upstream/trunk", nil)
+		versioning.On("MergeBase", "upstream/trunk").Return("cafebabe", nil)
+		fileReader.On("Read", "header.txt").Return([]byte("Copyright {{.Year}} ACME"), nil)
+
+		checks := Doctor(configuration, system)
+
+		Expect(checks[2]).To(Equal(EnvironmentCheck{
+			Name:    "base revision",
+			Status:  CheckPassed,
+			Message: "merge base cafebabe with base branch upstream/trunk resolves",
+		}))
+	})
+
+	It("resolves the base revision from the CI environment when asked to", func() {
+		configuration.BaseBranch = ""
+		configuration.CiBase = true
+		system.Environment = func(key string) string {
+			if key == "CI_MERGE_REQUEST_DIFF_BASE_SHA" {
+				return "cafebabe"
+			}
+			return ""
+		}
+		versioning.On("Version").Return("2.39.2", nil)
+		versioning.On("IsShallow").Return(false, nil)
+		versioning.On("Log", "-1", "--format=%H", "cafebabe", "--").Return("cafebabe", nil)
+		fileReader.On("Read", "header.txt").Return([]byte("Copyright {{.Year}} ACME"), nil)
+
+		checks := Doctor(configuration, system)
+
+		Expect(checks[2]).To(Equal(EnvironmentCheck{Name: "base revision", Status: CheckPassed, Message: "base revision cafebabe resolves"}))
+	})
+})
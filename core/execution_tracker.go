@@ -17,6 +17,8 @@
 package core
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
 	"fmt"
 	"github.com/fbiville/headache/fs"
 	"github.com/fbiville/headache/helper"
@@ -41,8 +43,12 @@ type ExecutionVcsTracker struct {
 	FileSystem   *fs.FileSystem
 	Clock        helper.Clock
 	ConfigLoader *ConfigurationLoader
+	remoteHeader []byte // contents of the remote header read by the current execution, recorded when tracking it
 }
 
+// remote headers are not versioned, their contents are therefore recorded along the tracked execution
+var remoteHeaderRegex = regexp.MustCompile("(?m)^remoteHeader:(.*)$")
+
 // returns the header template at its current version and at the version it was last time headache ran
 func (evt *ExecutionVcsTracker) RetrieveVersionedTemplate(currentConfiguration *Configuration) (*VersionedHeaderTemplate, error) {
 	currentTemplate, err := evt.readCurrentTemplate(currentConfiguration)
@@ -71,7 +77,7 @@ func (evt *ExecutionVcsTracker) RetrieveVersionedTemplate(currentConfiguration *
 			Revision: "",
 		}, nil
 	}
-	previousTemplate, err := evt.readFormerTemplate(previousConfiguration, revision)
+	previousTemplate, err := evt.readFormerTemplate(previousConfiguration, trackingPath, revision)
 	if err != nil {
 		return nil, err
 	}
@@ -90,7 +96,12 @@ func (evt *ExecutionVcsTracker) TrackExecution(configurationPath *string) (error
 		return err
 	}
 	timestamp := evt.Clock.Now().Unix()
-	contents := fmt.Sprintf("# Generated by headache | %d -- commit me!\nconfiguration:%s", timestamp, *configurationPath)
+	contents := fmt.Sprintf("# Generated by headache | %d -- commit me!\n", timestamp)
+	if evt.remoteHeader != nil {
+		contents += fmt.Sprintf("remoteHeader:%s\n", base64.StdEncoding.EncodeToString(evt.remoteHeader))
+	}
+	// the configuration comes last, as it spans the rest of the file
+	contents += "configuration:" + *configurationPath
 	return evt.FileSystem.FileWriter.Write(trackerPath, contents, 0640)
 }
 
@@ -119,11 +130,14 @@ func (evt *ExecutionVcsTracker) readPreviousConfiguration(trackingPath string, r
 		previousConfigPath = currentConfigPath
 	}
 
-	previousConfig, err := evt.Versioning.ShowContentAtRevision(previousConfigPath, revision)
+	previousConfig, err := ResolveConfiguration(previousConfigPath, func(path string) ([]byte, error) {
+		contents, err := evt.Versioning.ShowContentAtRevision(path, revision)
+		return []byte(contents), err
+	})
 	if err != nil {
 		return nil, err
 	}
-	return evt.ConfigLoader.UnmarshallConfiguration([]byte(previousConfig))
+	return evt.ConfigLoader.UnmarshallConfiguration(previousConfig)
 }
 
 func (evt *ExecutionVcsTracker) readCurrentTemplate(configuration *Configuration) (*HeaderTemplate, error) {
@@ -131,22 +145,60 @@ func (evt *ExecutionVcsTracker) readCurrentTemplate(configuration *Configuration
 	if err != nil {
 		return nil, err
 	}
-	return template(string(headerBytes), configuration.TemplateData), nil
+	err = verifyChecksum(configuration.HeaderFile, headerBytes, configuration.HeaderChecksum)
+	if err != nil {
+		return nil, err
+	}
+	if fs.IsRemote(configuration.HeaderFile) {
+		evt.remoteHeader = headerBytes
+	}
+	return template(string(headerBytes), configuration), nil
 }
 
-func (evt *ExecutionVcsTracker) readFormerTemplate(configuration *Configuration, revision string) (*HeaderTemplate, error) {
+func (evt *ExecutionVcsTracker) readFormerTemplate(configuration *Configuration, trackingPath string, revision string) (*HeaderTemplate, error) {
+	if fs.IsRemote(configuration.HeaderFile) {
+		previousHeader, found, err := evt.getPreviousRemoteHeader(trackingPath)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			return template(previousHeader, configuration), nil
+		}
+		// executions tracked before remote headers were recorded: assume they did not change since then
+		headerBytes, err := evt.FileSystem.FileReader.Read(configuration.HeaderFile)
+		if err != nil {
+			return nil, err
+		}
+		return template(string(headerBytes), configuration), nil
+	}
 	previousHeader, err := evt.Versioning.ShowContentAtRevision(configuration.HeaderFile, revision)
 	if err != nil {
 		return nil, err
 	}
-	return template(previousHeader, configuration.TemplateData), nil
+	return template(previousHeader, configuration), nil
 }
 
-func template(contents string, data map[string]string) *HeaderTemplate {
-	return &HeaderTemplate{
+func verifyChecksum(path string, contents []byte, expectedChecksum string) error {
+	if expectedChecksum == "" {
+		return nil
+	}
+	checksum := fmt.Sprintf("%x", sha256.Sum256(contents))
+	if !strings.EqualFold(checksum, expectedChecksum) {
+		return fmt.Errorf("SHA-256 checksum of header file %s is %s, expected %s", path, checksum, expectedChecksum)
+	}
+	return nil
+}
+
+func template(contents string, configuration *Configuration) *HeaderTemplate {
+	result := expandHolders(&HeaderTemplate{
 		Lines: strings.Split(contents, "\n"),
-		Data:  data,
+		Data:  configuration.TemplateData,
+	}, configuration.Holders)
+	if configuration.Marker != "" {
+		// the marker closes the header, see ComputeMarkerRegex
+		result.Lines = append(result.Lines[:len(result.Lines):len(result.Lines)], configuration.Marker)
 	}
+	return result
 }
 
 func (evt *ExecutionVcsTracker) getPreviousExecutionConfigurationPath(trackingPath string) (string, error) {
@@ -162,6 +214,23 @@ func (evt *ExecutionVcsTracker) getPreviousExecutionConfigurationPath(trackingPa
 	return result[1], nil
 }
 
+// returns the contents of the remote header recorded along the previous execution, if any
+func (evt *ExecutionVcsTracker) getPreviousRemoteHeader(trackingPath string) (string, bool, error) {
+	bytes, err := evt.FileSystem.FileReader.Read(trackingPath)
+	if err != nil {
+		return "", false, err
+	}
+	result := remoteHeaderRegex.FindStringSubmatch(string(bytes))
+	if result == nil {
+		return "", false, nil
+	}
+	header, err := base64.StdEncoding.DecodeString(strings.TrimSpace(result[1]))
+	if err != nil {
+		return "", false, fmt.Errorf("invalid remote header recorded in %s\n\t%v", trackingPath, err)
+	}
+	return string(header), true, nil
+}
+
 func (evt *ExecutionVcsTracker) getTrackerFilePath() (string, error) {
 	versioning := evt.Versioning
 	root, err := versioning.Root()
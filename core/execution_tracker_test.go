@@ -25,6 +25,7 @@ import (
 	"github.com/fbiville/headache/vcs_mocks"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
 	"os"
 	"reflect"
 	"strings"
@@ -105,6 +106,34 @@ var _ = Describe("The execution tracker", func() {
 			Expect(strings.Join(versionedTemplate.Previous.Lines, "\n")).To(Equal(currentContents))
 		})
 
+		It("repeats the holder lines once per copyright holder", func() {
+			currentConfiguration.Holders = []string{"Zeta Corp", "ACME"}
+			fileReader.On("Read", currentHeaderFile).Return([]byte("Copyright {{.Holder}}\nsome header"), nil)
+			vcs.On("Root").Return(fakeRepositoryRoot, nil)
+			fileReader.On("Stat", trackerFilePath).Return(&FakeFileInfo{FileMode: 0777}, nil)
+			vcs.On("LatestRevision", trackerFilePath).Return("", nil)
+
+			versionedTemplate, err := tracker.RetrieveVersionedTemplate(currentConfiguration)
+
+			Expect(err).To(BeNil())
+			Expect(versionedTemplate.Current.Lines).To(HaveLen(3))
+			Expect(versionedTemplate.Current.Data).To(HaveLen(len(currentData) + 2))
+			Expect(currentData).To(HaveLen(1), "configured data must not be altered")
+		})
+
+		It("closes the header with the marker", func() {
+			currentConfiguration.Marker = "managed by headache"
+			fileReader.On("Read", currentHeaderFile).Return([]byte("some\nheader"), nil)
+			vcs.On("Root").Return(fakeRepositoryRoot, nil)
+			fileReader.On("Stat", trackerFilePath).Return(&FakeFileInfo{FileMode: 0777}, nil)
+			vcs.On("LatestRevision", trackerFilePath).Return("", nil)
+
+			versionedTemplate, err := tracker.RetrieveVersionedTemplate(currentConfiguration)
+
+			Expect(err).To(BeNil())
+			Expect(versionedTemplate.Current.Lines).To(Equal([]string{"some", "header", "managed by headache"}))
+		})
+
 		It("gets the current config at the previous revision if there were no tracked configuration, for backwards compatibility", func() {
 			revision := "some-revision"
 			currentContents := "some\nheader"
@@ -156,6 +185,130 @@ var _ = Describe("The execution tracker", func() {
 			Expect(result.Previous.Data).To(Equal(map[string]string{"some": "thing"}))
 		})
 
+		It("resolves the configurations extended by the previous configuration at the previous revision", func() {
+			previousConfigFile := "config/previous-config.json"
+			revision := "some-revision"
+			previousHeaderFile := "previous-header"
+			currentContents := "some\nheader"
+			previousContents := "previous\nheader"
+			fileReader.On("Read", currentHeaderFile).Return([]byte(currentContents), nil)
+			vcs.On("Root").Return(fakeRepositoryRoot, nil)
+			fileReader.On("Stat", trackerFilePath).Return(&FakeFileInfo{FileMode: 0777}, nil)
+			vcs.On("LatestRevision", trackerFilePath).Return(revision, nil)
+			fileReader.On("Read", trackerFilePath).Return([]byte("configuration:"+previousConfigFile), nil)
+			vcs.On("ShowContentAtRevision", previousConfigFile, revision).
+				Return(`{"extends": "../base-config.json", "data": {"some": "thing"}}`, nil)
+			vcs.On("ShowContentAtRevision", "base-config.json", revision).
+				Return(fmt.Sprintf(`{"headerFile": "%s", "data": {"some": "one", "other": "thing"}}`, previousHeaderFile), nil)
+			vcs.On("ShowContentAtRevision", previousHeaderFile, revision).Return(previousContents, nil)
+
+			result, err := tracker.RetrieveVersionedTemplate(currentConfiguration)
+
+			Expect(err).To(BeNil())
+			Expect(result.Revision).To(Equal(revision))
+			Expect(strings.Join(result.Previous.Lines, "\n")).To(Equal(previousContents))
+			Expect(result.Previous.Data).To(Equal(map[string]string{"some": "thing", "other": "thing"}))
+		})
+
+		It("returns the current remote contents as previous contents if the previous execution did not record them", func() {
+			previousConfigFile := "previous-config"
+			revision := "some-revision"
+			remoteHeaderFile := "https://example.com/license-header.txt"
+			currentConfiguration.HeaderFile = remoteHeaderFile
+			currentContents := "some\nheader"
+			fileReader.On("Read", remoteHeaderFile).Return([]byte(currentContents), nil)
+			vcs.On("Root").Return(fakeRepositoryRoot, nil)
+			fileReader.On("Stat", trackerFilePath).Return(&FakeFileInfo{FileMode: 0777}, nil)
+			vcs.On("LatestRevision", trackerFilePath).Return(revision, nil)
+			fileReader.On("Read", trackerFilePath).Return([]byte("configuration:"+previousConfigFile), nil)
+			vcs.On("ShowContentAtRevision", previousConfigFile, revision).Return(fmt.Sprintf(`{
+  "headerFile": "%s",
+  "data": {"some": "thing"}
+}`, remoteHeaderFile), nil)
+
+			result, err := tracker.RetrieveVersionedTemplate(currentConfiguration)
+
+			Expect(err).To(BeNil())
+			Expect(strings.Join(result.Current.Lines, "\n")).To(Equal(currentContents))
+			Expect(strings.Join(result.Previous.Lines, "\n")).To(Equal(currentContents))
+			Expect(result.Previous.Data).To(Equal(map[string]string{"some": "thing"}))
+		})
+
+		It("returns the remote contents recorded by the previous execution as previous contents", func() {
+			previousConfigFile := "previous-config"
+			revision := "some-revision"
+			remoteHeaderFile := "https://example.com/license-header.txt"
+			currentConfiguration.HeaderFile = remoteHeaderFile
+			currentConfiguration.Path = &previousConfigFile
+			previousContents := "some\nheader"
+			currentContents := "some\nnew header"
+			fileReader.On("Read", remoteHeaderFile).Return([]byte(previousContents), nil).Once()
+			fileReader.On("Read", remoteHeaderFile).Return([]byte(currentContents), nil).Once()
+			vcs.On("Root").Return(fakeRepositoryRoot, nil)
+			fileReader.On("Stat", trackerFilePath).Return(&FakeFileInfo{FileMode: 0777}, nil)
+			vcs.On("LatestRevision", trackerFilePath).Return("", nil).Once()
+			var trackedContents string
+			fileWriter.On("Write", trackerFilePath, mock.Anything, os.FileMode(0640)).
+				Run(func(args mock.Arguments) { trackedContents = args.String(1) }).
+				Return(nil)
+			_, err := tracker.RetrieveVersionedTemplate(currentConfiguration)
+			Expect(err).To(BeNil())
+			Expect(tracker.TrackExecution(&previousConfigFile)).To(Succeed())
+			vcs.On("LatestRevision", trackerFilePath).Return(revision, nil)
+			fileReader.On("Read", trackerFilePath).Return([]byte(trackedContents), nil)
+			vcs.On("ShowContentAtRevision", previousConfigFile, revision).Return(fmt.Sprintf(`{
+  "headerFile": "%s",
+  "data": {"some": "thing"}
+}`, remoteHeaderFile), nil)
+
+			result, err := tracker.RetrieveVersionedTemplate(currentConfiguration)
+
+			Expect(err).To(BeNil())
+			Expect(strings.Join(result.Current.Lines, "\n")).To(Equal(currentContents))
+			Expect(strings.Join(result.Previous.Lines, "\n")).To(Equal(previousContents))
+			Expect(result.RequiresFullScan()).To(BeTrue())
+		})
+
+		It("fails if the remote contents recorded by the previous execution are invalid", func() {
+			remoteHeaderFile := "https://example.com/license-header.txt"
+			currentConfiguration.HeaderFile = remoteHeaderFile
+			fileReader.On("Read", remoteHeaderFile).Return([]byte("some\nheader"), nil)
+			vcs.On("Root").Return(fakeRepositoryRoot, nil)
+			fileReader.On("Stat", trackerFilePath).Return(&FakeFileInfo{FileMode: 0777}, nil)
+			vcs.On("LatestRevision", trackerFilePath).Return("some-revision", nil)
+			fileReader.On("Read", trackerFilePath).Return([]byte("remoteHeader:not base64!\nconfiguration:previous-config"), nil)
+			vcs.On("ShowContentAtRevision", "previous-config", "some-revision").
+				Return(fmt.Sprintf(`{"headerFile": "%s"}`, remoteHeaderFile), nil)
+
+			_, err := tracker.RetrieveVersionedTemplate(currentConfiguration)
+
+			Expect(err.Error()).To(HavePrefix(fmt.Sprintf("invalid remote header recorded in %s", trackerFilePath)))
+		})
+
+		It("accepts the current template if its checksum matches", func() {
+			currentContents := "some\nheader"
+			currentConfiguration.HeaderChecksum = "ECE3512712A083CD6843EB8FEC3F231A9F07D233F077CB92252F84566ED324C6"
+			fileReader.On("Read", currentHeaderFile).Return([]byte(currentContents), nil)
+			vcs.On("Root").Return(fakeRepositoryRoot, nil)
+			fileReader.On("Stat", trackerFilePath).Return(&FakeFileInfo{FileMode: 0777}, nil)
+			vcs.On("LatestRevision", trackerFilePath).Return("", nil)
+
+			versionedTemplate, err := tracker.RetrieveVersionedTemplate(currentConfiguration)
+
+			Expect(err).To(BeNil())
+			Expect(strings.Join(versionedTemplate.Current.Lines, "\n")).To(Equal(currentContents))
+		})
+
+		It("fails if the current template checksum does not match", func() {
+			currentConfiguration.HeaderChecksum = "c0ffee"
+			fileReader.On("Read", currentHeaderFile).Return([]byte("some\nheader"), nil)
+
+			_, err := tracker.RetrieveVersionedTemplate(currentConfiguration)
+
+			Expect(err).To(MatchError("SHA-256 checksum of header file current-header-file is " +
+				"ece3512712a083cd6843eb8fec3f231a9f07d233f077cb92252f84566ed324c6, expected c0ffee"))
+		})
+
 		It("fails of the current template cannot be read", func() {
 			expectedError := errors.New("read error")
 			fileReader.On("Read", currentHeaderFile).Return(nil, expectedError)
@@ -314,6 +467,22 @@ configuration:%s`, configPath)
 			Expect(err).To(BeNil())
 		})
 
+		It("saves the contents of the remote header read by the execution", func() {
+			remoteHeaderFile := "https://example.com/license-header.txt"
+			fileReader.On("Read", remoteHeaderFile).Return([]byte("some\nheader"), nil)
+			vcs.On("Root").Return(repositoryFakeRoot, nil)
+			fileReader.On("Stat", trackerFilePath).Return(nil, os.ErrNotExist)
+			fileWriter.On("Write", trackerFilePath, fmt.Sprintf(`# Generated by headache | 42 -- commit me!
+remoteHeader:c29tZQpoZWFkZXI=
+configuration:%s`, *configurationPath), fileMode).Return(nil)
+			_, err := tracker.RetrieveVersionedTemplate(&core.Configuration{HeaderFile: remoteHeaderFile, Path: configurationPath})
+			Expect(err).To(BeNil())
+
+			err = tracker.TrackExecution(configurationPath)
+
+			Expect(err).To(BeNil())
+		})
+
 		It("fails if the repository root cannot be retrieved", func() {
 			rootErr := errors.New("root error")
 			vcs.On("Root").Return("", rootErr)
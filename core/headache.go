@@ -17,60 +17,425 @@
 package core
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/fbiville/headache/fs"
 	"github.com/fbiville/headache/vcs"
 	tpl "html/template"
 	"log"
 	"os"
+	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 )
 
 type VcsChangeGetter func(vcs.Vcs, string, string) (error, []vcs.FileChange)
 
-func Run(config *ChangeSet, fileSystem *fs.FileSystem) {
-	for _, change := range config.Files {
+// Run writes the headers of the files needing an update and returns the ones left for subsequent runs, if any
+// when the number of written files is capped, files are processed by path so that successive runs write the next batch
+// files whose change is declined by the confirmer, if any, are left for subsequent runs as well
+func Run(config *ChangeSet, fileSystem *fs.FileSystem) []vcs.FileChange {
+	postWriteFailures := 0
+	writtenFiles := 0
+	confirmAll := false
+	var deferredFiles []vcs.FileChange
+	for _, change := range sortedFiles(config) {
 		path := change.Path
 		bytes, err := fileSystem.FileReader.Read(path)
 		if err != nil {
 			log.Fatalf("headache execution error, cannot read file %s\n\t%v", path, err)
 		}
-
-		fileContents := string(bytes)
-		matchLocation := config.HeaderRegex.FindStringIndex(fileContents)
-		existingHeader := ""
-		if matchLocation != nil {
-			existingHeader = fileContents[matchLocation[0]:matchLocation[1]]
-			fileContents = strings.TrimLeft(fileContents[:matchLocation[0]]+fileContents[matchLocation[1]:], "\n")
+		if isSkippedEmptyFile(path, bytes, config) {
+			continue
+		}
+		commentable, err := isCommentable(path, bytes, config)
+		if err != nil {
+			log.Fatalf("headache execution error, %v", err)
+		}
+		if !commentable {
+			continue
+		}
+		change, err = config.withHistory(change)
+		if err != nil {
+			log.Fatalf("headache execution error, %v", err)
 		}
 
-		finalHeaderContent, err := insertYears(config.HeaderContents, &change, existingHeader)
+		newContents, err := updatedContents(change, bytes, config)
 		if err != nil {
-			log.Fatalf("headache execution error, cannot parse header for file %s\n\t%v", path, err)
+			log.Fatalf("headache execution error, %v", err)
+		}
+		if newContents == nil {
+			continue
+		}
+		if config.MaxFiles > 0 && writtenFiles == config.MaxFiles {
+			deferredFiles = append(deferredFiles, change)
+			continue
+		}
+		if config.Confirmer != nil && !confirmAll {
+			answer, err := confirm(config, change, bytes)
+			if err != nil {
+				log.Fatalf("headache execution error, %v", err)
+			}
+			if answer == No {
+				log.Printf("Skipping %s, update declined", path)
+				deferredFiles = append(deferredFiles, change)
+				continue
+			}
+			confirmAll = answer == All
 		}
-		newContents := append([]byte(fmt.Sprintf("%s%s", finalHeaderContent, "\n\n")), []byte(fileContents)...)
 		writeToFile(fileSystem.FileWriter, path, newContents)
+		writtenFiles++
+		if err := runPostWriteCommand(config, path); err != nil {
+			log.Printf("headache execution error, post-write command failed for file %s\n\t%v", path, err)
+			postWriteFailures++
+		}
+	}
+	if postWriteFailures > 0 {
+		log.Fatalf("headache execution error, post-write commands failed for %d file(s)", postWriteFailures)
+	}
+	return deferredFiles
+}
+
+// asks the confirmer whether the planned change of the file is to be written
+func confirm(config *ChangeSet, change vcs.FileChange, bytes []byte) (Answer, error) {
+	reason, err := updateReason(change, bytes, config)
+	if err != nil {
+		return No, err
 	}
+	return config.Confirmer.Confirm(change.Path, reason)
 }
 
-func insertYears(template string, change *vcs.FileChange, existingHeader string) (string, error) {
+// returns the contents of the file with the expected header, or nil if the file does not need to be written
+func updatedContents(change vcs.FileChange, bytes []byte, config *ChangeSet) ([]byte, error) {
+	if isNotebook(change.Path) {
+		result, _, err := updateNotebook(change, bytes, config)
+		return result, err
+	}
+	_, contents := splitByteOrderMark(string(bytes))
+	_, body := splitPreamble(contents, config)
+	_, existingHeaders := splitHeaders(body, config.HeaderRegex, config.topHeaderRegex())
+
+	finalHeaderContent, err := insertYears(headerContents(config, change), &change, existingHeaders, config.YearRangeFormat, config.DateFormat)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse header for file %s\n\t%v", change.Path, err)
+	}
+	if err := ValidateRenderedHeader(finalHeaderContent, config.CommentStyle); err != nil {
+		return nil, fmt.Errorf("invalid header for file %s\n\t%v", change.Path, err)
+	}
+	result, editedByHand := applyHeader(bytes, finalHeaderContent, config)
+	if editedByHand {
+		log.Printf("Skipping %s, its header was edited by hand, add --force to overwrite it", change.Path)
+	}
+	return result, nil
+}
+
+// applies the rendered header to the contents, as ApplyHeader does for embedding programs
+// returns the resulting contents, or nil if they are to be left untouched, and whether they are because their header
+// was edited by hand
+func applyHeader(bytes []byte, header string, config *ChangeSet) ([]byte, bool) {
+	if skipsEmptyContents(bytes, config) || isBinary(bytes) {
+		return nil, false
+	}
+	return withHeader(bytes, header, config)
+}
+
+// returns the contents with the rendered header inserted or updated, or nil if they are to be left untouched, and
+// whether they are because their header was edited by hand
+func withHeader(bytes []byte, header string, config *ChangeSet) ([]byte, bool) {
+	byteOrderMark, contents := splitByteOrderMark(string(bytes))
+	prologue, body := splitPreamble(contents, config)
+	fileContents, existingHeaders := splitHeaders(body, config.HeaderRegex, config.topHeaderRegex())
+	prologue, fileContents, misplaced := hoistDirectives(prologue, fileContents, existingHeaders)
+
+	newLine := lineBreak(contents, config.LineEnding)
+	header = withLineBreaks(header, newLine)
+	needsUpdate, reason := NeedsUpdate(body, header, config.CommentStyle)
+	if config.AddOnly && !isMissingHeader(reason, existingHeaders) {
+		return nil, false
+	}
+	if needsUpdate && !config.Force && isEditedByHand(config, body, header, existingHeaders, reason) {
+		return nil, true
+	}
+	if reason == HeaderWithOutdatedLicense && len(existingHeaders) == 0 {
+		// the undetected header is the one to replace, rather than a third-party notice to keep below the header
+		fileContents = removeTopComment(fileContents, config.CommentStyle)
+	}
+	if !needsUpdate && !misplaced && len(existingHeaders) <= 1 {
+		return nil, false
+	}
+	if !misplaced && len(existingHeaders) == 1 {
+		if updatedBody, updated := updateYearsInPlace(body, existingHeaders[0], header); updated {
+			return []byte(byteOrderMark + prologue + updatedBody), false
+		}
+	}
+	return []byte(fmt.Sprintf("%s%s%s%s%s", byteOrderMark, prologue, header, newLine+newLine, fileContents)), false
+}
+
+// returns the line break headers are written with, the one ending the first line of the contents in auto mode
+func lineBreak(contents string, lineEnding string) string {
+	switch lineEnding {
+	case CrlfLineEnding:
+		return "\r\n"
+	case AutoLineEnding:
+		if index := strings.Index(contents, "\n"); index > 0 && contents[index-1] == '\r' {
+			return "\r\n"
+		}
+	}
+	return "\n"
+}
+
+// returns the header with its line breaks replaced, CRLF line breaks of header templates included
+func withLineBreaks(header string, newLine string) string {
+	return strings.Replace(strings.Replace(header, "\r\n", "\n", -1), "\n", newLine, -1)
+}
+
+func removeTopComment(contents string, style CommentStyle) string {
+	trimmedContents := strings.TrimLeft(contents, " \t\r\n")
+	topComment := extractTopComment(trimmedContents, style)
+	return strings.TrimLeft(trimmedContents[len(topComment):], "\r\n")
+}
+
+func sortedFiles(config *ChangeSet) []vcs.FileChange {
+	if config.MaxFiles <= 0 {
+		return config.Files
+	}
+	result := make([]vcs.FileChange, len(config.Files))
+	copy(result, config.Files)
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Path < result[j].Path
+	})
+	return result
+}
+
+// files with a header with a different wording, or with a header below other contents, do have a header
+func isMissingHeader(reason UpdateReason, existingHeaders []string) bool {
+	return reason == HeaderMissing && len(existingHeaders) == 0
+}
+
+func isSkippedEmptyFile(path string, contents []byte, config *ChangeSet) bool {
+	if !skipsEmptyContents(contents, config) {
+		return false
+	}
+	log.Printf("Skipping %s, empty files get no header", path)
+	return true
+}
+
+// a header alone is meaningless, empty contents only get one when asked to
+func skipsEmptyContents(contents []byte, config *ChangeSet) bool {
+	return len(contents) == 0 && !config.AddHeaderToEmptyFiles
+}
+
+// git considers files with a NUL byte among their first 8000 bytes as binary
+const binaryDetectionLength = 8000
+
+// binary files, such as images, cannot be commented whatever the comment style, nor can the files whose extension no
+// comment style applies to
+// they are either skipped or reported as an error
+func isCommentable(path string, contents []byte, config *ChangeSet) (bool, error) {
+	if isBinary(contents) {
+		if !config.SkipUnknownStyles {
+			return false, fmt.Errorf("no comment style applies to binary file %s, set skipUnknownStyles to skip such files", path)
+		}
+		log.Printf("Skipping %s, no comment style applies to binary files", path)
+		return false, nil
+	}
+	if !isKnownExtension(path, config.CommentStyle) {
+		extension := filepath.Ext(path)
+		if !config.SkipUnknownStyles {
+			return false, fmt.Errorf("no comment style applies to %s files such as %s, set skipUnknownStyles to skip such files", extension, path)
+		}
+		log.Printf("Skipping %s, no comment style applies to %s files", path, extension)
+		return false, nil
+	}
+	return true, nil
+}
+
+func isBinary(contents []byte) bool {
+	if len(contents) > binaryDetectionLength {
+		contents = contents[:binaryDetectionLength]
+	}
+	return bytes.Contains(contents, []byte{0})
+}
+
+const utf8ByteOrderMark = "\uFEFF"
+
+// returns the UTF-8 byte order mark starting the contents, if any, and the remaining contents
+// headers go after the byte order mark, which is preserved
+func splitByteOrderMark(contents string) (string, string) {
+	if strings.HasPrefix(contents, utf8ByteOrderMark) {
+		return utf8ByteOrderMark, contents[len(utf8ByteOrderMark):]
+	}
+	return "", contents
+}
+
+// replaces the existing header at the top of the contents by the expected one if they only differ by their years
+// the rest of the contents is left untouched, so that the resulting diff is limited to the lines with years
+func updateYearsInPlace(contents string, existingHeader string, expectedHeader string) (string, bool) {
+	if !strings.HasPrefix(contents, existingHeader) {
+		return "", false
+	}
+	matchedHeader := yearAgnosticRegex(expectedHeader).FindString(existingHeader)
+	if matchedHeader == "" {
+		return "", false
+	}
+	return expectedHeader + contents[len(matchedHeader):], true
+}
+
+// returns the contents to keep above the header, and the remaining contents
+// besides the prologue, the lines above an existing header starting within the search window, such as XML declarations
+// or editor modelines, stay above it, while headers found below are considered misplaced
+func splitPreamble(contents string, config *ChangeSet) (string, string) {
+	prologue, body := splitPrologue(contents, config.InsertAfter)
+	if config.HeaderSearchLines <= 0 {
+		return prologue, body
+	}
+	location := config.HeaderRegex.FindStringIndex(body)
+	if location == nil || location[0] == 0 || body[location[0]-1] != '\n' {
+		return prologue, body
+	}
+	if strings.Count(prologue, "\n")+strings.Count(body[:location[0]], "\n") >= config.HeaderSearchLines {
+		return prologue, body
+	}
+	return prologue + body[:location[0]], body[location[0]:]
+}
+
+// returns the contents to keep above the header, and the remaining contents
+// the prologue is made of the contents up to and including the line matching the insertion pattern if there is one and
+// it matches, otherwise of the leading shebang and build constraint lines
+func splitPrologue(contents string, insertAfter *regexp.Regexp) (string, string) {
+	if insertAfter != nil {
+		if matchLocation := insertAfter.FindStringIndex(contents); matchLocation != nil {
+			end := endOfLine(contents, matchLocation[1])
+			return withTrailingNewline(contents[:end]), contents[end:]
+		}
+	}
+	return splitDirectives(contents)
+}
+
+// build constraints must be followed by a blank line, hence the extra line feed
+func splitDirectives(contents string) (string, string) {
+	shebangEnd := 0
+	if strings.HasPrefix(contents, "#!") {
+		shebangEnd = endOfLine(contents, 0)
+	}
+	constraintsEnd := shebangEnd
+	for offset := shebangEnd; offset < len(contents); {
+		end := endOfLine(contents, offset)
+		line := strings.TrimSpace(contents[offset:end])
+		if isBuildConstraint(line) {
+			constraintsEnd = end
+		} else if line != "" {
+			break
+		}
+		offset = end
+	}
+	if constraintsEnd == 0 {
+		return "", contents
+	}
+	prologue := withTrailingNewline(contents[:constraintsEnd])
+	if constraintsEnd != shebangEnd {
+		prologue += "\n"
+	}
+	return prologue, strings.TrimLeft(contents[constraintsEnd:], "\n")
+}
+
+// moves build constraints found right below existing headers (inserted before constraints were preserved) above them
+// returns whether constraints were moved, in which case the file needs to be rewritten
+func hoistDirectives(prologue string, contents string, existingHeaders []string) (string, string, bool) {
+	if prologue != "" || len(existingHeaders) == 0 {
+		return prologue, contents, false
+	}
+	directives, remainingContents := splitDirectives(contents)
+	if directives == "" {
+		return prologue, contents, false
+	}
+	return directives, remainingContents, true
+}
+
+func isBuildConstraint(line string) bool {
+	return strings.HasPrefix(line, "//go:build ") || strings.HasPrefix(line, "// +build ")
+}
+
+// returns the index right after the line feed ending the line including the given index
+func endOfLine(contents string, index int) int {
+	if lineEnd := strings.Index(contents[index:], "\n"); lineEnd != -1 {
+		return index + lineEnd + 1
+	}
+	return len(contents)
+}
+
+func withTrailingNewline(contents string) string {
+	if !strings.HasSuffix(contents, "\n") {
+		return contents + "\n"
+	}
+	return contents
+}
+
+// returns the contents stripped from the detected header, and the detected header
+// consecutive headers (resulting from past bad merges for instance) are all stripped and returned
+// headers are usually at the top: matching there first avoids scanning whole files, which is the slowest part of
+// processing up-to-date files, and yields the same match as the leftmost match of the unanchored regex
+func splitHeaders(contents string, headerRegex *regexp.Regexp, topHeaderRegex *regexp.Regexp) (string, []string) {
+	matchLocation := topHeaderRegex.FindStringIndex(contents)
+	if matchLocation == nil {
+		matchLocation = headerRegex.FindStringIndex(contents)
+	}
+	if matchLocation == nil {
+		return contents, nil
+	}
+	headers := []string{contents[matchLocation[0]:matchLocation[1]]}
+	before := contents[:matchLocation[0]]
+	after := contents[matchLocation[1]:]
+	for {
+		trimmedAfter := strings.TrimLeft(after, "\r\n")
+		nextMatchLocation := topHeaderRegex.FindStringIndex(trimmedAfter)
+		if nextMatchLocation == nil {
+			break
+		}
+		headers = append(headers, trimmedAfter[:nextMatchLocation[1]])
+		after = trimmedAfter[nextMatchLocation[1]:]
+	}
+	if strings.HasSuffix(before, "\n\n") || strings.HasSuffix(before, "\n\r\n") {
+		// the blank line above misplaced headers already separates the contents around them
+		after = strings.TrimLeft(after, "\r\n")
+	}
+	return strings.TrimLeft(before+after, "\r\n"), headers
+}
+
+// returns the regex only matching at the start of the text
+func anchor(regex *regexp.Regexp) *regexp.Regexp {
+	return regexp.MustCompile(`\A(?:` + regex.String() + `)`)
+}
+
+// the year range is collapsed into a single year when the start and end years are the same, unless it is expanded
+// listed years keep the years of the existing headers, the start and end years being added if missing
+// dates are rendered in UTC, so that headers do not depend on the time zone of the machine headache runs on
+func insertYears(template string, change *vcs.FileChange, existingHeaders []string, yearRangeFormat string, dateFormat string) (string, error) {
 	t, err := tpl.New("header-second-pass").Parse(template)
 	if err != nil {
 		return "", err
 	}
 	data := make(map[string]string)
-	startYear, endYear, err := computeCopyrightYears(change, existingHeader)
+	startYear, endYear, err := computeCopyrightYears(change, existingHeaders...)
 	if err != nil {
 		return "", err
 	}
+	data["Path"] = change.GetDisplayPath()
 	data["YearRange"] = strconv.Itoa(startYear)
 	data["StartYear"] = strconv.Itoa(startYear)
 	data["EndYear"] = strconv.Itoa(endYear)
-	if startYear != endYear {
+	if yearRangeFormat == ListYearRangeFormat {
+		data["YearRange"] = listYears(startYear, endYear, existingHeaders)
+	} else if startYear != endYear || yearRangeFormat == ExpandedYearRangeFormat {
 		data["YearRange"] = fmt.Sprintf("%d-%d", startYear, endYear)
 	}
+	if dateFormat == "" {
+		dateFormat = DefaultDateFormat
+	}
+	data["CreationDate"] = change.CreationTime.UTC().Format(dateFormat)
+	data["LastEditionDate"] = change.LastEditionTime.UTC().Format(dateFormat)
 	builder := &strings.Builder{}
 	err = t.Execute(builder, data)
 	if err != nil {
@@ -79,11 +444,38 @@ func insertYears(template string, change *vcs.FileChange, existingHeader string)
 	return builder.String(), nil
 }
 
-func computeCopyrightYears(change *vcs.FileChange, existingHeader string) (int, int, error) {
+var yearRegex = regexp.MustCompile(`\d{4}`)
+
+// returns the sorted distinct years of the first year lists of the headers along with the given years, comma-separated
+func listYears(startYear int, endYear int, existingHeaders []string) string {
+	years := map[int]struct{}{startYear: {}, endYear: {}}
+	for _, header := range existingHeaders {
+		for _, year := range yearRegex.FindAllString(yearRangeRegex.FindString(header), -1) {
+			value, _ := strconv.Atoi(year)
+			years[value] = struct{}{}
+		}
+	}
+	sortedYears := make([]int, 0, len(years))
+	for year := range years {
+		sortedYears = append(sortedYears, year)
+	}
+	sort.Ints(sortedYears)
+	result := make([]string, len(sortedYears))
+	for i, year := range sortedYears {
+		result[i] = strconv.Itoa(year)
+	}
+	return strings.Join(result, ", ")
+}
+
+// the earliest start year found in the existing headers is preserved if it predates the creation year
+func computeCopyrightYears(change *vcs.FileChange, existingHeaders ...string) (int, int, error) {
 	regex := regexp.MustCompile(`(\d{4})(?:\s*-\s*(\d{4}))?`)
-	matches := regex.FindStringSubmatch(existingHeader)
 	creationYear := change.CreationYear
-	if len(matches) > 2 {
+	for _, existingHeader := range existingHeaders {
+		matches := regex.FindStringSubmatch(existingHeader)
+		if len(matches) <= 2 {
+			continue
+		}
 		startYearInHeader, err := strconv.Atoi(matches[1])
 		if err != nil {
 			return 0, 0, err
@@ -17,13 +17,23 @@
 package core
 
 import (
+	"errors"
+	"fmt"
 	"github.com/fbiville/headache/fs"
 	"github.com/fbiville/headache/fs_mocks"
 	"github.com/fbiville/headache/vcs"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"io"
+	"io/ioutil"
 	"os"
 	"regexp"
+	"strings"
+	"time"
 )
 
 var _ = Describe("Headache", func() {
@@ -257,21 +267,748 @@ var _ = Describe("Headache", func() {
 		Run(&configuration, fileSystem)
 	})
 
+	It("runs the post-write command configured for the extension of the written files", func() {
+		header := "// Copyright 2022 ACME"
+		fakeFile := new(fs_mocks.File)
+		fileReader.On("Read", "main.go").Return([]byte("package main"), nil).Once()
+		fileReader.On("Read", "up-to-date.go").Return([]byte(header+"\n\npackage main"), nil).Once()
+		fileReader.On("Read", "script.sh").Return([]byte("echo hello"), nil).Once()
+		fileWriter.On("Open", "main.go", os.O_WRONLY|os.O_TRUNC, os.ModeAppend).Return(fakeFile, nil).Once()
+		fileWriter.On("Open", "script.sh", os.O_WRONLY|os.O_TRUNC, os.ModeAppend).Return(fakeFile, nil).Once()
+		fakeFile.On("Write", mock.Anything).Return(nil).Twice()
+		fakeFile.On("Close").Return(nil).Twice()
+		var commands [][]string
+		configuration := ChangeSet{
+			HeaderRegex:       regexp.MustCompile("// Copyright .* ACME\n?"),
+			HeaderContents:    "// Copyright {{.YearRange}} ACME",
+			CommentStyle:      SlashSlash{},
+			PostWriteCommands: map[string][]string{".go": {"gofmt", "-w"}},
+			CommandRunner: func(name string, args ...string) (string, error) {
+				commands = append(commands, append([]string{name}, args...))
+				return "", nil
+			},
+			Files: []vcs.FileChange{
+				{Path: "main.go", CreationYear: 2022, LastEditionYear: 2022},
+				{Path: "up-to-date.go", CreationYear: 2022, LastEditionYear: 2022},
+				{Path: "script.sh", CreationYear: 2022, LastEditionYear: 2022},
+			},
+		}
+
+		Run(&configuration, fileSystem)
+
+		Expect(commands).To(Equal([][]string{{"gofmt", "-w", "main.go"}}))
+	})
+
+	It("reports the failures of post-write commands", func() {
+		configuration := ChangeSet{
+			PostWriteCommands: map[string][]string{".go": {"gofmt", "-w"}},
+			CommandRunner: func(name string, args ...string) (string, error) {
+				return "main.go:1:1: expected 'package', found 'EOF'", errors.New("exit status 2")
+			},
+		}
+
+		err := runPostWriteCommand(&configuration, "main.go")
+
+		Expect(err).To(MatchError("gofmt failed\n\texit status 2\n\tmain.go:1:1: expected 'package', found 'EOF'"))
+	})
+
+	It("moves headers found below the package clause to the top", func() {
+		header := "// Copyright 2022 ACME"
+		fakeFile := new(fs_mocks.File)
+		fileReader.On("Read", "main.go").
+			Return([]byte("package main\n\n"+header+"\n\nfunc main() {}\n"), nil).
+			Once()
+		fileWriter.On("Open", "main.go", os.O_WRONLY|os.O_TRUNC, os.ModeAppend).
+			Return(fakeFile, nil).
+			Once()
+		fakeFile.On("Write", []byte(header+"\n\npackage main\n\nfunc main() {}\n")).Return(nil).Once()
+		fakeFile.On("Close").Return(nil).Once()
+
+		configuration := ChangeSet{
+			HeaderRegex:    regexp.MustCompile("(?m)^// Copyright .* ACME\n?"),
+			HeaderContents: "// Copyright {{.YearRange}} ACME",
+			CommentStyle:   SlashSlash{},
+			Files:          []vcs.FileChange{{Path: "main.go", CreationYear: 2022, LastEditionYear: 2022}},
+		}
+
+		Run(&configuration, fileSystem)
+	})
+
+	It("writes at most the maximum number of files, by path, and returns the others", func() {
+		header := "// Copyright 2022 ACME"
+		fakeFile := new(fs_mocks.File)
+		fileReader.On("Read", "c.go").Return([]byte("package c"), nil)
+		fileReader.On("Read", "a.go").Return([]byte(header+"\n\npackage a"), nil)
+		fileReader.On("Read", "d.go").Return([]byte("package d"), nil)
+		fileReader.On("Read", "b.go").Return([]byte("package b"), nil)
+		fileWriter.On("Open", "b.go", os.O_WRONLY|os.O_TRUNC, os.ModeAppend).Return(fakeFile, nil).Twice()
+		fileWriter.On("Open", "c.go", os.O_WRONLY|os.O_TRUNC, os.ModeAppend).Return(fakeFile, nil).Twice()
+		fakeFile.On("Write", mock.Anything).Return(nil)
+		fakeFile.On("Close").Return(nil)
+		files := []vcs.FileChange{
+			{Path: "c.go", CreationYear: 2022, LastEditionYear: 2022},
+			{Path: "a.go", CreationYear: 2022, LastEditionYear: 2022},
+			{Path: "d.go", CreationYear: 2022, LastEditionYear: 2022},
+			{Path: "b.go", CreationYear: 2022, LastEditionYear: 2022},
+		}
+		configuration := ChangeSet{
+			HeaderRegex:    regexp.MustCompile("// Copyright .* ACME\n?"),
+			HeaderContents: "// Copyright {{.YearRange}} ACME",
+			CommentStyle:   SlashSlash{},
+			MaxFiles:       2,
+			Files:          files,
+		}
+
+		deferredFiles := Run(&configuration, fileSystem)
+
+		Expect(deferredFiles).To(Equal([]vcs.FileChange{files[2]}))
+		configuration.Files = []vcs.FileChange{files[3], files[2], files[1], files[0]}
+		Expect(Run(&configuration, fileSystem)).To(Equal(deferredFiles))
+		Expect(configuration.Files[0]).To(Equal(files[3]), "the files of the change set are left unsorted")
+	})
+
+	It("only writes the files whose change is confirmed", func() {
+		fakeFile := new(fs_mocks.File)
+		fileReader.On("Read", "a.go").Return([]byte("package a"), nil).Once()
+		fileReader.On("Read", "b.go").Return([]byte("package b"), nil).Once()
+		fileReader.On("Read", "c.go").Return([]byte("package c"), nil).Once()
+		fileWriter.On("Open", "a.go", os.O_WRONLY|os.O_TRUNC, os.ModeAppend).Return(fakeFile, nil).Once()
+		fileWriter.On("Open", "c.go", os.O_WRONLY|os.O_TRUNC, os.ModeAppend).Return(fakeFile, nil).Once()
+		fakeFile.On("Write", mock.Anything).Return(nil)
+		fakeFile.On("Close").Return(nil)
+		files := []vcs.FileChange{
+			{Path: "a.go", CreationYear: 2022, LastEditionYear: 2022},
+			{Path: "b.go", CreationYear: 2022, LastEditionYear: 2022},
+			{Path: "c.go", CreationYear: 2022, LastEditionYear: 2022},
+		}
+		prompts := &strings.Builder{}
+		configuration := ChangeSet{
+			HeaderRegex:    regexp.MustCompile("// Copyright .* ACME\n?"),
+			HeaderContents: "// Copyright {{.YearRange}} ACME",
+			CommentStyle:   SlashSlash{},
+			Files:          files,
+			Confirmer:      NewPromptConfirmer(strings.NewReader("y\nno\nYes\n"), prompts),
+		}
+
+		deferredFiles := Run(&configuration, fileSystem)
+
+		Expect(deferredFiles).To(Equal([]vcs.FileChange{files[1]}), "declined files are left for subsequent runs")
+		Expect(prompts.String()).To(Equal(
+			"Update the header of a.go (missing header)? [y/n/a] " +
+				"Update the header of b.go (missing header)? [y/n/a] " +
+				"Update the header of c.go (missing header)? [y/n/a] "))
+	})
+
+	It("writes the remaining files without asking once all changes are confirmed", func() {
+		fakeFile := new(fs_mocks.File)
+		fileReader.On("Read", "a.go").Return([]byte("package a"), nil).Once()
+		fileReader.On("Read", "b.go").Return([]byte("// Copyright 2021 ACME\n\npackage b"), nil).Once()
+		fileReader.On("Read", "c.go").Return([]byte("package c"), nil).Once()
+		fileWriter.On("Open", "b.go", os.O_WRONLY|os.O_TRUNC, os.ModeAppend).Return(fakeFile, nil).Once()
+		fileWriter.On("Open", "c.go", os.O_WRONLY|os.O_TRUNC, os.ModeAppend).Return(fakeFile, nil).Once()
+		fakeFile.On("Write", mock.Anything).Return(nil)
+		fakeFile.On("Close").Return(nil)
+		files := []vcs.FileChange{
+			{Path: "a.go", CreationYear: 2022, LastEditionYear: 2022},
+			{Path: "b.go", CreationYear: 2021, LastEditionYear: 2022},
+			{Path: "c.go", CreationYear: 2022, LastEditionYear: 2022},
+		}
+		prompts := &strings.Builder{}
+		configuration := ChangeSet{
+			HeaderRegex:    regexp.MustCompile("// Copyright .* ACME\n?"),
+			HeaderContents: "// Copyright {{.YearRange}} ACME",
+			CommentStyle:   SlashSlash{},
+			Files:          files,
+			Confirmer:      NewPromptConfirmer(strings.NewReader("n\na\n"), prompts),
+		}
+
+		deferredFiles := Run(&configuration, fileSystem)
+
+		Expect(deferredFiles).To(Equal([]vcs.FileChange{files[0]}))
+		Expect(prompts.String()).To(Equal(
+			"Update the header of a.go (missing header)? [y/n/a] " +
+				"Update the header of b.go (stale year)? [y/n/a] "))
+	})
+
+	It("declines the changes left once the answers run out", func() {
+		fileReader.On("Read", "a.go").Return([]byte("package a"), nil).Once()
+		files := []vcs.FileChange{{Path: "a.go", CreationYear: 2022, LastEditionYear: 2022}}
+		configuration := ChangeSet{
+			HeaderRegex:    regexp.MustCompile("// Copyright .* ACME\n?"),
+			HeaderContents: "// Copyright {{.YearRange}} ACME",
+			CommentStyle:   SlashSlash{},
+			Files:          files,
+			Confirmer:      NewPromptConfirmer(strings.NewReader(""), ioutil.Discard),
+		}
+
+		Expect(Run(&configuration, fileSystem)).To(Equal(files))
+	})
+
+	It("preserves headers edited by hand since the last execution", func() {
+		fileReader.On("Read", "edited.go").Return([]byte("// Copyright 2021 ACME and friends\n//\n// Some license\n\npackage edited"), nil).Once()
+		regex, err := ComputeDetectionRegex([]string{"Copyright {{.YearRange}} {{.Owner}}", "", "Some license"}, map[string]string{"YearRange": "", "Owner": ""})
+		Expect(err).NotTo(HaveOccurred())
+		configuration := ChangeSet{
+			HeaderRegex:     regexp.MustCompile(regex),
+			HeaderContents:  "// Copyright {{.YearRange}} ACME\n//\n// Some license",
+			CommentStyle:    SlashSlash{},
+			DetectHandEdits: true,
+			Files:           []vcs.FileChange{{Path: "edited.go", CreationYear: 2021, LastEditionYear: 2022}},
+		}
+
+		Expect(Run(&configuration, fileSystem)).To(BeEmpty())
+	})
+
+	It("overwrites headers edited by hand when forced to", func() {
+		fakeFile := new(fs_mocks.File)
+		fileReader.On("Read", "edited.go").Return([]byte("// Copyright 2021 ACME and friends\n//\n// Some license\n\npackage edited"), nil).Once()
+		fileWriter.On("Open", "edited.go", os.O_WRONLY|os.O_TRUNC, os.ModeAppend).Return(fakeFile, nil).Once()
+		fakeFile.On("Write", []byte("// Copyright 2021-2022 ACME\n//\n// Some license\n\npackage edited")).Return(nil).Once()
+		fakeFile.On("Close").Return(nil).Once()
+		regex, err := ComputeDetectionRegex([]string{"Copyright {{.YearRange}} {{.Owner}}", "", "Some license"}, map[string]string{"YearRange": "", "Owner": ""})
+		Expect(err).NotTo(HaveOccurred())
+		configuration := ChangeSet{
+			HeaderRegex:     regexp.MustCompile(regex),
+			HeaderContents:  "// Copyright {{.YearRange}} ACME\n//\n// Some license",
+			CommentStyle:    SlashSlash{},
+			DetectHandEdits: true,
+			Force:           true,
+			Files:           []vcs.FileChange{{Path: "edited.go", CreationYear: 2021, LastEditionYear: 2022}},
+		}
+
+		Run(&configuration, fileSystem)
+
+		fakeFile.AssertExpectations(GinkgoT())
+	})
+
+	It("updates headers found below preambles of varying lengths within the search window", func() {
+		preambles := []string{
+			"# -*- coding: utf-8 -*-\n",
+			"# -*- coding: utf-8 -*-\n# vim: set filetype=python:\n",
+			"# -*- coding: utf-8 -*-\n# vim: set filetype=python:\n\n# pylint: skip-file\n",
+		}
+		for _, preamble := range preambles {
+			fakeFile := new(fs_mocks.File)
+			path := fmt.Sprintf("preamble-%d.py", strings.Count(preamble, "\n"))
+			fileReader.On("Read", path).Return([]byte(preamble+"# Copyright 2019 ACME\n\nprint('hello')\n"), nil).Once()
+			fileWriter.On("Open", path, os.O_WRONLY|os.O_TRUNC, os.ModeAppend).Return(fakeFile, nil).Once()
+			fakeFile.On("Write", []byte(preamble+"# Copyright 2019-2022 ACME\n\nprint('hello')\n")).Return(nil).Once()
+			fakeFile.On("Close").Return(nil).Once()
+			configuration := ChangeSet{
+				HeaderRegex:       regexp.MustCompile("# Copyright .* ACME\n?"),
+				HeaderContents:    "# Copyright {{.YearRange}} ACME",
+				CommentStyle:      Hash{},
+				HeaderSearchLines: 5,
+				Files:             []vcs.FileChange{{Path: path, CreationYear: 2019, LastEditionYear: 2022}},
+			}
+
+			Run(&configuration, fileSystem)
+
+			fakeFile.AssertExpectations(GinkgoT())
+		}
+	})
+
+	It("leaves headers found below preambles within the search window untouched when up-to-date", func() {
+		fileReader.On("Read", "up-to-date.py").
+			Return([]byte("# -*- coding: utf-8 -*-\n# vim: set filetype=python:\n# Copyright 2019-2022 ACME\n\nprint('hello')\n"), nil).Once()
+		configuration := ChangeSet{
+			HeaderRegex:       regexp.MustCompile("# Copyright .* ACME\n?"),
+			HeaderContents:    "# Copyright {{.YearRange}} ACME",
+			CommentStyle:      Hash{},
+			HeaderSearchLines: 3,
+			Files:             []vcs.FileChange{{Path: "up-to-date.py", CreationYear: 2019, LastEditionYear: 2022}},
+		}
+
+		Run(&configuration, fileSystem)
+	})
+
+	It("moves headers found beyond the search window to the top", func() {
+		fakeFile := new(fs_mocks.File)
+		fileReader.On("Read", "deep.py").
+			Return([]byte("# -*- coding: utf-8 -*-\n# vim: set filetype=python:\n# Copyright 2019 ACME\n\nprint('hello')\n"), nil).Once()
+		fileWriter.On("Open", "deep.py", os.O_WRONLY|os.O_TRUNC, os.ModeAppend).Return(fakeFile, nil).Once()
+		fakeFile.On("Write", []byte("# Copyright 2019-2022 ACME\n\n# -*- coding: utf-8 -*-\n# vim: set filetype=python:\n\nprint('hello')\n")).Return(nil).Once()
+		fakeFile.On("Close").Return(nil).Once()
+		configuration := ChangeSet{
+			HeaderRegex:       regexp.MustCompile("# Copyright .* ACME\n?"),
+			HeaderContents:    "# Copyright {{.YearRange}} ACME",
+			CommentStyle:      Hash{},
+			HeaderSearchLines: 2,
+			Files:             []vcs.FileChange{{Path: "deep.py", CreationYear: 2019, LastEditionYear: 2022}},
+		}
+
+		Run(&configuration, fileSystem)
+
+		fakeFile.AssertExpectations(GinkgoT())
+	})
+
+	It("leaves empty files untouched by default", func() {
+		fileReader.On("Read", "empty.go").Return([]byte{}, nil).Once()
+
+		configuration := ChangeSet{
+			HeaderRegex:    regexp.MustCompile("// Copyright .* ACME\n?"),
+			HeaderContents: "// Copyright {{.YearRange}} ACME",
+			CommentStyle:   SlashSlash{},
+			Files:          []vcs.FileChange{{Path: "empty.go", CreationYear: 2022, LastEditionYear: 2022}},
+		}
+
+		Run(&configuration, fileSystem)
+	})
+
+	It("writes the header of empty files when asked to", func() {
+		fakeFile := new(fs_mocks.File)
+		fileReader.On("Read", "empty.go").Return([]byte{}, nil).Once()
+		fileWriter.On("Open", "empty.go", os.O_WRONLY|os.O_TRUNC, os.ModeAppend).Return(fakeFile, nil).Once()
+		fakeFile.On("Write", []byte("// Copyright 2022 ACME\n\n")).Return(nil).Once()
+		fakeFile.On("Close").Return(nil).Once()
+
+		configuration := ChangeSet{
+			HeaderRegex:           regexp.MustCompile("// Copyright .* ACME\n?"),
+			HeaderContents:        "// Copyright {{.YearRange}} ACME",
+			CommentStyle:          SlashSlash{},
+			AddHeaderToEmptyFiles: true,
+			Files:                 []vcs.FileChange{{Path: "empty.go", CreationYear: 2022, LastEditionYear: 2022}},
+		}
+
+		Run(&configuration, fileSystem)
+	})
+
+	It("leaves binary files untouched", func() {
+		fileReader.On("Read", "logo.png").
+			Return([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), nil).
+			Once()
+
+		configuration := ChangeSet{
+			HeaderRegex:       regexp.MustCompile("// Copyright .* ACME\n?"),
+			HeaderContents:    "// Copyright {{.YearRange}} ACME",
+			CommentStyle:      SlashSlash{},
+			SkipUnknownStyles: true,
+			Files:             []vcs.FileChange{{Path: "logo.png", CreationYear: 2022, LastEditionYear: 2022}},
+		}
+
+		Run(&configuration, fileSystem)
+	})
+
+	It("only computes the history of the files it writes the header of when loaded lazily", func() {
+		fakeFile := new(fs_mocks.File)
+		fileReader.On("Read", "empty.go").Return([]byte{}, nil).Once()
+		fileReader.On("Read", "logo.png").Return([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), nil).Once()
+		fileReader.On("Read", "main.go").Return([]byte("package main"), nil).Once()
+		fileWriter.On("Open", "main.go", os.O_WRONLY|os.O_TRUNC, os.ModeAppend).Return(fakeFile, nil).Once()
+		fakeFile.On("Write", []byte("// Copyright 2018-2022 ACME"+delimiter+"package main")).Return(nil).Once()
+		fakeFile.On("Close").Return(nil).Once()
+		loadedPaths := make([]string, 0)
+		configuration := ChangeSet{
+			HeaderRegex:       regexp.MustCompile("// Copyright .* ACME\n?"),
+			HeaderContents:    "// Copyright {{.YearRange}} ACME",
+			CommentStyle:      SlashSlash{},
+			SkipUnknownStyles: true,
+			Files:             []vcs.FileChange{{Path: "empty.go"}, {Path: "logo.png"}, {Path: "main.go"}},
+			HistoryLoader: func(changes []vcs.FileChange) ([]vcs.FileChange, error) {
+				result := make([]vcs.FileChange, len(changes))
+				for i, change := range changes {
+					loadedPaths = append(loadedPaths, change.Path)
+					change.CreationYear = 2018
+					change.LastEditionYear = 2022
+					result[i] = change
+				}
+				return result, nil
+			},
+		}
+
+		Run(&configuration, fileSystem)
+
+		Expect(loadedPaths).To(Equal([]string{"main.go"}))
+	})
+
+	It("replaces headers ending with the marker whatever their wording", func() {
+		oldHeader := "// Licensed under MIT\n// by Someone\n// managed by headache"
+		newHeader := "// Copyright 2022 ACME\n// managed by headache"
+		fakeFile := new(fs_mocks.File)
+		fileContents := "hello\nworld"
+		fileName := "some-file-1"
+		fileReader.On("Read", fileName).
+			Return([]byte(oldHeader+"\n\n"+fileContents), nil).
+			Once()
+		fileWriter.On("Open", fileName, os.O_WRONLY|os.O_TRUNC, os.ModeAppend).
+			Return(fakeFile, nil).
+			Once()
+		fakeFile.On("Write", []byte(newHeader+"\n\n"+fileContents)).Return(nil).Once()
+		fakeFile.On("Close").Return(nil).Once()
+
+		configuration := ChangeSet{
+			HeaderRegex:    regexp.MustCompile(ComputeMarkerRegex("managed by headache", SlashSlash{})),
+			HeaderContents: "// Copyright {{.YearRange}} ACME\n// managed by headache",
+			CommentStyle:   SlashSlash{},
+			Files:          []vcs.FileChange{{Path: fileName, CreationYear: 2022, LastEditionYear: 2022}},
+		}
+
+		Run(&configuration, fileSystem)
+	})
+
+	It("replaces headers declaring the expected copyright with an outdated license", func() {
+		oldHeader := "/*\n * Copyright 2020-2022 ACME\n *\n * Licensed under MIT\n */"
+		newHeader := "/*\n * Copyright 2020-2022 ACME\n *\n * Licensed under Apache 2\n */"
+		fakeFile := new(fs_mocks.File)
+		fileContents := "/* third-party notice */\nhello\nworld"
+		fileName := "some-file-1"
+		fileReader.On("Read", fileName).
+			Return([]byte(oldHeader+delimiter+fileContents), nil).
+			Once()
+		fileWriter.On("Open", fileName, os.O_WRONLY|os.O_TRUNC, os.ModeAppend).
+			Return(fakeFile, nil).
+			Once()
+		fakeFile.On("Write", []byte(newHeader+delimiter+fileContents)).Return(nil).Once()
+		fakeFile.On("Close").Return(nil).Once()
+
+		configuration := ChangeSet{
+			HeaderRegex:    getRegexWithParams(map[string]string{"YearRange": ""}, "Copyright {{.YearRange}} ACME", "", "Licensed under Apache 2"),
+			HeaderContents: "/*\n * Copyright {{.YearRange}} ACME\n *\n * Licensed under Apache 2\n */",
+			CommentStyle:   SlashStar{},
+			Files:          []vcs.FileChange{{Path: fileName, CreationYear: 2020, LastEditionYear: 2022}},
+		}
+
+		Run(&configuration, fileSystem)
+	})
+
+	It("replaces headers with an outdated license up to their actual end when comments nest", func() {
+		oldHeader := "/*\n * Copyright 2020-2022 ACME\n *\n * Licensed under MIT /* see LICENSE */\n */"
+		newHeader := "/*\n * Copyright 2020-2022 ACME\n *\n * Licensed under Apache 2\n */"
+		fakeFile := new(fs_mocks.File)
+		fileContents := "/* outer /* inner */ still outer */\nhello\nworld"
+		fileName := "some-file-1"
+		fileReader.On("Read", fileName).
+			Return([]byte(oldHeader+delimiter+fileContents), nil).
+			Once()
+		fileWriter.On("Open", fileName, os.O_WRONLY|os.O_TRUNC, os.ModeAppend).
+			Return(fakeFile, nil).
+			Once()
+		fakeFile.On("Write", []byte(newHeader+delimiter+fileContents)).Return(nil).Once()
+		fakeFile.On("Close").Return(nil).Once()
+
+		configuration := ChangeSet{
+			HeaderRegex:    getRegexWithParams(map[string]string{"YearRange": ""}, "Copyright {{.YearRange}} ACME", "", "Licensed under Apache 2"),
+			HeaderContents: "/*\n * Copyright {{.YearRange}} ACME\n *\n * Licensed under Apache 2\n */",
+			CommentStyle:   NestedComments(SlashStar{}),
+			Files:          []vcs.FileChange{{Path: fileName, CreationYear: 2020, LastEditionYear: 2022}},
+		}
+
+		Run(&configuration, fileSystem)
+	})
+
+	It("bounds the top comment by its closing token, nested comments included when comments nest", func() {
+		contents := "/* header /* nested */ header */\n/* outer /* inner */ still outer */\npackage main"
+
+		Expect(extractTopComment(contents, NestedComments(SlashStar{}))).To(Equal("/* header /* nested */ header */"))
+		Expect(extractTopComment(contents, SlashStar{})).To(Equal("/* header /* nested */"))
+	})
+
+	It("keeps third-party headers below the added header", func() {
+		oldHeader := "/*\n * Copyright 2015 Someone Else\n *\n * Licensed under MIT\n */"
+		newHeader := "/*\n * Copyright 2020-2022 ACME\n *\n * Licensed under Apache 2\n */"
+		fakeFile := new(fs_mocks.File)
+		fileContents := "hello\nworld"
+		fileName := "some-file-1"
+		fileReader.On("Read", fileName).
+			Return([]byte(oldHeader+delimiter+fileContents), nil).
+			Once()
+		fileWriter.On("Open", fileName, os.O_WRONLY|os.O_TRUNC, os.ModeAppend).
+			Return(fakeFile, nil).
+			Once()
+		fakeFile.On("Write", []byte(newHeader+delimiter+oldHeader+delimiter+fileContents)).Return(nil).Once()
+		fakeFile.On("Close").Return(nil).Once()
+
+		configuration := ChangeSet{
+			HeaderRegex:    getRegexWithParams(map[string]string{"YearRange": ""}, "Copyright {{.YearRange}} ACME", "", "Licensed under Apache 2"),
+			HeaderContents: "/*\n * Copyright {{.YearRange}} ACME\n *\n * Licensed under Apache 2\n */",
+			CommentStyle:   SlashStar{},
+			Files:          []vcs.FileChange{{Path: fileName, CreationYear: 2020, LastEditionYear: 2022}},
+		}
+
+		Run(&configuration, fileSystem)
+	})
+
+	Describe("with minified files", func() {
+
+		var (
+			minifiedContents string
+			configuration    ChangeSet
+		)
+
+		BeforeEach(func() {
+			minifiedContents = strings.Repeat("a.b(c);", 100000/7)
+			configuration = ChangeSet{
+				HeaderRegex:    regexp.MustCompile(ComputeMarkerRegex("managed by headache", SlashStar{})),
+				HeaderContents: "/*\n * Copyright {{.YearRange}} ACME\n * managed by headache\n */",
+				CommentStyle:   SlashStar{},
+				Files:          []vcs.FileChange{{Path: "app.min.js", CreationYear: 2022, LastEditionYear: 2022}},
+			}
+		})
+
+		It("inserts the header above the single line of the file", func() {
+			fakeFile := new(fs_mocks.File)
+			fileReader.On("Read", "app.min.js").Return([]byte(minifiedContents), nil).Once()
+			fileWriter.On("Open", "app.min.js", os.O_WRONLY|os.O_TRUNC, os.ModeAppend).Return(fakeFile, nil).Once()
+			fakeFile.On("Write", []byte("/*\n * Copyright 2022 ACME\n * managed by headache\n */"+delimiter+minifiedContents)).
+				Return(nil).Once()
+			fakeFile.On("Close").Return(nil).Once()
+
+			Run(&configuration, fileSystem)
+		})
+
+		It("detects the inserted header", func() {
+			headedContents := "/*\n * Copyright 2022 ACME\n * managed by headache\n */" + delimiter + minifiedContents
+			fileReader.On("Read", "app.min.js").Return([]byte(headedContents), nil).Once()
+
+			Run(&configuration, fileSystem)
+		})
+
+		It("replaces headers whose lines were joined by minifiers", func() {
+			fakeFile := new(fs_mocks.File)
+			fileReader.On("Read", "app.min.js").
+				Return([]byte("/*! Copyright 2021 ACME * managed by headache */"+minifiedContents), nil).Once()
+			fileWriter.On("Open", "app.min.js", os.O_WRONLY|os.O_TRUNC, os.ModeAppend).Return(fakeFile, nil).Once()
+			fakeFile.On("Write", []byte("/*\n * Copyright 2021-2022 ACME\n * managed by headache\n */"+delimiter+minifiedContents)).
+				Return(nil).Once()
+			fakeFile.On("Close").Return(nil).Once()
+
+			Run(&configuration, fileSystem)
+		})
+	})
+
 	It("preserves existing start year when it is lower than the configured one", func() {
 		oldHeader := "// Copyright 2014 ACME"
 		newHeader := "// Copyright 2014-2022 ACME"
 		fakeFile := new(fs_mocks.File)
-		fileContents := "hello\nworld"
-		fileName := "some-file-1"
+		fileContents := "hello\nworld"
+		fileName := "some-file-1"
+		fileReader.On("Read", fileName).
+			Return([]byte(oldHeader+delimiter+fileContents), nil).
+			Once()
+		fileWriter.On("Open", fileName, os.O_WRONLY|os.O_TRUNC, os.ModeAppend).
+			Return(fakeFile, nil).
+			Once()
+		fakeFile.On(
+			"Write",
+			[]byte(newHeader+delimiter+fileContents)).Return(nil).Once()
+		fakeFile.On("Close").Return(nil).Once()
+
+		configuration := ChangeSet{
+			HeaderRegex: getRegexWithParams(map[string]string{
+				"Year":    "{{.Year}}",
+				"Company": "ACME",
+			}, "Copyright {{.Year}} {{.Company}}"),
+			HeaderContents: newHeader,
+			Files:          []vcs.FileChange{{Path: fileName, CreationYear: 2016, LastEditionYear: 2022}},
+		}
+
+		Run(&configuration, fileSystem)
+	})
+
+	It("does not rewrite files with an up-to-date header", func() {
+		header := "// Copyright 2014-2022 ACME"
+		fileName := "some-file-1"
+		fileReader.On("Read", fileName).
+			Return([]byte(header+"\nhello\nworld"), nil).
+			Once()
+
+		configuration := ChangeSet{
+			HeaderRegex: getRegexWithParams(map[string]string{
+				"Year":    "{{.Year}}",
+				"Company": "ACME",
+			}, "Copyright {{.Year}} {{.Company}}"),
+			HeaderContents: "// Copyright {{.YearRange}} ACME",
+			CommentStyle:   SlashSlash{},
+			Files:          []vcs.FileChange{{Path: fileName, CreationYear: 2014, LastEditionYear: 2022}},
+		}
+
+		Run(&configuration, fileSystem)
+	})
+
+	It("does not rewrite files with an up-to-date header stripped of its trailing whitespace", func() {
+		fileName := "some-file-1"
+		fileReader.On("Read", fileName).
+			Return([]byte("/*\n * Copyright 2014-2022 ACME\n *\n * Licensed under\n * Some license\n */\n\nhello\nworld"), nil).
+			Once()
+
+		configuration := ChangeSet{
+			HeaderRegex: getRegexWithParams(map[string]string{
+				"Year":    "{{.Year}}",
+				"Company": "ACME",
+			}, "Copyright {{.Year}} {{.Company}}", "", "Licensed under  ", "Some license"),
+			HeaderContents: "/*\n * Copyright {{.YearRange}} ACME\n *\n * Licensed under  \n * Some license\n */",
+			CommentStyle:   SlashStar{},
+			Files:          []vcs.FileChange{{Path: fileName, CreationYear: 2014, LastEditionYear: 2022}},
+		}
+
+		Run(&configuration, fileSystem)
+	})
+
+	It("only adds headers to files without any in add-only mode", func() {
+		fakeFile := new(fs_mocks.File)
+		fileReader.On("Read", "stale.go").
+			Return([]byte("// Copyright 2014 ACME\n\npackage foo"), nil).
+			Once()
+		fileReader.On("Read", "other-license.go").
+			Return([]byte("// Licensed under MIT\n\npackage foo"), nil).
+			Once()
+		fileReader.On("Read", "bare.go").
+			Return([]byte("package foo"), nil).
+			Once()
+		fileWriter.On("Open", "bare.go", os.O_WRONLY|os.O_TRUNC, os.ModeAppend).
+			Return(fakeFile, nil).
+			Once()
+		fakeFile.On("Write", []byte("// Copyright 2014-2022 ACME\n\npackage foo")).Return(nil).Once()
+		fakeFile.On("Close").Return(nil).Once()
+
+		configuration := ChangeSet{
+			HeaderRegex: getRegexWithParams(map[string]string{
+				"Year":    "{{.Year}}",
+				"Company": "ACME",
+			}, "Copyright {{.Year}} {{.Company}}"),
+			HeaderContents: "// Copyright {{.YearRange}} ACME",
+			CommentStyle:   SlashSlash{},
+			AddOnly:        true,
+			Files: []vcs.FileChange{
+				{Path: "stale.go", CreationYear: 2014, LastEditionYear: 2022},
+				{Path: "other-license.go", CreationYear: 2014, LastEditionYear: 2022},
+				{Path: "bare.go", CreationYear: 2014, LastEditionYear: 2022},
+			},
+		}
+
+		Run(&configuration, fileSystem)
+
+		fakeFile.AssertExpectations(GinkgoT())
+	})
+
+	It("collapses stacked headers into a single one with the union year range", func() {
+		oldHeaders := "// Copyright 2016-2018 ACME\n\n// Copyright 2014 ACME\n"
+		newHeader := "// Copyright 2014-2022 ACME"
+		fakeFile := new(fs_mocks.File)
+		fileContents := "hello\nworld"
+		fileName := "some-file-1"
+		fileReader.On("Read", fileName).
+			Return([]byte(oldHeaders+delimiter+fileContents), nil).
+			Once()
+		fileWriter.On("Open", fileName, os.O_WRONLY|os.O_TRUNC, os.ModeAppend).
+			Return(fakeFile, nil).
+			Once()
+		fakeFile.On(
+			"Write",
+			[]byte(newHeader+delimiter+fileContents)).Return(nil).Once()
+		fakeFile.On("Close").Return(nil).Once()
+		configuration := ChangeSet{
+			HeaderRegex: getRegexWithParams(map[string]string{
+				"Year":    "{{.Year}}",
+				"Company": "ACME",
+			}, "Copyright {{.Year}} {{.Company}}"),
+			HeaderContents: "// Copyright {{.YearRange}} ACME",
+			Files:          []vcs.FileChange{{Path: fileName, CreationYear: 2016, LastEditionYear: 2022}},
+		}
+
+		Run(&configuration, fileSystem)
+	})
+
+	It("inserts the header after the line matching the insertion pattern", func() {
+		header := "/*\n * Copyright 2019 ACME\n */"
+		fakeFile := new(fs_mocks.File)
+		fileContents := "namespace Acme;\n\necho 'hello';"
+		fileName := "index.php"
+		fileReader.On("Read", fileName).
+			Return([]byte("<?php\n"+fileContents), nil).
+			Once()
+		fileWriter.On("Open", fileName, os.O_WRONLY|os.O_TRUNC, os.ModeAppend).
+			Return(fakeFile, nil).
+			Once()
+		fakeFile.On(
+			"Write",
+			[]byte("<?php\n"+header+delimiter+fileContents)).Return(nil).Once()
+		fakeFile.On("Close").Return(nil).Once()
+
+		configuration := ChangeSet{
+			HeaderRegex: getRegexWithParams(map[string]string{
+				"Year":    "{{.Year}}",
+				"Company": "ACME",
+			}, "Copyright {{.Year}} {{.Company}}"),
+			HeaderContents: "/*\n * Copyright {{.YearRange}} ACME\n */",
+			CommentStyle:   SlashStar{},
+			InsertAfter:    regexp.MustCompile(`^<\?php`),
+			Files:          []vcs.FileChange{{Path: fileName, CreationYear: 2019, LastEditionYear: 2019}},
+		}
+
+		Run(&configuration, fileSystem)
+	})
+
+	It("does not rewrite files with an up-to-date header after the insertion pattern", func() {
+		fileName := "index.php"
+		fileReader.On("Read", fileName).
+			Return([]byte("<?php\n/*\n * Copyright 2019 ACME\n */\n\necho 'hello';"), nil).
+			Once()
+
+		configuration := ChangeSet{
+			HeaderRegex: getRegexWithParams(map[string]string{
+				"Year":    "{{.Year}}",
+				"Company": "ACME",
+			}, "Copyright {{.Year}} {{.Company}}"),
+			HeaderContents: "/*\n * Copyright {{.YearRange}} ACME\n */",
+			CommentStyle:   SlashStar{},
+			InsertAfter:    regexp.MustCompile(`^<\?php`),
+			Files:          []vcs.FileChange{{Path: fileName, CreationYear: 2019, LastEditionYear: 2019}},
+		}
+
+		Run(&configuration, fileSystem)
+	})
+
+	It("inserts the header at the top when the insertion pattern does not match", func() {
+		prologue, contents := splitPrologue("echo 'hello';", regexp.MustCompile(`^<\?php`))
+
+		Expect(prologue).To(BeEmpty())
+		Expect(contents).To(Equal("echo 'hello';"))
+	})
+
+	It("inserts the header between build constraints and the package comment", func() {
+		header := "// Copyright 2019 ACME"
+		fakeFile := new(fs_mocks.File)
+		fileContents := "// Package foo does things\npackage foo"
+		fileName := "foo_linux.go"
+		fileReader.On("Read", fileName).
+			Return([]byte("//go:build linux\n\n"+fileContents), nil).
+			Once()
+		fileWriter.On("Open", fileName, os.O_WRONLY|os.O_TRUNC, os.ModeAppend).
+			Return(fakeFile, nil).
+			Once()
+		fakeFile.On(
+			"Write",
+			[]byte("//go:build linux\n\n"+header+delimiter+fileContents)).Return(nil).Once()
+		fakeFile.On("Close").Return(nil).Once()
+
+		configuration := ChangeSet{
+			HeaderRegex: getRegexWithParams(map[string]string{
+				"Year":    "{{.Year}}",
+				"Company": "ACME",
+			}, "Copyright {{.Year}} {{.Company}}"),
+			HeaderContents: "// Copyright {{.YearRange}} ACME",
+			CommentStyle:   SlashSlash{},
+			Files:          []vcs.FileChange{{Path: fileName, CreationYear: 2019, LastEditionYear: 2019}},
+		}
+
+		Run(&configuration, fileSystem)
+	})
+
+	It("inserts the header right after the shebang", func() {
+		header := "# Copyright 2019 ACME"
+		fakeFile := new(fs_mocks.File)
+		fileContents := "echo 'hello'"
+		fileName := "hello.sh"
 		fileReader.On("Read", fileName).
-			Return([]byte(oldHeader+delimiter+fileContents), nil).
+			Return([]byte("#!/bin/sh\n\n"+fileContents), nil).
 			Once()
 		fileWriter.On("Open", fileName, os.O_WRONLY|os.O_TRUNC, os.ModeAppend).
 			Return(fakeFile, nil).
 			Once()
 		fakeFile.On(
 			"Write",
-			[]byte(newHeader+delimiter+fileContents)).Return(nil).Once()
+			[]byte("#!/bin/sh\n"+header+delimiter+fileContents)).Return(nil).Once()
 		fakeFile.On("Close").Return(nil).Once()
 
 		configuration := ChangeSet{
@@ -279,13 +1016,339 @@ var _ = Describe("Headache", func() {
 				"Year":    "{{.Year}}",
 				"Company": "ACME",
 			}, "Copyright {{.Year}} {{.Company}}"),
-			HeaderContents: newHeader,
-			Files:          []vcs.FileChange{{Path: fileName, CreationYear: 2016, LastEditionYear: 2022}},
+			HeaderContents: "# Copyright {{.YearRange}} ACME",
+			CommentStyle:   Hash{},
+			Files:          []vcs.FileChange{{Path: fileName, CreationYear: 2019, LastEditionYear: 2019}},
+		}
+
+		Run(&configuration, fileSystem)
+	})
+
+	It("does not rewrite files with an up-to-date header below build constraints", func() {
+		fileName := "foo_linux.go"
+		fileReader.On("Read", fileName).
+			Return([]byte("//go:build linux\n\n// Copyright 2019 ACME\n\n// Package foo does things\npackage foo"), nil).
+			Once()
+
+		configuration := ChangeSet{
+			HeaderRegex: getRegexWithParams(map[string]string{
+				"Year":    "{{.Year}}",
+				"Company": "ACME",
+			}, "Copyright {{.Year}} {{.Company}}"),
+			HeaderContents: "// Copyright {{.YearRange}} ACME",
+			CommentStyle:   SlashSlash{},
+			Files:          []vcs.FileChange{{Path: fileName, CreationYear: 2019, LastEditionYear: 2019}},
+		}
+
+		Run(&configuration, fileSystem)
+	})
+
+	It("keeps both build constraint syntaxes above the header", func() {
+		constraints := "//go:build linux\n// +build linux\n"
+		header := "/*\n * Copyright 2019 ACME\n */"
+		fileContents := "package foo\n"
+		expectedContents := constraints + "\n" + header + delimiter + fileContents
+		fakeFile := new(fs_mocks.File)
+		fileName := "foo.go"
+		fileReader.On("Read", fileName).
+			Return([]byte(constraints+"\n"+fileContents), nil).
+			Once()
+		fileWriter.On("Open", fileName, os.O_WRONLY|os.O_TRUNC, os.ModeAppend).
+			Return(fakeFile, nil).
+			Once()
+		fakeFile.On("Write", []byte(expectedContents)).Return(nil).Once()
+		fakeFile.On("Close").Return(nil).Once()
+
+		configuration := ChangeSet{
+			HeaderRegex: getRegexWithParams(map[string]string{
+				"Year":    "{{.Year}}",
+				"Company": "ACME",
+			}, "Copyright {{.Year}} {{.Company}}"),
+			HeaderContents: "/*\n * Copyright {{.YearRange}} ACME\n */",
+			CommentStyle:   SlashStar{},
+			Files:          []vcs.FileChange{{Path: fileName, CreationYear: 2019, LastEditionYear: 2019}},
+		}
+
+		Run(&configuration, fileSystem)
+
+		Expect(compiles(fileName, expectedContents)).To(BeTrue())
+		Expect(matchesBuildConstraints(fileName, expectedContents, "linux")).To(BeTrue())
+		Expect(matchesBuildConstraints(fileName, expectedContents, "windows")).To(BeFalse())
+	})
+
+	It("moves build constraints found below an existing header above it", func() {
+		constraints := "// +build linux\n"
+		header := "/*\n * Copyright 2019 ACME\n */"
+		fileContents := "package foo\n"
+		expectedContents := constraints + "\n" + header + delimiter + fileContents
+		fakeFile := new(fs_mocks.File)
+		fileName := "foo.go"
+		fileReader.On("Read", fileName).
+			Return([]byte(header+delimiter+constraints+"\n"+fileContents), nil).
+			Once()
+		fileWriter.On("Open", fileName, os.O_WRONLY|os.O_TRUNC, os.ModeAppend).
+			Return(fakeFile, nil).
+			Once()
+		fakeFile.On("Write", []byte(expectedContents)).Return(nil).Once()
+		fakeFile.On("Close").Return(nil).Once()
+
+		configuration := ChangeSet{
+			HeaderRegex: getRegexWithParams(map[string]string{
+				"Year":    "{{.Year}}",
+				"Company": "ACME",
+			}, "Copyright {{.Year}} {{.Company}}"),
+			HeaderContents: "/*\n * Copyright {{.YearRange}} ACME\n */",
+			CommentStyle:   SlashStar{},
+			Files:          []vcs.FileChange{{Path: fileName, CreationYear: 2019, LastEditionYear: 2019}},
+		}
+
+		Run(&configuration, fileSystem)
+
+		Expect(matchesBuildConstraints(fileName, expectedContents, "windows")).To(BeFalse())
+	})
+
+	It("only updates the years of an otherwise up-to-date header", func() {
+		fileContents := "\n\n\npackage foo\n"
+		oldContents := "/*\n * Copyright 2018 ACME\n *\n * Some license\n */" + fileContents
+		fakeFile := new(fs_mocks.File)
+		fileName := "foo.go"
+		fileReader.On("Read", fileName).
+			Return([]byte(oldContents), nil).
+			Once()
+		fileWriter.On("Open", fileName, os.O_WRONLY|os.O_TRUNC, os.ModeAppend).
+			Return(fakeFile, nil).
+			Once()
+		var writtenContents string
+		fakeFile.On("Write", mock.Anything).
+			Run(func(args mock.Arguments) { writtenContents = string(args.Get(0).([]byte)) }).
+			Return(nil).
+			Once()
+		fakeFile.On("Close").Return(nil).Once()
+
+		configuration := ChangeSet{
+			HeaderRegex: getRegexWithParams(map[string]string{
+				"Year":    "{{.Year}}",
+				"Company": "ACME",
+			}, "Copyright {{.Year}} {{.Company}}", "", "Some license"),
+			HeaderContents: "/*\n * Copyright {{.YearRange}} ACME\n *\n * Some license\n */",
+			CommentStyle:   SlashStar{},
+			Files:          []vcs.FileChange{{Path: fileName, CreationYear: 2018, LastEditionYear: 2019}},
+		}
+
+		Run(&configuration, fileSystem)
+
+		Expect(changedLines(oldContents, writtenContents)).To(Equal([]string{" * Copyright 2018-2019 ACME"}))
+	})
+
+	It("renders the displayed path and writes to the actual path", func() {
+		fakeFile := new(fs_mocks.File)
+		fileContents := "package main"
+		fileName := "packages/foo/src/main.go"
+		fileReader.On("Read", fileName).
+			Return([]byte(fileContents), nil).
+			Once()
+		fileWriter.On("Open", fileName, os.O_WRONLY|os.O_TRUNC, os.ModeAppend).
+			Return(fakeFile, nil).
+			Once()
+		fakeFile.On(
+			"Write",
+			[]byte("// foo/main.go"+delimiter+fileContents)).Return(nil).Once()
+		fakeFile.On("Close").Return(nil).Once()
+
+		configuration := ChangeSet{
+			HeaderRegex:    getRegexWithParams(map[string]string{"Path": "{{.Path}}"}, "{{.Path}}"),
+			HeaderContents: "// {{.Path}}",
+			Files:          []vcs.FileChange{{Path: fileName, DisplayPath: "foo/main.go"}},
+		}
+
+		Run(&configuration, fileSystem)
+	})
+
+	It("inserts headers after the byte order mark of files starting with one", func() {
+		fakeFile := new(fs_mocks.File)
+		fileName := "some-file-1"
+		fileReader.On("Read", fileName).Return([]byte("\uFEFFhello\nworld"), nil).Once()
+		fileWriter.On("Open", fileName, os.O_WRONLY|os.O_TRUNC, os.ModeAppend).Return(fakeFile, nil).Once()
+		fakeFile.On("Write", []byte("\uFEFF// some header"+delimiter+"hello\nworld")).Return(nil).Once()
+		fakeFile.On("Close").Return(nil).Once()
+		configuration := ChangeSet{
+			HeaderRegex:    getRegex("some header"),
+			HeaderContents: "// some header",
+			Files:          []vcs.FileChange{{Path: fileName}},
+		}
+
+		Run(&configuration, fileSystem)
+	})
+
+	It("does not add a byte order mark to files without one", func() {
+		fakeFile := new(fs_mocks.File)
+		fileName := "some-file-1"
+		fileReader.On("Read", fileName).Return([]byte("hello\nworld"), nil).Once()
+		fileWriter.On("Open", fileName, os.O_WRONLY|os.O_TRUNC, os.ModeAppend).Return(fakeFile, nil).Once()
+		fakeFile.On("Write", []byte("// some header"+delimiter+"hello\nworld")).Return(nil).Once()
+		fakeFile.On("Close").Return(nil).Once()
+		configuration := ChangeSet{
+			HeaderRegex:    getRegex("some header"),
+			HeaderContents: "// some header",
+			Files:          []vcs.FileChange{{Path: fileName}},
+		}
+
+		Run(&configuration, fileSystem)
+	})
+
+	It("leaves up-to-date headers following a byte order mark untouched", func() {
+		fileName := "some-file-1"
+		fileReader.On("Read", fileName).Return([]byte("\uFEFF// some header"+delimiter+"hello\nworld"), nil).Once()
+		configuration := ChangeSet{
+			HeaderRegex:    getRegex("some header"),
+			HeaderContents: "// some header",
+			Files:          []vcs.FileChange{{Path: fileName}},
+		}
+
+		Run(&configuration, fileSystem)
+	})
+
+	It("updates years in place after the byte order mark", func() {
+		fakeFile := new(fs_mocks.File)
+		fileName := "some-file-1"
+		fileReader.On("Read", fileName).Return([]byte("\uFEFF// Copyright 2018 ACME"+delimiter+"hello"), nil).Once()
+		fileWriter.On("Open", fileName, os.O_WRONLY|os.O_TRUNC, os.ModeAppend).Return(fakeFile, nil).Once()
+		fakeFile.On("Write", []byte("\uFEFF// Copyright 2018-2019 ACME"+delimiter+"hello")).Return(nil).Once()
+		fakeFile.On("Close").Return(nil).Once()
+		configuration := ChangeSet{
+			HeaderRegex:    regexp.MustCompile(`(?m)^// Copyright .* ACME\n?`),
+			HeaderContents: "// Copyright {{.YearRange}} ACME",
+			Files:          []vcs.FileChange{{Path: fileName, CreationYear: 2018, LastEditionYear: 2019}},
+		}
+
+		Run(&configuration, fileSystem)
+	})
+
+	It("writes headers with LF line breaks by default, whatever the line breaks of the file", func() {
+		fakeFile := new(fs_mocks.File)
+		fileName := "some-file-1"
+		fileReader.On("Read", fileName).Return([]byte("hello\r\nworld"), nil).Once()
+		fileWriter.On("Open", fileName, os.O_WRONLY|os.O_TRUNC, os.ModeAppend).Return(fakeFile, nil).Once()
+		fakeFile.On("Write", []byte("/*\n * some header\n */\n\nhello\r\nworld")).Return(nil).Once()
+		fakeFile.On("Close").Return(nil).Once()
+		configuration := ChangeSet{
+			HeaderRegex:    getRegex("some header"),
+			HeaderContents: "/*\r\n * some header\r\n */",
+			Files:          []vcs.FileChange{{Path: fileName}},
+			LineEnding:     LfLineEnding,
+		}
+
+		Run(&configuration, fileSystem)
+	})
+
+	It("writes headers with CRLF line breaks when asked to", func() {
+		fakeFile := new(fs_mocks.File)
+		fileName := "some-file-1"
+		fileReader.On("Read", fileName).Return([]byte("hello\nworld"), nil).Once()
+		fileWriter.On("Open", fileName, os.O_WRONLY|os.O_TRUNC, os.ModeAppend).Return(fakeFile, nil).Once()
+		fakeFile.On("Write", []byte("/*\r\n * some header\r\n */\r\n\r\nhello\nworld")).Return(nil).Once()
+		fakeFile.On("Close").Return(nil).Once()
+		configuration := ChangeSet{
+			HeaderRegex:    getRegex("some header"),
+			HeaderContents: "/*\n * some header\n */",
+			Files:          []vcs.FileChange{{Path: fileName}},
+			LineEnding:     CrlfLineEnding,
 		}
 
 		Run(&configuration, fileSystem)
 	})
 
+	It("writes headers with the line breaks of the file in auto mode", func() {
+		crlfFile := new(fs_mocks.File)
+		lfFile := new(fs_mocks.File)
+		fileReader.On("Read", "crlf-file").Return([]byte("hello\r\nworld"), nil).Once()
+		fileReader.On("Read", "lf-file").Return([]byte("hello\nworld"), nil).Once()
+		fileWriter.On("Open", "crlf-file", os.O_WRONLY|os.O_TRUNC, os.ModeAppend).Return(crlfFile, nil).Once()
+		fileWriter.On("Open", "lf-file", os.O_WRONLY|os.O_TRUNC, os.ModeAppend).Return(lfFile, nil).Once()
+		crlfFile.On("Write", []byte("/*\r\n * some header\r\n */\r\n\r\nhello\r\nworld")).Return(nil).Once()
+		crlfFile.On("Close").Return(nil).Once()
+		lfFile.On("Write", []byte("/*\n * some header\n */\n\nhello\nworld")).Return(nil).Once()
+		lfFile.On("Close").Return(nil).Once()
+		configuration := ChangeSet{
+			HeaderRegex:    getRegex("some header"),
+			HeaderContents: "/*\n * some header\n */",
+			Files:          []vcs.FileChange{{Path: "crlf-file"}, {Path: "lf-file"}},
+			LineEnding:     AutoLineEnding,
+		}
+
+		Run(&configuration, fileSystem)
+	})
+
+	It("does not rewrite files with an up-to-date header with CRLF line breaks in auto mode", func() {
+		fileName := "some-file-1"
+		fileReader.On("Read", fileName).Return([]byte("/*\r\n * some header\r\n */\r\n\r\nhello\r\nworld"), nil).Once()
+		configuration := ChangeSet{
+			HeaderRegex:    getRegex("some header"),
+			HeaderContents: "/*\n * some header\n */",
+			Files:          []vcs.FileChange{{Path: fileName}},
+			LineEnding:     AutoLineEnding,
+		}
+
+		Run(&configuration, fileSystem)
+	})
+
+	It("rewrites the lines of headers with CRLF line breaks with LF line breaks when asked to", func() {
+		fakeFile := new(fs_mocks.File)
+		fileName := "some-file-1"
+		fileReader.On("Read", fileName).Return([]byte("/*\r\n * some header\r\n */\r\n\r\nhello\r\nworld"), nil).Once()
+		fileWriter.On("Open", fileName, os.O_WRONLY|os.O_TRUNC, os.ModeAppend).Return(fakeFile, nil).Once()
+		fakeFile.On("Write", []byte("/*\n * some header\n */\r\n\r\nhello\r\nworld")).Return(nil).Once()
+		fakeFile.On("Close").Return(nil).Once()
+		configuration := ChangeSet{
+			HeaderRegex:    getRegex("some header"),
+			HeaderContents: "/*\n * some header\n */",
+			Files:          []vcs.FileChange{{Path: fileName}},
+			LineEnding:     LfLineEnding,
+		}
+
+		Run(&configuration, fileSystem)
+	})
+
+	It("does not collapse headers separated by other contents", func() {
+		oldHeaders := "// Copyright 2016 ACME\n\nhello\n\n// Copyright 2014 ACME"
+
+		regex := getRegexWithParams(map[string]string{
+			"Year":    "{{.Year}}",
+			"Company": "ACME",
+		}, "Copyright {{.Year}} {{.Company}}")
+
+		contents, headers := splitHeaders(oldHeaders, regex, anchor(regex))
+
+		Expect(contents).To(Equal("hello\n\n// Copyright 2014 ACME"))
+		Expect(headers).To(Equal([]string{"// Copyright 2016 ACME\n"}))
+	})
+
+	It("detects the same headers whether they are at the top or not", func() {
+		regex := getRegexWithParams(map[string]string{"Year": "{{.Year}}", "Company": "ACME"},
+			"Copyright {{.Year}} {{.Company}}", "", "Some license")
+		header := "// Copyright 2016 ACME\n//\n// Some license"
+		for _, contents := range []string{
+			header + "\n\npackage foo",
+			header + "\n\n" + header + "\n\n\npackage foo",
+			header + "\npackage foo\n\n" + header,
+			header + "\n\n/* Copyright 2014 ACME\n *\n * Some license\n */\n\npackage foo",
+			"// Copyright 2016 ACME\n\npackage foo",
+			"// Copyright 2016 ACME\n\n" + header,
+			"#!/bin/sh\n" + header,
+			"\n\n" + header,
+			"package foo\n\n" + header + "\n\n" + header,
+			"package foo",
+			"",
+		} {
+			expectedContents, expectedHeaders := splitHeadersAnywhere(contents, regex)
+
+			actualContents, actualHeaders := splitHeaders(contents, regex, anchor(regex))
+
+			Expect(actualContents).To(Equal(expectedContents), contents)
+			Expect(actualHeaders).To(Equal(expectedHeaders), contents)
+		}
+	})
+
 	It("replaces single future copyright header date with single commit year", func() {
 		change := vcs.FileChange{
 			Path:            "pkg/fileutils/abs_test.go",
@@ -314,12 +1377,152 @@ var _ = Describe("Headache", func() {
 		Expect(startYear).To(Equal(2018))
 		Expect(endYear).To(Equal(2018))
 	})
+
+	It("renders a single year when the file was created and last edited the same year", func() {
+		change := vcs.FileChange{Path: "some-file", CreationYear: 2020, LastEditionYear: 2020}
+
+		header, err := insertYears("// Copyright {{.YearRange}} ACME", &change, nil, CollapsedYearRangeFormat, "")
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(header).To(Equal("// Copyright 2020 ACME"))
+	})
+
+	It("renders a year range when the file was last edited after its creation year", func() {
+		change := vcs.FileChange{Path: "some-file", CreationYear: 2018, LastEditionYear: 2020}
+
+		header, err := insertYears("// Copyright {{.YearRange}} ACME", &change, nil, CollapsedYearRangeFormat, "")
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(header).To(Equal("// Copyright 2018-2020 ACME"))
+	})
+
+	It("renders single years as ranges when the year range is expanded", func() {
+		change := vcs.FileChange{Path: "some-file", CreationYear: 2020, LastEditionYear: 2020}
+
+		header, err := insertYears("// Copyright {{.YearRange}} ACME", &change, nil, ExpandedYearRangeFormat, "")
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(header).To(Equal("// Copyright 2020-2020 ACME"))
+	})
+
+	It("adds the last edition year to the years listed by the existing header", func() {
+		change := vcs.FileChange{Path: "some-file", CreationYear: 2019, LastEditionYear: 2023}
+
+		header, err := insertYears("// Copyright {{.YearRange}} ACME", &change, []string{"// Copyright 2018, 2020 ACME"}, ListYearRangeFormat, "")
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(header).To(Equal("// Copyright 2018, 2020, 2023 ACME"))
+	})
+
+	It("keeps listed years as they are when they already include the last edition year", func() {
+		change := vcs.FileChange{Path: "some-file", CreationYear: 2018, LastEditionYear: 2020}
+
+		header, err := insertYears("// Copyright {{.YearRange}} ACME", &change, []string{"// Copyright 2018, 2020 ACME"}, ListYearRangeFormat, "")
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(header).To(Equal("// Copyright 2018, 2020 ACME"))
+	})
+
+	It("lists the creation and last edition years of files without header", func() {
+		change := vcs.FileChange{Path: "some-file", CreationYear: 2020, LastEditionYear: 2020}
+
+		header, err := insertYears("// Copyright {{.YearRange}} ACME", &change, nil, ListYearRangeFormat, "")
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(header).To(Equal("// Copyright 2020 ACME"))
+	})
+
+	It("renders the last edition date as an ISO date by default", func() {
+		change := vcs.FileChange{
+			Path:            "some-file",
+			CreationYear:    2020,
+			LastEditionYear: 2024,
+			CreationTime:    time.Date(2020, time.June, 1, 9, 30, 0, 0, time.UTC),
+			LastEditionTime: time.Date(2024, time.March, 15, 16, 45, 0, 0, time.UTC),
+		}
+
+		header, err := insertYears("// Created: {{.CreationDate}}, last modified: {{.LastEditionDate}}", &change, nil, "", "")
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(header).To(Equal("// Created: 2020-06-01, last modified: 2024-03-15"))
+	})
+
+	It("renders dates in UTC with the configured layout", func() {
+		paris := time.FixedZone("CET", 3600)
+		change := vcs.FileChange{
+			Path:            "some-file",
+			CreationYear:    2024,
+			LastEditionYear: 2024,
+			LastEditionTime: time.Date(2024, time.March, 16, 0, 30, 0, 0, paris),
+		}
+
+		header, err := insertYears("// Last modified: {{.LastEditionDate}}", &change, nil, "", "January 2, 2006 15:04 MST")
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(header).To(Equal("// Last modified: March 15, 2024 23:30 UTC"))
+	})
 })
 
+// reference implementation of splitHeaders, only relying on the unanchored header regex
+func splitHeadersAnywhere(contents string, headerRegex *regexp.Regexp) (string, []string) {
+	matchLocation := headerRegex.FindStringIndex(contents)
+	if matchLocation == nil {
+		return contents, nil
+	}
+	headers := []string{contents[matchLocation[0]:matchLocation[1]]}
+	before := contents[:matchLocation[0]]
+	after := contents[matchLocation[1]:]
+	for {
+		trimmedAfter := strings.TrimLeft(after, "\n")
+		nextMatchLocation := headerRegex.FindStringIndex(trimmedAfter)
+		if nextMatchLocation == nil || nextMatchLocation[0] != 0 {
+			break
+		}
+		headers = append(headers, trimmedAfter[:nextMatchLocation[1]])
+		after = trimmedAfter[nextMatchLocation[1]:]
+	}
+	if strings.HasSuffix(before, "\n\n") {
+		after = strings.TrimLeft(after, "\n")
+	}
+	return strings.TrimLeft(before+after, "\n"), headers
+}
+
 func getRegex(headerLines ...string) *regexp.Regexp {
 	return getRegexWithParams(map[string]string{}, headerLines...)
 }
 
+// returns the lines of the new contents which differ from the lines of the old contents at the same position
+func changedLines(oldContents string, newContents string) []string {
+	oldLines := strings.Split(oldContents, "\n")
+	newLines := strings.Split(newContents, "\n")
+	Expect(newLines).To(HaveLen(len(oldLines)))
+	result := make([]string, 0)
+	for i, line := range newLines {
+		if line != oldLines[i] {
+			result = append(result, line)
+		}
+	}
+	return result
+}
+
+func compiles(fileName string, contents string) bool {
+	_, err := parser.ParseFile(token.NewFileSet(), fileName, contents, parser.ParseComments)
+	return err == nil
+}
+
+func matchesBuildConstraints(fileName string, contents string, goos string) bool {
+	context := build.Default
+	context.GOOS = goos
+	context.OpenFile = func(string) (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader(contents)), nil
+	}
+	matches, err := context.MatchFile(".", fileName)
+	if err != nil {
+		panic(err)
+	}
+	return matches
+}
+
 func getRegexWithParams(params map[string]string, headerLines ...string) *regexp.Regexp {
 	regex, err := ComputeDetectionRegex(headerLines, params)
 	if err != nil {
@@ -0,0 +1,150 @@
+/*
+ * Copyright 2018 Florent Biville (@fbiville)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"fmt"
+	"github.com/fbiville/headache/fs"
+	"github.com/fbiville/headache/vcs"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const holderParameter = "{{.Holder}}"
+
+var expandedHolderRegex = regexp.MustCompile(`\{\{index \. "Holder#(\d+)"\}\}`)
+
+// HolderOverride is the header of the files matching a path pattern, rendered for another copyright holder
+type HolderOverride struct {
+	Pattern        string
+	HeaderContents string
+	DetectionRegex *regexp.Regexp
+}
+
+// repeats the template lines referencing {{.Holder}} once per copyright holder, sorted and deduplicated
+// each repeated line references its own holder data parameter, so that detection regexes match any holder
+func expandHolders(template *HeaderTemplate, holders []string) *HeaderTemplate {
+	holders = distinctSortedHolders(holders)
+	if len(holders) == 0 {
+		return template
+	}
+	data := make(map[string]string, len(template.Data)+len(holders))
+	for key, value := range template.Data {
+		data[key] = value
+	}
+	lines := make([]string, 0, len(template.Lines))
+	for _, line := range template.Lines {
+		if !strings.Contains(line, holderParameter) {
+			lines = append(lines, line)
+			continue
+		}
+		for i, holder := range holders {
+			key := fmt.Sprintf("Holder#%d", i+1)
+			data[key] = holder
+			lines = append(lines, strings.Replace(line, holderParameter, fmt.Sprintf(`{{index . %q}}`, key), -1))
+		}
+	}
+	return &HeaderTemplate{Lines: lines, Data: data}
+}
+
+func distinctSortedHolders(holders []string) []string {
+	result := make([]string, 0, len(holders))
+	seenHolders := make(map[string]struct{})
+	for _, holder := range holders {
+		holder = strings.TrimSpace(holder)
+		if _, seen := seenHolders[holder]; seen || holder == "" {
+			continue
+		}
+		seenHolders[holder] = struct{}{}
+		result = append(result, holder)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// renders the header of the files matching each holder override pattern, sorted by pattern
+// this must run before the default header gets parsed, as parsing alters the template data
+func parseHolderOverrides(config *Configuration, versionedTemplate *VersionedHeaderTemplate, style CommentStyle) ([]HolderOverride, error) {
+	patterns := make([]string, 0, len(config.HolderOverrides))
+	for pattern := range config.HolderOverrides {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	result := make([]HolderOverride, 0, len(patterns))
+	for _, pattern := range patterns {
+		holder := config.HolderOverrides[pattern]
+		contents, err := ParseTemplate(&VersionedHeaderTemplate{
+			Current:  overrideHolder(versionedTemplate.Current, holder),
+			Previous: overrideHolder(versionedTemplate.Previous, holder),
+			Revision: versionedTemplate.Revision,
+		}, style, config.HeaderFormats[style.GetName()])
+		if err != nil {
+			return nil, fmt.Errorf("invalid holder override for %q\n\t%v", pattern, err)
+		}
+		result = append(result, HolderOverride{
+			Pattern:        pattern,
+			HeaderContents: contents.ActualContent,
+			DetectionRegex: contents.DetectionRegex,
+		})
+	}
+	return result, nil
+}
+
+// replaces the holders of the template with the given one, the template being left untouched
+func overrideHolder(template *HeaderTemplate, holder string) *HeaderTemplate {
+	data := make(map[string]string, len(template.Data)+1)
+	for key, value := range template.Data {
+		data[key] = value
+	}
+	data["Holder"] = holder
+	lines := make([]string, 0, len(template.Lines))
+	for _, line := range template.Lines {
+		if match := expandedHolderRegex.FindStringSubmatch(line); match != nil {
+			// holders were expanded, only the line of the first one is kept
+			if match[1] != "1" {
+				continue
+			}
+			data["Holder#1"] = holder
+		}
+		lines = append(lines, line)
+	}
+	return &HeaderTemplate{Lines: lines, Data: data}
+}
+
+// the headers of the holder overrides are detected as well as the default one
+func withHolderOverrides(headerRegex *regexp.Regexp, overrides []HolderOverride) (*regexp.Regexp, error) {
+	if len(overrides) == 0 {
+		return headerRegex, nil
+	}
+	pattern := headerRegex.String()
+	for _, override := range overrides {
+		pattern = fmt.Sprintf(`%s|(?:%s)`, pattern, override.DetectionRegex)
+	}
+	return regexp.Compile(pattern)
+}
+
+// returns the header the file gets, the one of the first holder override matching its path if any, the default one
+// otherwise
+func headerContents(config *ChangeSet, change vcs.FileChange) string {
+	for _, override := range config.HolderOverrides {
+		if fs.MatchesPath(change.Path, override.Pattern) {
+			return override.HeaderContents
+		}
+	}
+	return config.HeaderContents
+}
@@ -0,0 +1,151 @@
+/*
+ * Copyright 2018 Florent Biville (@fbiville)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"github.com/fbiville/headache/fs"
+	"github.com/fbiville/headache/fs_mocks"
+	"github.com/fbiville/headache/vcs"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Copyright holders", func() {
+
+	var headerTemplate *HeaderTemplate
+
+	BeforeEach(func() {
+		headerTemplate = &HeaderTemplate{
+			Lines: []string{"Copyright {{.YearRange}} {{.Holder}}", "", "Licensed under {{.License}}"},
+			Data:  map[string]string{"License": "Apache 2"},
+		}
+	})
+
+	It("renders one line per holder, sorted and deduplicated", func() {
+		template := expandHolders(headerTemplate, []string{"Zeta Corp", "ACME", "Zeta Corp"})
+		versionedTemplate := &VersionedHeaderTemplate{Current: template, Previous: template}
+
+		result, err := ParseTemplate(versionedTemplate, SlashSlash{}, HeaderFormat{})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.ActualContent).To(Equal("// Copyright {{.YearRange}} ACME\n" +
+			"// Copyright {{.YearRange}} Zeta Corp\n" +
+			"//\n" +
+			"// Licensed under Apache 2"))
+	})
+
+	It("leaves templates untouched without holders", func() {
+		Expect(expandHolders(headerTemplate, nil)).To(BeIdenticalTo(headerTemplate))
+	})
+
+	It("detects the rendered holder block as up to date", func() {
+		t := GinkgoT()
+		template := expandHolders(headerTemplate, []string{"Zeta Corp", "ACME"})
+		parsedTemplate, err := ParseTemplate(&VersionedHeaderTemplate{Current: template, Previous: template}, SlashSlash{}, HeaderFormat{})
+		Expect(err).NotTo(HaveOccurred())
+		fileReader := new(fs_mocks.FileReader)
+		fileReader.On("Read", "headed.go").Return([]byte("// Copyright 2018-2019 ACME\n"+
+			"// Copyright 2018-2019 Zeta Corp\n"+
+			"//\n"+
+			"// Licensed under Apache 2\n\npackage foo"), nil)
+		fileReader.On("Read", "single-holder.go").Return([]byte("// Copyright 2018-2019 ACME\n"+
+			"//\n"+
+			"// Licensed under Apache 2\n\npackage foo"), nil)
+		changeSet := &ChangeSet{
+			HeaderContents: parsedTemplate.ActualContent,
+			HeaderRegex:    parsedTemplate.DetectionRegex,
+			CommentStyle:   SlashSlash{},
+			Files: []vcs.FileChange{
+				{Path: "headed.go", CreationYear: 2018, LastEditionYear: 2019},
+				{Path: "single-holder.go", CreationYear: 2018, LastEditionYear: 2019},
+			},
+		}
+
+		verdicts, err := Check(changeSet, &fs.FileSystem{FileReader: fileReader})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(verdicts).To(Equal([]Verdict{{Path: "single-holder.go", Reason: HeaderWithDifferentWording}}))
+		fileReader.AssertExpectations(t)
+	})
+
+	Describe("with holder overrides", func() {
+
+		var (
+			config    *Configuration
+			changeSet *ChangeSet
+		)
+
+		BeforeEach(func() {
+			headerTemplate.Data["Holder"] = "ACME"
+			config = &Configuration{HolderOverrides: map[string]string{"vendor/**/*.go": "Third Party"}}
+		})
+
+		JustBeforeEach(func() {
+			versionedTemplate := &VersionedHeaderTemplate{Current: headerTemplate, Previous: headerTemplate}
+			overrides, err := parseHolderOverrides(config, versionedTemplate, SlashSlash{})
+			Expect(err).NotTo(HaveOccurred())
+			parsedTemplate, err := ParseTemplate(versionedTemplate, SlashSlash{}, HeaderFormat{})
+			Expect(err).NotTo(HaveOccurred())
+			headerRegex, err := withHolderOverrides(parsedTemplate.DetectionRegex, overrides)
+			Expect(err).NotTo(HaveOccurred())
+			changeSet = &ChangeSet{
+				HeaderContents:  parsedTemplate.ActualContent,
+				HeaderRegex:     headerRegex,
+				HolderOverrides: overrides,
+				CommentStyle:    SlashSlash{},
+			}
+		})
+
+		It("renders the overriding holder in the headers of matching files only", func() {
+			vendored, err := updatedContents(vcs.FileChange{Path: "vendor/lib/lib.go", CreationYear: 2019, LastEditionYear: 2019},
+				[]byte("package lib"), changeSet)
+			Expect(err).NotTo(HaveOccurred())
+			owned, err := updatedContents(vcs.FileChange{Path: "pkg/main.go", CreationYear: 2019, LastEditionYear: 2019},
+				[]byte("package main"), changeSet)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(string(vendored)).To(Equal("// Copyright 2019 Third Party\n//\n// Licensed under Apache 2\n\npackage lib"))
+			Expect(string(owned)).To(Equal("// Copyright 2019 ACME\n//\n// Licensed under Apache 2\n\npackage main"))
+		})
+
+		It("detects the headers of the overriding holder as up to date", func() {
+			vendored := "// Copyright 2019 Third Party\n//\n// Licensed under Apache 2\n\npackage lib"
+
+			result, err := updatedContents(vcs.FileChange{Path: "vendor/lib/lib.go", CreationYear: 2019, LastEditionYear: 2019},
+				[]byte(vendored), changeSet)
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(BeNil())
+		})
+
+		Context("and expanded holders", func() {
+
+			BeforeEach(func() {
+				headerTemplate = expandHolders(headerTemplate, []string{"Zeta Corp", "ACME"})
+			})
+
+			It("renders the overriding holder alone", func() {
+				result, err := updatedContents(vcs.FileChange{Path: "vendor/lib/lib.go", CreationYear: 2019, LastEditionYear: 2019},
+					[]byte("package lib"), changeSet)
+
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(result)).To(Equal("// Copyright 2019 Third Party\n//\n// Licensed under Apache 2\n\npackage lib"))
+				Expect(changeSet.HeaderContents).To(HavePrefix("// Copyright {{.YearRange}} ACME\n// Copyright {{.YearRange}} Zeta Corp\n"))
+			})
+		})
+	})
+})
@@ -0,0 +1,254 @@
+/*
+ * Copyright 2018 Florent Biville (@fbiville)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/fbiville/headache/vcs"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Jupyter notebooks are JSON documents, their header is the source of a leading markdown cell rather than a comment
+// written at the top of the file, which would corrupt them
+// markdown cells are never executed, unlike code cells, which kernels would fail on with comment styles they do not
+// support
+const notebookExtension = ".ipynb"
+
+// cell ids are required from nbformat 4.5 on, and rejected before
+const (
+	notebookHeaderCellId       = "license-header"
+	notebookCellIdMinorVersion = 5
+)
+
+func isNotebook(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), notebookExtension)
+}
+
+// notebook keeps the parsed parts of the document it needs and the others as they are, so that they are written back
+// unchanged
+type notebook struct {
+	fields      map[string]json.RawMessage
+	cells       []json.RawMessage
+	headerIndex int    // index of the header cell, -1 if there is none
+	headerType  string // type of the header cell, code cells being the ones of former headache versions
+	header      string // detected header of the header cell
+	code        string // source of the header cell following its header
+}
+
+type notebookCell struct {
+	CellType string          `json:"cell_type"`
+	Source   json.RawMessage `json:"source"`
+}
+
+// returns the parsed notebook along with its first cell starting with a header, if any
+func parseNotebook(path string, contents []byte, topHeaderRegex *regexp.Regexp) (*notebook, error) {
+	result := &notebook{headerIndex: -1}
+	if err := json.Unmarshal(contents, &result.fields); err != nil {
+		return nil, fmt.Errorf("cannot parse notebook %s\n\t%v", path, err)
+	}
+	if cells, found := result.fields["cells"]; found {
+		if err := json.Unmarshal(cells, &result.cells); err != nil {
+			return nil, fmt.Errorf("cannot parse cells of notebook %s\n\t%v", path, err)
+		}
+	}
+	for i, rawCell := range result.cells {
+		cell := notebookCell{}
+		if err := json.Unmarshal(rawCell, &cell); err != nil {
+			return nil, fmt.Errorf("cannot parse cell %d of notebook %s\n\t%v", i+1, path, err)
+		}
+		if cell.CellType != "markdown" && cell.CellType != "code" {
+			continue
+		}
+		source, err := cellSource(cell.Source)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse source of cell %d of notebook %s\n\t%v", i+1, path, err)
+		}
+		if header := topHeaderRegex.FindString(source); header != "" {
+			result.headerIndex = i
+			result.headerType = cell.CellType
+			result.header = header
+			result.code = strings.TrimLeft(source[len(header):], "\n")
+			break
+		}
+	}
+	return result, nil
+}
+
+// sources are either strings or arrays of lines
+func cellSource(source json.RawMessage) (string, error) {
+	if len(source) == 0 {
+		return "", nil
+	}
+	lines := make([]string, 0)
+	if err := json.Unmarshal(source, &lines); err == nil {
+		return strings.Join(lines, ""), nil
+	}
+	result := ""
+	err := json.Unmarshal(source, &result)
+	return result, err
+}
+
+// returns the source of the header cell, the lines of which keep their line feed as Jupyter stores them
+func headerSource(header string) []string {
+	lines := strings.SplitAfter(header, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// returns the notebook with the header as the source of its first cell, the existing header cell being moved and
+// updated, keeping its other contents and metadata, if any
+// the header of former code header cells is moved to a new markdown cell, the code cell being kept if it has code
+func (nb *notebook) withHeader(header string) ([]byte, error) {
+	headerCell := map[string]json.RawMessage{
+		"cell_type": json.RawMessage(`"markdown"`),
+		"metadata":  json.RawMessage(`{}`),
+	}
+	if nb.hasCellIds() {
+		headerCell["id"] = json.RawMessage(fmt.Sprintf("%q", notebookHeaderCellId))
+	}
+	otherCells := nb.cells
+	if nb.headerIndex != -1 {
+		existingCell := map[string]json.RawMessage{}
+		if err := json.Unmarshal(nb.cells[nb.headerIndex], &existingCell); err != nil {
+			return nil, err
+		}
+		otherCells = append(append([]json.RawMessage{}, nb.cells[:nb.headerIndex]...), nb.cells[nb.headerIndex+1:]...)
+		if nb.headerType == "markdown" {
+			headerCell = existingCell
+			if nb.code != "" {
+				header = header + "\n\n" + nb.code
+			}
+		} else if nb.code != "" {
+			codeCell, err := nb.withoutHeader(existingCell)
+			if err != nil {
+				return nil, err
+			}
+			otherCells = append(otherCells[:nb.headerIndex], append([]json.RawMessage{codeCell}, otherCells[nb.headerIndex:]...)...)
+		}
+	}
+	source, err := json.Marshal(headerSource(header))
+	if err != nil {
+		return nil, err
+	}
+	headerCell["source"] = source
+	rawHeaderCell, err := marshalNotebookJson(headerCell)
+	if err != nil {
+		return nil, err
+	}
+	cells, err := marshalNotebookJson(append([]json.RawMessage{rawHeaderCell}, otherCells...))
+	if err != nil {
+		return nil, err
+	}
+	nb.fields["cells"] = cells
+	result, err := marshalNotebookJson(nb.fields)
+	if err != nil {
+		return nil, err
+	}
+	// Jupyter indents notebooks with a single space, sorts their keys and ends them with a line feed
+	buffer := bytes.Buffer{}
+	if err := json.Indent(&buffer, result, "", " "); err != nil {
+		return nil, err
+	}
+	buffer.WriteString("\n")
+	return buffer.Bytes(), nil
+}
+
+// returns the former code header cell with its code only, its id being changed if it is the one of header cells
+func (nb *notebook) withoutHeader(cell map[string]json.RawMessage) (json.RawMessage, error) {
+	source, err := json.Marshal(headerSource(nb.code))
+	if err != nil {
+		return nil, err
+	}
+	cell["source"] = source
+	id := ""
+	if rawId, found := cell["id"]; found {
+		_ = json.Unmarshal(rawId, &id)
+	}
+	if id == notebookHeaderCellId {
+		cell["id"] = json.RawMessage(fmt.Sprintf("%q", notebookHeaderCellId+"-code"))
+	}
+	return marshalNotebookJson(cell)
+}
+
+func (nb *notebook) hasCellIds() bool {
+	minorVersion := 0
+	if version, found := nb.fields["nbformat_minor"]; found {
+		_ = json.Unmarshal(version, &minorVersion)
+	}
+	return minorVersion >= notebookCellIdMinorVersion
+}
+
+// unlike json.Marshal, characters such as < and > are kept as they are, as Jupyter does
+func marshalNotebookJson(value interface{}) (json.RawMessage, error) {
+	buffer := bytes.Buffer{}
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buffer.Bytes(), "\n"), nil
+}
+
+// returns the notebook with the expected header cell, or nil if it does not need to be written, along with the reason
+// why it needs to be
+// in add-only mode, notebooks with a header cell are left untouched
+func updateNotebook(change vcs.FileChange, contents []byte, config *ChangeSet) ([]byte, UpdateReason, error) {
+	path := change.Path
+	parsedNotebook, err := parseNotebook(path, contents, config.topHeaderRegex())
+	if err != nil {
+		return nil, "", err
+	}
+	var existingHeaders []string
+	if parsedNotebook.headerIndex != -1 {
+		existingHeaders = []string{parsedNotebook.header}
+	}
+	expectedHeader, err := insertYears(headerContents(config, change), &change, existingHeaders, config.YearRangeFormat, config.DateFormat)
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot parse header for file %s\n\t%v", path, err)
+	}
+	if err := ValidateRenderedHeader(expectedHeader, config.CommentStyle); err != nil {
+		return nil, "", fmt.Errorf("invalid header for file %s\n\t%v", path, err)
+	}
+	reason := HeaderMissing
+	if parsedNotebook.headerIndex != -1 {
+		if config.AddOnly {
+			return nil, HeaderUpToDate, nil
+		}
+		_, reason = NeedsUpdate(parsedNotebook.header, expectedHeader, config.CommentStyle)
+		if reason == HeaderMissing {
+			// the detected header is a header, whatever its wording
+			reason = HeaderWithDifferentWording
+		}
+		if reason == HeaderUpToDate && (parsedNotebook.headerIndex > 0 || parsedNotebook.headerType != "markdown") {
+			reason = HeaderMisplaced
+		}
+	}
+	if reason == HeaderUpToDate {
+		return nil, reason, nil
+	}
+	result, err := parsedNotebook.withHeader(expectedHeader)
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot write notebook %s\n\t%v", path, err)
+	}
+	return result, reason, nil
+}
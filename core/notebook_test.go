@@ -0,0 +1,268 @@
+/*
+ * Copyright 2018 Florent Biville (@fbiville)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"github.com/fbiville/headache/vcs"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Notebook", func() {
+
+	var config *ChangeSet
+
+	BeforeEach(func() {
+		config = &ChangeSet{
+			HeaderContents: "# Copyright {{.YearRange}} ACME\n#\n# Licensed under MIT",
+			HeaderRegex:    getRegexWithParams(map[string]string{"YearRange": ""}, "Copyright {{.YearRange}} ACME", "", "Licensed under MIT"),
+			CommentStyle:   Hash{},
+		}
+	})
+
+	It("inserts a header cell before the other cells", func() {
+		contents := `{
+ "cells": [
+  {
+   "cell_type": "markdown",
+   "metadata": {},
+   "source": [
+    "# Analysis of <results>"
+   ]
+  }
+ ],
+ "metadata": {
+  "kernelspec": {
+   "name": "python3"
+  }
+ },
+ "nbformat": 4,
+ "nbformat_minor": 4
+}
+`
+		change := vcs.FileChange{Path: "analysis.ipynb", CreationYear: 2020, LastEditionYear: 2021}
+
+		result, reason, err := updateNotebook(change, []byte(contents), config)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reason).To(Equal(HeaderMissing))
+		Expect(string(result)).To(Equal(`{
+ "cells": [
+  {
+   "cell_type": "markdown",
+   "metadata": {},
+   "source": [
+    "# Copyright 2020-2021 ACME\n",
+    "#\n",
+    "# Licensed under MIT"
+   ]
+  },
+  {
+   "cell_type": "markdown",
+   "metadata": {},
+   "source": [
+    "# Analysis of <results>"
+   ]
+  }
+ ],
+ "metadata": {
+  "kernelspec": {
+   "name": "python3"
+  }
+ },
+ "nbformat": 4,
+ "nbformat_minor": 4
+}
+`))
+	})
+
+	It("gives an id to the inserted header cell when the notebook format requires one", func() {
+		contents := `{"cells": [], "metadata": {}, "nbformat": 4, "nbformat_minor": 5}`
+		change := vcs.FileChange{Path: "analysis.ipynb", CreationYear: 2021, LastEditionYear: 2021}
+
+		result, _, err := updateNotebook(change, []byte(contents), config)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(result)).To(ContainSubstring(`"id": "license-header"`))
+	})
+
+	It("updates the existing header cell, keeping its other contents and metadata", func() {
+		contents := `{
+ "cells": [
+  {
+   "cell_type": "markdown",
+   "metadata": {},
+   "source": "# Analysis"
+  },
+  {
+   "cell_type": "markdown",
+   "id": "a1b2",
+   "metadata": {"tags": ["legal"]},
+   "source": ["# Copyright 2020 ACME\n", "#\n", "# Licensed under MIT\n", "\n", "See LICENSE."]
+  }
+ ],
+ "metadata": {},
+ "nbformat": 4,
+ "nbformat_minor": 5
+}`
+		change := vcs.FileChange{Path: "analysis.ipynb", CreationYear: 2020, LastEditionYear: 2022}
+
+		result, reason, err := updateNotebook(change, []byte(contents), config)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reason).To(Equal(HeaderWithStaleYears))
+		Expect(string(result)).To(Equal(`{
+ "cells": [
+  {
+   "cell_type": "markdown",
+   "id": "a1b2",
+   "metadata": {
+    "tags": [
+     "legal"
+    ]
+   },
+   "source": [
+    "# Copyright 2020-2022 ACME\n",
+    "#\n",
+    "# Licensed under MIT\n",
+    "\n",
+    "See LICENSE."
+   ]
+  },
+  {
+   "cell_type": "markdown",
+   "metadata": {},
+   "source": "# Analysis"
+  }
+ ],
+ "metadata": {},
+ "nbformat": 4,
+ "nbformat_minor": 5
+}
+`))
+	})
+
+	It("moves the header of former code header cells to a markdown cell, keeping their code and metadata", func() {
+		contents := `{
+ "cells": [
+  {
+   "cell_type": "markdown",
+   "metadata": {},
+   "source": "# Analysis"
+  },
+  {
+   "cell_type": "code",
+   "execution_count": 1,
+   "id": "a1b2",
+   "metadata": {"tags": ["setup"]},
+   "outputs": [],
+   "source": ["# Copyright 2020 ACME\n", "#\n", "# Licensed under MIT\n", "\n", "import pandas"]
+  }
+ ],
+ "metadata": {},
+ "nbformat": 4,
+ "nbformat_minor": 5
+}`
+		change := vcs.FileChange{Path: "analysis.ipynb", CreationYear: 2020, LastEditionYear: 2022}
+
+		result, reason, err := updateNotebook(change, []byte(contents), config)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reason).To(Equal(HeaderWithStaleYears))
+		Expect(string(result)).To(Equal(`{
+ "cells": [
+  {
+   "cell_type": "markdown",
+   "id": "license-header",
+   "metadata": {},
+   "source": [
+    "# Copyright 2020-2022 ACME\n",
+    "#\n",
+    "# Licensed under MIT"
+   ]
+  },
+  {
+   "cell_type": "markdown",
+   "metadata": {},
+   "source": "# Analysis"
+  },
+  {
+   "cell_type": "code",
+   "execution_count": 1,
+   "id": "a1b2",
+   "metadata": {
+    "tags": [
+     "setup"
+    ]
+   },
+   "outputs": [],
+   "source": [
+    "import pandas"
+   ]
+  }
+ ],
+ "metadata": {},
+ "nbformat": 4,
+ "nbformat_minor": 5
+}
+`))
+	})
+
+	It("replaces former code header cells without code by a markdown cell", func() {
+		contents := `{"cells": [{"cell_type": "code", "execution_count": null, "metadata": {}, "outputs": [], "source": "# Copyright 2020 ACME\n#\n# Licensed under MIT"}], "nbformat": 4}`
+		change := vcs.FileChange{Path: "analysis.ipynb", CreationYear: 2020, LastEditionYear: 2020}
+
+		result, reason, err := updateNotebook(change, []byte(contents), config)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reason).To(Equal(HeaderMisplaced))
+		Expect(string(result)).To(Equal(`{
+ "cells": [
+  {
+   "cell_type": "markdown",
+   "metadata": {},
+   "source": [
+    "# Copyright 2020 ACME\n",
+    "#\n",
+    "# Licensed under MIT"
+   ]
+  }
+ ],
+ "nbformat": 4
+}
+`))
+	})
+
+	It("leaves notebooks with an up-to-date header cell untouched", func() {
+		contents := `{"cells": [{"cell_type": "markdown", "source": "# Copyright 2020 ACME\n#\n# Licensed under MIT"}], "nbformat": 4}`
+		change := vcs.FileChange{Path: "analysis.ipynb", CreationYear: 2020, LastEditionYear: 2020}
+
+		result, reason, err := updateNotebook(change, []byte(contents), config)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reason).To(Equal(HeaderUpToDate))
+		Expect(result).To(BeNil())
+	})
+
+	It("fails on invalid notebooks", func() {
+		change := vcs.FileChange{Path: "analysis.ipynb"}
+
+		_, _, err := updateNotebook(change, []byte("# not JSON"), config)
+
+		Expect(err).To(MatchError(HavePrefix("cannot parse notebook analysis.ipynb")))
+	})
+})
@@ -0,0 +1,228 @@
+/*
+ * Copyright 2018 Florent Biville (@fbiville)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"fmt"
+	"github.com/fbiville/headache/fs"
+	"io"
+	"strings"
+)
+
+// number of unchanged lines around the changed ones in patch hunks, as git diff does by default
+const patchContextLines = 3
+
+// beyond this number of compared line pairs, changed regions are diffed as a whole rather than line by line
+const maxPatchComparisons = 4000000
+
+// WritePatch writes the header changes of the files needing an update as a unified diff, with paths relative to the
+// repository root, which git apply accepts, instead of writing the files
+func WritePatch(writer io.Writer, config *ChangeSet, fileSystem *fs.FileSystem) error {
+	for _, change := range config.Files {
+		path := change.Path
+		bytes, err := fileSystem.FileReader.Read(path)
+		if err != nil {
+			return fmt.Errorf("cannot read file %s\n\t%v", path, err)
+		}
+		if isSkippedEmptyFile(path, bytes, config) {
+			continue
+		}
+		commentable, err := isCommentable(path, bytes, config)
+		if err != nil {
+			return err
+		}
+		if !commentable {
+			continue
+		}
+		change, err = config.withHistory(change)
+		if err != nil {
+			return err
+		}
+		newContents, err := updatedContents(change, bytes, config)
+		if err != nil {
+			return err
+		}
+		if newContents == nil {
+			continue
+		}
+		if _, err := io.WriteString(writer, unifiedDiff(path, string(bytes), string(newContents))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type patchLine struct {
+	kind byte // ' ' for unchanged lines, '-' for removed ones and '+' for added ones
+	text string
+}
+
+// returns the git-style unified diff of the file, empty if the contents are the same
+func unifiedDiff(path string, oldContents string, newContents string) string {
+	lines := diffLines(splitLines(oldContents), splitLines(newContents))
+	builder := &strings.Builder{}
+	oldLine, newLine := 0, 0
+	for start := 0; start < len(lines); {
+		if lines[start].kind == ' ' {
+			oldLine++
+			newLine++
+			start++
+			continue
+		}
+		if builder.Len() == 0 {
+			fmt.Fprintf(builder, "diff --git a/%[1]s b/%[1]s\n--- a/%[1]s\n+++ b/%[1]s\n", path)
+		}
+		context := min(start, patchContextLines)
+		start -= context
+		oldLine -= context
+		newLine -= context
+		end := hunkEnd(lines, start+context)
+		oldCount, newCount := 0, 0
+		for _, line := range lines[start:end] {
+			if line.kind != '+' {
+				oldCount++
+			}
+			if line.kind != '-' {
+				newCount++
+			}
+		}
+		fmt.Fprintf(builder, "@@ -%s +%s @@\n", hunkRange(oldLine, oldCount), hunkRange(newLine, newCount))
+		for _, line := range lines[start:end] {
+			builder.WriteByte(line.kind)
+			builder.WriteString(line.text)
+			if !strings.HasSuffix(line.text, "\n") {
+				builder.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		oldLine += oldCount
+		newLine += newCount
+		start = end
+	}
+	return builder.String()
+}
+
+// returns the index following the hunk starting with the change at the given index, changes separated by fewer
+// unchanged lines than twice the context belonging to the same hunk
+func hunkEnd(lines []patchLine, index int) int {
+	for index < len(lines) {
+		if lines[index].kind != ' ' {
+			index++
+			continue
+		}
+		unchanged := 0
+		for index+unchanged < len(lines) && lines[index+unchanged].kind == ' ' {
+			unchanged++
+		}
+		if index+unchanged == len(lines) || unchanged > 2*patchContextLines {
+			return index + min(unchanged, patchContextLines)
+		}
+		index += unchanged
+	}
+	return index
+}
+
+// ranges start after the preceding line when empty, as in -0,0 for files without lines
+func hunkRange(line int, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", line)
+	}
+	return fmt.Sprintf("%d,%d", line+1, count)
+}
+
+// returns the lines of the contents, including their line feed, the last line lacking it when the contents do
+func splitLines(contents string) []string {
+	lines := strings.SplitAfter(contents, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// returns the edit script turning the old lines into the new ones, based on their longest common subsequence
+// the leading and trailing lines they share are set aside first, headers usually being the only changed region
+func diffLines(oldLines []string, newLines []string) []patchLine {
+	prefix := 0
+	for prefix < len(oldLines) && prefix < len(newLines) && oldLines[prefix] == newLines[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(oldLines)-prefix && suffix < len(newLines)-prefix &&
+		oldLines[len(oldLines)-1-suffix] == newLines[len(newLines)-1-suffix] {
+		suffix++
+	}
+	result := make([]patchLine, 0, len(oldLines)+len(newLines))
+	for _, line := range oldLines[:prefix] {
+		result = append(result, patchLine{kind: ' ', text: line})
+	}
+	result = append(result, diffChangedLines(oldLines[prefix:len(oldLines)-suffix], newLines[prefix:len(newLines)-suffix])...)
+	for _, line := range oldLines[len(oldLines)-suffix:] {
+		result = append(result, patchLine{kind: ' ', text: line})
+	}
+	return result
+}
+
+func diffChangedLines(oldLines []string, newLines []string) []patchLine {
+	result := make([]patchLine, 0, len(oldLines)+len(newLines))
+	if len(oldLines)*len(newLines) > maxPatchComparisons {
+		for _, line := range oldLines {
+			result = append(result, patchLine{kind: '-', text: line})
+		}
+		for _, line := range newLines {
+			result = append(result, patchLine{kind: '+', text: line})
+		}
+		return result
+	}
+	// lengths[i][j] is the length of the longest common subsequence of oldLines[i:] and newLines[j:]
+	lengths := make([][]int, len(oldLines)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(newLines)+1)
+	}
+	for i := len(oldLines) - 1; i >= 0; i-- {
+		for j := len(newLines) - 1; j >= 0; j-- {
+			if oldLines[i] == newLines[j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else if lengths[i+1][j] >= lengths[i][j+1] {
+				lengths[i][j] = lengths[i+1][j]
+			} else {
+				lengths[i][j] = lengths[i][j+1]
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(oldLines) || j < len(newLines) {
+		switch {
+		case i < len(oldLines) && j < len(newLines) && oldLines[i] == newLines[j]:
+			result = append(result, patchLine{kind: ' ', text: oldLines[i]})
+			i++
+			j++
+		case j == len(newLines) || (i < len(oldLines) && lengths[i+1][j] >= lengths[i][j+1]):
+			result = append(result, patchLine{kind: '-', text: oldLines[i]})
+			i++
+		default:
+			result = append(result, patchLine{kind: '+', text: newLines[j]})
+			j++
+		}
+	}
+	return result
+}
+
+func min(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,146 @@
+/*
+ * Copyright 2018 Florent Biville (@fbiville)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core_test
+
+import (
+	. "github.com/fbiville/headache/core"
+	"github.com/fbiville/headache/fs"
+	"github.com/fbiville/headache/vcs"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var _ = Describe("Patch", func() {
+
+	var (
+		workingDirectory string
+		repository       string
+		changeSet        *ChangeSet
+		originalContents map[string]string
+	)
+
+	BeforeEach(func() {
+		if _, err := exec.LookPath("git"); err != nil {
+			Skip("git is not installed")
+		}
+		var err error
+		workingDirectory, err = os.Getwd()
+		Expect(err).NotTo(HaveOccurred())
+		repository, err = ioutil.TempDir("", "headache-patch")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.Chdir(repository)).To(Succeed())
+		originalContents = map[string]string{
+			"missing.go":       "package missing\n",
+			"stale.go":         "// Copyright 2019 ACME\n\npackage stale\n\nfunc a() {}\n\nfunc b() {}\n\nfunc c() {}\n",
+			"unterminated.go":  "package unterminated",
+			"up-to-date.go":    "// Copyright 2022 ACME\n\npackage uptodate\n",
+			"sub/dir/third.go": "package dir\n",
+			"misplaced.go":     "package misplaced\n\nvar a = 1\nvar b = 2\nvar c = 3\nvar d = 4\nvar e = 5\n\n// Copyright 2022 ACME\n\nfunc f() {}\n",
+		}
+		for path, contents := range originalContents {
+			Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(path, []byte(contents), 0644)).To(Succeed())
+		}
+		git("init", "-q")
+		changeSet = &ChangeSet{
+			HeaderContents: "// Copyright {{.YearRange}} ACME",
+			HeaderRegex:    regexp.MustCompile("// Copyright .* ACME\n?"),
+			CommentStyle:   SlashSlash{},
+			Files: []vcs.FileChange{
+				{Path: "missing.go", CreationYear: 2022, LastEditionYear: 2022},
+				{Path: "stale.go", CreationYear: 2019, LastEditionYear: 2022},
+				{Path: "unterminated.go", CreationYear: 2022, LastEditionYear: 2022},
+				{Path: "up-to-date.go", CreationYear: 2022, LastEditionYear: 2022},
+				{Path: "sub/dir/third.go", CreationYear: 2021, LastEditionYear: 2022},
+				{Path: "misplaced.go", CreationYear: 2022, LastEditionYear: 2022},
+			},
+		}
+	})
+
+	AfterEach(func() {
+		if repository == "" {
+			return
+		}
+		Expect(os.Chdir(workingDirectory)).To(Succeed())
+		Expect(os.RemoveAll(repository)).To(Succeed())
+	})
+
+	It("leaves the files untouched", func() {
+		Expect(WritePatch(&strings.Builder{}, changeSet, fs.DefaultFileSystem())).To(Succeed())
+
+		for path, contents := range originalContents {
+			Expect(ioutil.ReadFile(path)).To(Equal([]byte(contents)))
+		}
+	})
+
+	It("writes hunks with unified diff headers", func() {
+		patch := &strings.Builder{}
+
+		Expect(WritePatch(patch, changeSet, fs.DefaultFileSystem())).To(Succeed())
+
+		Expect(patch.String()).To(ContainSubstring("diff --git a/stale.go b/stale.go\n" +
+			"--- a/stale.go\n" +
+			"+++ b/stale.go\n" +
+			"@@ -1,4 +1,4 @@\n" +
+			"-// Copyright 2019 ACME\n" +
+			"+// Copyright 2019-2022 ACME\n" +
+			" \n" +
+			" package stale\n" +
+			" \n" +
+			"diff --git"))
+		Expect(patch.String()).To(ContainSubstring("diff --git a/unterminated.go b/unterminated.go\n" +
+			"--- a/unterminated.go\n" +
+			"+++ b/unterminated.go\n" +
+			"@@ -1,1 +1,3 @@\n" +
+			"+// Copyright 2022 ACME\n" +
+			"+\n" +
+			" package unterminated\n" +
+			"\\ No newline at end of file\n"))
+		Expect(patch.String()).To(ContainSubstring("diff --git a/sub/dir/third.go b/sub/dir/third.go\n"))
+		Expect(patch.String()).NotTo(ContainSubstring("up-to-date.go"))
+	})
+
+	It("writes a patch git applies cleanly to the original tree", func() {
+		patch := &strings.Builder{}
+		Expect(WritePatch(patch, changeSet, fs.DefaultFileSystem())).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(os.TempDir(), "headache.patch"), []byte(patch.String()), 0644)).To(Succeed())
+		defer os.Remove(filepath.Join(os.TempDir(), "headache.patch"))
+
+		git("apply", "--check", filepath.Join(os.TempDir(), "headache.patch"))
+		git("apply", filepath.Join(os.TempDir(), "headache.patch"))
+
+		Expect(ioutil.ReadFile("missing.go")).To(Equal([]byte("// Copyright 2022 ACME\n\npackage missing\n")))
+		Expect(ioutil.ReadFile("stale.go")).
+			To(Equal([]byte("// Copyright 2019-2022 ACME\n\npackage stale\n\nfunc a() {}\n\nfunc b() {}\n\nfunc c() {}\n")))
+		Expect(ioutil.ReadFile("unterminated.go")).To(Equal([]byte("// Copyright 2022 ACME\n\npackage unterminated")))
+		Expect(ioutil.ReadFile("up-to-date.go")).To(Equal([]byte(originalContents["up-to-date.go"])))
+		Expect(ioutil.ReadFile("sub/dir/third.go")).To(Equal([]byte("// Copyright 2021-2022 ACME\n\npackage dir\n")))
+		Expect(ioutil.ReadFile("misplaced.go")).
+			To(Equal([]byte("// Copyright 2022 ACME\n\npackage misplaced\n\nvar a = 1\nvar b = 2\nvar c = 3\nvar d = 4\nvar e = 5\n\nfunc f() {}\n")))
+	})
+})
+
+func git(args ...string) {
+	output, err := exec.Command("git", args...).CombinedOutput()
+	Expect(err).NotTo(HaveOccurred(), string(output))
+}
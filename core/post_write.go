@@ -0,0 +1,49 @@
+/*
+ * Copyright 2018 Florent Biville (@fbiville)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+)
+
+// CommandRunner runs the command with the given arguments and returns its combined output
+type CommandRunner func(name string, args ...string) (string, error)
+
+// runs the post-write command configured for the extension of the written file, if any, on that file
+// formatters such as gofmt can then reconcile the inserted header with their own layout
+func runPostWriteCommand(config *ChangeSet, path string) error {
+	command := config.PostWriteCommands[filepath.Ext(path)]
+	if len(command) == 0 {
+		return nil
+	}
+	runner := config.CommandRunner
+	if runner == nil {
+		runner = runCommand
+	}
+	args := append(command[1:len(command):len(command)], path)
+	if output, err := runner(command[0], args...); err != nil {
+		return fmt.Errorf("%s failed\n\t%v\n\t%s", command[0], err, output)
+	}
+	return nil
+}
+
+func runCommand(name string, args ...string) (string, error) {
+	output, err := exec.Command(name, args...).CombinedOutput()
+	return string(output), err
+}
@@ -0,0 +1,119 @@
+/*
+ * Copyright 2018 Florent Biville (@fbiville)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"fmt"
+	"github.com/fbiville/headache/vcs"
+)
+
+// PreviewHeader returns the header the file at the given path would get, without looking at any other file
+func PreviewHeader(versioning vcs.Vcs, tracker ExecutionTracker, path string, config *Configuration, system *SystemConfiguration) (string, error) {
+	changeSet, err := singleFileChangeSet(versioning, tracker, path, config, system)
+	if err != nil {
+		return "", err
+	}
+
+	// existing headers may push the start year back
+	fileBytes, err := system.FileSystem.FileReader.Read(path)
+	if err != nil {
+		return "", err
+	}
+	_, fileContents := splitByteOrderMark(string(fileBytes))
+	_, fileContents = splitPreamble(fileContents, changeSet)
+	_, existingHeaders := splitHeaders(fileContents, changeSet.HeaderRegex, changeSet.topHeaderRegex())
+
+	header, err := insertYears(headerContents(changeSet, changeSet.Files[0]), &changeSet.Files[0], existingHeaders, changeSet.YearRangeFormat, changeSet.DateFormat)
+	if err != nil {
+		return "", err
+	}
+	if err := ValidateRenderedHeader(header, changeSet.CommentStyle); err != nil {
+		return "", fmt.Errorf("invalid header for file %s\n\t%v", path, err)
+	}
+	return withLineBreaks(header, lineBreak(fileContents, changeSet.LineEnding)), nil
+}
+
+// HeadContents returns the given contents of the file at the given path with the header the file would get, without
+// writing anything, as when piping contents through headache
+// contents which would be left untouched, such as the ones with an up-to-date header, are returned as they are
+func HeadContents(versioning vcs.Vcs, tracker ExecutionTracker, path string, contents []byte, config *Configuration, system *SystemConfiguration) ([]byte, error) {
+	changeSet, err := singleFileChangeSet(versioning, tracker, path, config, system)
+	if err != nil {
+		return nil, err
+	}
+	if isSkippedEmptyFile(path, contents, changeSet) {
+		return contents, nil
+	}
+	commentable, err := isCommentable(path, contents, changeSet)
+	if err != nil {
+		return nil, err
+	}
+	if !commentable {
+		return contents, nil
+	}
+	result, err := updatedContents(changeSet.Files[0], contents, changeSet)
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return contents, nil
+	}
+	return result, nil
+}
+
+// returns the change set of the file at the given path only, whether it changed since the last execution or not
+func singleFileChangeSet(versioning vcs.Vcs, tracker ExecutionTracker, path string, config *Configuration, system *SystemConfiguration) (*ChangeSet, error) {
+	versionedTemplate, err := tracker.RetrieveVersionedTemplate(config)
+	if err != nil {
+		return nil, err
+	}
+	changeSet, err := newChangeSet(config, versionedTemplate)
+	if err != nil {
+		return nil, err
+	}
+	pathRewrite, err := pathRewriteRegex(config)
+	if err != nil {
+		return nil, err
+	}
+
+	if requiresDefaultBaseBranch(config) {
+		config, err = withDefaultBaseBranch(config, versioning)
+		if err != nil {
+			return nil, err
+		}
+	}
+	options, err := historyOptions(config, system.Clock)
+	if err != nil {
+		return nil, err
+	}
+	history, err := vcs.GetFileHistory(versioning, path, system.Clock, options)
+	if err != nil {
+		return nil, err
+	}
+	change := vcs.FileChange{
+		Path:            path,
+		CreationYear:    history.CreationYear,
+		LastEditionYear: history.LastEditionYear,
+		CreationTime:    history.CreationTime,
+		LastEditionTime: history.LastEditionTime,
+	}
+	if pathRewrite != nil {
+		change = rewritePaths([]vcs.FileChange{change}, pathRewrite, config.PathRewrite.Replacement)[0]
+	}
+	changeSet.Files = []vcs.FileChange{change}
+	return changeSet, nil
+}
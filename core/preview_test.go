@@ -0,0 +1,175 @@
+/*
+ * Copyright 2018 Florent Biville (@fbiville)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core_test
+
+import (
+	. "github.com/fbiville/headache/core"
+	"github.com/fbiville/headache/core_mocks"
+	"github.com/fbiville/headache/fs"
+	"github.com/fbiville/headache/fs_mocks"
+	"github.com/fbiville/headache/vcs_mocks"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Header preview", func() {
+
+	var (
+		t             GinkgoTInterface
+		versioning    *vcs_mocks.Vcs
+		fileReader    *fs_mocks.FileReader
+		tracker       *core_mocks.ExecutionTracker
+		configuration *Configuration
+		system        *SystemConfiguration
+		logArguments  []interface{}
+	)
+
+	BeforeEach(func() {
+		t = GinkgoT()
+		versioning = new(vcs_mocks.Vcs)
+		fileReader = new(fs_mocks.FileReader)
+		tracker = new(core_mocks.ExecutionTracker)
+		configuration = &Configuration{
+			HeaderFile:   "header.txt",
+			CommentStyle: "SlashSlash",
+			TemplateData: map[string]string{"Owner": "ACME"},
+			MaxYear:      2020,
+		}
+		system = &SystemConfiguration{
+			FileSystem: &fs.FileSystem{FileReader: fileReader},
+			Clock:      &FixedClock{},
+		}
+		logArguments = []interface{}{"--follow", "--name-status", "--use-mailmap", "--format=%at%x00%aN", "--", "main.go"}
+		tracker.On("RetrieveVersionedTemplate", configuration).
+			Return(unchangedHeaderContents("Copyright {{.YearRange}} {{.Owner}} - {{.Path}}", configuration.TemplateData, ""), nil)
+		versioning.On("Log", logArguments...).Return("1530000000\x00Jane\nM\tmain.go\n1499817600\x00John\nA\tmain.go\n", nil)
+	})
+
+	AfterEach(func() {
+		versioning.AssertExpectations(t)
+		fileReader.AssertExpectations(t)
+		tracker.AssertExpectations(t)
+		UnregisterCommentStyle("SemiColons")
+	})
+
+	It("renders the header of a file with the years of its history", func() {
+		fileReader.On("Read", "main.go").Return([]byte("package main"), nil)
+
+		header, err := PreviewHeader(versioning, tracker, "main.go", configuration, system)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(header).To(Equal("// Copyright 2017-2018 ACME - main.go"))
+	})
+
+	It("renders the last edition date of a file with the configured layout", func() {
+		configuration.DateFormat = "02/01/2006"
+		tracker.ExpectedCalls = nil
+		tracker.On("RetrieveVersionedTemplate", configuration).
+			Return(unchangedHeaderContents("Copyright {{.YearRange}} {{.Owner}}\nLast modified: {{.LastEditionDate}}", configuration.TemplateData, ""), nil)
+		fileReader.On("Read", "main.go").Return([]byte("package main"), nil)
+
+		header, err := PreviewHeader(versioning, tracker, "main.go", configuration, system)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(header).To(Equal("// Copyright 2017-2018 ACME\n// Last modified: 26/06/2018"))
+	})
+
+	It("preserves the start year of the existing header", func() {
+		fileReader.On("Read", "main.go").Return([]byte("// Copyright 2012 ACME - main.go\n\npackage main"), nil)
+
+		header, err := PreviewHeader(versioning, tracker, "main.go", configuration, system)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(header).To(Equal("// Copyright 2012-2018 ACME - main.go"))
+	})
+
+	It("renders the rewritten path of the file", func() {
+		configuration.PathRewrite = &PathRewrite{Pattern: `^(.*)\.go$`, Replacement: "src/$1.go"}
+		fileReader.On("Read", "main.go").Return([]byte("package main"), nil)
+
+		header, err := PreviewHeader(versioning, tracker, "main.go", configuration, system)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(header).To(Equal("// Copyright 2017-2018 ACME - src/main.go"))
+	})
+
+	It("renders the header with a registered comment style", func() {
+		RegisterCommentStyle("SemiColons", semiColons{})
+		configuration.CommentStyle = "SemiColons"
+		fileReader.On("Read", "main.go").Return([]byte("package main"), nil)
+
+		header, err := PreviewHeader(versioning, tracker, "main.go", configuration, system)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(header).To(Equal(";; Copyright 2017-2018 ACME - main.go"))
+	})
+
+	Describe("when piping contents", func() {
+
+		It("returns the contents with the header of the file", func() {
+			result, err := HeadContents(versioning, tracker, "main.go", []byte("package main\n"), configuration, system)
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(result)).To(Equal("// Copyright 2017-2018 ACME - main.go\n\npackage main\n"))
+		})
+
+		It("updates the existing header of the contents", func() {
+			contents := []byte("// Copyright 2012 ACME - main.go\n\npackage main\n")
+
+			result, err := HeadContents(versioning, tracker, "main.go", contents, configuration, system)
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(result)).To(Equal("// Copyright 2012-2018 ACME - main.go\n\npackage main\n"))
+		})
+
+		It("returns contents with an up-to-date header as they are", func() {
+			contents := []byte("// Copyright 2017-2018 ACME - main.go\n\npackage main\n")
+
+			result, err := HeadContents(versioning, tracker, "main.go", contents, configuration, system)
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal(contents))
+		})
+
+		It("returns contents with a hand-edited header as they are", func() {
+			tracker.ExpectedCalls = nil
+			tracker.On("RetrieveVersionedTemplate", configuration).
+				Return(unchangedHeaderContents("Copyright {{.YearRange}} {{.Owner}} - {{.Path}}", configuration.TemplateData, "some-sha"), nil)
+			configuration.Marker = "headache"
+			contents := []byte("// Copyright 2012 ACME Corporation\n// headache\n\npackage main\n")
+
+			result, err := HeadContents(versioning, tracker, "main.go", contents, configuration, system)
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal(contents))
+		})
+
+		It("overwrites hand-edited headers when forced to", func() {
+			tracker.ExpectedCalls = nil
+			tracker.On("RetrieveVersionedTemplate", configuration).
+				Return(unchangedHeaderContents("Copyright {{.YearRange}} {{.Owner}} - {{.Path}}", configuration.TemplateData, "some-sha"), nil)
+			configuration.Marker = "headache"
+			configuration.Force = true
+			contents := []byte("// Copyright 2012 ACME Corporation\n// headache\n\npackage main\n")
+
+			result, err := HeadContents(versioning, tracker, "main.go", contents, configuration, system)
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(result)).To(HavePrefix("// Copyright 2012-2018 ACME - main.go\n"))
+		})
+	})
+})
@@ -0,0 +1,240 @@
+/*
+ * Copyright 2019 Florent Biville (@fbiville)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/fbiville/headache/vcs"
+	"io"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// writes the displayed path and copyright years of each change as CSV rows sorted by path, preceded by a header row
+func WriteCsvReport(writer io.Writer, changes []vcs.FileChange, delimiter rune) error {
+	csvWriter := csv.NewWriter(writer)
+	csvWriter.Comma = delimiter
+	err := csvWriter.Write([]string{"path", "start_year", "end_year"})
+	if err != nil {
+		return err
+	}
+	for _, change := range sortByPath(changes) {
+		err = csvWriter.Write([]string{
+			change.GetDisplayPath(),
+			strconv.Itoa(change.CreationYear),
+			strconv.Itoa(change.LastEditionYear),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+// writes a GitHub Actions error annotation per verdict, so that the files needing a header update are reported inline
+// in pull requests
+func WriteGithubAnnotations(writer io.Writer, verdicts []Verdict) error {
+	for _, verdict := range verdicts {
+		_, err := fmt.Fprintf(writer, "::error file=%s,line=1::%s\n",
+			escapeAnnotationProperty(verdict.Path),
+			escapeAnnotationData(fmt.Sprintf("Missing or outdated license header (%s)", verdict.Reason)))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// see https://github.com/actions/toolkit/blob/main/packages/core/src/command.ts
+var (
+	annotationDataEscaper     = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	annotationPropertyEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+)
+
+func escapeAnnotationData(data string) string {
+	return annotationDataEscaper.Replace(data)
+}
+
+func escapeAnnotationProperty(property string) string {
+	return annotationPropertyEscaper.Replace(property)
+}
+
+// the SARIF rule of each update reason, in reporting order
+var sarifRules = []struct {
+	reason UpdateReason
+	rule   sarifRule
+}{
+	{HeaderMissing, sarifRule{Id: "headache/missing-header", ShortDescription: sarifMessage{Text: "Missing license header"}}},
+	{HeaderWithStaleYears, sarifRule{Id: "headache/stale-year", ShortDescription: sarifMessage{Text: "License header with stale copyright years"}}},
+	{HeaderWithDifferentWording, sarifRule{Id: "headache/different-wording", ShortDescription: sarifMessage{Text: "License header with a different wording"}}},
+	{HeaderMisplaced, sarifRule{Id: "headache/misplaced-header", ShortDescription: sarifMessage{Text: "License header below other contents"}}},
+	{HeaderWithOutdatedLicense, sarifRule{Id: "headache/outdated-license", ShortDescription: sarifMessage{Text: "License header with an outdated license"}}},
+	{HeaderEditedByHand, sarifRule{Id: "headache/hand-edited-header", ShortDescription: sarifMessage{Text: "License header edited by hand"}}},
+}
+
+// see https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html
+type sarifReport struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationUri string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	Id               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleId    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	Uri string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+// writes a SARIF 2.1.0 log with an error result per verdict, its rule depending on the update reason, for code
+// scanning and compliance dashboards to ingest
+func WriteSarifReport(writer io.Writer, verdicts []Verdict) error {
+	rules := make([]sarifRule, len(sarifRules))
+	ruleIndices := make(map[UpdateReason]int, len(sarifRules))
+	for i, entry := range sarifRules {
+		rules[i] = entry.rule
+		ruleIndices[entry.reason] = i
+	}
+	results := make([]sarifResult, 0, len(verdicts))
+	for _, verdict := range verdicts {
+		index, found := ruleIndices[verdict.Reason]
+		if !found {
+			return fmt.Errorf("no SARIF rule for update reason %q of file %s", verdict.Reason, verdict.Path)
+		}
+		results = append(results, sarifResult{
+			RuleId:    rules[index].Id,
+			RuleIndex: index,
+			Level:     "error",
+			Message:   sarifMessage{Text: fmt.Sprintf("Missing or outdated license header (%s)", verdict.Reason)},
+			Locations: []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{Uri: (&url.URL{Path: filepath.ToSlash(verdict.Path)}).String()},
+				Region:           sarifRegion{StartLine: 1},
+			}}},
+		})
+	}
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(sarifReport{
+		Version: "2.1.0",
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           "headache",
+				InformationUri: "https://github.com/fbiville/headache",
+				Rules:          rules,
+			}},
+			Results: results,
+		}},
+	})
+}
+
+// YearSpan is the copyright year range of a file, from its creation year to its last edition year
+type YearSpan struct {
+	CreationYear    int
+	LastEditionYear int
+}
+
+func (span YearSpan) String() string {
+	if span.CreationYear == span.LastEditionYear {
+		return strconv.Itoa(span.CreationYear)
+	}
+	return fmt.Sprintf("%d-%d", span.CreationYear, span.LastEditionYear)
+}
+
+// YearSpanGroup gathers the displayed paths of the files sharing the same year span, sorted
+type YearSpanGroup struct {
+	Span  YearSpan
+	Paths []string
+}
+
+// GroupByYearSpan returns the changes grouped by year span, sorted by creation year and then by last edition year
+func GroupByYearSpan(changes []vcs.FileChange) []YearSpanGroup {
+	groups := make(map[YearSpan][]string)
+	for _, change := range sortByPath(changes) {
+		span := YearSpan{CreationYear: change.CreationYear, LastEditionYear: change.LastEditionYear}
+		groups[span] = append(groups[span], change.GetDisplayPath())
+	}
+	result := make([]YearSpanGroup, 0, len(groups))
+	for span, paths := range groups {
+		result = append(result, YearSpanGroup{Span: span, Paths: paths})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		left, right := result[i].Span, result[j].Span
+		if left.CreationYear != right.CreationYear {
+			return left.CreationYear < right.CreationYear
+		}
+		return left.LastEditionYear < right.LastEditionYear
+	})
+	return result
+}
+
+func sortByPath(changes []vcs.FileChange) []vcs.FileChange {
+	result := make([]vcs.FileChange, len(changes))
+	copy(result, changes)
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].GetDisplayPath() < result[j].GetDisplayPath()
+	})
+	return result
+}
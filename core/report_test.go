@@ -0,0 +1,178 @@
+/*
+ * Copyright 2019 Florent Biville (@fbiville)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core_test
+
+import (
+	"encoding/json"
+	"github.com/fbiville/headache/core"
+	. "github.com/fbiville/headache/vcs"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"strings"
+)
+
+var _ = Describe("CSV report", func() {
+
+	It("writes a header row followed by copyright years sorted by path", func() {
+		builder := &strings.Builder{}
+		changes := []FileChange{
+			{Path: "pkg/some,file.go", CreationYear: 2016, LastEditionYear: 2019},
+			{Path: "main.go", CreationYear: 2018, LastEditionYear: 2018},
+		}
+
+		err := core.WriteCsvReport(builder, changes, ',')
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(builder.String()).To(Equal(`path,start_year,end_year
+main.go,2018,2018
+"pkg/some,file.go",2016,2019
+`))
+	})
+
+	It("writes rows with the configured delimiter", func() {
+		builder := &strings.Builder{}
+		changes := []FileChange{
+			{Path: "pkg/some,file.go", CreationYear: 2016, LastEditionYear: 2019},
+			{Path: "pkg/some;file.go", CreationYear: 2017, LastEditionYear: 2018},
+		}
+
+		err := core.WriteCsvReport(builder, changes, ';')
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(builder.String()).To(Equal(`path;start_year;end_year
+pkg/some,file.go;2016;2019
+"pkg/some;file.go";2017;2018
+`))
+	})
+
+	It("does not reorder the given changes", func() {
+		changes := []FileChange{{Path: "b.go"}, {Path: "a.go"}}
+
+		err := core.WriteCsvReport(&strings.Builder{}, changes, ',')
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes).To(Equal([]FileChange{{Path: "b.go"}, {Path: "a.go"}}))
+	})
+})
+
+var _ = Describe("GitHub annotations", func() {
+
+	It("writes an error annotation per file needing a header update", func() {
+		builder := &strings.Builder{}
+		verdicts := []core.Verdict{
+			{Path: "main.go", Reason: core.HeaderMissing},
+			{Path: "pkg/stale.go", Reason: core.HeaderWithStaleYears},
+		}
+
+		err := core.WriteGithubAnnotations(builder, verdicts)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(builder.String()).To(Equal("::error file=main.go,line=1::Missing or outdated license header (missing header)\n" +
+			"::error file=pkg/stale.go,line=1::Missing or outdated license header (stale year)\n"))
+	})
+
+	It("escapes the paths of the annotated files", func() {
+		builder := &strings.Builder{}
+
+		err := core.WriteGithubAnnotations(builder, []core.Verdict{{Path: "some,100%:file.go", Reason: core.HeaderMissing}})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(builder.String()).To(HavePrefix("::error file=some%2C100%25%3Afile.go,line=1::"))
+	})
+})
+
+var _ = Describe("SARIF report", func() {
+
+	It("writes a result per file needing a header update", func() {
+		builder := &strings.Builder{}
+		verdicts := []core.Verdict{
+			{Path: "main.go", Reason: core.HeaderMissing},
+			{Path: "pkg/stale file.go", Reason: core.HeaderWithStaleYears},
+		}
+
+		err := core.WriteSarifReport(builder, verdicts)
+
+		Expect(err).NotTo(HaveOccurred())
+		var report map[string]interface{}
+		Expect(json.Unmarshal([]byte(builder.String()), &report)).To(Succeed())
+		Expect(report["version"]).To(Equal("2.1.0"))
+		Expect(report["$schema"]).To(Equal("https://json.schemastore.org/sarif-2.1.0.json"))
+		runs := report["runs"].([]interface{})
+		Expect(runs).To(HaveLen(1))
+		run := runs[0].(map[string]interface{})
+		driver := run["tool"].(map[string]interface{})["driver"].(map[string]interface{})
+		Expect(driver["name"]).To(Equal("headache"))
+		rules := driver["rules"].([]interface{})
+		Expect(rules).To(ContainElement(HaveKeyWithValue("id", "headache/missing-header")))
+		Expect(rules).To(ContainElement(HaveKeyWithValue("id", "headache/stale-year")))
+		results := run["results"].([]interface{})
+		Expect(results).To(HaveLen(2))
+		for i, expected := range []struct{ ruleId, uri string }{
+			{"headache/missing-header", "main.go"},
+			{"headache/stale-year", "pkg/stale%20file.go"},
+		} {
+			result := results[i].(map[string]interface{})
+			Expect(result["ruleId"]).To(Equal(expected.ruleId))
+			Expect(result["level"]).To(Equal("error"))
+			Expect(rules[int(result["ruleIndex"].(float64))]).To(HaveKeyWithValue("id", expected.ruleId))
+			location := result["locations"].([]interface{})[0].(map[string]interface{})["physicalLocation"].(map[string]interface{})
+			Expect(location["artifactLocation"]).To(Equal(map[string]interface{}{"uri": expected.uri}))
+			Expect(location["region"]).To(Equal(map[string]interface{}{"startLine": float64(1)}))
+		}
+	})
+
+	It("writes an empty result list when no file needs a header update", func() {
+		builder := &strings.Builder{}
+
+		err := core.WriteSarifReport(builder, []core.Verdict{})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(builder.String()).To(ContainSubstring(`"results": []`))
+	})
+
+	It("rejects unknown update reasons", func() {
+		err := core.WriteSarifReport(&strings.Builder{}, []core.Verdict{{Path: "main.go", Reason: core.HeaderUpToDate}})
+
+		Expect(err).To(MatchError(`no SARIF rule for update reason "up-to-date" of file main.go`))
+	})
+})
+
+var _ = Describe("Year span report", func() {
+
+	It("groups the changes by year span", func() {
+		changes := []FileChange{
+			{Path: "c.go", CreationYear: 2019, LastEditionYear: 2024},
+			{Path: "b.go", CreationYear: 2022, LastEditionYear: 2022},
+			{Path: "a.go", CreationYear: 2019, LastEditionYear: 2024},
+			{Path: "d.go", CreationYear: 2019, LastEditionYear: 2020},
+			{Path: "e.go", DisplayPath: "src/e.go", CreationYear: 2022, LastEditionYear: 2022},
+		}
+
+		groups := core.GroupByYearSpan(changes)
+
+		Expect(groups).To(Equal([]core.YearSpanGroup{
+			{Span: core.YearSpan{CreationYear: 2019, LastEditionYear: 2020}, Paths: []string{"d.go"}},
+			{Span: core.YearSpan{CreationYear: 2019, LastEditionYear: 2024}, Paths: []string{"a.go", "c.go"}},
+			{Span: core.YearSpan{CreationYear: 2022, LastEditionYear: 2022}, Paths: []string{"b.go", "src/e.go"}},
+		}))
+	})
+
+	It("formats year spans as rendered in headers", func() {
+		Expect(core.YearSpan{CreationYear: 2019, LastEditionYear: 2024}.String()).To(Equal("2019-2024"))
+		Expect(core.YearSpan{CreationYear: 2022, LastEditionYear: 2022}.String()).To(Equal("2022"))
+	})
+})
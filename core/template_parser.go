@@ -27,9 +27,16 @@ type ParsedTemplate struct { // visible for testing
 	DetectionRegex *regexp.Regexp
 }
 
-func ParseTemplate(versionedHeader *VersionedHeaderTemplate, style CommentStyle) (*ParsedTemplate, error) {
-	currentData := injectReservedYearParameter(versionedHeader.Current.Data)
-	commentedLines, err := applyComments(versionedHeader.Current.Lines, style)
+// HeaderFormat tunes how headers are laid out in comments of a given style
+// headers are detected whatever their format
+type HeaderFormat struct {
+	BlankLines bool `json:"blankLines"` // an empty commented line follows the opening line and precedes the closing line
+	Padding    int  `json:"padding"`    // number of extra spaces between the comment prefix and the header lines
+}
+
+func ParseTemplate(versionedHeader *VersionedHeaderTemplate, style CommentStyle, format HeaderFormat) (*ParsedTemplate, error) {
+	currentData := injectReservedParameters(versionedHeader.Current.Data)
+	commentedLines, err := applyComments(versionedHeader.Current.Lines, style, format)
 	if err != nil {
 		return nil, err
 	}
@@ -43,7 +50,7 @@ func ParseTemplate(versionedHeader *VersionedHeaderTemplate, style CommentStyle)
 		return nil, err
 	}
 
-	previousData := injectReservedYearParameter(versionedHeader.Previous.Data)
+	previousData := injectReservedParameters(versionedHeader.Previous.Data)
 	regex, err := ComputeDetectionRegex(versionedHeader.Previous.Lines, previousData)
 	if err != nil {
 		return nil, err
@@ -56,22 +63,35 @@ func ParseTemplate(versionedHeader *VersionedHeaderTemplate, style CommentStyle)
 
 // injects reserved parameter into template data map by setting values as template placeholders
 // the template will be parsed a second time, file by file, with the actual values
-func injectReservedYearParameter(currentData map[string]string) map[string]string {
+func injectReservedParameters(currentData map[string]string) map[string]string {
 	currentData["Year"] = "{{.YearRange}}" // deprecated but kept for backwards compatibility
 	currentData["YearRange"] = "{{.YearRange}}"
 	currentData["StartYear"] = "{{.StartYear}}"
 	currentData["EndYear"] = "{{.EndYear}}"
+	currentData["CreationDate"] = "{{.CreationDate}}"
+	currentData["LastEditionDate"] = "{{.LastEditionDate}}"
+	currentData["Path"] = "{{.Path}}"
 	return currentData
 }
 
-func applyComments(lines []string, style CommentStyle) ([]string, error) {
+func applyComments(lines []string, style CommentStyle, format HeaderFormat) ([]string, error) {
 	result := make([]string, 0)
 	if openingLine := style.GetOpeningString(); openingLine != "" {
 		result = append(result, openingLine)
 	}
+	if format.BlankLines {
+		result = append(result, prependLine(style, ""))
+	}
+	padding := strings.Repeat(" ", format.Padding)
 	for _, line := range lines {
+		if line != "" {
+			line = padding + line
+		}
 		result = append(result, prependLine(style, line))
 	}
+	if format.BlankLines {
+		result = append(result, prependLine(style, ""))
+	}
 	if closingLine := style.GetClosingString(); closingLine != "" {
 		result = append(result, closingLine)
 	}
@@ -33,7 +33,7 @@ var _ = Describe("Template parser", func() {
 			Current:  &template,
 			Revision: "",
 		}
-		result, err := core.ParseTemplate(versionedTemplate, core.Hash{})
+		result, err := core.ParseTemplate(versionedTemplate, core.Hash{}, core.HeaderFormat{})
 
 		Expect(err).NotTo(HaveOccurred())
 		Expect(result.ActualContent).To(Equal("# Copyright (c) {{.StartYear}} -- {{.EndYear}} Florent"))
@@ -45,7 +45,7 @@ var _ = Describe("Template parser", func() {
 			Current:  &yearRangeTemplate,
 			Revision: "",
 		}
-		result, err := core.ParseTemplate(versionedTemplate, core.Hash{})
+		result, err := core.ParseTemplate(versionedTemplate, core.Hash{}, core.HeaderFormat{})
 
 		Expect(err).NotTo(HaveOccurred())
 		Expect(result.ActualContent).To(Equal("# Copyright (c) {{.YearRange}} Florent"))
@@ -57,9 +57,44 @@ var _ = Describe("Template parser", func() {
 			Current:  &legacyTemplate,
 			Revision: "",
 		}
-		result, err := core.ParseTemplate(versionedTemplate, core.Hash{})
+		result, err := core.ParseTemplate(versionedTemplate, core.Hash{}, core.HeaderFormat{})
 
 		Expect(err).NotTo(HaveOccurred())
 		Expect(result.ActualContent).To(Equal("# Copyright (c) {{.YearRange}} Florent"))
 	})
+
+	Describe("with header formats", func() {
+
+		// parsing replaces the template data with their detection patterns
+		versionedTemplate := func() *core.VersionedHeaderTemplate {
+			licenseTemplate := core.HeaderTemplate{
+				Lines: []string{"Copyright {{.YearRange}} {{.Author}}", "", "Licensed under MIT"},
+				Data:  map[string]string{"Author": "ACME"},
+			}
+			return &core.VersionedHeaderTemplate{Previous: &licenseTemplate, Current: &licenseTemplate}
+		}
+
+		It("renders the same template idiomatically per comment style", func() {
+			blockResult, err := core.ParseTemplate(versionedTemplate(), core.SlashStar{}, core.HeaderFormat{BlankLines: true})
+			Expect(err).NotTo(HaveOccurred())
+			lineResult, err := core.ParseTemplate(versionedTemplate(), core.SlashSlash{}, core.HeaderFormat{Padding: 1})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(blockResult.ActualContent).To(Equal("/*\n *\n * Copyright {{.YearRange}} ACME\n *\n * Licensed under MIT\n *\n */"))
+			Expect(lineResult.ActualContent).To(Equal("//  Copyright {{.YearRange}} ACME\n//\n//  Licensed under MIT"))
+		})
+
+		It("detects headers whatever their format", func() {
+			result, err := core.ParseTemplate(versionedTemplate(), core.SlashStar{}, core.HeaderFormat{})
+			Expect(err).NotTo(HaveOccurred())
+
+			for _, header := range []string{
+				"/*\n * Copyright 2020 ACME\n *\n * Licensed under MIT\n */",
+				"/*\n *\n * Copyright 2020 ACME\n *\n * Licensed under MIT\n *\n */",
+				"//  Copyright 2020 ACME\n//\n//  Licensed under MIT",
+			} {
+				Expect(result.DetectionRegex.FindString(header+"\n\npackage foo")).To(HavePrefix(header), header)
+			}
+		})
+	})
 })
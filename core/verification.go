@@ -0,0 +1,443 @@
+/*
+ * Copyright 2019 Florent Biville (@fbiville)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"github.com/fbiville/headache/fs"
+	"github.com/fbiville/headache/vcs"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type UpdateReason string
+
+const (
+	HeaderUpToDate             UpdateReason = "up-to-date"
+	HeaderMissing              UpdateReason = "missing header"
+	HeaderWithStaleYears       UpdateReason = "stale year"
+	HeaderWithDifferentWording UpdateReason = "different wording"
+	HeaderMisplaced            UpdateReason = "misplaced header"
+	HeaderWithOutdatedLicense  UpdateReason = "outdated license"
+	HeaderEditedByHand         UpdateReason = "hand-edited header"
+)
+
+// year lists such as 2018, 2020-2021 are matched as a whole
+var yearRangeRegex = regexp.MustCompile(`\d{4}(?:[ \t]*[-,][ \t]*\d{4})*`)
+
+// the holder follows the years of copyright lines, as in Copyright (c) 2018-2019, 2021 ACME
+var copyrightHolderRegex = regexp.MustCompile(`(?im)copyright[ \t]+(?:\(c\)[ \t]*|©[ \t]*)?(?:\d{4}(?:[ \t]*-[ \t]*\d{4})?[ \t]*,?[ \t]*)+(.*)$`)
+
+type Verdict struct {
+	Path   string
+	Reason UpdateReason
+}
+
+// NeedsUpdate returns whether the file contents start with the expected header and, if not, why
+// top comments declaring the expected copyrights, years aside, are considered as headers with an outdated license,
+// other top comments mentioning a copyright or a license are considered as headers with a different wording
+// lines only differing by their trailing whitespace, which editors often strip, are considered equal
+func NeedsUpdate(currentContent string, expectedHeader string, style CommentStyle) (bool, UpdateReason) {
+	lineCount := strings.Count(expectedHeader, "\n") + 1
+	expectedHeader = trimTrailingWhitespace(expectedHeader, lineCount)
+	currentContent = trimTrailingWhitespace(currentContent, lineCount)
+	if strings.HasPrefix(currentContent, expectedHeader) {
+		return false, HeaderUpToDate
+	}
+	if yearAgnosticRegex(expectedHeader).MatchString(currentContent) {
+		return true, HeaderWithStaleYears
+	}
+	if isOutdatedLicense(extractTopComment(currentContent, style), expectedHeader) {
+		return true, HeaderWithOutdatedLicense
+	}
+	topComment := strings.ToLower(extractTopComment(currentContent, style))
+	if strings.Contains(topComment, "copyright") || strings.Contains(topComment, "license") {
+		return true, HeaderWithDifferentWording
+	}
+	return true, HeaderMissing
+}
+
+// Check returns the verdicts of the files whose header needs to be updated
+// only files without header are reported in add-only mode
+func Check(config *ChangeSet, fileSystem *fs.FileSystem) ([]Verdict, error) {
+	result := make([]Verdict, 0)
+	for _, change := range config.Files {
+		bytes, err := fileSystem.FileReader.Read(change.Path)
+		if err != nil {
+			return nil, err
+		}
+		if isSkippedEmptyFile(change.Path, bytes, config) {
+			continue
+		}
+		commentable, err := isCommentable(change.Path, bytes, config)
+		if err != nil {
+			return nil, err
+		}
+		if !commentable {
+			continue
+		}
+		change, err = config.withHistory(change)
+		if err != nil {
+			return nil, err
+		}
+		reason, err := updateReason(change, bytes, config)
+		if err != nil {
+			return nil, err
+		}
+		if reason != HeaderUpToDate {
+			result = append(result, Verdict{Path: change.Path, Reason: reason})
+		}
+	}
+	return result, nil
+}
+
+// returns why the header of the commentable file needs to be updated, or HeaderUpToDate if it does not
+func updateReason(change vcs.FileChange, bytes []byte, config *ChangeSet) (UpdateReason, error) {
+	if isNotebook(change.Path) {
+		_, reason, err := updateNotebook(change, bytes, config)
+		return reason, err
+	}
+	_, contents := splitByteOrderMark(string(bytes))
+	prologue, fileContents := splitPreamble(contents, config)
+	remainingContents, existingHeaders := splitHeaders(fileContents, config.HeaderRegex, config.topHeaderRegex())
+	_, _, misplaced := hoistDirectives(prologue, remainingContents, existingHeaders)
+	expectedHeader, err := insertYears(headerContents(config, change), &change, existingHeaders, config.YearRangeFormat, config.DateFormat)
+	if err != nil {
+		return "", err
+	}
+	if err := ValidateRenderedHeader(expectedHeader, config.CommentStyle); err != nil {
+		return "", fmt.Errorf("invalid header for file %s\n\t%v", change.Path, err)
+	}
+	expectedHeader = withLineBreaks(expectedHeader, lineBreak(contents, config.LineEnding))
+	needsUpdate, reason := NeedsUpdate(fileContents, expectedHeader, config.CommentStyle)
+	if needsUpdate && reason == HeaderMissing && len(existingHeaders) > 0 {
+		// the header is there, only below other contents, where it is moved from rather than added again
+		reason = HeaderMisplaced
+	}
+	if config.AddOnly && !isMissingHeader(reason, existingHeaders) {
+		return HeaderUpToDate, nil
+	}
+	if needsUpdate && isEditedByHand(config, fileContents, expectedHeader, existingHeaders, reason) {
+		return HeaderEditedByHand, nil
+	}
+	if needsUpdate {
+		return reason, nil
+	}
+	if misplaced {
+		return HeaderMisplaced, nil
+	}
+	return HeaderUpToDate, nil
+}
+
+// FindFilesWithoutHeader returns the paths of the files without any header matching the configured one
+func FindFilesWithoutHeader(config *ChangeSet, fileSystem *fs.FileSystem) ([]string, error) {
+	result := make([]string, 0)
+	for _, change := range config.Files {
+		bytes, err := fileSystem.FileReader.Read(change.Path)
+		if err != nil {
+			return nil, err
+		}
+		_, contents := splitByteOrderMark(string(bytes))
+		_, fileContents := splitPreamble(contents, config)
+		if _, existingHeaders := splitHeaders(fileContents, config.HeaderRegex, config.topHeaderRegex()); len(existingHeaders) == 0 {
+			result = append(result, change.Path)
+		}
+	}
+	return result, nil
+}
+
+// StaleHeader describes a file edited after the latest year declared in its header
+type StaleHeader struct {
+	Path            string
+	DeclaredYear    int
+	LastEditionYear int
+}
+
+// FindStaleHeaders returns the files whose last edition year is after the latest year declared in their header
+// files without header are ignored
+func FindStaleHeaders(config *ChangeSet, fileSystem *fs.FileSystem) ([]StaleHeader, error) {
+	result := make([]StaleHeader, 0)
+	for _, change := range config.Files {
+		bytes, err := fileSystem.FileReader.Read(change.Path)
+		if err != nil {
+			return nil, err
+		}
+		_, contents := splitByteOrderMark(string(bytes))
+		_, fileContents := splitPreamble(contents, config)
+		_, existingHeaders := splitHeaders(fileContents, config.HeaderRegex, config.topHeaderRegex())
+		declaredYear, err := latestDeclaredYear(existingHeaders)
+		if err != nil {
+			return nil, err
+		}
+		if declaredYear == 0 {
+			continue
+		}
+		change, err = config.withHistory(change)
+		if err != nil {
+			return nil, err
+		}
+		if change.LastEditionYear > declaredYear {
+			result = append(result, StaleHeader{
+				Path:            change.Path,
+				DeclaredYear:    declaredYear,
+				LastEditionYear: change.LastEditionYear,
+			})
+		}
+	}
+	return result, nil
+}
+
+// HolderMismatch describes a file whose header declares other copyright holders than the expected ones
+type HolderMismatch struct {
+	Path            string
+	DeclaredHolders []string
+	ExpectedHolders []string
+}
+
+// FindHolderMismatches returns the files whose header declares other copyright holders than the header they would get,
+// as when a company got renamed
+// files without header are ignored
+func FindHolderMismatches(config *ChangeSet, fileSystem *fs.FileSystem) ([]HolderMismatch, error) {
+	result := make([]HolderMismatch, 0)
+	for _, change := range config.Files {
+		bytes, err := fileSystem.FileReader.Read(change.Path)
+		if err != nil {
+			return nil, err
+		}
+		_, contents := splitByteOrderMark(string(bytes))
+		_, fileContents := splitPreamble(contents, config)
+		_, existingHeaders := splitHeaders(fileContents, config.HeaderRegex, config.topHeaderRegex())
+		if len(existingHeaders) == 0 {
+			continue
+		}
+		change, err = config.withHistory(change)
+		if err != nil {
+			return nil, err
+		}
+		expectedHeader, err := insertYears(headerContents(config, change), &change, existingHeaders, config.YearRangeFormat, config.DateFormat)
+		if err != nil {
+			return nil, err
+		}
+		declaredHolders := copyrightHolders(existingHeaders...)
+		expectedHolders := copyrightHolders(expectedHeader)
+		if !reflect.DeepEqual(declaredHolders, expectedHolders) {
+			result = append(result, HolderMismatch{
+				Path:            change.Path,
+				DeclaredHolders: declaredHolders,
+				ExpectedHolders: expectedHolders,
+			})
+		}
+	}
+	return result, nil
+}
+
+// HeaderFingerprint returns a digest of the header, years and whitespace aside, so that the headers of files only
+// differing by them share the same fingerprint
+func HeaderFingerprint(header string) string {
+	canonicalHeader := strings.Join(strings.Fields(yearRangeRegex.ReplaceAllString(header, "")), " ")
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(canonicalHeader)))
+}
+
+// HeaderGroup gathers the paths of the files sharing the same header fingerprint, sorted
+type HeaderGroup struct {
+	Fingerprint string
+	Paths       []string
+}
+
+// GroupByHeaderFingerprint returns the files with a header grouped by header fingerprint, the largest groups first,
+// so that the files whose wording diverges from the norm stand out
+// files without header are ignored
+func GroupByHeaderFingerprint(config *ChangeSet, fileSystem *fs.FileSystem) ([]HeaderGroup, error) {
+	groups := make(map[string][]string)
+	for _, change := range config.Files {
+		bytes, err := fileSystem.FileReader.Read(change.Path)
+		if err != nil {
+			return nil, err
+		}
+		_, contents := splitByteOrderMark(string(bytes))
+		_, fileContents := splitPreamble(contents, config)
+		_, existingHeaders := splitHeaders(fileContents, config.HeaderRegex, config.topHeaderRegex())
+		if len(existingHeaders) == 0 {
+			continue
+		}
+		fingerprint := HeaderFingerprint(strings.Join(existingHeaders, "\n"))
+		groups[fingerprint] = append(groups[fingerprint], change.Path)
+	}
+	result := make([]HeaderGroup, 0, len(groups))
+	for fingerprint, paths := range groups {
+		sort.Strings(paths)
+		result = append(result, HeaderGroup{Fingerprint: fingerprint, Paths: paths})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if len(result[i].Paths) != len(result[j].Paths) {
+			return len(result[i].Paths) > len(result[j].Paths)
+		}
+		return result[i].Paths[0] < result[j].Paths[0]
+	})
+	return result, nil
+}
+
+// returns the sorted distinct holders of the copyright lines of the headers, without any trailing comment closing
+func copyrightHolders(headers ...string) []string {
+	holders := make([]string, 0)
+	for _, header := range headers {
+		for _, match := range copyrightHolderRegex.FindAllStringSubmatch(header, -1) {
+			holders = append(holders, strings.TrimSuffix(strings.TrimSpace(match[1]), "*/"))
+		}
+	}
+	return distinctSortedHolders(holders)
+}
+
+// returns the latest end year of the year ranges of the headers, or 0 if none declares any
+func latestDeclaredYear(headers []string) (int, error) {
+	result := 0
+	for _, header := range headers {
+		for _, yearRange := range yearRangeRegex.FindAllString(header, -1) {
+			for _, yearString := range yearRegex.FindAllString(yearRange, -1) {
+				year, err := strconv.Atoi(yearString)
+				if err != nil {
+					return 0, err
+				}
+				if year > result {
+					result = year
+				}
+			}
+		}
+	}
+	return result, nil
+}
+
+// returns whether the detected header, or else the top comment declaring the expected copyrights, words things
+// differently than the expected header, years and comment delimiters aside
+// headers written with the current template can only differ that way when edited by hand, hence only then is it checked
+func isEditedByHand(config *ChangeSet, contents string, expectedHeader string, existingHeaders []string, reason UpdateReason) bool {
+	if !config.DetectHandEdits {
+		return false
+	}
+	header := ""
+	if len(existingHeaders) > 0 {
+		header = existingHeaders[0]
+	} else if reason == HeaderWithOutdatedLicense {
+		header = extractTopComment(contents, config.CommentStyle)
+	}
+	return header != "" && !reflect.DeepEqual(wording(header), wording(expectedHeader))
+}
+
+// returns the words of the header, leaving out years and the fields without letters nor digits, such as comment delimiters
+func wording(header string) []string {
+	result := make([]string, 0)
+	for _, field := range strings.Fields(yearRangeRegex.ReplaceAllString(header, "")) {
+		if strings.IndexFunc(field, isAlphanumeric) != -1 {
+			result = append(result, field)
+		}
+	}
+	return result
+}
+
+func isAlphanumeric(char rune) bool {
+	return unicode.IsLetter(char) || unicode.IsDigit(char)
+}
+
+// returns whether the comment declares the same copyrights as the expected header, years aside, the rest of its text,
+// i.e. the license, being different
+func isOutdatedLicense(comment string, expectedHeader string) bool {
+	expectedLines := copyrightLines(expectedHeader)
+	actualLines := copyrightLines(comment)
+	if len(expectedLines) == 0 || len(actualLines) != len(expectedLines) {
+		return false
+	}
+	for i, expectedLine := range expectedLines {
+		if yearAgnosticRegex(expectedLine).FindString(actualLines[i]) != actualLines[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// returns the lines of the header mentioning a copyright, without their trailing whitespace
+func copyrightLines(header string) []string {
+	result := make([]string, 0)
+	for _, line := range strings.Split(header, "\n") {
+		if strings.Contains(strings.ToLower(line), "copyright") {
+			result = append(result, strings.TrimRight(line, " \t"))
+		}
+	}
+	return result
+}
+
+// trailing whitespace is ignored, except on the last line
+func yearAgnosticRegex(header string) *regexp.Regexp {
+	header = trimTrailingWhitespace(header, strings.Count(header, "\n"))
+	builder := strings.Builder{}
+	builder.WriteString("^")
+	previousEnd := 0
+	for _, location := range yearRangeRegex.FindAllStringIndex(header, -1) {
+		builder.WriteString(quoteLines(header[previousEnd:location[0]]))
+		builder.WriteString(yearRangeRegex.String())
+		previousEnd = location[1]
+	}
+	builder.WriteString(quoteLines(header[previousEnd:]))
+	return regexp.MustCompile(builder.String())
+}
+
+func quoteLines(contents string) string {
+	contents = strings.Replace(contents, "\r\n", "\n", -1)
+	return strings.Replace(regexp.QuoteMeta(contents), "\n", "[ \t]*\r?\n", -1)
+}
+
+// removes the trailing whitespace of the given number of first lines of the contents
+func trimTrailingWhitespace(contents string, lineCount int) string {
+	lines := strings.SplitN(contents, "\n", lineCount+1)
+	for i := 0; i < len(lines) && i < lineCount; i++ {
+		if strings.HasSuffix(lines[i], "\r") {
+			lines[i] = strings.TrimRight(lines[i][:len(lines[i])-1], " \t") + "\r"
+		} else {
+			lines[i] = strings.TrimRight(lines[i], " \t")
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func extractTopComment(contents string, style CommentStyle) string {
+	if style == nil {
+		return ""
+	}
+	contents = strings.TrimLeft(contents, " \t\r\n")
+	if opening := style.GetOpeningString(); opening != "" {
+		if !strings.HasPrefix(contents, opening) {
+			return ""
+		}
+		if end := blockCommentEnd(contents, style); end != -1 {
+			return contents[:end]
+		}
+		return contents
+	}
+	prefix := strings.TrimRight(style.GetString(), " ")
+	lines := make([]string, 0)
+	for _, line := range strings.Split(contents, "\n") {
+		if !strings.HasPrefix(line, prefix) {
+			break
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright 2018 Florent Biville (@fbiville)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"fmt"
+	"github.com/fbiville/headache/fs"
+	"github.com/fbiville/headache/vcs"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+var benchmarkVerdicts []Verdict
+
+func BenchmarkCheckUpToDateFiles(b *testing.B) {
+	changeSet, fileSystem := benchmarkChangeSet("// Copyright 2018-2019 ACME\n//\n// Some license\n\n")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		benchmarkVerdicts, _ = Check(changeSet, fileSystem)
+	}
+}
+
+func BenchmarkCheckFilesWithoutHeader(b *testing.B) {
+	changeSet, fileSystem := benchmarkChangeSet("")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		benchmarkVerdicts, _ = Check(changeSet, fileSystem)
+	}
+}
+
+// 100 files of about 40kB each, starting with the given header
+func benchmarkChangeSet(header string) (*ChangeSet, *fs.FileSystem) {
+	template := &HeaderTemplate{
+		Lines: []string{"Copyright {{.YearRange}} {{.Owner}}", "", "Some license"},
+		Data:  map[string]string{"Owner": "ACME"},
+	}
+	parsedTemplate, err := ParseTemplate(&VersionedHeaderTemplate{Current: template, Previous: template}, SlashSlash{}, HeaderFormat{})
+	if err != nil {
+		panic(err)
+	}
+	body := "package foo\n\n" + strings.Repeat("// does things\nfunc foo() string {\n\treturn \"bar\"\n}\n\n", 1000)
+	reader := inMemoryFileReader{}
+	changes := make([]vcs.FileChange, 0)
+	for i := 0; i < 100; i++ {
+		path := fmt.Sprintf("file-%d.go", i)
+		reader[path] = []byte(header + body)
+		changes = append(changes, vcs.FileChange{Path: path, CreationYear: 2018, LastEditionYear: 2019})
+	}
+	changeSet := &ChangeSet{
+		HeaderContents: parsedTemplate.ActualContent,
+		HeaderRegex:    parsedTemplate.DetectionRegex,
+		TopHeaderRegex: anchor(parsedTemplate.DetectionRegex),
+		CommentStyle:   SlashSlash{},
+		Files:          changes,
+	}
+	return changeSet, &fs.FileSystem{FileReader: reader}
+}
+
+type inMemoryFileReader map[string][]byte
+
+func (reader inMemoryFileReader) Read(path string) ([]byte, error) {
+	contents, found := reader[path]
+	if !found {
+		return nil, os.ErrNotExist
+	}
+	return contents, nil
+}
+func (inMemoryFileReader) Open(path string) (http.File, error)   { panic("not implemented") }
+func (inMemoryFileReader) Stat(path string) (os.FileInfo, error) { panic("not implemented") }
@@ -0,0 +1,609 @@
+/*
+ * Copyright 2019 Florent Biville (@fbiville)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core_test
+
+import (
+	. "github.com/fbiville/headache/core"
+	"github.com/fbiville/headache/fs"
+	"github.com/fbiville/headache/fs_mocks"
+	"github.com/fbiville/headache/vcs"
+	"github.com/fbiville/headache/vcs_mocks"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"regexp"
+)
+
+var _ = Describe("Header verification", func() {
+
+	var expectedHeader string
+
+	BeforeEach(func() {
+		expectedHeader = "/*\n * Copyright 2018-2019 ACME\n *\n * Some license\n */"
+	})
+
+	It("does not require updates when the expected header is at the top", func() {
+		needsUpdate, reason := NeedsUpdate(expectedHeader+"\n\npackage foo", expectedHeader, SlashStar{})
+
+		Expect(needsUpdate).To(BeFalse())
+		Expect(reason).To(Equal(HeaderUpToDate))
+	})
+
+	It("does not require updates when the expected header only differs by trailing whitespace", func() {
+		expectedHeader := "/*\n * Copyright 2018-2019 ACME  \n *\n * Some license\t\n */"
+
+		needsUpdate, reason := NeedsUpdate("/*\n * Copyright 2018-2019 ACME\n *\n * Some license\n */\n\npackage foo", expectedHeader, SlashStar{})
+
+		Expect(needsUpdate).To(BeFalse())
+		Expect(reason).To(Equal(HeaderUpToDate))
+	})
+
+	It("requires updates when the header years are stale and its trailing whitespace stripped", func() {
+		expectedHeader := "/*\n * Copyright 2018-2019 ACME  \n *\n * Some license\n */"
+
+		needsUpdate, reason := NeedsUpdate("/*\n * Copyright 2018 ACME\n *\n * Some license\n */\n\npackage foo", expectedHeader, SlashStar{})
+
+		Expect(needsUpdate).To(BeTrue())
+		Expect(reason).To(Equal(HeaderWithStaleYears))
+	})
+
+	It("does not require updates when the expected CRLF header only differs by trailing whitespace", func() {
+		expectedHeader := "/*\r\n * Copyright 2018-2019 ACME  \r\n *\r\n * Some license\r\n */"
+
+		needsUpdate, reason := NeedsUpdate("/*\r\n * Copyright 2018-2019 ACME\r\n *\r\n * Some license\r\n */\r\n\r\npackage foo", expectedHeader, SlashStar{})
+
+		Expect(needsUpdate).To(BeFalse())
+		Expect(reason).To(Equal(HeaderUpToDate))
+	})
+
+	It("requires updates when the header is missing", func() {
+		needsUpdate, reason := NeedsUpdate("// Package foo does things\npackage foo", expectedHeader, SlashStar{})
+
+		Expect(needsUpdate).To(BeTrue())
+		Expect(reason).To(Equal(HeaderMissing))
+	})
+
+	It("requires updates when the header years are stale", func() {
+		contents := "/*\n * Copyright 2018 ACME\n *\n * Some license\n */\n\npackage foo"
+
+		needsUpdate, reason := NeedsUpdate(contents, expectedHeader, SlashStar{})
+
+		Expect(needsUpdate).To(BeTrue())
+		Expect(reason).To(Equal(HeaderWithStaleYears))
+	})
+
+	It("requires updates when the header lists stale years", func() {
+		contents := "/*\n * Copyright 2018, 2020 ACME\n *\n * Some license\n */\n\npackage foo"
+
+		needsUpdate, reason := NeedsUpdate(contents, "/*\n * Copyright 2018, 2020, 2023 ACME\n *\n * Some license\n */", SlashStar{})
+
+		Expect(needsUpdate).To(BeTrue())
+		Expect(reason).To(Equal(HeaderWithStaleYears))
+	})
+
+	It("requires updates when the header wording is different", func() {
+		contents := "/*\n * Copyright 2018-2019 ACME Corp.\n *\n * Some other license\n */\n\npackage foo"
+
+		needsUpdate, reason := NeedsUpdate(contents, expectedHeader, SlashStar{})
+
+		Expect(needsUpdate).To(BeTrue())
+		Expect(reason).To(Equal(HeaderWithDifferentWording))
+	})
+
+	It("requires updates when the header declares the expected copyright with an outdated license", func() {
+		contents := "/*\n * Copyright 2018-2019 ACME\n *\n * Some former license\n */\n\npackage foo"
+
+		needsUpdate, reason := NeedsUpdate(contents, expectedHeader, SlashStar{})
+
+		Expect(needsUpdate).To(BeTrue())
+		Expect(reason).To(Equal(HeaderWithOutdatedLicense))
+	})
+
+	It("requires updates when a line comment header has a different wording", func() {
+		contents := "// Licensed under MIT\n\npackage foo"
+
+		needsUpdate, reason := NeedsUpdate(contents, "// Copyright 2019 ACME", SlashSlash{})
+
+		Expect(needsUpdate).To(BeTrue())
+		Expect(reason).To(Equal(HeaderWithDifferentWording))
+	})
+
+	It("reports the files needing an update", func() {
+		t := GinkgoT()
+		fileReader := new(fs_mocks.FileReader)
+		fileReader.On("Read", "up-to-date.go").Return([]byte("// Copyright 2018-2019 ACME\n\npackage foo"), nil)
+		fileReader.On("Read", "stale.go").Return([]byte("// Copyright 2018 ACME\n\npackage foo"), nil)
+		fileReader.On("Read", "missing.go").Return([]byte("package foo"), nil)
+		changeSet := &ChangeSet{
+			HeaderContents: "// Copyright {{.YearRange}} ACME",
+			HeaderRegex:    regexp.MustCompile(`(?m)^// Copyright .* ACME\n?`),
+			CommentStyle:   SlashSlash{},
+			Files: []vcs.FileChange{
+				{Path: "up-to-date.go", CreationYear: 2018, LastEditionYear: 2019},
+				{Path: "stale.go", CreationYear: 2018, LastEditionYear: 2019},
+				{Path: "missing.go", CreationYear: 2018, LastEditionYear: 2019},
+			},
+		}
+
+		verdicts, err := Check(changeSet, &fs.FileSystem{FileReader: fileReader})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(verdicts).To(Equal([]Verdict{
+			{Path: "stale.go", Reason: HeaderWithStaleYears},
+			{Path: "missing.go", Reason: HeaderMissing},
+		}))
+		fileReader.AssertExpectations(t)
+	})
+
+	Describe("with headers written by the last execution", func() {
+
+		var (
+			t          GinkgoTInterface
+			fileReader *fs_mocks.FileReader
+			changeSet  *ChangeSet
+		)
+
+		BeforeEach(func() {
+			t = GinkgoT()
+			fileReader = new(fs_mocks.FileReader)
+			fileReader.On("Read", "stale.go").Return([]byte("// Copyright 2018 ACME\n//\n// Some license\n\npackage foo"), nil)
+			fileReader.On("Read", "edited-holder.go").Return([]byte("// Copyright 2018 ACME and friends\n//\n// Some license\n\npackage foo"), nil)
+			fileReader.On("Read", "edited-license.go").Return([]byte("// Copyright 2018 ACME\n//\n// Some modified license\n\npackage foo"), nil)
+			regex, err := ComputeDetectionRegex([]string{"Copyright {{.YearRange}} {{.Owner}}", "", "Some license"}, map[string]string{"YearRange": "", "Owner": ""})
+			Expect(err).NotTo(HaveOccurred())
+			changeSet = &ChangeSet{
+				HeaderContents:  "// Copyright {{.YearRange}} ACME\n//\n// Some license",
+				HeaderRegex:     regexp.MustCompile(regex),
+				CommentStyle:    SlashSlash{},
+				DetectHandEdits: true,
+				Files: []vcs.FileChange{
+					{Path: "stale.go", CreationYear: 2018, LastEditionYear: 2019},
+					{Path: "edited-holder.go", CreationYear: 2018, LastEditionYear: 2019},
+					{Path: "edited-license.go", CreationYear: 2018, LastEditionYear: 2019},
+				},
+			}
+		})
+
+		AfterEach(func() {
+			fileReader.AssertExpectations(t)
+		})
+
+		It("reports the headers edited by hand", func() {
+			verdicts, err := Check(changeSet, &fs.FileSystem{FileReader: fileReader})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(verdicts).To(Equal([]Verdict{
+				{Path: "stale.go", Reason: HeaderWithStaleYears},
+				{Path: "edited-holder.go", Reason: HeaderEditedByHand},
+				{Path: "edited-license.go", Reason: HeaderEditedByHand},
+			}))
+		})
+
+		It("reports the headers differing from another template as such", func() {
+			changeSet.DetectHandEdits = false
+
+			verdicts, err := Check(changeSet, &fs.FileSystem{FileReader: fileReader})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(verdicts).To(Equal([]Verdict{
+				{Path: "stale.go", Reason: HeaderWithStaleYears},
+				{Path: "edited-holder.go", Reason: HeaderWithDifferentWording},
+				{Path: "edited-license.go", Reason: HeaderWithOutdatedLicense},
+			}))
+		})
+	})
+
+	It("reports headers found below preambles within the search window according to their years only", func() {
+		t := GinkgoT()
+		fileReader := new(fs_mocks.FileReader)
+		fileReader.On("Read", "up-to-date.py").Return([]byte("# -*- coding: utf-8 -*-\n# Copyright 2018-2019 ACME\n\nprint()"), nil)
+		fileReader.On("Read", "stale.py").Return([]byte("# -*- coding: utf-8 -*-\n# Copyright 2018 ACME\n\nprint()"), nil)
+		changeSet := &ChangeSet{
+			HeaderContents:    "# Copyright {{.YearRange}} ACME",
+			HeaderRegex:       regexp.MustCompile(`(?m)^# Copyright .* ACME\n?`),
+			CommentStyle:      Hash{},
+			HeaderSearchLines: 2,
+			Files: []vcs.FileChange{
+				{Path: "up-to-date.py", CreationYear: 2018, LastEditionYear: 2019},
+				{Path: "stale.py", CreationYear: 2018, LastEditionYear: 2019},
+			},
+		}
+
+		verdicts, err := Check(changeSet, &fs.FileSystem{FileReader: fileReader})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(verdicts).To(Equal([]Verdict{{Path: "stale.py", Reason: HeaderWithStaleYears}}))
+		fileReader.AssertExpectations(t)
+	})
+
+	It("only reports the files without header in add-only mode", func() {
+		t := GinkgoT()
+		fileReader := new(fs_mocks.FileReader)
+		fileReader.On("Read", "stale.go").Return([]byte("// Copyright 2018 ACME\n\npackage foo"), nil)
+		fileReader.On("Read", "missing.go").Return([]byte("package foo"), nil)
+		changeSet := &ChangeSet{
+			HeaderContents: "// Copyright {{.YearRange}} ACME",
+			HeaderRegex:    regexp.MustCompile(`(?m)^// Copyright .* ACME\n?`),
+			CommentStyle:   SlashSlash{},
+			AddOnly:        true,
+			Files: []vcs.FileChange{
+				{Path: "stale.go", CreationYear: 2018, LastEditionYear: 2019},
+				{Path: "missing.go", CreationYear: 2018, LastEditionYear: 2019},
+			},
+		}
+
+		verdicts, err := Check(changeSet, &fs.FileSystem{FileReader: fileReader})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(verdicts).To(Equal([]Verdict{{Path: "missing.go", Reason: HeaderMissing}}))
+		fileReader.AssertExpectations(t)
+	})
+
+	It("skips binary files", func() {
+		t := GinkgoT()
+		fileReader := new(fs_mocks.FileReader)
+		fileReader.On("Read", "logo.png").Return([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), nil)
+		fileReader.On("Read", "missing.go").Return([]byte("package foo"), nil)
+		changeSet := &ChangeSet{
+			HeaderContents:    "// Copyright {{.YearRange}} ACME",
+			HeaderRegex:       regexp.MustCompile(`(?m)^// Copyright .* ACME\n?`),
+			CommentStyle:      SlashSlash{},
+			SkipUnknownStyles: true,
+			Files: []vcs.FileChange{
+				{Path: "logo.png", CreationYear: 2018, LastEditionYear: 2019},
+				{Path: "missing.go", CreationYear: 2018, LastEditionYear: 2019},
+			},
+		}
+
+		verdicts, err := Check(changeSet, &fs.FileSystem{FileReader: fileReader})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(verdicts).To(Equal([]Verdict{{Path: "missing.go", Reason: HeaderMissing}}))
+		fileReader.AssertExpectations(t)
+	})
+
+	It("only reports empty files when they get a header", func() {
+		t := GinkgoT()
+		fileReader := new(fs_mocks.FileReader)
+		fileReader.On("Read", "empty.go").Return([]byte{}, nil)
+		changeSet := &ChangeSet{
+			HeaderContents: "// Copyright {{.YearRange}} ACME",
+			HeaderRegex:    regexp.MustCompile(`(?m)^// Copyright .* ACME\n?`),
+			CommentStyle:   SlashSlash{},
+			Files:          []vcs.FileChange{{Path: "empty.go", CreationYear: 2018, LastEditionYear: 2019}},
+		}
+
+		verdicts, err := Check(changeSet, &fs.FileSystem{FileReader: fileReader})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(verdicts).To(BeEmpty())
+
+		changeSet.AddHeaderToEmptyFiles = true
+		verdicts, err = Check(changeSet, &fs.FileSystem{FileReader: fileReader})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(verdicts).To(Equal([]Verdict{{Path: "empty.go", Reason: HeaderMissing}}))
+		fileReader.AssertExpectations(t)
+	})
+
+	It("fails on binary files when not skipping them", func() {
+		t := GinkgoT()
+		fileReader := new(fs_mocks.FileReader)
+		fileReader.On("Read", "logo.png").Return([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), nil)
+		changeSet := &ChangeSet{
+			HeaderContents: "// Copyright {{.YearRange}} ACME",
+			HeaderRegex:    regexp.MustCompile(`(?m)^// Copyright .* ACME\n?`),
+			CommentStyle:   SlashSlash{},
+			Files:          []vcs.FileChange{{Path: "logo.png", CreationYear: 2018, LastEditionYear: 2019}},
+		}
+
+		_, err := Check(changeSet, &fs.FileSystem{FileReader: fileReader})
+
+		Expect(err).To(MatchError("no comment style applies to binary file logo.png, set skipUnknownStyles to skip such files"))
+		fileReader.AssertExpectations(t)
+	})
+
+	It("skips files whose extension no comment style applies to", func() {
+		t := GinkgoT()
+		fileReader := new(fs_mocks.FileReader)
+		fileReader.On("Read", "notes.txt").Return([]byte("some notes"), nil)
+		fileReader.On("Read", "missing.go").Return([]byte("package foo"), nil)
+		changeSet := &ChangeSet{
+			HeaderContents:    "// Copyright {{.YearRange}} ACME",
+			HeaderRegex:       regexp.MustCompile(`(?m)^// Copyright .* ACME\n?`),
+			CommentStyle:      SlashSlash{},
+			SkipUnknownStyles: true,
+			Files: []vcs.FileChange{
+				{Path: "notes.txt", CreationYear: 2018, LastEditionYear: 2019},
+				{Path: "missing.go", CreationYear: 2018, LastEditionYear: 2019},
+			},
+		}
+
+		verdicts, err := Check(changeSet, &fs.FileSystem{FileReader: fileReader})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(verdicts).To(Equal([]Verdict{{Path: "missing.go", Reason: HeaderMissing}}))
+		fileReader.AssertExpectations(t)
+	})
+
+	It("fails on files whose extension no comment style applies to when not skipping them", func() {
+		t := GinkgoT()
+		fileReader := new(fs_mocks.FileReader)
+		fileReader.On("Read", "notes.txt").Return([]byte("some notes"), nil)
+		changeSet := &ChangeSet{
+			HeaderContents: "// Copyright {{.YearRange}} ACME",
+			HeaderRegex:    regexp.MustCompile(`(?m)^// Copyright .* ACME\n?`),
+			CommentStyle:   SlashSlash{},
+			Files:          []vcs.FileChange{{Path: "notes.txt", CreationYear: 2018, LastEditionYear: 2019}},
+		}
+
+		_, err := Check(changeSet, &fs.FileSystem{FileReader: fileReader})
+
+		Expect(err).To(MatchError("no comment style applies to .txt files such as notes.txt, set skipUnknownStyles to skip such files"))
+		fileReader.AssertExpectations(t)
+	})
+
+	It("checks files whose extension a registered comment style applies to", func() {
+		t := GinkgoT()
+		RegisterCommentStyle("SemiColons", WithExtensions(semiColons{}, ".lisp"))
+		defer UnregisterCommentStyle("SemiColons")
+		fileReader := new(fs_mocks.FileReader)
+		fileReader.On("Read", "core.LISP").Return([]byte("(defun foo ())"), nil)
+		changeSet := &ChangeSet{
+			HeaderContents: ";; Copyright {{.YearRange}} ACME",
+			HeaderRegex:    regexp.MustCompile(`(?m)^;; Copyright .* ACME\n?`),
+			CommentStyle:   semiColons{},
+			Files:          []vcs.FileChange{{Path: "core.LISP", CreationYear: 2018, LastEditionYear: 2019}},
+		}
+
+		verdicts, err := Check(changeSet, &fs.FileSystem{FileReader: fileReader})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(verdicts).To(Equal([]Verdict{{Path: "core.LISP", Reason: HeaderMissing}}))
+		fileReader.AssertExpectations(t)
+	})
+
+	It("reports headers below the package clause as misplaced", func() {
+		t := GinkgoT()
+		fileReader := new(fs_mocks.FileReader)
+		fileReader.On("Read", "foo.go").Return([]byte("package foo\n\n// Copyright 2018-2019 ACME\n\nfunc foo() {}\n"), nil)
+		changeSet := &ChangeSet{
+			HeaderContents: "// Copyright {{.YearRange}} ACME",
+			HeaderRegex:    regexp.MustCompile(`(?m)^// Copyright .* ACME\n?`),
+			CommentStyle:   SlashSlash{},
+			Files:          []vcs.FileChange{{Path: "foo.go", CreationYear: 2018, LastEditionYear: 2019}},
+		}
+
+		verdicts, err := Check(changeSet, &fs.FileSystem{FileReader: fileReader})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(verdicts).To(Equal([]Verdict{{Path: "foo.go", Reason: HeaderMisplaced}}))
+		fileReader.AssertExpectations(t)
+	})
+
+	It("reports up-to-date headers followed by older ones", func() {
+		t := GinkgoT()
+		fileReader := new(fs_mocks.FileReader)
+		fileReader.On("Read", "older-below.go").
+			Return([]byte("// Copyright 2018-2019 ACME\n\n// Copyright 2016 ACME\n\npackage foo"), nil)
+		fileReader.On("Read", "older-further-below.go").
+			Return([]byte("// Copyright 2018-2019 ACME\n\npackage foo\n\n// Copyright 2016 ACME\n"), nil)
+		changeSet := &ChangeSet{
+			HeaderContents: "// Copyright {{.YearRange}} ACME",
+			HeaderRegex:    regexp.MustCompile(`(?m)^// Copyright .* ACME\n?`),
+			CommentStyle:   SlashSlash{},
+			Files: []vcs.FileChange{
+				{Path: "older-below.go", CreationYear: 2018, LastEditionYear: 2019},
+				{Path: "older-further-below.go", CreationYear: 2018, LastEditionYear: 2019},
+			},
+		}
+
+		verdicts, err := Check(changeSet, &fs.FileSystem{FileReader: fileReader})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(verdicts).To(Equal([]Verdict{{Path: "older-below.go", Reason: HeaderWithStaleYears}}))
+		fileReader.AssertExpectations(t)
+	})
+
+	It("ignores the byte order mark of files starting with one", func() {
+		t := GinkgoT()
+		fileReader := new(fs_mocks.FileReader)
+		fileReader.On("Read", "bom.go").Return([]byte("\uFEFF// Copyright 2018-2019 ACME\n\npackage foo"), nil)
+		changeSet := &ChangeSet{
+			HeaderContents: "// Copyright {{.YearRange}} ACME",
+			HeaderRegex:    regexp.MustCompile(`(?m)^// Copyright .* ACME\n?`),
+			CommentStyle:   SlashSlash{},
+			Files:          []vcs.FileChange{{Path: "bom.go", CreationYear: 2018, LastEditionYear: 2019}},
+		}
+
+		verdicts, err := Check(changeSet, &fs.FileSystem{FileReader: fileReader})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(verdicts).To(BeEmpty())
+		fileReader.AssertExpectations(t)
+	})
+
+	It("reports headers placed above build constraints", func() {
+		t := GinkgoT()
+		fileReader := new(fs_mocks.FileReader)
+		fileReader.On("Read", "foo.go").Return([]byte("// Copyright 2019 ACME\n\n//go:build linux\n\npackage foo"), nil)
+		changeSet := &ChangeSet{
+			HeaderContents: "// Copyright {{.YearRange}} ACME",
+			HeaderRegex:    regexp.MustCompile(`(?m)^// Copyright .* ACME\n?`),
+			CommentStyle:   SlashSlash{},
+			Files:          []vcs.FileChange{{Path: "foo.go", CreationYear: 2019, LastEditionYear: 2019}},
+		}
+
+		verdicts, err := Check(changeSet, &fs.FileSystem{FileReader: fileReader})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(verdicts).To(Equal([]Verdict{{Path: "foo.go", Reason: HeaderMisplaced}}))
+		fileReader.AssertExpectations(t)
+	})
+
+	It("reports files edited after the year declared in their header", func() {
+		t := GinkgoT()
+		fileReader := new(fs_mocks.FileReader)
+		fileReader.On("Read", "stale.go").Return([]byte("// Copyright 2016-2018 ACME\n\npackage foo"), nil)
+		fileReader.On("Read", "up-to-date.go").Return([]byte("// Copyright 2019 ACME\n\npackage foo"), nil)
+		fileReader.On("Read", "missing.go").Return([]byte("package foo"), nil)
+		changeSet := &ChangeSet{
+			HeaderContents: "// Copyright {{.YearRange}} ACME",
+			HeaderRegex:    regexp.MustCompile(`(?m)^// Copyright .* ACME\n?`),
+			CommentStyle:   SlashSlash{},
+			Files: []vcs.FileChange{
+				{Path: "stale.go", CreationYear: 2016, LastEditionYear: 2019},
+				{Path: "up-to-date.go", CreationYear: 2017, LastEditionYear: 2019},
+				{Path: "missing.go", CreationYear: 2019, LastEditionYear: 2019},
+			},
+		}
+
+		staleHeaders, err := FindStaleHeaders(changeSet, &fs.FileSystem{FileReader: fileReader})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(staleHeaders).To(Equal([]StaleHeader{{Path: "stale.go", DeclaredYear: 2018, LastEditionYear: 2019}}))
+		fileReader.AssertExpectations(t)
+	})
+
+	It("reports files whose header declares other copyright holders", func() {
+		t := GinkgoT()
+		fileReader := new(fs_mocks.FileReader)
+		fileReader.On("Read", "acquired.go").Return([]byte("// Copyright (c) 2016-2018 Old Corp\n\npackage foo"), nil)
+		fileReader.On("Read", "up-to-date.go").Return([]byte("// Copyright 2017 ACME\n\npackage foo"), nil)
+		fileReader.On("Read", "missing.go").Return([]byte("package foo"), nil)
+		changeSet := &ChangeSet{
+			HeaderContents: "// Copyright {{.YearRange}} ACME",
+			HeaderRegex:    regexp.MustCompile(`(?m)^// Copyright .*\n?`),
+			CommentStyle:   SlashSlash{},
+			Files: []vcs.FileChange{
+				{Path: "acquired.go", CreationYear: 2016, LastEditionYear: 2019},
+				{Path: "up-to-date.go", CreationYear: 2017, LastEditionYear: 2019},
+				{Path: "missing.go", CreationYear: 2019, LastEditionYear: 2019},
+			},
+		}
+
+		mismatches, err := FindHolderMismatches(changeSet, &fs.FileSystem{FileReader: fileReader})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(mismatches).To(Equal([]HolderMismatch{
+			{Path: "acquired.go", DeclaredHolders: []string{"Old Corp"}, ExpectedHolders: []string{"ACME"}},
+		}))
+		fileReader.AssertExpectations(t)
+	})
+
+	It("fingerprints headers regardless of their years and whitespace", func() {
+		fingerprint := HeaderFingerprint("// Copyright 2018-2019 ACME\n//\n// Licensed under MIT")
+
+		Expect(HeaderFingerprint("// Copyright 2021 ACME  \n//\n//   Licensed under MIT\n")).To(Equal(fingerprint))
+		Expect(HeaderFingerprint("// Copyright 2018, 2020 ACME\n//\n// Licensed under MIT")).To(Equal(fingerprint))
+		Expect(HeaderFingerprint("// Copyright 2018-2019 ACME\n//\n// Licensed under Apache 2")).NotTo(Equal(fingerprint))
+	})
+
+	It("groups files by header fingerprint, the largest groups first", func() {
+		t := GinkgoT()
+		fileReader := new(fs_mocks.FileReader)
+		fileReader.On("Read", "a.go").Return([]byte("// Copyright 2016-2018 ACME\n// Licensed under MIT\n\npackage foo"), nil)
+		fileReader.On("Read", "b.go").Return([]byte("// Copyright 2020 ACME\n//  Licensed under MIT\n\npackage foo"), nil)
+		fileReader.On("Read", "c.go").Return([]byte("// Copyright 2019 ACME\n// Licensed under MIT, or not\n\npackage foo"), nil)
+		fileReader.On("Read", "d.go").Return([]byte("// Copyright 2017 ACME\n// Licensed under MIT\n\npackage foo"), nil)
+		fileReader.On("Read", "missing.go").Return([]byte("package foo"), nil)
+		changeSet := &ChangeSet{
+			HeaderRegex:  regexp.MustCompile(`(?m)^// Copyright .*\n//\s+Licensed .*\n?`),
+			CommentStyle: SlashSlash{},
+			Files: []vcs.FileChange{
+				{Path: "d.go"}, {Path: "c.go"}, {Path: "missing.go"}, {Path: "b.go"}, {Path: "a.go"},
+			},
+		}
+
+		groups, err := GroupByHeaderFingerprint(changeSet, &fs.FileSystem{FileReader: fileReader})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(groups).To(Equal([]HeaderGroup{
+			{Fingerprint: HeaderFingerprint("// Copyright ACME\n// Licensed under MIT"), Paths: []string{"a.go", "b.go", "d.go"}},
+			{Fingerprint: HeaderFingerprint("// Copyright ACME\n// Licensed under MIT, or not"), Paths: []string{"c.go"}},
+		}))
+		fileReader.AssertExpectations(t)
+	})
+
+	It("reads the copyright holders of every copyright line", func() {
+		t := GinkgoT()
+		fileReader := new(fs_mocks.FileReader)
+		fileReader.On("Read", "foo.go").
+			Return([]byte("/*\n * Copyright © 2019 Road Runner\n * Copyright 2018, 2020 ACME\n */\n\npackage foo"), nil)
+		changeSet := &ChangeSet{
+			HeaderContents: "/* Copyright {{.YearRange}} ACME */",
+			HeaderRegex:    regexp.MustCompile(`(?s)^/\*.*?\*/\n?`),
+			CommentStyle:   SlashStar{},
+			Files:          []vcs.FileChange{{Path: "foo.go", CreationYear: 2018, LastEditionYear: 2020}},
+		}
+
+		mismatches, err := FindHolderMismatches(changeSet, &fs.FileSystem{FileReader: fileReader})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(mismatches).To(Equal([]HolderMismatch{
+			{Path: "foo.go", DeclaredHolders: []string{"ACME", "Road Runner"}, ExpectedHolders: []string{"ACME"}},
+		}))
+		fileReader.AssertExpectations(t)
+	})
+
+	It("reports the files without header", func() {
+		t := GinkgoT()
+		fileReader := new(fs_mocks.FileReader)
+		fileReader.On("Read", "headed.go").Return([]byte("// Copyright 2016 ACME\n\npackage foo"), nil)
+		fileReader.On("Read", "stale.go").Return([]byte("// Copyright 2010-2012 ACME\n\npackage foo"), nil)
+		fileReader.On("Read", "bare.go").Return([]byte("package foo"), nil)
+		fileReader.On("Read", "other-license.go").Return([]byte("// Licensed under MIT\n\npackage foo"), nil)
+		changeSet := &ChangeSet{
+			HeaderContents: "// Copyright {{.YearRange}} ACME",
+			HeaderRegex:    regexp.MustCompile(`(?m)^// Copyright .* ACME\n?`),
+			CommentStyle:   SlashSlash{},
+			Files: []vcs.FileChange{
+				{Path: "headed.go"},
+				{Path: "stale.go"},
+				{Path: "bare.go"},
+				{Path: "other-license.go"},
+			},
+		}
+
+		paths, err := FindFilesWithoutHeader(changeSet, &fs.FileSystem{FileReader: fileReader})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(paths).To(Equal([]string{"bare.go", "other-license.go"}))
+		fileReader.AssertExpectations(t)
+	})
+
+	It("checks the staged content rather than the working tree content", func() {
+		t := GinkgoT()
+		vcsMock := new(vcs_mocks.Vcs)
+		vcsMock.On("ShowContentAtRevision", "main.go", vcs.IndexRevision).
+			Return("// Copyright 2018-2019 ACME\n\npackage main", nil)
+		workingTreeReader := new(fs_mocks.FileReader)
+		changeSet := &ChangeSet{
+			HeaderContents: "// Copyright {{.YearRange}} ACME",
+			HeaderRegex:    regexp.MustCompile(`(?m)^// Copyright .* ACME\n?`),
+			CommentStyle:   SlashSlash{},
+			Files:          []vcs.FileChange{{Path: "main.go", CreationYear: 2018, LastEditionYear: 2019}},
+		}
+		indexReader := &fs.IndexFileReader{FileReader: workingTreeReader, Vcs: vcsMock}
+
+		verdicts, err := Check(changeSet, &fs.FileSystem{FileReader: indexReader})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(verdicts).To(BeEmpty())
+		vcsMock.AssertExpectations(t)
+		workingTreeReader.AssertExpectations(t)
+	})
+})
@@ -32,7 +32,7 @@ type FileSystem struct {
 func DefaultFileSystem() *FileSystem {
 	return &FileSystem{
 		FileWriter: &OsFileWriter{},
-		FileReader: &OsFileReader{},
+		FileReader: NewRemoteFileReader(&OsFileReader{}),
 	}
 }
 
@@ -108,14 +108,17 @@ func UnsafeClose(file File) {
 
 // test utility
 type FakeFileInfo struct {
-	FileMode os.FileMode
+	FileMode         os.FileMode
+	ModificationTime time.Time
 }
 
 func (*FakeFileInfo) Name() string       { panic("not implemented") }
 func (*FakeFileInfo) Size() int64        { panic("not implemented") }
-func (*FakeFileInfo) ModTime() time.Time { panic("not implemented") }
 func (*FakeFileInfo) IsDir() bool        { panic("not implemented") }
 func (*FakeFileInfo) Sys() interface{}   { panic("not implemented") }
 func (ffi *FakeFileInfo) Mode() os.FileMode {
 	return ffi.FileMode
 }
+func (ffi *FakeFileInfo) ModTime() time.Time {
+	return ffi.ModificationTime
+}
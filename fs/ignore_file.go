@@ -0,0 +1,196 @@
+/*
+ * Copyright 2019 Florent Biville (@fbiville)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fs
+
+import (
+	"github.com/fbiville/headache/vcs"
+	"os"
+	"path"
+	"strings"
+)
+
+const IgnoreFileName = ".headacheignore"
+
+// IgnoreFile holds the rules of a .headacheignore file, following the .gitignore syntax
+// rules apply to paths relative to the directory of the file
+type IgnoreFile struct {
+	Dir   string
+	rules []ignoreRule
+}
+
+type ignoreRule struct {
+	segments []string
+	negated  bool
+	dirOnly  bool
+	anchored bool
+}
+
+func ParseIgnoreFile(dir string, contents string) *IgnoreFile {
+	result := &IgnoreFile{Dir: path.Clean(dir)}
+	for _, line := range strings.Split(contents, "\n") {
+		line = strings.TrimRight(line, " \r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := ignoreRule{}
+		if strings.HasPrefix(line, "!") {
+			rule.negated = true
+			line = line[1:]
+		}
+		line = strings.TrimPrefix(line, `\`)
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		rule.anchored = strings.Contains(line, "/")
+		line = strings.TrimPrefix(line, "/")
+		if line == "" {
+			continue
+		}
+		rule.segments = strings.Split(line, "/")
+		result.rules = append(result.rules, rule)
+	}
+	return result
+}
+
+// Match returns whether the file is ignored and whether any rule matched the file at all
+// the last matching rule wins, as with .gitignore
+func (ignoreFile *IgnoreFile) Match(filePath string) (ignored bool, matched bool) {
+	relativePath, ok := relativize(ignoreFile.Dir, path.Clean(filePath))
+	if !ok {
+		return false, false
+	}
+	components := strings.Split(relativePath, "/")
+	for _, rule := range ignoreFile.rules {
+		if rule.matches(components) {
+			ignored = !rule.negated
+			matched = true
+		}
+	}
+	return ignored, matched
+}
+
+// a rule matches a file if it matches the file itself or any of its parent directories
+func (rule ignoreRule) matches(components []string) bool {
+	for i := 1; i <= len(components); i++ {
+		isDir := i < len(components)
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		candidate := components[:i]
+		if rule.anchored && matchSegments(rule.segments, candidate) {
+			return true
+		}
+		if !rule.anchored && matchSegments(rule.segments, candidate[i-1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchSegments(patterns []string, components []string) bool {
+	if len(patterns) == 0 {
+		return len(components) == 0
+	}
+	if patterns[0] == "**" {
+		for i := 0; i <= len(components); i++ {
+			if matchSegments(patterns[1:], components[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(components) == 0 {
+		return false
+	}
+	if matched, err := path.Match(patterns[0], components[0]); err != nil || !matched {
+		return false
+	}
+	return matchSegments(patterns[1:], components[1:])
+}
+
+func relativize(dir string, filePath string) (string, bool) {
+	if dir == "." {
+		return filePath, !strings.HasPrefix(filePath, "../") && !path.IsAbs(filePath)
+	}
+	prefix := dir + "/"
+	if !strings.HasPrefix(filePath, prefix) {
+		return "", false
+	}
+	return filePath[len(prefix):], true
+}
+
+// RemoveIgnoredFiles excludes the changes matched by the .headacheignore file of the current directory
+// and, if nested is set, by the .headacheignore files of the parent directories of each change
+// deeper ignore files take precedence
+func RemoveIgnoredFiles(changes []vcs.FileChange, nested bool, reader FileReader) ([]vcs.FileChange, error) {
+	cache := make(map[string]*IgnoreFile)
+	result := make([]vcs.FileChange, 0)
+	for _, change := range changes {
+		dirs := []string{"."}
+		if nested {
+			dirs = parentDirectories(change.Path)
+		}
+		ignored := false
+		for _, dir := range dirs {
+			ignoreFile, err := readIgnoreFile(dir, reader, cache)
+			if err != nil {
+				return nil, err
+			}
+			if ignoreFile == nil {
+				continue
+			}
+			if dirIgnored, matched := ignoreFile.Match(change.Path); matched {
+				ignored = dirIgnored
+			}
+		}
+		if !ignored {
+			result = append(result, change)
+		}
+	}
+	return result, nil
+}
+
+func readIgnoreFile(dir string, reader FileReader, cache map[string]*IgnoreFile) (*IgnoreFile, error) {
+	if ignoreFile, found := cache[dir]; found {
+		return ignoreFile, nil
+	}
+	contents, err := reader.Read(path.Join(dir, IgnoreFileName))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var ignoreFile *IgnoreFile
+	if err == nil {
+		ignoreFile = ParseIgnoreFile(dir, string(contents))
+	}
+	cache[dir] = ignoreFile
+	return ignoreFile, nil
+}
+
+// returns the parent directories of the file, from the outermost to the innermost one
+func parentDirectories(filePath string) []string {
+	result := []string{"."}
+	dir := path.Dir(path.Clean(filePath))
+	if dir == "." || path.IsAbs(dir) || strings.HasPrefix(dir, "..") {
+		return result
+	}
+	components := strings.Split(dir, "/")
+	for i := 1; i <= len(components); i++ {
+		result = append(result, strings.Join(components[:i], "/"))
+	}
+	return result
+}
@@ -0,0 +1,141 @@
+/*
+ * Copyright 2019 Florent Biville (@fbiville)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fs_test
+
+import (
+	"errors"
+	. "github.com/fbiville/headache/fs"
+	"github.com/fbiville/headache/fs_mocks"
+	"github.com/fbiville/headache/vcs"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"os"
+)
+
+var _ = Describe("Ignore file", func() {
+
+	It("ignores directories", func() {
+		ignoreFile := ParseIgnoreFile(".", "# generated code\nvendor/\n")
+
+		Expect(isIgnored(ignoreFile, "vendor/github.com/foo/bar.go")).To(BeTrue())
+		Expect(isIgnored(ignoreFile, "pkg/vendor/bar.go")).To(BeTrue())
+		Expect(isIgnored(ignoreFile, "vendor")).To(BeFalse(), "directory-only rules do not match files")
+		Expect(isIgnored(ignoreFile, "pkg/vendoring.go")).To(BeFalse())
+	})
+
+	It("ignores extensions", func() {
+		ignoreFile := ParseIgnoreFile(".", "*.pb.go")
+
+		Expect(isIgnored(ignoreFile, "api/service.pb.go")).To(BeTrue())
+		Expect(isIgnored(ignoreFile, "service.pb.go")).To(BeTrue())
+		Expect(isIgnored(ignoreFile, "api/service.go")).To(BeFalse())
+	})
+
+	It("anchors rules containing slashes", func() {
+		ignoreFile := ParseIgnoreFile(".", "/main.go\ndocs/*.go\nexamples/**/fixture.go")
+
+		Expect(isIgnored(ignoreFile, "main.go")).To(BeTrue())
+		Expect(isIgnored(ignoreFile, "cmd/main.go")).To(BeFalse())
+		Expect(isIgnored(ignoreFile, "docs/schema.go")).To(BeTrue())
+		Expect(isIgnored(ignoreFile, "docs/v1/schema.go")).To(BeFalse())
+		Expect(isIgnored(ignoreFile, "examples/fixture.go")).To(BeTrue())
+		Expect(isIgnored(ignoreFile, "examples/a/b/fixture.go")).To(BeTrue())
+	})
+
+	It("re-includes negated paths", func() {
+		ignoreFile := ParseIgnoreFile(".", "*.go\n!main.go")
+
+		Expect(isIgnored(ignoreFile, "foo.go")).To(BeTrue())
+		Expect(isIgnored(ignoreFile, "main.go")).To(BeFalse())
+	})
+
+	It("only matches paths under its directory", func() {
+		ignoreFile := ParseIgnoreFile("pkg", "*.go")
+
+		Expect(isIgnored(ignoreFile, "pkg/foo.go")).To(BeTrue())
+		Expect(isIgnored(ignoreFile, "foo.go")).To(BeFalse())
+		Expect(isIgnored(ignoreFile, "pkgs/foo.go")).To(BeFalse())
+	})
+
+	Describe("when removing ignored files", func() {
+
+		var (
+			t          GinkgoTInterface
+			fileReader *fs_mocks.FileReader
+			changes    []vcs.FileChange
+		)
+
+		BeforeEach(func() {
+			t = GinkgoT()
+			fileReader = new(fs_mocks.FileReader)
+			changes = []vcs.FileChange{
+				{Path: "vendor/lib.go"},
+				{Path: "pkg/service.pb.go"},
+				{Path: "pkg/service.go"},
+				{Path: "pkg/generated/code.go"},
+			}
+		})
+
+		AfterEach(func() {
+			fileReader.AssertExpectations(t)
+		})
+
+		It("excludes the changes matched by the ignore file of the current directory", func() {
+			fileReader.On("Read", ".headacheignore").Return([]byte("vendor/\n*.pb.go"), nil).Once()
+
+			result, err := RemoveIgnoredFiles(changes, false, fileReader)
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal([]vcs.FileChange{{Path: "pkg/service.go"}, {Path: "pkg/generated/code.go"}}))
+		})
+
+		It("keeps all changes without ignore file", func() {
+			fileReader.On("Read", ".headacheignore").Return(nil, os.ErrNotExist).Once()
+
+			result, err := RemoveIgnoredFiles(changes, false, fileReader)
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal(changes))
+		})
+
+		It("fails if the ignore file cannot be read", func() {
+			readError := errors.New("read error")
+			fileReader.On("Read", ".headacheignore").Return(nil, readError).Once()
+
+			_, err := RemoveIgnoredFiles(changes, false, fileReader)
+
+			Expect(err).To(MatchError(readError))
+		})
+
+		It("excludes the changes matched by nested ignore files", func() {
+			fileReader.On("Read", ".headacheignore").Return([]byte("vendor/\n*.pb.go"), nil).Once()
+			fileReader.On("Read", "vendor/.headacheignore").Return(nil, os.ErrNotExist).Once()
+			fileReader.On("Read", "pkg/.headacheignore").Return([]byte("generated/\n!service.pb.go"), nil).Once()
+			fileReader.On("Read", "pkg/generated/.headacheignore").Return(nil, os.ErrNotExist).Once()
+
+			result, err := RemoveIgnoredFiles(changes, true, fileReader)
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal([]vcs.FileChange{{Path: "pkg/service.pb.go"}, {Path: "pkg/service.go"}}))
+		})
+	})
+})
+
+func isIgnored(ignoreFile *IgnoreFile, path string) bool {
+	ignored, _ := ignoreFile.Match(path)
+	return ignored
+}
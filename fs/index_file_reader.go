@@ -0,0 +1,34 @@
+/*
+ * Copyright 2019 Florent Biville (@fbiville)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fs
+
+import "github.com/fbiville/headache/vcs"
+
+// IndexFileReader reads the staged version of files instead of their working tree version
+// any other operation is delegated to the embedded reader
+type IndexFileReader struct {
+	FileReader
+	Vcs vcs.Vcs
+}
+
+func (ifr *IndexFileReader) Read(path string) ([]byte, error) {
+	contents, err := ifr.Vcs.ShowContentAtRevision(path, vcs.IndexRevision)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(contents), nil
+}
@@ -0,0 +1,66 @@
+/*
+ * Copyright 2019 Florent Biville (@fbiville)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fs_test
+
+import (
+	"errors"
+	. "github.com/fbiville/headache/fs"
+	"github.com/fbiville/headache/fs_mocks"
+	"github.com/fbiville/headache/vcs"
+	"github.com/fbiville/headache/vcs_mocks"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Index file reader", func() {
+	var (
+		t          GinkgoTInterface
+		fileReader *fs_mocks.FileReader
+		vcsMock    *vcs_mocks.Vcs
+		reader     *IndexFileReader
+	)
+
+	BeforeEach(func() {
+		t = GinkgoT()
+		fileReader = new(fs_mocks.FileReader)
+		vcsMock = new(vcs_mocks.Vcs)
+		reader = &IndexFileReader{FileReader: fileReader, Vcs: vcsMock}
+	})
+
+	AfterEach(func() {
+		fileReader.AssertExpectations(t)
+		vcsMock.AssertExpectations(t)
+	})
+
+	It("reads the staged content instead of the working tree content", func() {
+		vcsMock.On("ShowContentAtRevision", "main.go", vcs.IndexRevision).Return("// staged\npackage main", nil)
+
+		contents, err := reader.Read("main.go")
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(contents)).To(Equal("// staged\npackage main"))
+	})
+
+	It("fails to read files absent from the index", func() {
+		indexError := errors.New("fatal: path 'nope.go' does not exist (neither on disk nor in the index)")
+		vcsMock.On("ShowContentAtRevision", "nope.go", vcs.IndexRevision).Return("", indexError)
+
+		_, err := reader.Read("nope.go")
+
+		Expect(err).To(MatchError(indexError))
+	})
+})
@@ -0,0 +1,69 @@
+/*
+ * Copyright 2018 Florent Biville (@fbiville)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fs
+
+import (
+	"github.com/fbiville/headache/vcs"
+	"path"
+	"strings"
+)
+
+// DefaultLegalFiles are the names of the files at the root of the repository, such as licenses, which never get a
+// header by default, whatever their case and extensions, as in License.md
+var DefaultLegalFiles = []string{"LICENSE", "NOTICE", "COPYING", "README"}
+
+// RemoveLegalFiles returns the changes which are none of the default legal files and whose file name matches none of
+// the given patterns, given patterns starting with ! re-including the files they match, as in !README.go
+func RemoveLegalFiles(changes []vcs.FileChange, patterns []string) []vcs.FileChange {
+	legalPatterns := make([]string, 0)
+	reincludedPatterns := make([]string, 0)
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, "!") {
+			reincludedPatterns = append(reincludedPatterns, pattern[1:])
+		} else {
+			legalPatterns = append(legalPatterns, pattern)
+		}
+	}
+	result := make([]vcs.FileChange, 0, len(changes))
+	for _, change := range changes {
+		name := path.Base(change.Path)
+		isLegalFile := isDefaultLegalFile(change.Path) || matchesPattern(name, legalPatterns)
+		if isLegalFile && !matchesPattern(name, reincludedPatterns) {
+			continue
+		}
+		result = append(result, change)
+	}
+	return result
+}
+
+// source files named after legal files, such as LICENSE_checker.go, as well as the legal files of nested directories,
+// such as the ones of vendored dependencies, are not default legal files
+func isDefaultLegalFile(filePath string) bool {
+	if strings.Contains(filePath, "/") {
+		return false
+	}
+	name := strings.ToUpper(filePath)
+	if extensionStart := strings.Index(name, "."); extensionStart != -1 {
+		name = name[:extensionStart]
+	}
+	for _, legalFile := range DefaultLegalFiles {
+		if name == legalFile {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright 2018 Florent Biville (@fbiville)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fs_test
+
+import (
+	. "github.com/fbiville/headache/fs"
+	"github.com/fbiville/headache/vcs"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Legal files", func() {
+
+	var changes []vcs.FileChange
+
+	BeforeEach(func() {
+		changes = []vcs.FileChange{
+			{Path: "LICENSE"},
+			{Path: "NOTICE.txt"},
+			{Path: "COPYING"},
+			{Path: "README.md"},
+			{Path: "AUTHORS"},
+			{Path: "main.go"},
+			{Path: "pkg/license.go"},
+		}
+	})
+
+	It("excludes licenses, notices and readmes by default", func() {
+		Expect(RemoveLegalFiles(changes, nil)).To(Equal([]vcs.FileChange{
+			{Path: "AUTHORS"},
+			{Path: "main.go"},
+			{Path: "pkg/license.go"},
+		}))
+	})
+
+	It("excludes the default legal files whatever their case", func() {
+		changes := []vcs.FileChange{{Path: "license.txt"}, {Path: "Readme.md"}, {Path: "Copying"}, {Path: "notice.tar.gz"}}
+
+		Expect(RemoveLegalFiles(changes, nil)).To(BeEmpty())
+	})
+
+	It("only excludes the default legal files at the root of the repository", func() {
+		changes := []vcs.FileChange{{Path: "vendor/lib/LICENSE.md"}, {Path: "docs/README.md"}}
+
+		Expect(RemoveLegalFiles(changes, nil)).To(Equal(changes))
+	})
+
+	It("keeps source files named after legal files", func() {
+		changes := []vcs.FileChange{{Path: "LICENSE_checker.go"}, {Path: "NOTICE_builder.java"}, {Path: "pkg/LICENSE_checker.go"}, {Path: "READMEGenerator.kt"}}
+
+		Expect(RemoveLegalFiles(changes, nil)).To(Equal(changes))
+	})
+
+	It("extends the default legal files with the given patterns", func() {
+		Expect(RemoveLegalFiles(changes, []string{"AUTHORS"})).To(Equal([]vcs.FileChange{
+			{Path: "main.go"},
+			{Path: "pkg/license.go"},
+		}))
+	})
+
+	It("re-includes the files matching negated patterns", func() {
+		Expect(RemoveLegalFiles(changes, []string{"!README*", "!NOTICE.txt"})).To(Equal([]vcs.FileChange{
+			{Path: "NOTICE.txt"},
+			{Path: "README.md"},
+			{Path: "AUTHORS"},
+			{Path: "main.go"},
+			{Path: "pkg/license.go"},
+		}))
+	})
+})
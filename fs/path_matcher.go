@@ -67,6 +67,11 @@ func isExcluded(path string, excludes []string, filesystem *FileSystem) bool {
 	return !filesystem.IsFile(path) || matchesPattern(path, excludes)
 }
 
+// MatchesPath returns whether the path matches the glob pattern, as include and exclude patterns do
+func MatchesPath(path string, pattern string) bool {
+	return matchesPattern(path, []string{pattern})
+}
+
 func matchesPattern(path string, patterns []string) bool {
 	for _, pattern := range patterns {
 		if matched, err := zglob.Match(pattern, path); err == nil && matched {
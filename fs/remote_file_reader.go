@@ -0,0 +1,75 @@
+/*
+ * Copyright 2019 Florent Biville (@fbiville)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const remoteReadTimeout = 10 * time.Second
+
+// RemoteFileReader fetches https:// locations at most once and delegates any other path to the embedded reader
+type RemoteFileReader struct {
+	FileReader
+	Client *http.Client
+	cache  map[string][]byte
+}
+
+func NewRemoteFileReader(delegate FileReader) *RemoteFileReader {
+	return &RemoteFileReader{
+		FileReader: delegate,
+		Client:     &http.Client{Timeout: remoteReadTimeout},
+	}
+}
+
+func IsRemote(path string) bool {
+	return strings.HasPrefix(path, "https://")
+}
+
+func (rfr *RemoteFileReader) Read(path string) ([]byte, error) {
+	if !IsRemote(path) {
+		return rfr.FileReader.Read(path)
+	}
+	if contents, found := rfr.cache[path]; found {
+		return contents, nil
+	}
+	contents, err := rfr.fetch(path)
+	if err != nil {
+		return nil, err
+	}
+	if rfr.cache == nil {
+		rfr.cache = make(map[string][]byte)
+	}
+	rfr.cache[path] = contents
+	return contents, nil
+}
+
+func (rfr *RemoteFileReader) fetch(url string) ([]byte, error) {
+	response, err := rfr.Client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not fetch %s, got HTTP status %d", url, response.StatusCode)
+	}
+	return ioutil.ReadAll(response.Body)
+}
@@ -0,0 +1,101 @@
+/*
+ * Copyright 2019 Florent Biville (@fbiville)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fs_test
+
+import (
+	"fmt"
+	. "github.com/fbiville/headache/fs"
+	"github.com/fbiville/headache/fs_mocks"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/http/httptest"
+)
+
+var _ = Describe("Remote file reader", func() {
+	var (
+		t          GinkgoTInterface
+		fileReader *fs_mocks.FileReader
+		server     *httptest.Server
+		hits       int
+		reader     *RemoteFileReader
+	)
+
+	BeforeEach(func() {
+		t = GinkgoT()
+		fileReader = new(fs_mocks.FileReader)
+		hits = 0
+		server = httptest.NewTLSServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			hits++
+			if request.URL.Path != "/license-header.txt" {
+				writer.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = fmt.Fprint(writer, "Copyright {{.YearRange}} {{.Owner}}")
+		}))
+		reader = NewRemoteFileReader(fileReader)
+		reader.Client = server.Client()
+	})
+
+	AfterEach(func() {
+		server.Close()
+		fileReader.AssertExpectations(t)
+	})
+
+	It("fetches remote files", func() {
+		contents, err := reader.Read(server.URL + "/license-header.txt")
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(contents)).To(Equal("Copyright {{.YearRange}} {{.Owner}}"))
+	})
+
+	It("fetches remote files only once", func() {
+		_, _ = reader.Read(server.URL + "/license-header.txt")
+		contents, err := reader.Read(server.URL + "/license-header.txt")
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(contents)).To(Equal("Copyright {{.YearRange}} {{.Owner}}"))
+		Expect(hits).To(Equal(1))
+	})
+
+	It("fails to fetch missing remote files", func() {
+		url := server.URL + "/nope.txt"
+
+		_, err := reader.Read(url)
+
+		Expect(err).To(MatchError(fmt.Sprintf("could not fetch %s, got HTTP status 404", url)))
+	})
+
+	It("fails to fetch remote files served with untrusted certificates", func() {
+		reader.Client = &http.Client{}
+
+		_, err := reader.Read(server.URL + "/license-header.txt")
+
+		Expect(err).To(HaveOccurred())
+		Expect(hits).To(Equal(0))
+	})
+
+	It("delegates local file reads", func() {
+		fileReader.On("Read", "license-header.txt").Return([]byte("some header"), nil)
+
+		contents, err := reader.Read("license-header.txt")
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(contents)).To(Equal("some header"))
+		Expect(hits).To(Equal(0))
+	})
+})
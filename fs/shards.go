@@ -0,0 +1,41 @@
+/*
+ * Copyright 2018 Florent Biville (@fbiville)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fs
+
+import (
+	"github.com/fbiville/headache/vcs"
+	"hash/fnv"
+)
+
+// SelectShard returns the changes assigned to the shard of the given index, between 0 and count excluded
+// files are assigned by hashing their path, so that runs of all shards cover every change once, whatever the order
+// and the other changes
+func SelectShard(changes []vcs.FileChange, index int, count int) []vcs.FileChange {
+	result := make([]vcs.FileChange, 0, len(changes)/count+1)
+	for _, change := range changes {
+		if shardOf(change.Path, count) == index {
+			result = append(result, change)
+		}
+	}
+	return result
+}
+
+func shardOf(path string, count int) int {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(path))
+	return int(hash.Sum32() % uint32(count))
+}
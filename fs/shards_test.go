@@ -0,0 +1,75 @@
+/*
+ * Copyright 2018 Florent Biville (@fbiville)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fs_test
+
+import (
+	"fmt"
+	. "github.com/fbiville/headache/fs"
+	"github.com/fbiville/headache/vcs"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Shards", func() {
+
+	var changes []vcs.FileChange
+
+	BeforeEach(func() {
+		changes = make([]vcs.FileChange, 0, 200)
+		for i := 0; i < 200; i++ {
+			changes = append(changes, vcs.FileChange{Path: fmt.Sprintf("pkg%d/file%d.go", i%7, i)})
+		}
+	})
+
+	It("covers every change exactly once across all shards", func() {
+		shardCount := 4
+		seen := make(map[string]int)
+		union := make([]vcs.FileChange, 0, len(changes))
+
+		for index := 0; index < shardCount; index++ {
+			shard := SelectShard(changes, index, shardCount)
+			Expect(shard).NotTo(BeEmpty())
+			for _, change := range shard {
+				seen[change.Path]++
+			}
+			union = append(union, shard...)
+		}
+
+		Expect(union).To(ConsistOf(changes))
+		for path, count := range seen {
+			Expect(count).To(Equal(1), path)
+		}
+	})
+
+	It("assigns files to the same shard whatever the other changes", func() {
+		shard := SelectShard(changes, 1, 3)
+
+		reversed := make([]vcs.FileChange, len(changes))
+		for i, change := range changes {
+			reversed[len(changes)-1-i] = change
+		}
+		subset := SelectShard(reversed[:50], 1, 3)
+
+		for _, change := range subset {
+			Expect(shard).To(ContainElement(change))
+		}
+	})
+
+	It("keeps all changes with a single shard", func() {
+		Expect(SelectShard(changes, 0, 1)).To(Equal(changes))
+	})
+})
@@ -0,0 +1,90 @@
+/*
+ * Copyright 2018 Florent Biville (@fbiville)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fs
+
+import (
+	"github.com/fbiville/headache/vcs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ResolveSymlinks returns the changes with the paths of symbolic links replaced by the paths of the files they link to,
+// relative to the root directory of the repository, so that their years and headers are the ones of their targets
+// links to files outside of the repository, or to missing files, are left out and targets are only kept once
+func ResolveSymlinks(changes []vcs.FileChange, root string) ([]vcs.FileChange, error) {
+	absoluteRoot, err := evalAbsolutePath(root)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]vcs.FileChange, 0, len(changes))
+	paths := make(map[string]struct{}, len(changes))
+	for _, change := range changes {
+		resolvedChange, ok, err := resolveSymlink(change, root, absoluteRoot)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		if _, found := paths[resolvedChange.Path]; found {
+			continue
+		}
+		paths[resolvedChange.Path] = struct{}{}
+		result = append(result, resolvedChange)
+	}
+	return result, nil
+}
+
+// returns the change of the target of the symbolic link, the change itself if it is not a link, and whether to keep it
+func resolveSymlink(change vcs.FileChange, root string, absoluteRoot string) (vcs.FileChange, bool, error) {
+	path := filepath.Join(root, filepath.FromSlash(change.Path))
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return change, true, nil
+	}
+	if err != nil {
+		return change, false, err
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		return change, true, nil
+	}
+	target, err := evalAbsolutePath(path)
+	if os.IsNotExist(err) {
+		log.Printf("Skipping %s, its symlink target does not exist", change.Path)
+		return change, false, nil
+	}
+	if err != nil {
+		return change, false, err
+	}
+	relativeTarget, err := filepath.Rel(absoluteRoot, target)
+	if err != nil || relativeTarget == ".." || strings.HasPrefix(relativeTarget, ".."+string(filepath.Separator)) {
+		log.Printf("Skipping %s, its symlink target %s is outside of the repository", change.Path, target)
+		return change, false, nil
+	}
+	change.Path = filepath.ToSlash(relativeTarget)
+	return change, true, nil
+}
+
+func evalAbsolutePath(path string) (string, error) {
+	absolutePath, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(absolutePath)
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright 2018 Florent Biville (@fbiville)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fs_test
+
+import (
+	. "github.com/fbiville/headache/fs"
+	"github.com/fbiville/headache/vcs"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// the repository holds target.go, pkg/link.go linking to it, outside.go lives next to the repository
+var _ = Describe("Symlinks", func() {
+
+	var (
+		directory  string
+		repository string
+	)
+
+	BeforeEach(func() {
+		var err error
+		directory, err = ioutil.TempDir("", "headache-symlinks")
+		Expect(err).NotTo(HaveOccurred())
+		repository = filepath.Join(directory, "repository")
+		Expect(os.MkdirAll(filepath.Join(repository, "pkg"), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(repository, "target.go"), []byte("package target\n"), 0644)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(directory, "outside.go"), []byte("package outside\n"), 0644)).To(Succeed())
+		Expect(os.Symlink(filepath.Join("..", "target.go"), filepath.Join(repository, "pkg", "link.go"))).To(Succeed())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(directory)).To(Succeed())
+	})
+
+	It("resolves links to files of the repository to their target", func() {
+		changes := []vcs.FileChange{{Path: "pkg/link.go", CreationYear: 2019, LastEditionYear: 2020}}
+
+		result, err := ResolveSymlinks(changes, repository)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal([]vcs.FileChange{{Path: "target.go", CreationYear: 2019, LastEditionYear: 2020}}))
+	})
+
+	It("only keeps targets once", func() {
+		changes := []vcs.FileChange{{Path: "target.go"}, {Path: "pkg/link.go"}}
+
+		result, err := ResolveSymlinks(changes, repository)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal([]vcs.FileChange{{Path: "target.go"}}))
+	})
+
+	It("skips links to files outside of the repository", func() {
+		Expect(os.Symlink(filepath.Join("..", "outside.go"), filepath.Join(repository, "outside.go"))).To(Succeed())
+		changes := []vcs.FileChange{{Path: "outside.go"}, {Path: "target.go"}}
+
+		result, err := ResolveSymlinks(changes, repository)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal([]vcs.FileChange{{Path: "target.go"}}))
+	})
+
+	It("skips links to missing files", func() {
+		Expect(os.Symlink("missing.go", filepath.Join(repository, "dangling.go"))).To(Succeed())
+
+		result, err := ResolveSymlinks([]vcs.FileChange{{Path: "dangling.go"}}, repository)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(BeEmpty())
+	})
+
+	It("keeps the changes of regular and missing files as they are", func() {
+		changes := []vcs.FileChange{{Path: "target.go"}, {Path: "deleted.go"}}
+
+		result, err := ResolveSymlinks(changes, repository)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(changes))
+	})
+})
@@ -3,6 +3,7 @@ module github.com/fbiville/headache
 go 1.12
 
 require (
+	github.com/BurntSushi/toml v1.3.2
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/mattn/go-zglob v0.0.1
 	github.com/onsi/ginkgo v1.7.0
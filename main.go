@@ -18,11 +18,42 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	. "github.com/fbiville/headache/core"
 	"github.com/fbiville/headache/fs"
+	"io/ioutil"
 	"log"
+	"os"
+	"strings"
+	"unicode/utf8"
 )
 
+type cliOptions struct {
+	configFile   *string
+	csvReport    *bool
+	csvDelimiter *string
+	touch        *bool
+	check        *bool
+	staged       *bool
+	auditYears   *bool
+	auditTracked *bool
+	auditHolders *bool
+	auditWording *bool
+	patch        *string
+	preview      *string
+	yearSpans    *bool
+	addOnly      *bool
+	confirm      *bool
+	force        *bool
+	maxFiles     *int
+	shardIndex   *int
+	shardCount   *int
+	stdout       *string
+	stdin        *bool
+	checkFormat  *string
+	doctor       *bool
+}
+
 func main() {
 	log.Print("Starting...")
 
@@ -40,32 +71,315 @@ func main() {
 	}
 	matcher := &fs.ZglobPathMatcher{}
 
-	configFile := parseFlags()
+	options := parseFlags()
+	configFile := options.configFile
 
 	userConfiguration, err := configLoader.ReadConfiguration(configFile)
 	if err != nil {
 		log.Fatalf("headache configuration error, cannot load\n\t%v\n", err)
 	}
+	if *options.touch {
+		userConfiguration.Touch = true
+	}
+	if *options.addOnly {
+		userConfiguration.AddOnly = true
+	}
+	if *options.force {
+		userConfiguration.Force = true
+	}
+	if *options.maxFiles > 0 {
+		userConfiguration.MaxFiles = *options.maxFiles
+	}
+	userConfiguration.ShardIndex = *options.shardIndex
+	userConfiguration.ShardCount = *options.shardCount
+	userConfiguration.Paths = flag.Args()
+	if *options.doctor {
+		doctor(userConfiguration, systemConfig)
+		log.Print("Done!")
+		return
+	}
+	if *options.preview != "" {
+		previewHeader(*options.preview, userConfiguration, systemConfig, executionTracker)
+		log.Print("Done!")
+		return
+	}
+	if *options.stdout != "" {
+		pipeContents(*options.stdout, *options.stdin, userConfiguration, systemConfig, executionTracker)
+		log.Print("Done!")
+		return
+	}
+	if *options.stdin {
+		log.Fatalf("headache configuration error, contents can only be read from stdin when written to stdout, add --stdout\n")
+	}
+	if *options.staged {
+		if !*options.check {
+			log.Fatalf("headache configuration error, staged files can only be checked, add --check\n")
+		}
+		userConfiguration.Staged = true
+		// headers are verified against what is about to be committed, not against the working tree
+		fileSystem = &fs.FileSystem{
+			FileWriter: fileSystem.FileWriter,
+			FileReader: &fs.IndexFileReader{
+				FileReader: fileSystem.FileReader,
+				Vcs:        systemConfig.VersioningClient.GetClient(),
+			},
+		}
+	}
+
+	if *options.auditTracked {
+		userConfiguration.TrackedFiles = true
+	}
 
 	configuration, err := ParseConfiguration(userConfiguration, systemConfig, executionTracker, matcher)
 	if err != nil {
 		log.Fatalf("headache configuration error, cannot parse\n\t%v\n", err)
 	}
 
-	if len(configuration.Files) > 0 {
-		Run(configuration, fileSystem)
-		trackRun(configFile, executionTracker)
-	} else {
+	for _, change := range configuration.HeaderOnlyFiles {
+		log.Printf("Skipping %s, already managed by headache: only its header changed since last execution", change.Path)
+	}
+
+	if *options.csvReport {
+		writeCsvReport(configuration, *options.csvDelimiter)
+	} else if *options.yearSpans {
+		printYearSpans(configuration)
+	} else if configuration.IsEmpty() {
 		log.Print("No files to process")
+	} else if *options.check {
+		check(configuration, fileSystem, *options.checkFormat)
+	} else if *options.auditYears {
+		auditYears(configuration, fileSystem)
+	} else if *options.auditTracked {
+		auditTracked(configuration, fileSystem)
+	} else if *options.auditHolders {
+		auditHolders(configuration, fileSystem)
+	} else if *options.auditWording {
+		auditWording(configuration, fileSystem)
+	} else if *options.patch != "" {
+		writePatch(configuration, fileSystem, *options.patch)
+	} else {
+		if *options.confirm {
+			configuration.Confirmer = NewPromptConfirmer(os.Stdin, os.Stderr)
+		}
+		deferredFiles := Run(configuration, fileSystem)
+		for _, change := range deferredFiles {
+			log.Printf("Skipping %s, left for subsequent runs", change.Path)
+		}
+		if len(deferredFiles) > 0 {
+			// the next run must compute the same changes to process the deferred files
+			log.Printf("%d file(s) left for subsequent runs, this run is not tracked", len(deferredFiles))
+		} else if userConfiguration.ShardCount > 1 {
+			// the files of the other shards may not have been processed yet
+			log.Printf("Only shard %d of %d was processed, this run is not tracked", userConfiguration.ShardIndex, userConfiguration.ShardCount)
+		} else if len(userConfiguration.Paths) == 0 {
+			// other changed files may not have been processed
+			trackRun(configFile, executionTracker)
+		}
 	}
 
 	log.Print("Done!")
 }
 
-func parseFlags() *string {
-	configFile := flag.String("configuration", "headache.json", "Path to configuration file")
+func parseFlags() *cliOptions {
+	options := &cliOptions{
+		configFile:   flag.String("configuration", "headache.json", "Path to configuration file, in TOML if its extension is .toml and in JSON otherwise"),
+		csvReport:    flag.Bool("csv", false, "Print copyright years per file as CSV to stdout instead of writing headers"),
+		csvDelimiter: flag.String("csv-delimiter", ",", "Field delimiter of the CSV report"),
+		touch:        flag.Bool("touch", false, "Set the last edition year of every processed file to the current year"),
+		check:        flag.Bool("check", false, "Report files with a missing or outdated header instead of writing headers, fails if there are any"),
+		staged:       flag.Bool("staged", false, "Only check staged files, against their staged content"),
+		auditYears:   flag.Bool("audit-years", false, "Report files edited after the latest year declared in their header instead of writing headers, fails if there are any"),
+		auditTracked: flag.Bool("audit-tracked", false, "Report all tracked files without header, changed or not, instead of writing headers, fails if there are any"),
+		auditHolders: flag.Bool("audit-holders", false, "Report files whose header declares other copyright holders than the configured ones instead of writing headers, fails if there are any"),
+		auditWording: flag.Bool("audit-wording", false, "Report the files grouped by header wording, years and whitespace aside, instead of writing headers, fails if headers diverge"),
+		patch:        flag.String("patch", "", "Write the header changes as a patch to this path, or to stdout if it is -, instead of writing headers"),
+		preview:      flag.String("preview", "", "Print the header the file at this path would get to stdout instead of writing headers"),
+		yearSpans:    flag.Bool("year-spans", false, "Print the number of files per copyright year span instead of writing headers"),
+		addOnly:      flag.Bool("add-only", false, "Only add headers to files without any, leaving existing headers untouched even if outdated"),
+		force:        flag.Bool("force", false, "Overwrite the headers edited by hand since the last execution instead of skipping them"),
+		confirm:      flag.Bool("confirm", false, "Ask before writing the header of each file, answering a writes all the remaining ones"),
+		maxFiles:     flag.Int("max-files", 0, "Maximum number of files written per run, the others being left for subsequent runs"),
+		shardIndex:   flag.Int("shard-index", 0, "Index, from 0, of the shard of files to process when they are split with --shard-count"),
+		shardCount:   flag.Int("shard-count", 0, "Number of shards files are split into by hashing their path, so that parallel runs process disjoint files"),
+		stdout:       flag.String("stdout", "", "Print the contents of the file at this path with its header to stdout instead of writing headers"),
+		stdin:        flag.Bool("stdin", false, "Read the contents printed with --stdout from stdin instead of the file"),
+		doctor:       flag.Bool("doctor", false, "Check that git, the repository and the configuration are fit for headache instead of writing headers, fails if any check fails"),
+		checkFormat:  flag.String("check-format", textCheckFormat, "Format of the files reported by --check, either text, github, which also prints GitHub Actions annotations to stdout, or sarif, which also prints a SARIF report to stdout"),
+	}
 	flag.Parse()
-	return configFile
+	return options
+}
+
+const (
+	textCheckFormat   = "text"
+	githubCheckFormat = "github"
+	sarifCheckFormat  = "sarif"
+)
+
+func check(configuration *ChangeSet, fileSystem *fs.FileSystem, format string) {
+	if format != textCheckFormat && format != githubCheckFormat && format != sarifCheckFormat {
+		log.Fatalf("headache configuration error, check format must be one of: %s,%s,%s, got %q\n", textCheckFormat, githubCheckFormat, sarifCheckFormat, format)
+	}
+	verdicts, err := Check(configuration, fileSystem)
+	if err != nil {
+		log.Fatalf("headache execution error, cannot check headers\n\t%v\n", err)
+	}
+	if format == githubCheckFormat {
+		if err := WriteGithubAnnotations(os.Stdout, verdicts); err != nil {
+			log.Fatalf("headache execution error, cannot write annotations\n\t%v\n", err)
+		}
+	} else if format == sarifCheckFormat {
+		if err := WriteSarifReport(os.Stdout, verdicts); err != nil {
+			log.Fatalf("headache execution error, cannot write SARIF report\n\t%v\n", err)
+		}
+	}
+	for _, verdict := range verdicts {
+		log.Printf("%s: %s", verdict.Path, verdict.Reason)
+	}
+	if len(verdicts) > 0 {
+		log.Fatalf("%d file(s) need a header update", len(verdicts))
+	}
+}
+
+func auditYears(configuration *ChangeSet, fileSystem *fs.FileSystem) {
+	staleHeaders, err := FindStaleHeaders(configuration, fileSystem)
+	if err != nil {
+		log.Fatalf("headache execution error, cannot audit header years\n\t%v\n", err)
+	}
+	for _, staleHeader := range staleHeaders {
+		log.Printf("%s: header declares %d but file was last edited in %d", staleHeader.Path, staleHeader.DeclaredYear, staleHeader.LastEditionYear)
+	}
+	if len(staleHeaders) > 0 {
+		log.Fatalf("%d file(s) have a header older than their last edition", len(staleHeaders))
+	}
+}
+
+func auditTracked(configuration *ChangeSet, fileSystem *fs.FileSystem) {
+	paths, err := FindFilesWithoutHeader(configuration, fileSystem)
+	if err != nil {
+		log.Fatalf("headache execution error, cannot audit tracked files\n\t%v\n", err)
+	}
+	for _, path := range paths {
+		log.Printf("%s: %s", path, HeaderMissing)
+	}
+	if len(paths) > 0 {
+		log.Fatalf("%d tracked file(s) have no header", len(paths))
+	}
+}
+
+// the execution is not tracked, the files staying unchanged until the patch gets applied
+func writePatch(configuration *ChangeSet, fileSystem *fs.FileSystem, path string) {
+	if path == "-" {
+		if err := WritePatch(os.Stdout, configuration, fileSystem); err != nil {
+			log.Fatalf("headache execution error, cannot write patch\n\t%v\n", err)
+		}
+		return
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		log.Fatalf("headache execution error, cannot create patch\n\t%v\n", err)
+	}
+	if err := WritePatch(file, configuration, fileSystem); err != nil {
+		log.Fatalf("headache execution error, cannot write patch\n\t%v\n", err)
+	}
+	if err := file.Close(); err != nil {
+		log.Fatalf("headache execution error, cannot close patch\n\t%v\n", err)
+	}
+}
+
+func auditWording(configuration *ChangeSet, fileSystem *fs.FileSystem) {
+	groups, err := GroupByHeaderFingerprint(configuration, fileSystem)
+	if err != nil {
+		log.Fatalf("headache execution error, cannot audit header wordings\n\t%v\n", err)
+	}
+	for _, group := range groups {
+		log.Printf("%s: %d file(s): %s", group.Fingerprint[:12], len(group.Paths), strings.Join(group.Paths, ", "))
+	}
+	if len(groups) > 1 {
+		log.Fatalf("%d different header wordings found", len(groups))
+	}
+}
+
+func auditHolders(configuration *ChangeSet, fileSystem *fs.FileSystem) {
+	mismatches, err := FindHolderMismatches(configuration, fileSystem)
+	if err != nil {
+		log.Fatalf("headache execution error, cannot audit copyright holders\n\t%v\n", err)
+	}
+	for _, mismatch := range mismatches {
+		log.Printf("%s: header declares %s instead of %s", mismatch.Path,
+			strings.Join(mismatch.DeclaredHolders, ", "), strings.Join(mismatch.ExpectedHolders, ", "))
+	}
+	if len(mismatches) > 0 {
+		log.Fatalf("%d file(s) have a header with other copyright holders", len(mismatches))
+	}
+}
+
+func doctor(configuration *Configuration, systemConfig *SystemConfiguration) {
+	checks := Doctor(configuration, systemConfig)
+	failures := 0
+	for _, check := range checks {
+		log.Printf("[%s] %s: %s", check.Status, check.Name, check.Message)
+		if check.Status == CheckFailed {
+			failures++
+		}
+	}
+	if failures > 0 {
+		log.Fatalf("%d environment check(s) failed", failures)
+	}
+}
+
+func previewHeader(path string, configuration *Configuration, systemConfig *SystemConfiguration, tracker ExecutionTracker) {
+	header, err := PreviewHeader(systemConfig.VersioningClient.GetClient(), tracker, path, configuration, systemConfig)
+	if err != nil {
+		log.Fatalf("headache execution error, cannot preview header of %s\n\t%v\n", path, err)
+	}
+	fmt.Println(header)
+}
+
+// years still come from the history of the file, whatever the piped contents
+func pipeContents(path string, fromStdin bool, configuration *Configuration, systemConfig *SystemConfiguration, tracker ExecutionTracker) {
+	var contents []byte
+	var err error
+	if fromStdin {
+		contents, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		contents, err = systemConfig.FileSystem.FileReader.Read(path)
+	}
+	if err != nil {
+		log.Fatalf("headache execution error, cannot read contents of %s\n\t%v\n", path, err)
+	}
+	result, err := HeadContents(systemConfig.VersioningClient.GetClient(), tracker, path, contents, configuration, systemConfig)
+	if err != nil {
+		log.Fatalf("headache execution error, cannot add header to contents of %s\n\t%v\n", path, err)
+	}
+	if _, err := os.Stdout.Write(result); err != nil {
+		log.Fatalf("headache execution error, cannot write contents of %s\n\t%v\n", path, err)
+	}
+}
+
+func writeCsvReport(configuration *ChangeSet, delimiter string) {
+	if utf8.RuneCountInString(delimiter) != 1 {
+		log.Fatalf("headache configuration error, CSV delimiter must be a single character, got %q\n", delimiter)
+	}
+	separator, _ := utf8.DecodeRuneInString(delimiter)
+	loadHistory(configuration)
+	err := WriteCsvReport(os.Stdout, configuration.Files, separator)
+	if err != nil {
+		log.Fatalf("headache execution error, cannot write CSV report\n\t%v\n", err)
+	}
+}
+
+func printYearSpans(configuration *ChangeSet) {
+	loadHistory(configuration)
+	for _, group := range GroupByYearSpan(configuration.Files) {
+		fmt.Printf("%d file(s) span %s\n", len(group.Paths), group.Span)
+	}
+}
+
+func loadHistory(configuration *ChangeSet) {
+	if err := configuration.LoadHistory(); err != nil {
+		log.Fatalf("headache execution error, cannot compute file histories\n\t%v\n", err)
+	}
 }
 
 func trackRun(configFile *string, tracker ExecutionTracker) {
@@ -0,0 +1,141 @@
+/*
+ * Copyright 2018 Florent Biville (@fbiville)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vcs
+
+import (
+	"sync"
+	"time"
+)
+
+// CountingVcs delegates to the embedded Vcs and records the number of invocations of each method, as well as the
+// total time spent in the delegate
+type CountingVcs struct {
+	Vcs
+	mutex    sync.Mutex
+	counts   map[string]int
+	duration time.Duration
+}
+
+func NewCountingVcs(delegate Vcs) *CountingVcs {
+	return &CountingVcs{Vcs: delegate}
+}
+
+// Count returns the number of invocations of the given method, e.g. "Log"
+func (cv *CountingVcs) Count(method string) int {
+	cv.mutex.Lock()
+	defer cv.mutex.Unlock()
+	return cv.counts[method]
+}
+
+// TotalCount returns the number of invocations of all methods
+func (cv *CountingVcs) TotalCount() int {
+	cv.mutex.Lock()
+	defer cv.mutex.Unlock()
+	result := 0
+	for _, count := range cv.counts {
+		result += count
+	}
+	return result
+}
+
+// Duration returns the total wall time spent in the delegate
+func (cv *CountingVcs) Duration() time.Duration {
+	cv.mutex.Lock()
+	defer cv.mutex.Unlock()
+	return cv.duration
+}
+
+func (cv *CountingVcs) Status(args ...string) (string, error) {
+	defer cv.record("Status", time.Now())
+	return cv.Vcs.Status(args...)
+}
+
+func (cv *CountingVcs) Diff(args ...string) (string, error) {
+	defer cv.record("Diff", time.Now())
+	return cv.Vcs.Diff(args...)
+}
+
+func (cv *CountingVcs) Describe(args ...string) (string, error) {
+	defer cv.record("Describe", time.Now())
+	return cv.Vcs.Describe(args...)
+}
+
+func (cv *CountingVcs) LatestRevision(file string) (string, error) {
+	defer cv.record("LatestRevision", time.Now())
+	return cv.Vcs.LatestRevision(file)
+}
+
+func (cv *CountingVcs) Log(args ...string) (string, error) {
+	defer cv.record("Log", time.Now())
+	return cv.Vcs.Log(args...)
+}
+
+func (cv *CountingVcs) LsFiles(args ...string) (string, error) {
+	defer cv.record("LsFiles", time.Now())
+	return cv.Vcs.LsFiles(args...)
+}
+
+func (cv *CountingVcs) ShowContentAtRevision(path string, revision string) (string, error) {
+	defer cv.record("ShowContentAtRevision", time.Now())
+	return cv.Vcs.ShowContentAtRevision(path, revision)
+}
+
+func (cv *CountingVcs) Root() (string, error) {
+	defer cv.record("Root", time.Now())
+	return cv.Vcs.Root()
+}
+
+func (cv *CountingVcs) IsDetachedHead() (bool, error) {
+	defer cv.record("IsDetachedHead", time.Now())
+	return cv.Vcs.IsDetachedHead()
+}
+
+func (cv *CountingVcs) MergeBase(revision string) (string, error) {
+	defer cv.record("MergeBase", time.Now())
+	return cv.Vcs.MergeBase(revision)
+}
+
+func (cv *CountingVcs) CurrentRef() (string, string, error) {
+	defer cv.record("CurrentRef", time.Now())
+	return cv.Vcs.CurrentRef()
+}
+
+func (cv *CountingVcs) ConfigValue(key string) (string, error) {
+	defer cv.record("ConfigValue", time.Now())
+	return cv.Vcs.ConfigValue(key)
+}
+
+func (cv *CountingVcs) Version() (string, error) {
+	defer cv.record("Version", time.Now())
+	return cv.Vcs.Version()
+}
+
+func (cv *CountingVcs) IsShallow() (bool, error) {
+	defer cv.record("IsShallow", time.Now())
+	return cv.Vcs.IsShallow()
+}
+
+func (cv *CountingVcs) record(method string, start time.Time) {
+	elapsed := time.Since(start)
+	cv.mutex.Lock()
+	defer cv.mutex.Unlock()
+	if cv.counts == nil {
+		cv.counts = make(map[string]int)
+	}
+	cv.counts[method]++
+	cv.duration += elapsed
+}
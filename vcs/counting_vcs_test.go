@@ -0,0 +1,87 @@
+/*
+ * Copyright 2018 Florent Biville (@fbiville)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vcs_test
+
+import (
+	"errors"
+	. "github.com/fbiville/headache/vcs"
+	"github.com/fbiville/headache/vcs_mocks"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"time"
+)
+
+var _ = Describe("Counting VCS", func() {
+
+	var (
+		t           GinkgoTInterface
+		delegate    *vcs_mocks.Vcs
+		countingVcs *CountingVcs
+	)
+
+	BeforeEach(func() {
+		t = GinkgoT()
+		delegate = new(vcs_mocks.Vcs)
+		countingVcs = NewCountingVcs(delegate)
+	})
+
+	AfterEach(func() {
+		delegate.AssertExpectations(t)
+	})
+
+	It("delegates calls", func() {
+		delegate.On("Log", "-1", "--format=%H").Return("cafebabe\n", nil)
+
+		output, err := countingVcs.Log("-1", "--format=%H")
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(output).To(Equal("cafebabe\n"))
+	})
+
+	It("counts calls per method", func() {
+		delegate.On("Log", "--follow", "--", "a.go").Return("", nil)
+		delegate.On("Log", "--follow", "--", "b.go").Return("", nil)
+		delegate.On("Diff", "--name-status").Return("", nil)
+
+		_, _ = countingVcs.Log("--follow", "--", "a.go")
+		Expect(countingVcs.Count("Log")).To(Equal(1))
+		_, _ = countingVcs.Log("--follow", "--", "b.go")
+		_, _ = countingVcs.Diff("--name-status")
+
+		Expect(countingVcs.Count("Log")).To(Equal(2))
+		Expect(countingVcs.Count("Diff")).To(Equal(1))
+		Expect(countingVcs.Count("Status")).To(Equal(0))
+		Expect(countingVcs.TotalCount()).To(Equal(3))
+	})
+
+	It("counts failed calls", func() {
+		delegate.On("MergeBase", "origin/master").Return("", errors.New("unknown revision"))
+
+		_, err := countingVcs.MergeBase("origin/master")
+
+		Expect(err).To(MatchError("unknown revision"))
+		Expect(countingVcs.Count("MergeBase")).To(Equal(1))
+	})
+
+	It("records the time spent in the delegate", func() {
+		delegate.On("Root").Return("/some/repository", nil).After(10 * time.Millisecond)
+
+		_, _ = countingVcs.Root()
+
+		Expect(countingVcs.Duration()).To(BeNumerically(">=", 10*time.Millisecond))
+	})
+})
@@ -0,0 +1,120 @@
+/*
+ * Copyright 2018 Florent Biville (@fbiville)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vcs_test
+
+import (
+	. "github.com/fbiville/headache/vcs"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"os"
+	"os/exec"
+)
+
+// feature.txt is authored on a feature branch in 2018 and merged into trunk in 2019
+var _ = Describe("Creation year policies", func() {
+
+	var (
+		workingDirectory string
+		repository       string
+	)
+
+	BeforeEach(func() {
+		if _, err := exec.LookPath("git"); err != nil {
+			Skip("git is not installed")
+		}
+		var err error
+		workingDirectory, err = os.Getwd()
+		Expect(err).NotTo(HaveOccurred())
+		repository, err = ioutil.TempDir("", "headache-creation-policies")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.Chdir(repository)).To(Succeed())
+
+		runGit("init", "-q")
+		runGit("checkout", "-q", "-b", "trunk")
+		writeFile("trunk.txt", "created on trunk\n")
+		commitAllOn("initial", "2016-06-01T12:00:00Z")
+		runGit("checkout", "-q", "-b", "feature")
+		writeFile("feature.txt", "created on the feature branch\n")
+		commitAllOn("feature", "2018-06-01T12:00:00Z")
+		runGit("checkout", "-q", "trunk")
+		runGitOn("2019-06-01T12:00:00Z", "merge", "-q", "--no-ff", "--no-gpg-sign", "-m", "merge feature", "feature")
+		runGit("checkout", "-q", "-b", "topic")
+		writeFile("topic.txt", "created on the topic branch\n")
+		commitAllOn("topic", "2020-06-01T12:00:00Z")
+	})
+
+	AfterEach(func() {
+		if repository == "" {
+			return
+		}
+		Expect(os.Chdir(workingDirectory)).To(Succeed())
+		Expect(os.RemoveAll(repository)).To(Succeed())
+	})
+
+	It("uses the year of the earliest commit by default", func() {
+		history, err := GetFileHistory(&Git{}, "feature.txt", FakeTime{}, HistoryOptions{MinYear: 1970, MaxYear: 2030})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(history.CreationYear).To(Equal(2018))
+		Expect(history.LastEditionYear).To(Equal(2018))
+	})
+
+	It("uses the year files first appeared on the branch when asked to", func() {
+		options := HistoryOptions{MinYear: 1970, MaxYear: 2030, CreationBranch: "trunk"}
+
+		history, err := GetFileHistory(&Git{}, "feature.txt", FakeTime{}, options)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(history.CreationYear).To(Equal(2019))
+		Expect(history.LastEditionYear).To(Equal(2019))
+	})
+
+	It("keeps the creation year of files committed on the branch itself", func() {
+		options := HistoryOptions{MinYear: 1970, MaxYear: 2030, CreationBranch: "trunk"}
+
+		history, err := GetFileHistory(&Git{}, "trunk.txt", FakeTime{}, options)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(history.CreationYear).To(Equal(2016))
+	})
+
+	It("keeps the creation year of files absent from the branch", func() {
+		options := HistoryOptions{MinYear: 1970, MaxYear: 2030, CreationBranch: "trunk"}
+
+		history, err := GetFileHistory(&Git{}, "topic.txt", FakeTime{}, options)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(history.CreationYear).To(Equal(2020))
+	})
+})
+
+// commits with both the author and the committer dates set, first appearances on branches relying on the latter
+func commitAllOn(message string, date string) {
+	runGit("add", "-A")
+	runGitOn(date, "commit", "-q", "--no-gpg-sign", "-m", message)
+}
+
+func runGitOn(date string, args ...string) {
+	command := exec.Command("git", args...)
+	command.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=headache", "GIT_AUTHOR_EMAIL=headache@example.com",
+		"GIT_COMMITTER_NAME=headache", "GIT_COMMITTER_EMAIL=headache@example.com",
+		"GIT_AUTHOR_DATE="+date, "GIT_COMMITTER_DATE="+date)
+	output, err := command.CombinedOutput()
+	Expect(err).NotTo(HaveOccurred(), string(output))
+}
@@ -0,0 +1,262 @@
+/*
+ * Copyright 2018 Florent Biville (@fbiville)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vcs_test
+
+import (
+	. "github.com/fbiville/headache/vcs"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// the commit graph is as follows, with HEAD being feature:
+//
+//	initial (adds a.txt and b.txt) --- feature (changes a.txt)
+//	        \
+//	         main (changes b.txt)
+var _ = Describe("Diff modes", func() {
+
+	var (
+		workingDirectory string
+		repository       string
+	)
+
+	BeforeEach(func() {
+		if _, err := exec.LookPath("git"); err != nil {
+			Skip("git is not installed")
+		}
+		var err error
+		workingDirectory, err = os.Getwd()
+		Expect(err).NotTo(HaveOccurred())
+		repository, err = ioutil.TempDir("", "headache-diff-modes")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.Chdir(repository)).To(Succeed())
+
+		runGit("init", "-q")
+		runGit("checkout", "-q", "-b", "main")
+		writeFile("a.txt", "a")
+		writeFile("b.txt", "b")
+		commitAll("initial")
+		runGit("tag", "initial")
+		runGit("checkout", "-q", "-b", "feature")
+		writeFile("a.txt", "a, changed on feature")
+		commitAll("feature")
+		runGit("checkout", "-q", "main")
+		writeFile("b.txt", "b, changed on main")
+		commitAll("main")
+		runGit("checkout", "-q", "feature")
+	})
+
+	AfterEach(func() {
+		if repository == "" {
+			return
+		}
+		Expect(os.Chdir(workingDirectory)).To(Succeed())
+		Expect(os.RemoveAll(repository)).To(Succeed())
+	})
+
+	It("reports the files differing between a diverged base and HEAD in endpoints mode", func() {
+		changes, err := GetCommittedChanges(&Git{}, "main", ChangeOptions{})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes).To(ConsistOf(FileChange{Path: "a.txt"}, FileChange{Path: "b.txt"}))
+	})
+
+	It("reports the files changed on HEAD side since the merge base in merge base mode", func() {
+		changes, err := GetCommittedChanges(&Git{}, "main", ChangeOptions{MergeBase: true})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes).To(ConsistOf(FileChange{Path: "a.txt"}))
+	})
+
+	It("excludes the changes of an ancestor base commit itself in endpoints mode", func() {
+		changes, err := GetCommittedChanges(&Git{}, "initial", ChangeOptions{})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes).To(ConsistOf(FileChange{Path: "a.txt"}))
+	})
+
+	It("excludes the changes of an ancestor base commit itself in merge base mode", func() {
+		changes, err := GetCommittedChanges(&Git{}, "initial", ChangeOptions{MergeBase: true})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes).To(ConsistOf(FileChange{Path: "a.txt"}))
+	})
+
+	It("reports files whose lines were only deleted unless asked not to", func() {
+		writeFile("a.txt", "first line\nsecond line\n")
+		writeFile("b.txt", "first line\nsecond line\n")
+		commitAll("more lines")
+		runGit("tag", "more-lines")
+		writeFile("a.txt", "first line\nsecond line\nthird line\n")
+		writeFile("b.txt", "first line\n")
+		commitAll("additions and deletions")
+
+		changes, err := GetCommittedChanges(&Git{}, "more-lines", ChangeOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes).To(ConsistOf(FileChange{Path: "a.txt"}, FileChange{Path: "b.txt"}))
+
+		changes, err = GetCommittedChanges(&Git{}, "more-lines", ChangeOptions{AddedLinesOnly: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes).To(Equal([]FileChange{{Path: "a.txt"}}))
+	})
+
+	It("reports files whose mode only changed unless asked not to", func() {
+		Expect(os.Chmod("b.txt", 0755)).To(Succeed())
+		commitAll("mode change")
+
+		changes, err := GetCommittedChanges(&Git{}, "feature~1", ChangeOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes).To(Equal([]FileChange{{Path: "b.txt"}}))
+
+		changes, err = GetCommittedChanges(&Git{}, "feature~1", ChangeOptions{ExcludeModeOnlyChanges: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes).To(BeEmpty())
+	})
+
+	It("only reports the files of the given pathspecs", func() {
+		Expect(os.MkdirAll("services/payments", 0755)).To(Succeed())
+		Expect(os.MkdirAll("services/billing", 0755)).To(Succeed())
+		writeFile("services/payments/pay.txt", "pay")
+		writeFile("services/billing/bill.txt", "bill")
+		commitAll("services")
+		writeFile("services/payments/pay.txt", "pay, changed")
+		writeFile("services/payments/refund.txt", "refund")
+		writeFile("services/billing/bill.txt", "bill, changed")
+		writeFile("a.txt", "a, changed again")
+		options := ChangeOptions{Pathspecs: []string{"services/payments"}}
+
+		changes, err := GetCommittedChanges(&Git{}, "initial", options)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes).To(ConsistOf(FileChange{Path: "services/payments/pay.txt"}))
+
+		changes, err = GetUncommittedChanges(&Git{}, options)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes).To(ConsistOf(
+			FileChange{Path: "services/payments/pay.txt"},
+			FileChange{Path: "services/payments/refund.txt"},
+		))
+	})
+
+	It("reports files renamed in the index and modified in the working tree once, under their destination path", func() {
+		runGit("mv", "a.txt", "renamed.txt")
+		writeFile("renamed.txt", "a, changed on feature, then in the working tree")
+
+		changes, err := (&Client{Vcs: &Git{}}).GetChanges("initial", ChangeOptions{})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes).To(Equal([]FileChange{{Path: "renamed.txt"}}))
+	})
+})
+
+// the commit graph is as follows, with HEAD being feature, which merged main twice:
+//
+//	initial (adds a.txt and b.txt) --- feature (changes a.txt) --- merge --------------------- merge
+//	        \                                                    /                           /
+//	         main (changes b.txt) -------------------------------- main (adds c.txt) --------
+var _ = Describe("Fork point", func() {
+
+	var (
+		workingDirectory string
+		repository       string
+	)
+
+	BeforeEach(func() {
+		if _, err := exec.LookPath("git"); err != nil {
+			Skip("git is not installed")
+		}
+		var err error
+		workingDirectory, err = os.Getwd()
+		Expect(err).NotTo(HaveOccurred())
+		repository, err = ioutil.TempDir("", "headache-fork-point")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.Chdir(repository)).To(Succeed())
+
+		runGit("init", "-q")
+		runGit("checkout", "-q", "-b", "main")
+		writeFile("a.txt", "a")
+		writeFile("b.txt", "b")
+		commitAll("initial")
+		runGit("tag", "initial")
+		runGit("checkout", "-q", "-b", "feature")
+		writeFile("a.txt", "a, changed on feature")
+		commitAll("feature")
+		runGit("checkout", "-q", "main")
+		writeFile("b.txt", "b, changed on main")
+		commitAll("main")
+		runGit("checkout", "-q", "feature")
+		runGit("merge", "-q", "--no-edit", "--no-ff", "main")
+		runGit("checkout", "-q", "main")
+		writeFile("c.txt", "c")
+		commitAll("main again")
+		runGit("checkout", "-q", "feature")
+		runGit("merge", "-q", "--no-edit", "--no-ff", "main")
+	})
+
+	AfterEach(func() {
+		if repository == "" {
+			return
+		}
+		Expect(os.Chdir(workingDirectory)).To(Succeed())
+		Expect(os.RemoveAll(repository)).To(Succeed())
+	})
+
+	It("reports the files merged from the base branch without fork point", func() {
+		changes, err := GetCommittedChanges(&Git{}, "initial", ChangeOptions{})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes).To(ConsistOf(FileChange{Path: "a.txt"}, FileChange{Path: "b.txt"}, FileChange{Path: "c.txt"}))
+	})
+
+	It("excludes the files merged from the fork point branch", func() {
+		changes, err := GetCommittedChanges(&Git{}, "initial", ChangeOptions{ForkPointBranch: "main"})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes).To(ConsistOf(FileChange{Path: "a.txt"}))
+	})
+
+	It("excludes the files changed on HEAD side before the revision", func() {
+		writeFile("b.txt", "b, changed on feature after the merges")
+		commitAll("feature again")
+
+		changes, err := GetCommittedChanges(&Git{}, "HEAD~1", ChangeOptions{ForkPointBranch: "main"})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes).To(ConsistOf(FileChange{Path: "b.txt"}))
+	})
+})
+
+func runGit(args ...string) {
+	command := exec.Command("git", args...)
+	command.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=headache", "GIT_AUTHOR_EMAIL=headache@example.com",
+		"GIT_COMMITTER_NAME=headache", "GIT_COMMITTER_EMAIL=headache@example.com")
+	output, err := command.CombinedOutput()
+	Expect(err).NotTo(HaveOccurred(), string(output))
+}
+
+func writeFile(name string, contents string) {
+	Expect(ioutil.WriteFile(filepath.Join(".", name), []byte(contents), 0644)).To(Succeed())
+}
+
+func commitAll(message string) {
+	runGit("add", "-A")
+	runGit("commit", "-q", "--no-gpg-sign", "-m", message)
+}
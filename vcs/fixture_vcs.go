@@ -0,0 +1,121 @@
+/*
+ * Copyright 2018 Florent Biville (@fbiville)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vcs
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FixtureVcs replays canned git outputs, so that changes and histories can be computed without running git
+// command outputs are keyed by their arguments joined with spaces, as in "-1 --format=%H -- main.go"
+// invocations without canned output fail, so that tests notice unexpected commands
+type FixtureVcs struct {
+	StatusOutputs   map[string]string
+	DiffOutputs     map[string]string
+	DescribeOutputs map[string]string
+	LogOutputs      map[string]string
+	LsFilesOutputs  map[string]string
+	Contents        map[string]string // file contents keyed by revision and path, as in "HEAD:main.go" or ":main.go"
+	MergeBases      map[string]string // merge bases of HEAD and the revisions they are keyed by
+	RootDir         string
+	DetachedHead    bool
+	Remote          string            // tracked by the current branch, if any
+	RemoteBranch    string            // tracked by the current branch, if any
+	Config          map[string]string // git configuration values by key, missing keys being unset
+	GitVersion      string
+	Shallow         bool
+}
+
+func (f *FixtureVcs) Status(args ...string) (string, error) {
+	return fixtureOutput(f.StatusOutputs, "status", args)
+}
+
+func (f *FixtureVcs) Diff(args ...string) (string, error) {
+	return fixtureOutput(f.DiffOutputs, "diff", args)
+}
+
+func (f *FixtureVcs) Describe(args ...string) (string, error) {
+	return fixtureOutput(f.DescribeOutputs, "describe", args)
+}
+
+// LatestRevision is derived from the canned log outputs, as git computes it
+func (f *FixtureVcs) LatestRevision(file string) (string, error) {
+	result, err := f.Log("-1", `--format=%H`, "--", file)
+	if err != nil {
+		return "", err
+	}
+	return strings.Trim(result, "\n"), nil
+}
+
+func (f *FixtureVcs) Log(args ...string) (string, error) {
+	return fixtureOutput(f.LogOutputs, "log", args)
+}
+
+func (f *FixtureVcs) LsFiles(args ...string) (string, error) {
+	return fixtureOutput(f.LsFilesOutputs, "ls-files", args)
+}
+
+func (f *FixtureVcs) ShowContentAtRevision(path string, revision string) (string, error) {
+	if revision == "" {
+		return "", nil
+	}
+	if revision == IndexRevision {
+		return fixtureOutput(f.Contents, "show", []string{IndexRevision + path})
+	}
+	return fixtureOutput(f.Contents, "show", []string{fmt.Sprintf("%s:%s", revision, path)})
+}
+
+func (f *FixtureVcs) Root() (string, error) {
+	return f.RootDir, nil
+}
+
+func (f *FixtureVcs) IsDetachedHead() (bool, error) {
+	return f.DetachedHead, nil
+}
+
+func (f *FixtureVcs) MergeBase(revision string) (string, error) {
+	return fixtureOutput(f.MergeBases, "merge-base", []string{revision})
+}
+
+func (f *FixtureVcs) CurrentRef() (string, string, error) {
+	if f.DetachedHead || f.Remote == "" {
+		return "", "", nil
+	}
+	return f.Remote, f.RemoteBranch, nil
+}
+
+func (f *FixtureVcs) ConfigValue(key string) (string, error) {
+	return f.Config[key], nil
+}
+
+func (f *FixtureVcs) Version() (string, error) {
+	return f.GitVersion, nil
+}
+
+func (f *FixtureVcs) IsShallow() (bool, error) {
+	return f.Shallow, nil
+}
+
+func fixtureOutput(outputs map[string]string, command string, args []string) (string, error) {
+	key := strings.Join(args, " ")
+	output, found := outputs[key]
+	if !found {
+		return "", fmt.Errorf("no fixture for git %s %s", command, key)
+	}
+	return output, nil
+}
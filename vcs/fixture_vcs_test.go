@@ -0,0 +1,94 @@
+/*
+ * Copyright 2018 Florent Biville (@fbiville)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vcs_test
+
+import (
+	. "github.com/fbiville/headache/vcs"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"time"
+)
+
+var _ = Describe("Fixture VCS", func() {
+
+	const logArguments = "--follow --name-status --use-mailmap --format=%at%x00%aN -- "
+
+	var fixture *FixtureVcs
+
+	BeforeEach(func() {
+		fixture = &FixtureVcs{
+			DiffOutputs: map[string]string{
+				"--name-status -z --ignore-submodules HEAD~1..HEAD": "M\x00main.go\x00R095\x00old.go\x00new.go\x00D\x00gone.go\x00",
+			},
+			StatusOutputs: map[string]string{
+				"--porcelain -z --ignore-submodules": "?? notes.go\x00",
+			},
+			LogOutputs: map[string]string{
+				logArguments + "main.go":    "1530000000\x00Jane\nM\tmain.go\n1499817600\x00John\nA\tmain.go\n",
+				logArguments + "new.go":     "1420070400\x00Jane\nR095\told.go\tnew.go\n",
+				logArguments + "notes.go":   "",
+				"-1 --format=%H -- main.go": "cafebabe\n",
+			},
+			Contents: map[string]string{
+				"HEAD:main.go": "package main",
+			},
+			MergeBases: map[string]string{
+				"origin/master": "deadbeef",
+			},
+			RootDir: "/some/root",
+		}
+	})
+
+	It("computes changes and their years end-to-end", func() {
+		client := &Client{Vcs: fixture}
+
+		changes, err := client.GetChanges("HEAD~1", ChangeOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		changes, err = client.AddMetadata(changes, FakeTime{timestamp: fakeNow}, HistoryOptions{})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes).To(ConsistOf(
+			FileChange{Path: "main.go", CreationYear: 2017, LastEditionYear: 2018,
+				CreationTime: time.Unix(1499817600, 0), LastEditionTime: time.Unix(1530000000, 0)},
+			FileChange{Path: "new.go", CreationYear: 2015, LastEditionYear: 2015,
+				CreationTime: time.Unix(1420070400, 0), LastEditionTime: time.Unix(1420070400, 0)},
+			FileChange{Path: "notes.go", CreationYear: 1986, LastEditionYear: 1986,
+				CreationTime: time.Unix(fakeNow, 0), LastEditionTime: time.Unix(fakeNow, 0)},
+		))
+	})
+
+	It("replays the canned outputs of the other commands", func() {
+		revision, err := fixture.LatestRevision("main.go")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(revision).To(Equal("cafebabe"))
+		contents, err := fixture.ShowContentAtRevision("main.go", "HEAD")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(contents).To(Equal("package main"))
+		mergeBase, err := fixture.MergeBase("origin/master")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(mergeBase).To(Equal("deadbeef"))
+		root, err := fixture.Root()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(root).To(Equal("/some/root"))
+	})
+
+	It("fails on commands without canned output", func() {
+		_, err := fixture.Log("--format=%at", "--", "docs")
+
+		Expect(err).To(MatchError("no fixture for git log --format=%at -- docs"))
+	})
+})
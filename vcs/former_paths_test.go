@@ -0,0 +1,106 @@
+/*
+ * Copyright 2018 Florent Biville (@fbiville)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vcs_test
+
+import (
+	. "github.com/fbiville/headache/vcs"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"os"
+	"os/exec"
+)
+
+// first.txt is created in 2016 and renamed to second.txt in 2018, which is rewritten as third.txt in 2020, beyond what
+// rename detection recognizes, while other.txt is created in 2017 and removed in 2019
+var _ = Describe("Former paths", func() {
+
+	var (
+		workingDirectory string
+		repository       string
+		options          HistoryOptions
+	)
+
+	BeforeEach(func() {
+		if _, err := exec.LookPath("git"); err != nil {
+			Skip("git is not installed")
+		}
+		var err error
+		workingDirectory, err = os.Getwd()
+		Expect(err).NotTo(HaveOccurred())
+		repository, err = ioutil.TempDir("", "headache-former-paths")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.Chdir(repository)).To(Succeed())
+
+		runGit("init", "-q")
+		writeFile("first.txt", "some\ncontents\n")
+		commitAllOn("creation", "2016-06-01T12:00:00Z")
+		writeFile("other.txt", "other\ncontents\n")
+		commitAllOn("other creation", "2017-06-01T12:00:00Z")
+		runGit("mv", "first.txt", "second.txt")
+		commitAllOn("first hop", "2018-06-01T12:00:00Z")
+		Expect(os.Remove("other.txt")).To(Succeed())
+		commitAllOn("other removal", "2019-06-01T12:00:00Z")
+		Expect(os.Remove("second.txt")).To(Succeed())
+		writeFile("third.txt", "entirely\nrewritten\nthings\n")
+		commitAllOn("second hop", "2020-06-01T12:00:00Z")
+		options = HistoryOptions{MinYear: 1970, MaxYear: 2030}
+	})
+
+	AfterEach(func() {
+		if repository == "" {
+			return
+		}
+		Expect(os.Chdir(workingDirectory)).To(Succeed())
+		Expect(os.RemoveAll(repository)).To(Succeed())
+	})
+
+	It("misses the origin of rewritten renames by default", func() {
+		history, err := GetFileHistory(&Git{}, "third.txt", FakeTime{}, options)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(history.CreationYear).To(Equal(2020))
+	})
+
+	It("uses the earliest creation year across the rename chain of former paths", func() {
+		options.FormerPaths = map[string][]string{"third.txt": {"second.txt"}}
+
+		history, err := GetFileHistory(&Git{}, "third.txt", FakeTime{}, options)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(history.CreationYear).To(Equal(2016))
+		Expect(history.LastEditionYear).To(Equal(2020))
+	})
+
+	It("uses the earliest creation year among all former paths", func() {
+		options.FormerPaths = map[string][]string{"third.txt": {"other.txt", "first.txt"}}
+
+		history, err := GetFileHistory(&Git{}, "third.txt", FakeTime{}, options)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(history.CreationYear).To(Equal(2016))
+	})
+
+	It("ignores former paths that never existed", func() {
+		options.FormerPaths = map[string][]string{"third.txt": {"unknown.txt"}}
+
+		history, err := GetFileHistory(&Git{}, "third.txt", FakeTime{}, options)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(history.CreationYear).To(Equal(2020))
+	})
+})
@@ -0,0 +1,103 @@
+/*
+ * Copyright 2018 Florent Biville (@fbiville)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vcs_test
+
+import (
+	. "github.com/fbiville/headache/vcs"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"os"
+	"os/exec"
+)
+
+// edited.txt is created in 2016 and edited in 2018 and 2020, dormant.txt is created in 2016 and edited in 2017
+var _ = Describe("History cutoff date", func() {
+
+	var (
+		workingDirectory string
+		repository       string
+		options          HistoryOptions
+	)
+
+	BeforeEach(func() {
+		if _, err := exec.LookPath("git"); err != nil {
+			Skip("git is not installed")
+		}
+		var err error
+		workingDirectory, err = os.Getwd()
+		Expect(err).NotTo(HaveOccurred())
+		repository, err = ioutil.TempDir("", "headache-history-since")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.Chdir(repository)).To(Succeed())
+
+		runGit("init", "-q")
+		writeFile("edited.txt", "created\n")
+		writeFile("dormant.txt", "created\n")
+		commitAllOn("initial", "2016-06-01T12:00:00Z")
+		writeFile("dormant.txt", "edited\n")
+		commitAllOn("dormant edition", "2017-06-01T12:00:00Z")
+		writeFile("edited.txt", "edited\n")
+		commitAllOn("first edition", "2018-06-01T12:00:00Z")
+		writeFile("edited.txt", "edited again\n")
+		commitAllOn("second edition", "2020-06-01T12:00:00Z")
+		options = HistoryOptions{MinYear: 1970, MaxYear: 2030, Since: "2019-01-01"}
+	})
+
+	AfterEach(func() {
+		if repository == "" {
+			return
+		}
+		Expect(os.Chdir(workingDirectory)).To(Succeed())
+		Expect(os.RemoveAll(repository)).To(Succeed())
+	})
+
+	It("uses the year of the newest commit of the bounded window as last edition year", func() {
+		history, err := GetFileHistory(&Git{}, "edited.txt", FakeTime{}, options)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(history.LastEditionYear).To(Equal(2020))
+	})
+
+	It("looks the creation year up beyond the bounded window", func() {
+		history, err := GetFileHistory(&Git{}, "edited.txt", FakeTime{}, options)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(history.CreationYear).To(Equal(2016))
+	})
+
+	It("matches the years of the whole history", func() {
+		unboundedOptions := options
+		unboundedOptions.Since = ""
+
+		bounded, err := GetFileHistory(&Git{}, "edited.txt", FakeTime{}, options)
+		Expect(err).NotTo(HaveOccurred())
+		unbounded, err := GetFileHistory(&Git{}, "edited.txt", FakeTime{}, unboundedOptions)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(bounded.CreationYear).To(Equal(unbounded.CreationYear))
+		Expect(bounded.LastEditionYear).To(Equal(unbounded.LastEditionYear))
+	})
+
+	It("falls back to the whole history of files without commits in the bounded window", func() {
+		history, err := GetFileHistory(&Git{}, "dormant.txt", FakeTime{}, options)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(history.CreationYear).To(Equal(2016))
+		Expect(history.LastEditionYear).To(Equal(2017))
+	})
+})
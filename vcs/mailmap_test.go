@@ -0,0 +1,84 @@
+/*
+ * Copyright 2018 Florent Biville (@fbiville)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vcs_test
+
+import (
+	. "github.com/fbiville/headache/helper"
+	. "github.com/fbiville/headache/vcs"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"os"
+	"os/exec"
+)
+
+// main.go is committed under two spellings of the same author, collapsed by the mailmap, and by another author
+var _ = Describe("Mailmap", func() {
+
+	var (
+		workingDirectory string
+		repository       string
+	)
+
+	BeforeEach(func() {
+		if _, err := exec.LookPath("git"); err != nil {
+			Skip("git is not installed")
+		}
+		var err error
+		workingDirectory, err = os.Getwd()
+		Expect(err).NotTo(HaveOccurred())
+		repository, err = ioutil.TempDir("", "headache-mailmap")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.Chdir(repository)).To(Succeed())
+		runGit("init", "-q")
+		writeFile("main.go", "package main\n")
+		commitAllAs("initial", "Florent Biville <florent@example.com>")
+		writeFile("main.go", "package main\n\nfunc main() {}\n")
+		commitAllAs("add main", "fbiville <fbiville@example.com>")
+		writeFile("main.go", "package main\n\nfunc main() {\n}\n")
+		commitAllAs("reformat", "Someone Else <someone@example.com>")
+	})
+
+	AfterEach(func() {
+		if repository == "" {
+			return
+		}
+		Expect(os.Chdir(workingDirectory)).To(Succeed())
+		Expect(os.RemoveAll(repository)).To(Succeed())
+	})
+
+	It("canonicalizes the authors with the mailmap", func() {
+		writeFile(".mailmap", "Florent Biville <florent@example.com> fbiville <fbiville@example.com>\n")
+
+		history, err := GetFileHistory(&Git{}, "main.go", &SystemClock{}, HistoryOptions{})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(history.Authors).To(Equal([]string{"Someone Else", "Florent Biville"}))
+	})
+
+	It("keeps the authors as committed without mailmap", func() {
+		history, err := GetFileHistory(&Git{}, "main.go", &SystemClock{}, HistoryOptions{})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(history.Authors).To(Equal([]string{"Someone Else", "fbiville", "Florent Biville"}))
+	})
+})
+
+func commitAllAs(message string, author string) {
+	runGit("add", "-A")
+	runGit("commit", "-q", "--no-gpg-sign", "--author", author, "-m", message)
+}
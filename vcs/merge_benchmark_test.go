@@ -0,0 +1,56 @@
+/*
+ * Copyright 2018 Florent Biville (@fbiville)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vcs_test
+
+import (
+	. "github.com/fbiville/headache/vcs"
+	"github.com/fbiville/headache/vcs_mocks"
+	"strings"
+	"testing"
+)
+
+var mergedChanges []FileChange
+
+const benchmarkStatus = " M main.go\x00?? core/headache.go\x00"
+
+func BenchmarkGetChangesOfSmallChangeSet(b *testing.B) {
+	benchmarkGetChanges(b, benchmarkStatus)
+}
+
+// the status repeats the same 2 files so that the merge goes through the set, the result being the same
+func BenchmarkGetChangesOfLargeChangeSet(b *testing.B) {
+	benchmarkGetChanges(b, strings.Repeat(benchmarkStatus, 4))
+}
+
+func benchmarkGetChanges(b *testing.B, status string) {
+	vcsMock := new(vcs_mocks.Vcs)
+	vcsMock.On("Diff", "--name-status", "-z", "--ignore-submodules", "origin/master..HEAD").Return("M\x00main.go\x00", nil)
+	vcsMock.On("Status", "--porcelain", "-z", "--ignore-submodules").Return(status, nil)
+	client := &Client{Vcs: vcsMock}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		changes, err := client.GetChanges("origin/master", ChangeOptions{})
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(changes) != 2 {
+			b.Fatalf("expected 2 changes, got %v", changes)
+		}
+		mergedChanges = changes
+	}
+}
@@ -0,0 +1,85 @@
+/*
+ * Copyright 2018 Florent Biville (@fbiville)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vcs
+
+import (
+	"fmt"
+	. "strings"
+)
+
+// FileError is the failure to process a single file
+type FileError struct {
+	Path string
+	Err  error
+}
+
+func (err *FileError) Error() string {
+	return fmt.Sprintf("%s: %v", err.Path, err.Err)
+}
+
+func (err *FileError) Unwrap() error {
+	return err.Err
+}
+
+// MultiError aggregates the failures to process files, in processing order, so that one failing file does not hide
+// the others
+type MultiError struct {
+	Failures []*FileError
+}
+
+func (err *MultiError) Error() string {
+	messages := make([]string, len(err.Failures))
+	for i, failure := range err.Failures {
+		messages[i] = failure.Error()
+	}
+	return fmt.Sprintf("%d file(s) failed\n\t%s", len(err.Failures), Join(messages, "\n\t"))
+}
+
+// Unwrap returns the failures of every file
+func (err *MultiError) Unwrap() []error {
+	result := make([]error, len(err.Failures))
+	for i, failure := range err.Failures {
+		result[i] = failure
+	}
+	return result
+}
+
+// Paths returns the paths of the failing files
+func (err *MultiError) Paths() []string {
+	result := make([]string, len(err.Failures))
+	for i, failure := range err.Failures {
+		result[i] = failure.Path
+	}
+	return result
+}
+
+// add records the failure of the file, nested multiple errors being flattened
+func (err *MultiError) add(path string, cause error) {
+	if multiError, ok := cause.(*MultiError); ok {
+		err.Failures = append(err.Failures, multiError.Failures...)
+		return
+	}
+	err.Failures = append(err.Failures, &FileError{Path: path, Err: cause})
+}
+
+// returns nil rather than an empty multiple error, so that callers can keep comparing errors to nil
+func (err *MultiError) orNil() error {
+	if len(err.Failures) == 0 {
+		return nil
+	}
+	return err
+}
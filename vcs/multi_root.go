@@ -0,0 +1,244 @@
+/*
+ * Copyright 2018 Florent Biville (@fbiville)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vcs
+
+import (
+	"fmt"
+	. "github.com/fbiville/headache/helper"
+	"os"
+	"path/filepath"
+	"sort"
+	. "strings"
+)
+
+// the well-known hash of git empty tree, used as base revision of nested repositories created after the revision
+const emptyTreeRevision = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+type NestedRoot struct {
+	Path   string // relative to the main repository
+	Client VersioningClient
+}
+
+// MultiRootClient aggregates the changes of the main repository and of nested repositories, such as submodules
+// paths of nested repositories changes are prefixed with the path of their root
+// the changes of nested repositories are computed since their last commit at the time of the main repository revision
+type MultiRootClient struct {
+	Main  VersioningClient
+	Roots []NestedRoot
+}
+
+func (client *MultiRootClient) GetChanges(revision string, options ChangeOptions) ([]FileChange, error) {
+	mainChanges, err := client.Main.GetChanges(revision, options)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]FileChange, 0, len(mainChanges))
+	for _, change := range mainChanges {
+		// nested repositories show up as changed entries of the main repository
+		if !client.isRoot(change.Path) {
+			result = append(result, change)
+		}
+	}
+	timestamp := ""
+	if !options.Staged {
+		output, err := client.Main.GetClient().Log("-1", "--format=%ct", revision)
+		if err != nil {
+			return nil, err
+		}
+		timestamp = Trim(output, "\n")
+	}
+	rootOptions := options
+	// the fork point branch belongs to the main repository
+	rootOptions.ForkPointBranch = ""
+	for _, root := range client.Roots {
+		pathspecs, inScope := nestedPathspecs(root.Path, options.Pathspecs)
+		if !inScope {
+			continue
+		}
+		rootOptions.Pathspecs = pathspecs
+		rootRevision := ""
+		if !options.Staged {
+			rootRevision, err = revisionBefore(root.Client.GetClient(), timestamp)
+			if err != nil {
+				return nil, err
+			}
+		}
+		rootChanges, err := root.Client.GetChanges(rootRevision, rootOptions)
+		if err != nil {
+			return nil, err
+		}
+		for _, change := range rootChanges {
+			change.Path = root.Path + "/" + change.Path
+			result = append(result, change)
+		}
+	}
+	return result, nil
+}
+
+func (client *MultiRootClient) AddMetadata(changes []FileChange, clock Clock, options HistoryOptions) ([]FileChange, error) {
+	result := make([]FileChange, len(changes))
+	indices := make(map[int][]int)
+	groups := make(map[int][]FileChange)
+	for i, change := range changes {
+		rootIndex, relativePath := client.findRoot(change.Path)
+		change.Path = relativePath
+		indices[rootIndex] = append(indices[rootIndex], i)
+		groups[rootIndex] = append(groups[rootIndex], change)
+	}
+	rootIndices := make([]int, 0, len(groups))
+	for rootIndex := range groups {
+		rootIndices = append(rootIndices, rootIndex)
+	}
+	// failures are reported root by root, the main repository first
+	sort.Ints(rootIndices)
+	failures := &MultiError{}
+	for _, rootIndex := range rootIndices {
+		group := groups[rootIndex]
+		versioningClient := client.Main
+		prefix := ""
+		rootOptions := options
+		if rootIndex != -1 {
+			versioningClient = client.Roots[rootIndex].Client
+			prefix = client.Roots[rootIndex].Path + "/"
+			// the edition and reference revisions, as well as former paths, belong to the main repository
+			rootOptions.EditionRevision = ""
+			rootOptions.ReferenceRevision = ""
+			rootOptions.FormerPaths = nil
+		}
+		augmentedChanges, err := versioningClient.AddMetadata(group, clock, rootOptions)
+		multiError, partial := err.(*MultiError)
+		if err != nil && !partial {
+			return nil, err
+		}
+		if partial {
+			for _, failure := range multiError.Failures {
+				failures.add(prefix+failure.Path, failure.Err)
+			}
+		}
+		for j, change := range augmentedChanges {
+			change.Path = prefix + change.Path
+			result[indices[rootIndex][j]] = change
+		}
+	}
+	return result, failures.orNil()
+}
+
+func (client *MultiRootClient) GetClient() Vcs {
+	return client.Main.GetClient()
+}
+
+// ShowContentAtRevision returns the contents of the file at the given revision of the main repository
+// files of nested repositories are shown from their own root, at their last commit at the time of the main revision
+func (client *MultiRootClient) ShowContentAtRevision(path string, revision string) (string, error) {
+	rootIndex, relativePath := client.findRoot(path)
+	if rootIndex == -1 {
+		return client.Main.GetClient().ShowContentAtRevision(path, revision)
+	}
+	output, err := client.Main.GetClient().Log("-1", "--format=%ct", revision)
+	if err != nil {
+		return "", err
+	}
+	rootVcs := client.Roots[rootIndex].Client.GetClient()
+	rootRevision, err := revisionBefore(rootVcs, Trim(output, "\n"))
+	if err != nil {
+		return "", err
+	}
+	return rootVcs.ShowContentAtRevision(relativePath, rootRevision)
+}
+
+// returns the pathspecs relative to the nested repository, none if it is entirely in scope, and whether it is in scope
+// pathspecs are treated as plain paths, the nested repository being in scope when they lead to or into it
+func nestedPathspecs(root string, pathspecs []string) ([]string, bool) {
+	if len(pathspecs) == 0 {
+		return nil, true
+	}
+	result := make([]string, 0)
+	for _, pathspec := range pathspecs {
+		pathspec = TrimSuffix(filepath.ToSlash(filepath.Clean(pathspec)), "/")
+		if pathspec == "." || pathspec == root || HasPrefix(root, pathspec+"/") {
+			return nil, true
+		}
+		if HasPrefix(pathspec, root+"/") {
+			result = append(result, TrimPrefix(pathspec, root+"/"))
+		}
+	}
+	return result, len(result) > 0
+}
+
+func (client *MultiRootClient) isRoot(path string) bool {
+	for _, root := range client.Roots {
+		if root.Path == path {
+			return true
+		}
+	}
+	return false
+}
+
+// returns the index of the innermost root containing the path and the path relative to it, -1 for the main repository
+func (client *MultiRootClient) findRoot(path string) (int, string) {
+	result, relativePath := -1, path
+	longestPrefix := 0
+	for i, root := range client.Roots {
+		prefix := root.Path + "/"
+		if HasPrefix(path, prefix) && len(prefix) > longestPrefix {
+			result, relativePath, longestPrefix = i, path[len(prefix):], len(prefix)
+		}
+	}
+	return result, relativePath
+}
+
+func revisionBefore(vcs Vcs, timestamp string) (string, error) {
+	output, err := vcs.Log("-1", "--format=%H", fmt.Sprintf("--before=%s", timestamp))
+	if err != nil {
+		return "", err
+	}
+	if revision := Trim(output, "\n"); revision != "" {
+		return revision, nil
+	}
+	return emptyTreeRevision, nil
+}
+
+// DiscoverNestedRoots returns the directories below dir containing a .git entry (a directory, or a file for
+// submodules), relative to dir and sorted
+// the contents of nested repositories are searched as well
+func DiscoverNestedRoots(dir string) ([]string, error) {
+	result := make([]string, 0)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Name() != ".git" {
+			return nil
+		}
+		root, err := filepath.Rel(dir, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		if root != "." {
+			result = append(result, filepath.ToSlash(root))
+		}
+		if info.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(result)
+	return result, nil
+}
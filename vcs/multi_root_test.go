@@ -0,0 +1,217 @@
+/*
+ * Copyright 2018 Florent Biville (@fbiville)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vcs_test
+
+import (
+	"errors"
+	. "github.com/fbiville/headache/vcs"
+	"github.com/fbiville/headache/vcs_mocks"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+var _ = Describe("Multiple roots", func() {
+
+	var (
+		t          GinkgoTInterface
+		mainVcs    *vcs_mocks.Vcs
+		mainClient *vcs_mocks.VersioningClient
+		libVcs     *vcs_mocks.Vcs
+		libClient  *vcs_mocks.VersioningClient
+		docsVcs    *vcs_mocks.Vcs
+		docsClient *vcs_mocks.VersioningClient
+		client     *MultiRootClient
+	)
+
+	BeforeEach(func() {
+		t = GinkgoT()
+		mainVcs = new(vcs_mocks.Vcs)
+		mainClient = new(vcs_mocks.VersioningClient)
+		mainClient.On("GetClient").Return(mainVcs)
+		libVcs = new(vcs_mocks.Vcs)
+		libClient = new(vcs_mocks.VersioningClient)
+		libClient.On("GetClient").Return(libVcs)
+		docsVcs = new(vcs_mocks.Vcs)
+		docsClient = new(vcs_mocks.VersioningClient)
+		docsClient.On("GetClient").Return(docsVcs)
+		client = &MultiRootClient{
+			Main: mainClient,
+			Roots: []NestedRoot{
+				{Path: "vendor/lib", Client: libClient},
+				{Path: "docs", Client: docsClient},
+			},
+		}
+	})
+
+	AfterEach(func() {
+		mainVcs.AssertExpectations(t)
+		libVcs.AssertExpectations(t)
+		docsVcs.AssertExpectations(t)
+	})
+
+	It("aggregates the changes of all roots with prefixed paths", func() {
+		mainClient.On("GetChanges", "cafebabe", ChangeOptions{}).
+			Return([]FileChange{{Path: "main.go"}, {Path: "vendor/lib"}}, nil)
+		mainVcs.On("Log", "-1", "--format=%ct", "cafebabe").Return("1551657600\n", nil)
+		libVcs.On("Log", "-1", "--format=%H", "--before=1551657600").Return("deadbeef\n", nil)
+		libClient.On("GetChanges", "deadbeef", ChangeOptions{}).Return([]FileChange{{Path: "lib.go"}}, nil)
+		docsVcs.On("Log", "-1", "--format=%H", "--before=1551657600").Return("", nil)
+		docsClient.On("GetChanges", "4b825dc642cb6eb9a060e54bf8d69288fbee4904", ChangeOptions{}).
+			Return([]FileChange{{Path: "index.md"}}, nil)
+
+		changes, err := client.GetChanges("cafebabe", ChangeOptions{})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes).To(Equal([]FileChange{
+			{Path: "main.go"},
+			{Path: "vendor/lib/lib.go"},
+			{Path: "docs/index.md"},
+		}))
+	})
+
+	It("only computes the changes of the main repository since its fork point", func() {
+		options := ChangeOptions{ForkPointBranch: "origin/main"}
+		mainClient.On("GetChanges", "cafebabe", options).Return([]FileChange{{Path: "main.go"}}, nil)
+		mainVcs.On("Log", "-1", "--format=%ct", "cafebabe").Return("1551657600\n", nil)
+		libVcs.On("Log", "-1", "--format=%H", "--before=1551657600").Return("deadbeef\n", nil)
+		libClient.On("GetChanges", "deadbeef", ChangeOptions{}).Return([]FileChange{{Path: "lib.go"}}, nil)
+		docsVcs.On("Log", "-1", "--format=%H", "--before=1551657600").Return("", nil)
+		docsClient.On("GetChanges", "4b825dc642cb6eb9a060e54bf8d69288fbee4904", ChangeOptions{}).
+			Return([]FileChange{}, nil)
+
+		changes, err := client.GetChanges("cafebabe", options)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes).To(Equal([]FileChange{{Path: "main.go"}, {Path: "vendor/lib/lib.go"}}))
+	})
+
+	It("only computes the changes of the nested repositories within the given pathspecs", func() {
+		options := ChangeOptions{Pathspecs: []string{"vendor/lib/pkg", "main.go"}}
+		mainClient.On("GetChanges", "cafebabe", options).Return([]FileChange{{Path: "main.go"}}, nil)
+		mainVcs.On("Log", "-1", "--format=%ct", "cafebabe").Return("1551657600\n", nil)
+		libVcs.On("Log", "-1", "--format=%H", "--before=1551657600").Return("deadbeef\n", nil)
+		libClient.On("GetChanges", "deadbeef", ChangeOptions{Pathspecs: []string{"pkg"}}).
+			Return([]FileChange{{Path: "pkg/lib.go"}}, nil)
+
+		changes, err := client.GetChanges("cafebabe", options)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes).To(Equal([]FileChange{{Path: "main.go"}, {Path: "vendor/lib/pkg/lib.go"}}))
+	})
+
+	It("retrieves the history of each file from its own root", func() {
+		clock := FakeTime{timestamp: fakeNow}
+		mainClient.On("AddMetadata", []FileChange{{Path: "main.go"}}, clock, HistoryOptions{}).
+			Return([]FileChange{{Path: "main.go", CreationYear: 2017, LastEditionYear: 2019}}, nil)
+		libClient.On("AddMetadata", []FileChange{{Path: "lib.go"}}, clock, HistoryOptions{}).
+			Return([]FileChange{{Path: "lib.go", CreationYear: 2012, LastEditionYear: 2014}}, nil)
+
+		changes, err := client.AddMetadata([]FileChange{{Path: "vendor/lib/lib.go"}, {Path: "main.go"}}, clock, HistoryOptions{})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes).To(Equal([]FileChange{
+			{Path: "vendor/lib/lib.go", CreationYear: 2012, LastEditionYear: 2014},
+			{Path: "main.go", CreationYear: 2017, LastEditionYear: 2019},
+		}))
+	})
+
+	It("retrieves the history of the given files from their own root", func() {
+		clock := FakeTime{timestamp: fakeNow}
+		mainClient.On("AddMetadata", []FileChange{{Path: "main.go"}}, clock, HistoryOptions{}).
+			Return([]FileChange{{Path: "main.go", CreationYear: 2017, LastEditionYear: 2019}}, nil)
+		libClient.On("AddMetadata", []FileChange{{Path: "lib.go"}}, clock, HistoryOptions{}).
+			Return([]FileChange{{Path: "lib.go", CreationYear: 2012, LastEditionYear: 2014}}, nil)
+
+		changes, err := ChangesForPaths(client, []string{"main.go", "vendor/lib/lib.go"}, clock, HistoryOptions{})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes).To(Equal([]FileChange{
+			{Path: "main.go", CreationYear: 2017, LastEditionYear: 2019},
+			{Path: "vendor/lib/lib.go", CreationYear: 2012, LastEditionYear: 2014},
+		}))
+	})
+
+	It("shows the contents of the files of the main repository at the given revision", func() {
+		mainVcs.On("ShowContentAtRevision", "main.go", "cafebabe").Return("package main", nil)
+
+		contents, err := client.ShowContentAtRevision("main.go", "cafebabe")
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(contents).To(Equal("package main"))
+	})
+
+	It("shows the contents of the files of nested repositories from their own root", func() {
+		mainVcs.On("Log", "-1", "--format=%ct", "cafebabe").Return("1551657600\n", nil)
+		libVcs.On("Log", "-1", "--format=%H", "--before=1551657600").Return("deadbeef\n", nil)
+		libVcs.On("ShowContentAtRevision", "lib.go", "deadbeef").Return("package lib", nil)
+
+		contents, err := client.ShowContentAtRevision("vendor/lib/lib.go", "cafebabe")
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(contents).To(Equal("package lib"))
+	})
+
+	It("reports the failures of every repository with their full path", func() {
+		clock := FakeTime{timestamp: fakeNow}
+		mainClient.On("AddMetadata", []FileChange{{Path: "main.go"}}, clock, HistoryOptions{}).
+			Return([]FileChange{{Path: "main.go"}}, &MultiError{Failures: []*FileError{{Path: "main.go", Err: errors.New("main failure")}}})
+		libClient.On("AddMetadata", []FileChange{{Path: "lib.go"}, {Path: "other.go"}}, clock, HistoryOptions{}).
+			Return([]FileChange{{Path: "lib.go", CreationYear: 2012, LastEditionYear: 2014}, {Path: "other.go"}},
+				&MultiError{Failures: []*FileError{{Path: "other.go", Err: errors.New("lib failure")}}})
+
+		changes, err := client.AddMetadata([]FileChange{{Path: "vendor/lib/lib.go"}, {Path: "main.go"}, {Path: "vendor/lib/other.go"}}, clock, HistoryOptions{})
+
+		Expect(err).To(BeAssignableToTypeOf(&MultiError{}))
+		Expect(err.(*MultiError).Paths()).To(Equal([]string{"main.go", "vendor/lib/other.go"}))
+		Expect(changes).To(Equal([]FileChange{
+			{Path: "vendor/lib/lib.go", CreationYear: 2012, LastEditionYear: 2014},
+			{Path: "main.go"},
+			{Path: "vendor/lib/other.go"},
+		}))
+	})
+
+	It("only bounds the edition years of the files of the main repository", func() {
+		clock := FakeTime{timestamp: fakeNow}
+		options := HistoryOptions{EditionRevision: "base"}
+		mainClient.On("AddMetadata", []FileChange{{Path: "main.go"}}, clock, options).
+			Return([]FileChange{{Path: "main.go", CreationYear: 2017, LastEditionYear: 2019}}, nil)
+		libClient.On("AddMetadata", []FileChange{{Path: "lib.go"}}, clock, HistoryOptions{}).
+			Return([]FileChange{{Path: "lib.go", CreationYear: 2012, LastEditionYear: 2014}}, nil)
+
+		_, err := client.AddMetadata([]FileChange{{Path: "vendor/lib/lib.go"}, {Path: "main.go"}}, clock, options)
+
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("discovers nested repositories and submodules", func() {
+		dir, err := ioutil.TempDir("", "headache-roots")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+		Expect(os.MkdirAll(filepath.Join(dir, ".git"), 0755)).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(dir, "tools", "linter", ".git"), 0755)).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(dir, "vendor", "lib"), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(dir, "vendor", "lib", ".git"), []byte("gitdir: ../../.git/modules/lib"), 0644)).To(Succeed())
+
+		roots, err := DiscoverNestedRoots(dir)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(roots).To(Equal([]string{"tools/linter", "vendor/lib"}))
+	})
+})
@@ -0,0 +1,105 @@
+/*
+ * Copyright 2018 Florent Biville (@fbiville)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vcs_test
+
+import (
+	. "github.com/fbiville/headache/vcs"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"os"
+	"os/exec"
+)
+
+// the base revision is tagged in 2018, rebased.txt is then changed and reverted in 2020 and changed.txt changed in 2020
+var _ = Describe("Reference revision", func() {
+
+	var (
+		workingDirectory string
+		repository       string
+	)
+
+	BeforeEach(func() {
+		if _, err := exec.LookPath("git"); err != nil {
+			Skip("git is not installed")
+		}
+		var err error
+		workingDirectory, err = os.Getwd()
+		Expect(err).NotTo(HaveOccurred())
+		repository, err = ioutil.TempDir("", "headache-reference-revision")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.Chdir(repository)).To(Succeed())
+
+		runGit("init", "-q")
+		writeFile("rebased.txt", "unchanged contents\n")
+		writeFile("changed.txt", "initial contents\n")
+		commitAllOn("initial", "2016-06-01T12:00:00Z")
+		writeFile("rebased.txt", "still unchanged contents\n")
+		commitAllOn("edition", "2018-06-01T12:00:00Z")
+		runGit("tag", "base")
+		writeFile("rebased.txt", "temporarily changed contents\n")
+		writeFile("changed.txt", "changed contents\n")
+		commitAllOn("change", "2020-06-01T12:00:00Z")
+		writeFile("rebased.txt", "still unchanged contents\n")
+		commitAllOn("revert", "2020-07-01T12:00:00Z")
+		writeFile("added.txt", "added contents\n")
+		commitAllOn("addition", "2020-08-01T12:00:00Z")
+	})
+
+	AfterEach(func() {
+		if repository == "" {
+			return
+		}
+		Expect(os.Chdir(workingDirectory)).To(Succeed())
+		Expect(os.RemoveAll(repository)).To(Succeed())
+	})
+
+	It("uses the year of the latest commit by default", func() {
+		history, err := GetFileHistory(&Git{}, "rebased.txt", FakeTime{}, HistoryOptions{MinYear: 1970, MaxYear: 2030})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(history.LastEditionYear).To(Equal(2020))
+	})
+
+	It("keeps the edition year the file had at the reference revision when its contents are identical", func() {
+		options := HistoryOptions{MinYear: 1970, MaxYear: 2030, ReferenceRevision: "base"}
+
+		history, err := GetFileHistory(&Git{}, "rebased.txt", FakeTime{}, options)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(history.CreationYear).To(Equal(2016))
+		Expect(history.LastEditionYear).To(Equal(2018))
+	})
+
+	It("uses the year of the latest commit of files whose contents changed", func() {
+		options := HistoryOptions{MinYear: 1970, MaxYear: 2030, ReferenceRevision: "base"}
+
+		history, err := GetFileHistory(&Git{}, "changed.txt", FakeTime{}, options)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(history.LastEditionYear).To(Equal(2020))
+	})
+
+	It("uses the year of the latest commit of files absent from the reference revision", func() {
+		options := HistoryOptions{MinYear: 1970, MaxYear: 2030, ReferenceRevision: "base"}
+
+		history, err := GetFileHistory(&Git{}, "added.txt", FakeTime{}, options)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(history.LastEditionYear).To(Equal(2020))
+	})
+})
@@ -0,0 +1,86 @@
+/*
+ * Copyright 2018 Florent Biville (@fbiville)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vcs_test
+
+import (
+	. "github.com/fbiville/headache/vcs"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"os"
+	"os/exec"
+)
+
+// old.txt is added in 2015, renamed to new.txt in 2017 and changed in 2018
+var _ = Describe("Rename policies", func() {
+
+	var (
+		workingDirectory string
+		repository       string
+	)
+
+	BeforeEach(func() {
+		if _, err := exec.LookPath("git"); err != nil {
+			Skip("git is not installed")
+		}
+		var err error
+		workingDirectory, err = os.Getwd()
+		Expect(err).NotTo(HaveOccurred())
+		repository, err = ioutil.TempDir("", "headache-rename-policies")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.Chdir(repository)).To(Succeed())
+
+		runGit("init", "-q")
+		writeFile("old.txt", "some contents\nspanning\nseveral lines\n")
+		commitAllAt("initial", "2015-06-01T12:00:00Z")
+		runGit("mv", "old.txt", "new.txt")
+		commitAllAt("rename", "2017-06-01T12:00:00Z")
+		writeFile("new.txt", "some contents\nspanning\nseveral lines\nand then some\n")
+		commitAllAt("change", "2018-06-01T12:00:00Z")
+	})
+
+	AfterEach(func() {
+		if repository == "" {
+			return
+		}
+		Expect(os.Chdir(workingDirectory)).To(Succeed())
+		Expect(os.RemoveAll(repository)).To(Succeed())
+	})
+
+	It("preserves the creation year of renamed files by default", func() {
+		history, err := GetFileHistory(&Git{}, "new.txt", FakeTime{}, HistoryOptions{MinYear: 1970, MaxYear: 2020})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(history.CreationYear).To(Equal(2015))
+		Expect(history.LastEditionYear).To(Equal(2018))
+	})
+
+	It("resets the creation year of renamed files to the rename year", func() {
+		options := HistoryOptions{MinYear: 1970, MaxYear: 2020, RenameResetsCreation: true}
+
+		history, err := GetFileHistory(&Git{}, "new.txt", FakeTime{}, options)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(history.CreationYear).To(Equal(2017))
+		Expect(history.LastEditionYear).To(Equal(2018))
+	})
+})
+
+func commitAllAt(message string, date string) {
+	runGit("add", "-A")
+	runGit("commit", "-q", "--no-gpg-sign", "--date", date, "-m", message)
+}
@@ -0,0 +1,94 @@
+/*
+ * Copyright 2018 Florent Biville (@fbiville)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vcs_test
+
+import (
+	. "github.com/fbiville/headache/vcs"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"os"
+	"os/exec"
+)
+
+// lib is added as a submodule along with a change to main.go, its pointer is then bumped
+var _ = Describe("Submodules", func() {
+
+	var (
+		workingDirectory string
+		library          string
+		repository       string
+	)
+
+	BeforeEach(func() {
+		if _, err := exec.LookPath("git"); err != nil {
+			Skip("git is not installed")
+		}
+		var err error
+		workingDirectory, err = os.Getwd()
+		Expect(err).NotTo(HaveOccurred())
+		library, err = ioutil.TempDir("", "headache-submodule")
+		Expect(err).NotTo(HaveOccurred())
+		repository, err = ioutil.TempDir("", "headache-superproject")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(os.Chdir(library)).To(Succeed())
+		runGit("init", "-q")
+		writeFile("lib.go", "package lib\n")
+		commitAll("initial")
+		writeFile("lib.go", "package lib\n\nconst Version = 2\n")
+		commitAll("version")
+
+		Expect(os.Chdir(repository)).To(Succeed())
+		runGit("init", "-q")
+		writeFile("main.go", "package main\n")
+		commitAll("initial")
+		runGit("-c", "protocol.file.allow=always", "submodule", "add", "-q", library, "lib")
+		writeFile("main.go", "package main\n\nfunc main() {}\n")
+		commitAll("add lib")
+	})
+
+	AfterEach(func() {
+		if repository == "" {
+			return
+		}
+		Expect(os.Chdir(workingDirectory)).To(Succeed())
+		Expect(os.RemoveAll(repository)).To(Succeed())
+		Expect(os.RemoveAll(library)).To(Succeed())
+	})
+
+	It("excludes added submodules from committed changes", func() {
+		changes, err := GetCommittedChanges(&Git{}, "HEAD~1", ChangeOptions{})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes).To(Equal([]FileChange{{Path: ".gitmodules"}, {Path: "main.go"}}))
+	})
+
+	It("excludes submodules whose pointer changed", func() {
+		runGit("-C", "lib", "checkout", "-q", "HEAD~1")
+		commitAll("downgrade lib")
+
+		committedChanges, err := GetCommittedChanges(&Git{}, "HEAD~1", ChangeOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(committedChanges).To(BeEmpty())
+
+		runGit("-C", "lib", "checkout", "-q", "-")
+		uncommittedChanges, err := GetUncommittedChanges(&Git{}, ChangeOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(uncommittedChanges).To(BeEmpty())
+	})
+})
@@ -0,0 +1,83 @@
+/*
+ * Copyright 2018 Florent Biville (@fbiville)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vcs_test
+
+import (
+	. "github.com/fbiville/headache/vcs"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"os"
+	"os/exec"
+)
+
+// link.go is a regular file turned into a symlink to target.go, file.go a symlink turned into a regular file
+var _ = Describe("Type changes", func() {
+
+	var (
+		workingDirectory string
+		repository       string
+	)
+
+	BeforeEach(func() {
+		if _, err := exec.LookPath("git"); err != nil {
+			Skip("git is not installed")
+		}
+		var err error
+		workingDirectory, err = os.Getwd()
+		Expect(err).NotTo(HaveOccurred())
+		repository, err = ioutil.TempDir("", "headache-type-changes")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.Chdir(repository)).To(Succeed())
+
+		runGit("init", "-q")
+		writeFile("target.go", "package target\n")
+		writeFile("link.go", "package link\n")
+		Expect(os.Symlink("target.go", "file.go")).To(Succeed())
+		commitAll("initial")
+		Expect(os.Remove("link.go")).To(Succeed())
+		Expect(os.Symlink("target.go", "link.go")).To(Succeed())
+		Expect(os.Remove("file.go")).To(Succeed())
+		writeFile("file.go", "package file\n")
+	})
+
+	AfterEach(func() {
+		if repository == "" {
+			return
+		}
+		Expect(os.Chdir(workingDirectory)).To(Succeed())
+		Expect(os.RemoveAll(repository)).To(Succeed())
+	})
+
+	It("excludes committed files turned into symlinks", func() {
+		commitAll("type changes")
+
+		changes, err := GetCommittedChanges(&Git{}, "HEAD~1", ChangeOptions{})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes).To(Equal([]FileChange{{Path: "file.go"}}))
+	})
+
+	It("excludes staged files turned into symlinks", func() {
+		runGit("add", "-A")
+
+		changes, err := GetStagedChanges(&Git{}, ChangeOptions{})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes).To(Equal([]FileChange{{Path: "file.go"}}))
+	})
+})
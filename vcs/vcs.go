@@ -17,6 +17,7 @@
 package vcs
 
 import (
+	"errors"
 	"fmt"
 	. "github.com/fbiville/headache/helper"
 	"os/exec"
@@ -28,18 +29,98 @@ import (
 type Vcs interface {
 	Status(args ...string) (string, error)
 	Diff(args ...string) (string, error)
+	Describe(args ...string) (string, error)
 	LatestRevision(file string) (string, error)
 	Log(args ...string) (string, error)
+	LsFiles(args ...string) (string, error)
 	ShowContentAtRevision(path string, revision string) (string, error)
 	Root() (string, error)
+	IsDetachedHead() (bool, error)
+	MergeBase(revision string) (string, error)
+	CurrentRef() (remote string, branch string, err error)
+	ConfigValue(key string) (string, error)
+	Version() (string, error)
+	IsShallow() (bool, error)
 }
 
-type Git struct{}
-func (*Git) Status(args ...string) (string, error) {
-	return git(PrependString("status", args)...)
+// IndexRevision designates the staged version of files
+const IndexRevision = ":"
+
+// Git runs git commands in Dir, or in the current directory if Dir is empty
+type Git struct {
+	Dir    string
+	Runner Runner // runs actual git commands if nil
+}
+
+// Runner runs the git command with the given arguments in the given directory and returns its standard output
+// failed commands are reported as *GitError
+type Runner func(dir string, args ...string) (string, error)
+
+type GitError struct {
+	Args     []string
+	ExitCode int
+	Stderr   string
+}
+
+func (err *GitError) Error() string {
+	return fmt.Sprintf("git %s failed with exit code %d\n\t%s", strings.Join(err.Args, " "), err.ExitCode, strings.TrimSpace(err.Stderr))
+}
+
+// common failures, see Cause
+var (
+	ErrNotARepository  = errors.New("not a repository")
+	ErrBadRevision     = errors.New("bad revision")
+	ErrFileNotTracked  = errors.New("file not tracked")
+	ErrVcsNotInstalled = errors.New("git is not installed")
+)
+
+var knownFailures = []struct {
+	stderrPattern string
+	cause         error
+}{
+	{"not a git repository", ErrNotARepository},
+	{"did not match any file(s) known to git", ErrFileNotTracked},
+	{"does not exist in", ErrFileNotTracked},
+	{"exists on disk, but not in", ErrFileNotTracked},
+	{"unknown revision", ErrBadRevision},
+	{"bad revision", ErrBadRevision},
+	{"not a valid object name", ErrBadRevision},
+	{"invalid object name", ErrBadRevision},
+	{"bad object", ErrBadRevision},
+}
+
+// Unwrap returns the common failure the error corresponds to, if any
+func (err *GitError) Unwrap() error {
+	stderr := strings.ToLower(err.Stderr)
+	for _, failure := range knownFailures {
+		if strings.Contains(stderr, failure.stderrPattern) {
+			return failure.cause
+		}
+	}
+	return nil
+}
+
+// Cause returns the common failure the error corresponds to, i.e. one of the Err* errors, or the error itself
+func Cause(err error) error {
+	if gitError, ok := err.(*GitError); ok {
+		if cause := gitError.Unwrap(); cause != nil {
+			return cause
+		}
+	}
+	return err
+}
+
+// forces UTF-8 author names and unquoted paths, whatever the commit encoding and the user configuration
+var outputEncodingArgs = []string{"-c", "i18n.logOutputEncoding=UTF-8", "-c", "core.quotepath=false"}
+
+func (g *Git) Status(args ...string) (string, error) {
+	return g.git(withOutputEncoding("status", args)...)
 }
-func (*Git) Diff(args ...string) (string, error) {
-	return git(PrependString("diff", args)...)
+func (g *Git) Diff(args ...string) (string, error) {
+	return g.git(withOutputEncoding("diff", args)...)
+}
+func (g *Git) Describe(args ...string) (string, error) {
+	return g.git(PrependString("describe", args)...)
 }
 func (g *Git) LatestRevision(file string) (string, error) {
 	result, err := g.Log("-1", `--format=%H`, "--", file)
@@ -48,34 +129,128 @@ func (g *Git) LatestRevision(file string) (string, error) {
 	}
 	return strings.Trim(result, "\n"), nil
 }
-func (*Git) Log(args ...string) (string, error) {
-	return git(PrependString("log", args)...)
+func (g *Git) Log(args ...string) (string, error) {
+	return g.git(withOutputEncoding("log", args)...)
+}
+func (g *Git) LsFiles(args ...string) (string, error) {
+	return g.git(PrependString("ls-files", args)...)
 }
-func (*Git) ShowContentAtRevision(path string, revision string) (string, error) {
+func (g *Git) ShowContentAtRevision(path string, revision string) (string, error) {
 	if revision == "" {
 		return "", nil
 	}
-	fullRevision, err := revParse(revision)
+	if revision == IndexRevision {
+		return g.git("show", IndexRevision+path)
+	}
+	fullRevision, err := g.revParse(revision)
 	if err != nil {
 		return "", err
 	}
 	fullRevision = strings.Trim(fullRevision, "\n")
-	return git("cat-file", "-p", fmt.Sprintf("%s:%s", fullRevision, path))
+	return g.git("cat-file", "-p", fmt.Sprintf("%s:%s", fullRevision, path))
+}
+func (g *Git) Root() (string, error) {
+	result, err := g.git("rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", err
+	}
+	return strings.Trim(result, "\n"), nil
+}
+
+func (g *Git) IsDetachedHead() (bool, error) {
+	_, err := g.git("symbolic-ref", "-q", "HEAD")
+	if gitError, ok := err.(*GitError); ok && gitError.ExitCode == 1 {
+		return true, nil
+	}
+	return false, err
 }
-func (*Git) Root() (string, error) {
-	result, err := git("rev-parse", "--show-toplevel")
+func (g *Git) MergeBase(revision string) (string, error) {
+	result, err := g.git("merge-base", "HEAD", revision)
 	if err != nil {
 		return "", err
 	}
 	return strings.Trim(result, "\n"), nil
 }
 
-func revParse(revision string) (string, error) {
-	return git("rev-parse", revision)
+// CurrentRef returns the remote and the remote branch tracked by the current branch
+// both are empty if HEAD is detached or if the current branch does not track any branch
+func (g *Git) CurrentRef() (string, string, error) {
+	ref, err := g.git("rev-parse", "--symbolic-full-name", "HEAD")
+	if err != nil {
+		return "", "", err
+	}
+	ref = strings.Trim(ref, "\n")
+	if !strings.HasPrefix(ref, "refs/heads/") {
+		return "", "", nil
+	}
+	upstream, err := g.git("for-each-ref", "--format=%(upstream:remotename)%00%(upstream:remoteref)", ref)
+	if err != nil {
+		return "", "", err
+	}
+	parts := strings.Split(strings.Trim(upstream, "\n"), "\x00")
+	if len(parts) != 2 || parts[0] == "" {
+		return "", "", nil
+	}
+	return parts[0], strings.TrimPrefix(parts[1], "refs/heads/"), nil
+}
+
+// ConfigValue returns the value of the git configuration key, or an empty string if it is not set
+func (g *Git) ConfigValue(key string) (string, error) {
+	value, err := g.git("config", "--get", key)
+	if gitError, ok := err.(*GitError); ok && gitError.ExitCode == 1 {
+		// git config exits with 1 when the key is not set
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(value), nil
+}
+
+// Version returns the version of git, e.g. 2.39.2
+func (g *Git) Version() (string, error) {
+	result, err := g.git("version")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(strings.TrimSpace(result), "git version "), nil
+}
+
+// IsShallow returns whether the repository is a shallow clone, i.e. whether part of its history is missing
+func (g *Git) IsShallow() (bool, error) {
+	result, err := g.git("rev-parse", "--is-shallow-repository")
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(result) == "true", nil
+}
+func (g *Git) revParse(revision string) (string, error) {
+	return g.git("rev-parse", revision)
 }
 
-func git(args ...string) (string, error) {
-	out, err := exec.Command("git", args...).Output()
+func withOutputEncoding(command string, args []string) []string {
+	result := append([]string{}, outputEncodingArgs...)
+	result = append(result, command)
+	return append(result, args...)
+}
+
+func (g *Git) git(args ...string) (string, error) {
+	if g.Runner != nil {
+		return g.Runner(g.Dir, args...)
+	}
+	return runGit(g.Dir, args...)
+}
+
+func runGit(dir string, args ...string) (string, error) {
+	command := exec.Command("git", args...)
+	command.Dir = dir
+	out, err := command.Output()
+	if execError, ok := err.(*exec.Error); ok && execError.Err == exec.ErrNotFound {
+		return "", ErrVcsNotInstalled
+	}
+	if exitError, ok := err.(*exec.ExitError); ok {
+		return "", &GitError{Args: args, ExitCode: exitError.ExitCode(), Stderr: string(exitError.Stderr)}
+	}
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,237 @@
+/*
+ * Copyright 2018 Florent Biville (@fbiville)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vcs_test
+
+import (
+	. "github.com/fbiville/headache/vcs"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"os"
+	"strings"
+)
+
+var _ = Describe("Git", func() {
+
+	var (
+		invocations []string
+		outputs     map[string]string
+		errors      map[string]error
+		git         *Git
+	)
+
+	BeforeEach(func() {
+		invocations = nil
+		outputs = make(map[string]string)
+		errors = make(map[string]error)
+		git = &Git{
+			Dir: "some/repository",
+			Runner: func(dir string, args ...string) (string, error) {
+				Expect(dir).To(Equal("some/repository"))
+				command := strings.Join(args, " ")
+				invocations = append(invocations, command)
+				return outputs[command], errors[command]
+			},
+		}
+	})
+
+	It("detects detached HEAD", func() {
+		errors["symbolic-ref -q HEAD"] = &GitError{Args: []string{"symbolic-ref", "-q", "HEAD"}, ExitCode: 1}
+
+		detached, err := git.IsDetachedHead()
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(detached).To(BeTrue())
+	})
+
+	It("detects attached HEAD", func() {
+		outputs["symbolic-ref -q HEAD"] = "refs/heads/master\n"
+
+		detached, err := git.IsDetachedHead()
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(detached).To(BeFalse())
+	})
+
+	It("fails to detect detached HEAD outside of repositories", func() {
+		errors["symbolic-ref -q HEAD"] = &GitError{
+			Args:     []string{"symbolic-ref", "-q", "HEAD"},
+			ExitCode: 128,
+			Stderr:   "fatal: not a git repository (or any of the parent directories): .git\n",
+		}
+
+		_, err := git.IsDetachedHead()
+
+		Expect(err).To(MatchError("git symbolic-ref -q HEAD failed with exit code 128\n\t" +
+			"fatal: not a git repository (or any of the parent directories): .git"))
+	})
+
+	It("resolves the merge base of HEAD and the given revision", func() {
+		outputs["merge-base HEAD origin/master"] = "cafebabe\n"
+
+		mergeBase, err := git.MergeBase("origin/master")
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(mergeBase).To(Equal("cafebabe"))
+		Expect(invocations).To(Equal([]string{"merge-base HEAD origin/master"}))
+	})
+
+	It("forces UTF-8 output and unquoted paths of log, diff and status commands", func() {
+		_, err := git.Log("--format=%an", "--", "café.go")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = git.Diff("--name-status", "-z", "HEAD~1..HEAD")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = git.Status("--porcelain", "-z")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(invocations).To(Equal([]string{
+			"-c i18n.logOutputEncoding=UTF-8 -c core.quotepath=false log --format=%an -- café.go",
+			"-c i18n.logOutputEncoding=UTF-8 -c core.quotepath=false diff --name-status -z HEAD~1..HEAD",
+			"-c i18n.logOutputEncoding=UTF-8 -c core.quotepath=false status --porcelain -z",
+		}))
+	})
+
+	It("forces UTF-8 output when retrieving the latest revision of a file", func() {
+		outputs["-c i18n.logOutputEncoding=UTF-8 -c core.quotepath=false log -1 --format=%H -- main.go"] = "cafebabe\n"
+
+		revision, err := git.LatestRevision("main.go")
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(revision).To(Equal("cafebabe"))
+	})
+
+	It("maps known failures to their cause", func() {
+		failures := map[string]error{
+			"fatal: not a git repository (or any of the parent directories): .git":                ErrNotARepository,
+			"fatal: bad revision 'nope..HEAD'":                                                    ErrBadRevision,
+			"fatal: ambiguous argument 'nope': unknown revision or path not in the working tree.": ErrBadRevision,
+			"fatal: Not a valid object name nope":                                                 ErrBadRevision,
+			"fatal: path 'missing.go' does not exist in 'HEAD'":                                   ErrFileNotTracked,
+			"fatal: path 'untracked.go' exists on disk, but not in 'HEAD'":                        ErrFileNotTracked,
+			"error: pathspec 'missing.go' did not match any file(s) known to git":                 ErrFileNotTracked,
+		}
+		for stderr, cause := range failures {
+			errors["merge-base HEAD nope"] = &GitError{Args: []string{"merge-base", "HEAD", "nope"}, ExitCode: 128, Stderr: stderr}
+
+			_, err := git.MergeBase("nope")
+
+			Expect(Cause(err)).To(Equal(cause), stderr)
+		}
+	})
+
+	It("reports git as not installed when it cannot be found", func() {
+		path := os.Getenv("PATH")
+		Expect(os.Setenv("PATH", "")).To(Succeed())
+		defer os.Setenv("PATH", path)
+
+		_, err := (&Git{}).MergeBase("HEAD")
+
+		Expect(err).To(Equal(ErrVcsNotInstalled))
+	})
+
+	It("keeps unknown failures as they are", func() {
+		gitError := &GitError{Args: []string{"log"}, ExitCode: 128, Stderr: "fatal: something unexpected"}
+
+		Expect(Cause(gitError)).To(Equal(gitError))
+	})
+
+	It("returns the remote and the branch tracked by the current branch", func() {
+		outputs["rev-parse --symbolic-full-name HEAD"] = "refs/heads/feature\n"
+		outputs["for-each-ref --format=%(upstream:remotename)%00%(upstream:remoteref) refs/heads/feature"] = "origin\x00refs/heads/main\n"
+
+		remote, branch, err := git.CurrentRef()
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(remote).To(Equal("origin"))
+		Expect(branch).To(Equal("main"))
+	})
+
+	It("returns no remote nor branch when the current branch does not track any branch", func() {
+		outputs["rev-parse --symbolic-full-name HEAD"] = "refs/heads/feature\n"
+		outputs["for-each-ref --format=%(upstream:remotename)%00%(upstream:remoteref) refs/heads/feature"] = "\x00\n"
+
+		remote, branch, err := git.CurrentRef()
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(remote).To(BeEmpty())
+		Expect(branch).To(BeEmpty())
+	})
+
+	It("returns no remote nor branch when HEAD is detached", func() {
+		outputs["rev-parse --symbolic-full-name HEAD"] = "HEAD\n"
+
+		remote, branch, err := git.CurrentRef()
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(remote).To(BeEmpty())
+		Expect(branch).To(BeEmpty())
+		Expect(invocations).To(Equal([]string{"rev-parse --symbolic-full-name HEAD"}))
+	})
+
+	It("reads git configuration values", func() {
+		outputs["config --get init.defaultBranch"] = "trunk\n"
+
+		value, err := git.ConfigValue("init.defaultBranch")
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(value).To(Equal("trunk"))
+	})
+
+	It("reads unset git configuration values as empty", func() {
+		errors["config --get checkout.defaultRemote"] = &GitError{Args: []string{"config", "--get", "checkout.defaultRemote"}, ExitCode: 1}
+
+		value, err := git.ConfigValue("checkout.defaultRemote")
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(value).To(BeEmpty())
+	})
+
+	It("fails to read git configuration values of invalid configurations", func() {
+		configError := &GitError{Args: []string{"config", "--get", "init.defaultBranch"}, ExitCode: 3, Stderr: "fatal: bad config line 1"}
+		errors["config --get init.defaultBranch"] = configError
+
+		_, err := git.ConfigValue("init.defaultBranch")
+
+		Expect(err).To(MatchError(configError))
+	})
+
+	It("returns the version of git", func() {
+		outputs["version"] = "git version 2.39.2\n"
+
+		version, err := git.Version()
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(version).To(Equal("2.39.2"))
+	})
+
+	It("detects shallow clones", func() {
+		outputs["rev-parse --is-shallow-repository"] = "true\n"
+
+		shallow, err := git.IsShallow()
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shallow).To(BeTrue())
+	})
+
+	It("detects complete clones", func() {
+		outputs["rev-parse --is-shallow-repository"] = "false\n"
+
+		shallow, err := git.IsShallow()
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shallow).To(BeFalse())
+	})
+})
@@ -19,30 +19,146 @@ package vcs
 import (
 	"fmt"
 	. "github.com/fbiville/headache/helper"
+	"log"
+	"path"
+	"regexp"
 	"strconv"
 	. "strings"
+	"sync"
 	"time"
 )
 
 type VersioningClient interface {
-	GetChanges(revision string) ([]FileChange, error)
-	AddMetadata(changes []FileChange, clock Clock) ([]FileChange, error)
+	GetChanges(revision string, options ChangeOptions) ([]FileChange, error)
+	AddMetadata(changes []FileChange, clock Clock, options HistoryOptions) ([]FileChange, error)
 	GetClient() Vcs
 }
 
 type Client struct {
-	Vcs Vcs
+	Vcs   Vcs
+	Bases *BaseCache // revisions are resolved by every git command if nil
+}
+
+// BaseCache resolves the revisions changes are computed from to commits, once per revision, so that successive change
+// computations rely on the same commits even if references move in the meantime
+type BaseCache struct {
+	mutex   sync.Mutex
+	commits map[string]string
+}
+
+// Resolve returns the hash of the commit the revision designates, as first resolved
+func (cache *BaseCache) Resolve(vcs Vcs, revision string) (string, error) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if commit, found := cache.commits[revision]; found {
+		return commit, nil
+	}
+	output, err := vcs.Log("-1", "--format=%H", revision)
+	if err != nil {
+		return "", err
+	}
+	if cache.commits == nil {
+		cache.commits = make(map[string]string)
+	}
+	commit := Trim(output, "\n")
+	cache.commits[revision] = commit
+	return commit, nil
 }
 
 type FileChange struct {
 	Path            string
+	DisplayPath     string // path exposed to templates and reports, if different from Path
 	CreationYear    int
 	LastEditionYear int
+	CreationTime    time.Time // of the earliest commit, whatever the years are adjusted to
+	LastEditionTime time.Time // of the latest commit, or of the last working tree edition if later
+}
+
+// GetDisplayPath returns the path to expose to templates and reports
+func (change FileChange) GetDisplayPath() string {
+	if change.DisplayPath != "" {
+		return change.DisplayPath
+	}
+	return change.Path
 }
 
 type FileHistory struct {
 	CreationYear    int
 	LastEditionYear int
+	CreationTime    time.Time // of the earliest commit, or the current time without commits
+	LastEditionTime time.Time // of the latest commit, or the current time without commits or when touched
+	Authors         []string  // distinct commit authors, from the latest to the earliest
+}
+
+type commit struct {
+	timestamp int64
+	author    string
+}
+
+// ChangeOptions tunes how changes are computed
+// zero values disable the corresponding behaviour
+type ChangeOptions struct {
+	RenameThreshold int  // similarity percentage above which files are considered renamed, git default if zero
+	CopyThreshold   int  // similarity percentage above which files are considered copied
+	Staged          bool // only staged changes are considered, regardless of the revision
+	// changes are computed from the merge base of the revision and HEAD, as in revision...HEAD, instead of from the
+	// revision itself, as in revision..HEAD (which is the same as diffing the two endpoints)
+	// in both cases, the changes of the base commit itself are not considered
+	MergeBase bool
+	// if set, only the changes also made on HEAD side since the merge base of this branch and HEAD are considered,
+	// so that the changes merged from this branch, as when a feature branch merges main, are left out
+	ForkPointBranch string
+	// only changes with one of these statuses (A, C, M, R or T, as reported by git diff) are considered, if any
+	// untracked files are considered added
+	Statuses []string
+	// committed changes of files whose contents are unchanged, only their mode, e.g. their executable bit, changing,
+	// are left out
+	ExcludeModeOnlyChanges bool
+	// only the committed changes adding lines, as reported by git diff --numstat, are considered, so that files only
+	// losing lines are left out
+	AddedLinesOnly bool
+	// if set, git only computes the changes under these paths, relative to the repository root, as in
+	// git diff -- services/payments, which saves parsing the changes of the rest of large repositories
+	Pathspecs []string
+}
+
+// DefaultMinYear is the earliest year of commits by default, commits dated at the Unix epoch being clamped to it as
+// they usually come from misconfigured clocks
+const DefaultMinYear = 1971
+
+// HistoryOptions tunes how file histories are computed
+// zero values disable the corresponding behaviour
+type HistoryOptions struct {
+	MinYear int  // years before this one are clamped to it
+	MaxYear int  // years after this one are clamped to it
+	Touch   bool // last edition years are set to the current year
+	// last edition years are the years of the earliest release tags containing the last commit of each file
+	// unreleased files keep their last commit year
+	ReleaseYears bool
+	// creation years are the years of the commits adding files under their current path, instead of following renames
+	RenameResetsCreation bool
+	// if set, last edition years are the years of the last commits since this revision
+	// files without such commits keep the year of their last commit
+	EditionRevision string
+	// if set, files with fewer commits than this get the creation year of the earliest commit of their directory, if
+	// it is earlier
+	DirectoryHistoryThreshold int
+	// if set, creation years are the years the files first appeared in the first-parent history of this branch, as when
+	// they got merged into it, files absent from it keep the year of their earliest commit
+	CreationBranch string
+	// if set, files whose contents at HEAD are identical to their contents at this revision, as when a rebase rewrote
+	// their commits, keep the year of their last commit reachable from it as last edition year
+	ReferenceRevision string
+	// if set, only the commits since this date, in any format git log --since accepts, are scanned for edition years
+	// and authors, which speeds lookups up in deep histories, creation years being looked up separately
+	// files without commits since then fall back to their whole history
+	Since string
+	// former paths of files, by current path, whose histories are followed as well, creation years being the earliest
+	// across all of them, which recovers origins that --follow misses in rename chains
+	FormerPaths map[string][]string
+	// if set, the commits whose author name matches this are left out of last edition years, as those of bots syncing
+	// vendored code, files only committed by such authors keeping their creation year
+	EditionExcludedAuthors *regexp.Regexp
 }
 
 const (
@@ -50,118 +166,747 @@ const (
 	duplicatedCopiedContents  = "C100"
 )
 
-func (client *Client) GetChanges(revision string) ([]FileChange, error) {
+func (client *Client) GetChanges(revision string, options ChangeOptions) ([]FileChange, error) {
 	vcs := client.Vcs
-	committedChanges, err := GetCommittedChanges(vcs, revision)
+	if options.Staged {
+		return GetStagedChanges(vcs, options)
+	}
+	revision, options, err := client.resolveBases(revision, options)
 	if err != nil {
 		return nil, err
 	}
-	uncommittedChanges, err := GetUncommittedChanges(vcs)
+	committedChanges, err := GetCommittedChanges(vcs, revision, options)
 	if err != nil {
 		return nil, err
 	}
-	return merge(committedChanges, uncommittedChanges), nil
+	uncommittedChanges, renamedPaths, err := getUncommittedChanges(vcs, options)
+	if err != nil {
+		return nil, err
+	}
+	return merge(withoutRenamedPaths(committedChanges, renamedPaths), uncommittedChanges), nil
+}
+
+func (client *Client) resolveBases(revision string, options ChangeOptions) (string, ChangeOptions, error) {
+	if client.Bases == nil {
+		return revision, options, nil
+	}
+	var err error
+	if revision != "" {
+		revision, err = client.Bases.Resolve(client.Vcs, revision)
+		if err != nil {
+			return "", options, err
+		}
+	}
+	if options.ForkPointBranch != "" {
+		options.ForkPointBranch, err = client.Bases.Resolve(client.Vcs, options.ForkPointBranch)
+		if err != nil {
+			return "", options, err
+		}
+	}
+	return revision, options, nil
 }
 
-func (client *Client) AddMetadata(changes []FileChange, clock Clock) ([]FileChange, error) {
+// AddMetadata sets the copyright years of every change it can compute the history of
+// failures do not stop the other files from being processed, they are returned together as a *MultiError, along with
+// the changes, the failing ones being left as they are
+func (client *Client) AddMetadata(changes []FileChange, clock Clock, options HistoryOptions) ([]FileChange, error) {
+	failures := &MultiError{}
 	for i, change := range changes {
-		history, err := GetFileHistory(client.Vcs, change.Path, clock)
+		history, err := GetFileHistory(client.Vcs, change.Path, clock, options)
 		if err != nil {
-			return nil, err
+			failures.add(change.Path, err)
+			continue
 		}
 		change.CreationYear = history.CreationYear
 		change.LastEditionYear = history.LastEditionYear
+		change.CreationTime = history.CreationTime
+		change.LastEditionTime = history.LastEditionTime
 		changes[i] = change
 	}
-	return changes, nil
+	return changes, failures.orNil()
 }
 
 func (client *Client) GetClient() Vcs {
 	return client.Vcs
 }
 
-func GetCommittedChanges(vcs Vcs, revision string) ([]FileChange, error) {
-	revisions := fmt.Sprintf("%s..HEAD", revision)
-	output, err := vcs.Diff("--name-status", revisions)
+func GetCommittedChanges(vcs Vcs, revision string, options ChangeOptions) ([]FileChange, error) {
+	rangeSeparator := ".."
+	if options.MergeBase {
+		rangeSeparator = "..."
+	}
+	revisionRange := fmt.Sprintf("%s%sHEAD", revision, rangeSeparator)
+	output, err := vcs.Diff(withPathspecs(append(diffArgs(options), revisionRange), options)...)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := parseDiff(vcs, output, options)
 	if err != nil {
 		return nil, err
 	}
+	if options.AddedLinesOnly {
+		changes, err = keepAddingChanges(vcs, changes, revisionRange, options)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if options.ForkPointBranch == "" {
+		return changes, nil
+	}
+	output, err = vcs.Diff(withPathspecs(append(diffArgs(options), fmt.Sprintf("%s...HEAD", options.ForkPointBranch)), options)...)
+	if err != nil {
+		return nil, err
+	}
+	forkPointChanges, err := parseDiff(vcs, output, options)
+	if err != nil {
+		return nil, err
+	}
+	return keepChangedPaths(changes, forkPointChanges), nil
+}
+
+// Difference returns the changes whose path is not among the previous changes, in their original order, as when only
+// reporting the files which became non-compliant since a previous check
+func Difference(changes []FileChange, previousChanges []FileChange) []FileChange {
+	paths := make(map[string]struct{}, len(previousChanges))
+	for _, change := range previousChanges {
+		paths[change.Path] = struct{}{}
+	}
+	result := make([]FileChange, 0, len(changes))
+	for _, change := range changes {
+		if _, found := paths[change.Path]; !found {
+			result = append(result, change)
+		}
+	}
+	return result
+}
+
+// keeps the changes adding lines in the revision range
+// numstat records are made of the added and deleted line counts and the path, separated by tabs, the path being empty
+// for renames and copies, followed by the source and destination paths as separate records
+// binary files, whose line counts are reported as -, are kept
+func keepAddingChanges(vcs Vcs, changes []FileChange, revisionRange string, options ChangeOptions) ([]FileChange, error) {
+	args := []string{"--numstat", "-z", "--ignore-submodules"}
+	if options.RenameThreshold != 0 {
+		args = append(args, fmt.Sprintf("-M%d%%", options.RenameThreshold))
+	}
+	if options.CopyThreshold != 0 {
+		args = append(args, fmt.Sprintf("-C%d%%", options.CopyThreshold))
+	}
+	output, err := vcs.Diff(withPathspecs(append(args, revisionRange), options)...)
+	if err != nil {
+		return nil, err
+	}
+	addingChanges := make([]FileChange, 0)
+	fields := Split(output, "\x00")
+	for i := 0; i < len(fields); i++ {
+		counts := SplitN(fields[i], "\t", 3)
+		if len(counts) != 3 {
+			// trailing terminator
+			continue
+		}
+		path := counts[2]
+		if path == "" {
+			i += 2
+			if i >= len(fields) {
+				break
+			}
+			path = fields[i]
+		}
+		if counts[0] != "0" {
+			addingChanges = append(addingChanges, FileChange{Path: path})
+		}
+	}
+	return keepChangedPaths(changes, addingChanges), nil
+}
+
+// keeps the changes whose path is among the other changes
+func keepChangedPaths(changes []FileChange, otherChanges []FileChange) []FileChange {
+	paths := make(map[string]struct{}, len(otherChanges))
+	for _, change := range otherChanges {
+		paths[change.Path] = struct{}{}
+	}
+	result := make([]FileChange, 0, len(changes))
+	for _, change := range changes {
+		if _, found := paths[change.Path]; found {
+			result = append(result, change)
+		}
+	}
+	return result
+}
+
+func GetStagedChanges(vcs Vcs, options ChangeOptions) ([]FileChange, error) {
+	output, err := vcs.Diff(withPathspecs(append(diffArgs(options), "--cached"), options)...)
+	if err != nil {
+		return nil, err
+	}
+	return parseDiff(vcs, output, options)
+}
+
+// ChangesForPaths returns the changes of the given files along with their copyright years, whether they changed or not
+// the years of files of nested repositories come from their own root when the client is a MultiRootClient
+func ChangesForPaths(client VersioningClient, paths []string, clock Clock, options HistoryOptions) ([]FileChange, error) {
+	changes := make([]FileChange, len(paths))
+	for i, file := range paths {
+		changes[i] = FileChange{Path: file}
+	}
+	return client.AddMetadata(changes, clock, options)
+}
+
+// ChangesInCommits returns the files changed by any of the given commits, or commit ranges such as base..head, as when
+// only verifying what a pull request touched
+// commits are compared to their first parent, root commits to the empty tree
+func ChangesInCommits(vcs Vcs, commits []string, options ChangeOptions) ([]FileChange, error) {
 	result := make([]FileChange, 0)
-	for _, line := range Split(output, "\n") {
-		if line == "" {
+	for _, commit := range commits {
+		revisions := []string{commit}
+		if !Contains(commit, "..") {
+			parents, err := vcs.Log("-1", "--format=%P", commit)
+			if err != nil {
+				return nil, err
+			}
+			parent := emptyTreeRevision
+			if fields := Fields(parents); len(fields) > 0 {
+				parent = fields[0]
+			}
+			revisions = []string{parent, commit}
+		}
+		output, err := vcs.Diff(append(diffArgs(options), revisions...)...)
+		if err != nil {
+			return nil, err
+		}
+		changes, err := parseDiff(vcs, output, options)
+		if err != nil {
+			return nil, err
+		}
+		result = merge(result, changes)
+	}
+	return result, nil
+}
+
+// GetTrackedFiles returns all the files tracked by the repository, whether they changed or not
+func GetTrackedFiles(vcs Vcs) ([]FileChange, error) {
+	output, err := vcs.LsFiles("-z")
+	if err != nil {
+		return nil, err
+	}
+	result := make([]FileChange, 0)
+	for _, path := range Split(output, "\x00") {
+		if path != "" {
+			result = append(result, FileChange{Path: path})
+		}
+	}
+	return result, nil
+}
+
+// submodules are excluded, their paths are not files
+func diffArgs(options ChangeOptions) []string {
+	args := []string{"--name-status", "-z", "--ignore-submodules"}
+	if options.ExcludeModeOnlyChanges {
+		// only raw records tell mode changes apart from content changes
+		args = []string{"--raw", "--no-abbrev", "-z", "--ignore-submodules"}
+	}
+	if options.RenameThreshold != 0 {
+		args = append(args, fmt.Sprintf("-M%d%%", options.RenameThreshold))
+	}
+	if options.CopyThreshold != 0 {
+		args = append(args, fmt.Sprintf("-C%d%%", options.CopyThreshold))
+	}
+	return args
+}
+
+// appends the pathspecs, if any, after the separator telling them apart from revisions
+func withPathspecs(args []string, options ChangeOptions) []string {
+	if len(options.Pathspecs) == 0 {
+		return args
+	}
+	return append(append(args, "--"), options.Pathspecs...)
+}
+
+// parses the output of a diff run with diffArgs
+func parseDiff(vcs Vcs, output string, options ChangeOptions) ([]FileChange, error) {
+	if options.ExcludeModeOnlyChanges {
+		output = nameStatusOfRaw(output)
+	}
+	return parseNameStatus(vcs, output, options)
+}
+
+// turns raw records into name-status ones, leaving out those of mode-only changes
+// raw records start with the old and new modes, the old and new object names and the status, as in
+// :100644 100755 <object> <object> M, followed by the paths
+func nameStatusOfRaw(output string) string {
+	fields := Split(output, "\x00")
+	result := make([]string, 0, len(fields))
+	for i := 0; i < len(fields); i++ {
+		header := Fields(TrimPrefix(fields[i], ":"))
+		if len(header) != 5 {
+			// trailing terminator
+			continue
+		}
+		status := header[4]
+		pathCount := 1
+		if HasPrefix(status, "R") || HasPrefix(status, "C") {
+			pathCount = 2
+		}
+		if status == "M" && header[0] != header[1] && header[2] == header[3] {
+			i += pathCount
 			continue
 		}
-		statusName := SplitN(line, "\t", 2)
-		status := Trim(statusName[0], " ")
+		result = append(result, status)
+		for j := 0; j < pathCount && i+1 < len(fields); j++ {
+			i++
+			result = append(result, fields[i])
+		}
+	}
+	return Join(result, "\x00")
+}
+
+// parses NUL-terminated records, so that paths never need unquoting
+// renames and copies are followed by both the source and the destination paths
+func parseNameStatus(vcs Vcs, output string, options ChangeOptions) ([]FileChange, error) {
+	result := make([]FileChange, 0)
+	fields := Split(output, "\x00")
+	for i := 0; i < len(fields); i++ {
+		status := fields[i]
 		switch {
+		case status == "":
+			// trailing terminator
 		case status == "D":
-			// ignore
-		case HasPrefix(status, "R"):
-			statusName := SplitN(line, "\t", 3)
-			result = append(result, FileChange{
-				Path: Trim(statusName[2], " "),
-			})
+			i++
+		case status == "T":
+			// files turning into symlinks cannot get a header, written headers would end up in their target
+			i++
+			if i >= len(fields) || !isStatusAllowed(status, options) {
+				continue
+			}
+			symlink, err := isSymlink(vcs, fields[i])
+			if err != nil {
+				return nil, err
+			}
+			if !symlink {
+				result = append(result, FileChange{Path: fields[i]})
+			}
+		case HasPrefix(status, "R") || HasPrefix(status, "C"):
+			i += 2
+			if i < len(fields) && isStatusAllowed(status[:1], options) {
+				result = append(result, FileChange{Path: fields[i]})
+			}
 		default:
-			result = append(result, FileChange{
-				Path: Trim(statusName[1], " "),
-			})
+			i++
+			if i < len(fields) && isStatusAllowed(status, options) {
+				result = append(result, FileChange{Path: fields[i]})
+			}
 		}
 	}
 	return result, nil
 }
 
-func GetUncommittedChanges(vcs Vcs) ([]FileChange, error) {
-	output, err := vcs.Status("--porcelain")
+const symlinkMode = "120000"
+
+// returns whether the file is staged as a symlink, the index being synchronized with HEAD outside of staged changes
+// ls-files records are made of the mode, the object name and the stage separated by spaces, then a tab and the path
+func isSymlink(vcs Vcs, file string) (bool, error) {
+	output, err := vcs.LsFiles("-s", "-z", "--", file)
 	if err != nil {
-		return nil, err
+		return false, err
 	}
-	result := make([]FileChange, 0)
-	if output == "" {
-		return result, nil
+	return HasPrefix(output, symlinkMode+" "), nil
+}
+
+// parses NUL-terminated porcelain records made of a two-letter status, a space and the path
+// renames and copies are followed by an extra record holding the source path
+func GetUncommittedChanges(vcs Vcs, options ChangeOptions) ([]FileChange, error) {
+	changes, _, err := getUncommittedChanges(vcs, options)
+	return changes, err
+}
+
+// returns the uncommitted changes, under their destination path if renamed, along with the source paths of renames
+// files renamed in the index and modified in the working tree, reported as RM, yield a single change
+func getUncommittedChanges(vcs Vcs, options ChangeOptions) ([]FileChange, map[string]struct{}, error) {
+	output, err := vcs.Status(withPathspecs([]string{"--porcelain", "-z", "--ignore-submodules"}, options)...)
+	if err != nil {
+		return nil, nil, err
 	}
-	for _, line := range Split(output, "\n") {
-		if line == "" {
+	result := make([]FileChange, 0)
+	renamedPaths := make(map[string]struct{})
+	records := Split(output, "\x00")
+	for i := 0; i < len(records); i++ {
+		record := records[i]
+		if len(record) < 4 {
 			continue
 		}
-		statusName := SplitN(Trim(line, " "), " ", 2)
-		statuses := Trim(statusName[0], " ")
-		if Index(statuses, "D") != -1 {
+		statuses := record[:2]
+		if ContainsAny(statuses, "RC") {
+			// the source path comes as the next record
+			i++
+			if Contains(statuses, "R") && i < len(records) {
+				renamedPaths[records[i]] = struct{}{}
+			}
+		}
+		if Index(statuses, "D") != -1 || !isAnyStatusAllowed(statuses, options) {
 			continue
 		}
 		result = append(result, FileChange{
-			Path: Trim(statusName[1], " "),
+			Path: record[3:],
 		})
 	}
-	return result, nil
+	return result, renamedPaths, nil
 }
 
-func GetFileHistory(vcs Vcs, file string, clock Clock) (*FileHistory, error) {
-	output, err := vcs.Log("--follow", "--name-status", "--format=%at", "--", file)
-	if err != nil {
-		return nil, err
+// the committed changes of files renamed since are left out, their uncommitted changes being reported under their
+// destination path instead
+func withoutRenamedPaths(changes []FileChange, renamedPaths map[string]struct{}) []FileChange {
+	if len(renamedPaths) == 0 {
+		return changes
+	}
+	result := make([]FileChange, 0, len(changes))
+	for _, change := range changes {
+		if _, renamed := renamedPaths[change.Path]; !renamed {
+			result = append(result, change)
+		}
+	}
+	return result
+}
+
+func isStatusAllowed(status string, options ChangeOptions) bool {
+	if len(options.Statuses) == 0 {
+		return true
+	}
+	for _, allowedStatus := range options.Statuses {
+		if status == allowedStatus {
+			return true
+		}
+	}
+	return false
+}
+
+// porcelain statuses are made of the index and the working tree statuses
+func isAnyStatusAllowed(statuses string, options ChangeOptions) bool {
+	if statuses == "??" {
+		return isStatusAllowed("A", options)
 	}
-	timestamps, err := getCommitTimestamps(file, output)
+	for _, status := range Replace(statuses, " ", "", -1) {
+		if isStatusAllowed(string(status), options) {
+			return true
+		}
+	}
+	return false
+}
+
+func GetFileHistory(vcs Vcs, file string, clock Clock, options HistoryOptions) (*FileHistory, error) {
+	// authors are canonicalized with the mailmap, if any
+	args := []string{"--name-status", "--use-mailmap", "--format=%at%x00%aN", "--", file}
+	if !options.RenameResetsCreation {
+		args = append([]string{"--follow"}, args...)
+	}
+	commits, err := getBoundedCommits(vcs, file, args, options.Since)
 	if err != nil {
 		return nil, err
 	}
-	defaultYear := clock.Now().Year()
+	now := clock.Now()
+	defaultYear := now.Year()
 	history := FileHistory{
 		CreationYear:    defaultYear,
 		LastEditionYear: defaultYear,
+		CreationTime:    now,
+		LastEditionTime: now,
 	}
 
-	if len(timestamps) > 0 {
-		minTimestamp := timestamps[len(timestamps)-1]
-		maxTimestamp := timestamps[0]
-		history.CreationYear = time.Unix(minTimestamp, 0).Year()
-		history.LastEditionYear = time.Unix(maxTimestamp, 0).Year()
-	}
+	history.Authors = distinctAuthors(commits)
 
+	if len(commits) > 0 {
+		minTimestamp := commits[len(commits)-1].timestamp
+		maxTimestamp := latestEditionTimestamp(commits, options.EditionExcludedAuthors)
+		history.CreationTime = time.Unix(minTimestamp, 0)
+		history.LastEditionTime = time.Unix(maxTimestamp, 0)
+		history.CreationYear = history.CreationTime.Year()
+		history.LastEditionYear = history.LastEditionTime.Year()
+		if options.Since != "" {
+			creationYear, err := getAdditionYear(vcs, file, options.RenameResetsCreation)
+			if err != nil {
+				return nil, err
+			}
+			if creationYear != 0 && creationYear < history.CreationYear {
+				history.CreationYear = creationYear
+			}
+		}
+		if formerPaths := options.FormerPaths[file]; len(formerPaths) > 0 {
+			formerYear, err := getFormerPathsCreationYear(vcs, formerPaths, options.RenameResetsCreation)
+			if err != nil {
+				return nil, err
+			}
+			if formerYear != 0 && formerYear < history.CreationYear {
+				history.CreationYear = formerYear
+			}
+		}
+		if len(commits) < options.DirectoryHistoryThreshold {
+			directoryYear, err := getDirectoryCreationYear(vcs, file)
+			if err != nil {
+				return nil, err
+			}
+			if directoryYear != 0 && directoryYear < history.CreationYear {
+				history.CreationYear = directoryYear
+			}
+		}
+		if options.CreationBranch != "" {
+			branchYear, err := getFirstSeenYear(vcs, file, options.CreationBranch)
+			if err != nil {
+				return nil, err
+			}
+			if branchYear != 0 {
+				history.CreationYear = branchYear
+			}
+			// files authored before being merged were last edited on the branch no earlier than when they appeared
+			if history.LastEditionYear < history.CreationYear {
+				history.LastEditionYear = history.CreationYear
+			}
+		}
+		if options.EditionRevision != "" {
+			editionYear, err := getEditionYearSince(vcs, file, options.EditionRevision)
+			if err != nil {
+				return nil, err
+			}
+			if editionYear != 0 {
+				history.LastEditionYear = editionYear
+			}
+		}
+		if options.ReferenceRevision != "" {
+			referenceYear, err := getUnchangedEditionYear(vcs, file, options.ReferenceRevision)
+			if err != nil {
+				return nil, err
+			}
+			if referenceYear != 0 {
+				history.LastEditionYear = referenceYear
+			}
+		}
+		if options.ReleaseYears {
+			releaseYear, err := getReleaseYear(vcs, file)
+			if err != nil {
+				return nil, err
+			}
+			if releaseYear != 0 {
+				history.LastEditionYear = releaseYear
+			}
+		}
+	}
+	if options.Touch {
+		history.LastEditionYear = defaultYear
+		history.LastEditionTime = now
+	}
+	history.CreationYear = clampYear(file, history.CreationYear, options)
+	history.LastEditionYear = clampYear(file, history.LastEditionYear, options)
 	return &history, nil
 }
 
-func getCommitTimestamps(file string, log string) ([]int64, error) {
-	var result []int64
+// returns the commits of the file since the given date, if any, all of them otherwise
+func getBoundedCommits(vcs Vcs, file string, args []string, since string) ([]commit, error) {
+	if since != "" {
+		output, err := vcs.Log(append([]string{"--since=" + since}, args...)...)
+		if err != nil {
+			return nil, err
+		}
+		commits, err := getCommits(file, output)
+		if err != nil || len(commits) > 0 {
+			return commits, err
+		}
+	}
+	output, err := vcs.Log(args...)
+	if err != nil {
+		return nil, err
+	}
+	return getCommits(file, output)
+}
+
+// returns the year of the earliest commit adding the file, or 0 if there is none
+// only the commits adding files are printed, which is cheaper than listing the whole history
+func getAdditionYear(vcs Vcs, file string, renameResetsCreation bool) (int, error) {
+	args := []string{"--diff-filter=A", "--format=%at", "--", file}
+	if !renameResetsCreation {
+		args = append([]string{"--follow"}, args...)
+	}
+	output, err := vcs.Log(args...)
+	if err != nil {
+		return 0, err
+	}
+	minTimestamp := int64(0)
+	for _, line := range Split(output, "\n") {
+		if line == "" {
+			continue
+		}
+		timestamp, err := strconv.ParseInt(line, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("could not parse timestamp of file %q additions\n\t%v", file, err)
+		}
+		if minTimestamp == 0 || timestamp < minTimestamp {
+			minTimestamp = timestamp
+		}
+	}
+	if minTimestamp == 0 {
+		return 0, nil
+	}
+	return time.Unix(minTimestamp, 0).Year(), nil
+}
+
+// returns the earliest year any of the paths got added, or 0 if none of them ever was
+func getFormerPathsCreationYear(vcs Vcs, paths []string, renameResetsCreation bool) (int, error) {
+	result := 0
+	for _, path := range paths {
+		year, err := getAdditionYear(vcs, path, renameResetsCreation)
+		if err != nil {
+			return 0, err
+		}
+		if year != 0 && (result == 0 || year < result) {
+			result = year
+		}
+	}
+	return result, nil
+}
+
+// returns the year of the earliest commit of the directory containing the file, or 0 if there is none
+func getDirectoryCreationYear(vcs Vcs, file string) (int, error) {
+	directory := path.Dir(file)
+	output, err := vcs.Log("--format=%at", "--", directory)
+	if err != nil {
+		return 0, err
+	}
+	minTimestamp := int64(0)
+	for _, line := range Split(output, "\n") {
+		if line == "" {
+			continue
+		}
+		timestamp, err := strconv.ParseInt(line, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("could not parse timestamp of directory %q commits\n\t%v", directory, err)
+		}
+		if minTimestamp == 0 || timestamp < minTimestamp {
+			minTimestamp = timestamp
+		}
+	}
+	if minTimestamp == 0 {
+		return 0, nil
+	}
+	return time.Unix(minTimestamp, 0).Year(), nil
+}
+
+// returns the year of the earliest first-parent commit of the branch adding the file, or 0 if there is none
+// commit dates are used rather than author dates, which predate merges
+func getFirstSeenYear(vcs Vcs, file string, branch string) (int, error) {
+	output, err := vcs.Log("--first-parent", "--diff-filter=A", "--format=%ct", branch, "--", file)
+	if err != nil {
+		return 0, err
+	}
+	minTimestamp := int64(0)
+	for _, line := range Split(output, "\n") {
+		if line == "" {
+			continue
+		}
+		timestamp, err := strconv.ParseInt(line, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("could not parse timestamp of file %q commits on branch %s\n\t%v", file, branch, err)
+		}
+		if minTimestamp == 0 || timestamp < minTimestamp {
+			minTimestamp = timestamp
+		}
+	}
+	if minTimestamp == 0 {
+		return 0, nil
+	}
+	return time.Unix(minTimestamp, 0).Year(), nil
+}
+
+// returns the year of the latest commit of the file reachable from HEAD but not from the revision, or 0 if there is none
+func getEditionYearSince(vcs Vcs, file string, revision string) (int, error) {
+	output, err := vcs.Log("--format=%at", revision+"..HEAD", "--", file)
+	if err != nil {
+		return 0, err
+	}
+	maxTimestamp := int64(0)
+	for _, line := range Split(output, "\n") {
+		if line == "" {
+			continue
+		}
+		timestamp, err := strconv.ParseInt(line, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("could not parse timestamp of file %q commits since %s\n\t%v", file, revision, err)
+		}
+		if timestamp > maxTimestamp {
+			maxTimestamp = timestamp
+		}
+	}
+	if maxTimestamp == 0 {
+		return 0, nil
+	}
+	return time.Unix(maxTimestamp, 0).Year(), nil
+}
+
+// returns the year of the latest commit of the file reachable from the revision if its contents did not change since,
+// or 0 otherwise
+func getUnchangedEditionYear(vcs Vcs, file string, revision string) (int, error) {
+	referenceContents, err := vcs.ShowContentAtRevision(file, revision)
+	if err != nil {
+		// most likely, the file did not exist at that revision
+		return 0, nil
+	}
+	currentContents, err := vcs.ShowContentAtRevision(file, "HEAD")
+	if err != nil || currentContents != referenceContents {
+		return 0, nil
+	}
+	output, err := vcs.Log("-1", "--format=%at", revision, "--", file)
+	if err != nil {
+		return 0, err
+	}
+	if Trim(output, "\n") == "" {
+		return 0, nil
+	}
+	timestamp, err := strconv.ParseInt(Trim(output, "\n"), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("could not parse timestamp of file %q commits at %s\n\t%v", file, revision, err)
+	}
+	return time.Unix(timestamp, 0).Year(), nil
+}
+
+// returns the year of the earliest tag containing the last commit of the file, or 0 if no tag contains it
+func getReleaseYear(vcs Vcs, file string) (int, error) {
+	revision, err := vcs.LatestRevision(file)
+	if err != nil {
+		return 0, err
+	}
+	description, err := vcs.Describe("--contains", "--tags", revision)
+	if err != nil {
+		// git fails to describe commits that have not been released yet
+		return 0, nil
+	}
+	// descriptions look like v1.2.0~3 or v1.2.0^2~1, the tag name being everything before the suffix
+	tag := Trim(description, "\n")
+	if end := IndexAny(tag, "~^"); end != -1 {
+		tag = tag[:end]
+	}
+	output, err := vcs.Log("-1", "--format=%at", tag)
+	if err != nil {
+		return 0, err
+	}
+	timestamp, err := strconv.ParseInt(Trim(output, "\n"), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("could not parse timestamp of tag %q for file %q\n\t%v", tag, file, err)
+	}
+	return time.Unix(timestamp, 0).Year(), nil
+}
+
+func clampYear(file string, year int, options HistoryOptions) int {
+	if options.MinYear != 0 && year < options.MinYear {
+		log.Printf("headache warning, year %d of file %q history is before %d, using %d instead", year, file, options.MinYear, options.MinYear)
+		return options.MinYear
+	}
+	if options.MaxYear != 0 && year > options.MaxYear {
+		log.Printf("headache warning, year %d of file %q history is after %d, using %d instead", year, file, options.MaxYear, options.MaxYear)
+		return options.MaxYear
+	}
+	return year
+}
+
+// parses commits formatted as the timestamp and the author name separated by NUL, each followed by the file status
+// the author name is read verbatim, up to the end of the line
+func getCommits(file string, log string) ([]commit, error) {
+	var result []commit
 	lines := Split(Replace(log, "\n\n", "\n", -1), "\n")
 	lines = lines[0 : len(lines)-1]
 	for i := 1; i < len(lines); i += 2 {
@@ -170,17 +915,80 @@ func getCommitTimestamps(file string, log string) ([]int64, error) {
 		if nameStatus == duplicatedRenamedContents || nameStatus == duplicatedCopiedContents {
 			continue
 		}
-		timestamp, err := strconv.ParseInt(lines[i-1], 10, 64)
+		fields := SplitN(lines[i-1], "\x00", 2)
+		timestamp, err := strconv.ParseInt(fields[0], 10, 64)
 		if err != nil {
 			errorMsg := "could not parse timestamp (line %d) of file %q history. Full commit log below\n%s"
 			return nil, fmt.Errorf(errorMsg, i, file, log)
 		}
-		result = append(result, timestamp)
+		author := ""
+		if len(fields) > 1 {
+			author = fields[1]
+		}
+		result = append(result, commit{timestamp: timestamp, author: author})
 	}
 	return result, nil
 }
 
+// returns the timestamp of the latest commit whose author is not excluded, or of the earliest commit if there is none
+func latestEditionTimestamp(commits []commit, excludedAuthors *regexp.Regexp) int64 {
+	for _, fileCommit := range commits {
+		if excludedAuthors == nil || !excludedAuthors.MatchString(fileCommit.author) {
+			return fileCommit.timestamp
+		}
+	}
+	return commits[len(commits)-1].timestamp
+}
+
+func distinctAuthors(commits []commit) []string {
+	result := make([]string, 0)
+	seenAuthors := make(map[string]struct{})
+	for _, fileCommit := range commits {
+		author := fileCommit.author
+		if _, seen := seenAuthors[author]; seen || author == "" {
+			continue
+		}
+		seenAuthors[author] = struct{}{}
+		result = append(result, author)
+	}
+	return result
+}
+
+// below this number of changes, a linear scan is cheaper than allocating a set
+const smallChangeSetThreshold = 8
+
 func merge(changes []FileChange, changes2 []FileChange) []FileChange {
+	if len(changes)+len(changes2) <= smallChangeSetThreshold {
+		return mergeSmall(changes, changes2)
+	}
+	return mergeLarge(changes, changes2)
+}
+
+func mergeSmall(changes []FileChange, changes2 []FileChange) []FileChange {
+	result := make([]FileChange, 0, len(changes)+len(changes2))
+	for _, change := range changes {
+		if !contains(result, change) {
+			result = append(result, change)
+		}
+	}
+	for _, change := range changes2 {
+		if !contains(result, change) {
+			result = append(result, change)
+		}
+	}
+	return result
+}
+
+func contains(changes []FileChange, change FileChange) bool {
+	for _, existingChange := range changes {
+		if existingChange == change {
+			return true
+		}
+	}
+	return false
+}
+
+func mergeLarge(changes []FileChange, changes2 []FileChange) []FileChange {
 	set := make(map[FileChange]struct{}, len(changes))
 	for _, change := range changes {
 		set[change] = struct{}{}
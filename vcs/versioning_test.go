@@ -17,10 +17,12 @@
 package vcs_test
 
 import (
+	"errors"
 	. "github.com/fbiville/headache/vcs"
 	"github.com/fbiville/headache/vcs_mocks"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"regexp"
 	"time"
 )
 
@@ -44,15 +46,14 @@ var _ = Describe("VCS", func() {
 	})
 
 	It("retrieves committed changes", func() {
-		vcsMock.On("Diff", "--name-status", "origin/master..HEAD").Return(`M	.gitignore
-M	configuration.go
-D	header.go
-D	header_test.go
-R099	line_comment.go	core/line_comment.go
-A	license-header.txt
-`, nil)
+		vcsMock.On("Diff", "--name-status", "-z", "--ignore-submodules", "origin/master..HEAD").Return("M\x00.gitignore\x00"+
+			"M\x00configuration.go\x00"+
+			"D\x00header.go\x00"+
+			"D\x00header_test.go\x00"+
+			"R099\x00line_comment.go\x00core/line_comment.go\x00"+
+			"A\x00license-header.txt\x00", nil)
 
-		changes, err := GetCommittedChanges(vcs, "origin/master")
+		changes, err := GetCommittedChanges(vcs, "origin/master", ChangeOptions{})
 
 		Expect(err).To(BeNil())
 		Expect(changes).To(Equal([]FileChange{
@@ -63,14 +64,126 @@ A	license-header.txt
 		}))
 	})
 
+	It("retrieves committed changes with configured rename and copy detection thresholds", func() {
+		vcsMock.On("Diff", "--name-status", "-z", "--ignore-submodules", "-M40%", "-C80%", "origin/master..HEAD").Return("R042\x00licence.go\x00license.go\x00"+
+			"C085\x00core/header.go\x00core/header_copy.go\x00"+
+			"M\x00main.go\x00", nil)
+
+		changes, err := GetCommittedChanges(vcs, "origin/master", ChangeOptions{RenameThreshold: 40, CopyThreshold: 80})
+
+		Expect(err).To(BeNil())
+		Expect(changes).To(Equal([]FileChange{
+			{Path: "license.go"},
+			{Path: "core/header_copy.go"},
+			{Path: "main.go"},
+		}))
+	})
+
+	It("retrieves committed changes with special file names", func() {
+		vcsMock.On("Diff", "--name-status", "-z", "--ignore-submodules", "origin/master..HEAD").Return("M\x00with\ttab.go\x00"+
+			"R100\x00old\nname.go\x00new\nname.go\x00"+
+			"A\x00 leading space.go\x00", nil)
+
+		changes, err := GetCommittedChanges(vcs, "origin/master", ChangeOptions{})
+
+		Expect(err).To(BeNil())
+		Expect(changes).To(Equal([]FileChange{
+			{Path: "with\ttab.go"},
+			{Path: "new\nname.go"},
+			{Path: " leading space.go"},
+		}))
+	})
+
+	It("leaves out mode-only changes when asked to", func() {
+		vcsMock.On("Diff", "--raw", "--no-abbrev", "-z", "--ignore-submodules", "origin/master..HEAD").Return(
+			":100644 100755 0123456789abcdef0123456789abcdef01234567 0123456789abcdef0123456789abcdef01234567 M\x00build.sh\x00"+
+				":100644 100755 0123456789abcdef0123456789abcdef01234567 fedcba9876543210fedcba9876543210fedcba98 M\x00run.sh\x00"+
+				":100644 100644 0123456789abcdef0123456789abcdef01234567 fedcba9876543210fedcba9876543210fedcba98 M\x00main.go\x00"+
+				":100644 100644 0123456789abcdef0123456789abcdef01234567 0123456789abcdef0123456789abcdef01234567 R100\x00old.go\x00new.go\x00"+
+				":000000 100644 0000000000000000000000000000000000000000 0123456789abcdef0123456789abcdef01234567 A\x00added.go\x00", nil)
+
+		changes, err := GetCommittedChanges(vcs, "origin/master", ChangeOptions{ExcludeModeOnlyChanges: true})
+
+		Expect(err).To(BeNil())
+		Expect(changes).To(Equal([]FileChange{
+			{Path: "run.sh"},
+			{Path: "main.go"},
+			{Path: "new.go"},
+			{Path: "added.go"},
+		}))
+	})
+
+	It("only retrieves the committed files with added lines when asked to", func() {
+		vcsMock.On("Diff", "--name-status", "-z", "--ignore-submodules", "origin/master..HEAD").Return("M\x00added.go\x00"+
+			"M\x00deleted.go\x00"+
+			"R087\x00old.go\x00renamed.go\x00"+
+			"M\x00logo.png\x00", nil)
+		vcsMock.On("Diff", "--numstat", "-z", "--ignore-submodules", "origin/master..HEAD").Return("3\t1\tadded.go\x00"+
+			"0\t5\tdeleted.go\x00"+
+			"2\t0\t\x00old.go\x00renamed.go\x00"+
+			"-\t-\tlogo.png\x00", nil)
+
+		changes, err := GetCommittedChanges(vcs, "origin/master", ChangeOptions{AddedLinesOnly: true})
+
+		Expect(err).To(BeNil())
+		Expect(changes).To(Equal([]FileChange{
+			{Path: "added.go"},
+			{Path: "renamed.go"},
+			{Path: "logo.png"},
+		}))
+	})
+
+	It("retrieves uncommitted files with special file names", func() {
+		vcsMock.On("Status", "--porcelain", "-z", "--ignore-submodules").Return(" M with\ttab.go\x00"+
+			"R  new\nname.go\x00old\nname.go\x00"+
+			"?? \"quoted\".go\x00", nil)
+
+		changes, err := GetUncommittedChanges(vcs, ChangeOptions{})
+
+		Expect(err).To(BeNil())
+		Expect(changes).To(Equal([]FileChange{
+			{Path: "with\ttab.go"},
+			{Path: "new\nname.go"},
+			{Path: "\"quoted\".go"},
+		}))
+	})
+
+	It("retrieves uncommitted files renamed in the index and modified in the working tree under their destination path", func() {
+		vcsMock.On("Status", "--porcelain", "-z", "--ignore-submodules").Return("RM new.go\x00old.go\x00"+
+			"RD gone.go\x00former.go\x00"+
+			" M main.go\x00", nil)
+
+		changes, err := GetUncommittedChanges(vcs, ChangeOptions{})
+
+		Expect(err).To(BeNil())
+		Expect(changes).To(Equal([]FileChange{
+			{Path: "new.go"},
+			{Path: "main.go"},
+		}))
+	})
+
+	It("leaves out the committed changes of files renamed since", func() {
+		vcsMock.On("Diff", "--name-status", "-z", "--ignore-submodules", "origin/master..HEAD").Return("M\x00old.go\x00"+
+			"M\x00main.go\x00", nil)
+		vcsMock.On("Status", "--porcelain", "-z", "--ignore-submodules").Return("RM new.go\x00old.go\x00", nil)
+		client := &Client{Vcs: vcs}
+
+		changes, err := client.GetChanges("origin/master", ChangeOptions{})
+
+		Expect(err).To(BeNil())
+		Expect(changes).To(Equal([]FileChange{
+			{Path: "main.go"},
+			{Path: "new.go"},
+		}))
+	})
+
 	It("retrieves uncommitted files", func() {
-		vcsMock.On("Status", "--porcelain").Return(` M Gopkg.lock
- D main.go
-?? build.sh
-?? git.go
-`, nil)
+		vcsMock.On("Status", "--porcelain", "-z", "--ignore-submodules").Return(" M Gopkg.lock\x00"+
+			" D main.go\x00"+
+			"?? build.sh\x00"+
+			"?? git.go\x00", nil)
 
-		changes, err := GetUncommittedChanges(vcs)
+		changes, err := GetUncommittedChanges(vcs, ChangeOptions{})
 
 		Expect(err).To(BeNil())
 		Expect(changes).To(Equal([]FileChange{
@@ -80,14 +193,164 @@ A	license-header.txt
 		}))
 	})
 
+	It("merges committed and uncommitted changes of small change sets", func() {
+		vcsMock.On("Diff", "--name-status", "-z", "--ignore-submodules", "origin/master..HEAD").Return("M\x00main.go\x00", nil)
+		vcsMock.On("Status", "--porcelain", "-z", "--ignore-submodules").Return(" M main.go\x00"+
+			"?? core/headache.go\x00", nil)
+		client := &Client{Vcs: vcs}
+
+		changes, err := client.GetChanges("origin/master", ChangeOptions{})
+
+		Expect(err).To(BeNil())
+		Expect(changes).To(Equal([]FileChange{
+			{Path: "main.go"},
+			{Path: "core/headache.go"},
+		}))
+	})
+
+	It("merges committed and uncommitted changes of large change sets", func() {
+		vcsMock.On("Diff", "--name-status", "-z", "--ignore-submodules", "origin/master..HEAD").Return("M\x00a.go\x00"+
+			"M\x00b.go\x00"+
+			"M\x00c.go\x00"+
+			"M\x00d.go\x00"+
+			"M\x00e.go\x00", nil)
+		vcsMock.On("Status", "--porcelain", "-z", "--ignore-submodules").Return(" M a.go\x00"+
+			"?? f.go\x00"+
+			"?? g.go\x00"+
+			"?? h.go\x00"+
+			"?? i.go\x00", nil)
+		client := &Client{Vcs: vcs}
+
+		changes, err := client.GetChanges("origin/master", ChangeOptions{})
+
+		Expect(err).To(BeNil())
+		Expect(changes).To(ConsistOf(
+			FileChange{Path: "a.go"}, FileChange{Path: "b.go"}, FileChange{Path: "c.go"},
+			FileChange{Path: "d.go"}, FileChange{Path: "e.go"}, FileChange{Path: "f.go"},
+			FileChange{Path: "g.go"}, FileChange{Path: "h.go"}, FileChange{Path: "i.go"},
+		))
+	})
+
+	Describe("with allowed statuses", func() {
+
+		BeforeEach(func() {
+			vcsMock.On("Diff", "--name-status", "-z", "--ignore-submodules", "origin/master..HEAD").Return("A\x00added.go\x00"+
+				"M\x00modified.go\x00"+
+				"R087\x00old.go\x00renamed.go\x00", nil)
+			vcsMock.On("Status", "--porcelain", "-z", "--ignore-submodules").Return(" M edited.go\x00"+
+				"A  staged.go\x00"+
+				"?? untracked.go\x00", nil)
+		})
+
+		It("only retrieves added files", func() {
+			client := &Client{Vcs: vcs}
+
+			changes, err := client.GetChanges("origin/master", ChangeOptions{Statuses: []string{"A"}})
+
+			Expect(err).To(BeNil())
+			Expect(changes).To(Equal([]FileChange{
+				{Path: "added.go"},
+				{Path: "staged.go"},
+				{Path: "untracked.go"},
+			}))
+		})
+
+		It("only retrieves added and modified files", func() {
+			client := &Client{Vcs: vcs}
+
+			changes, err := client.GetChanges("origin/master", ChangeOptions{Statuses: []string{"A", "M"}})
+
+			Expect(err).To(BeNil())
+			Expect(changes).To(Equal([]FileChange{
+				{Path: "added.go"},
+				{Path: "modified.go"},
+				{Path: "edited.go"},
+				{Path: "staged.go"},
+				{Path: "untracked.go"},
+			}))
+		})
+	})
+
+	It("retrieves only staged changes when asked to", func() {
+		vcsMock.On("Diff", "--name-status", "-z", "--ignore-submodules", "--cached").Return("A\x00new.go\x00"+
+			"M\x00main.go\x00"+
+			"D\x00old.go\x00", nil)
+		client := &Client{Vcs: vcs}
+
+		changes, err := client.GetChanges("origin/master", ChangeOptions{Staged: true})
+
+		Expect(err).To(BeNil())
+		Expect(changes).To(Equal([]FileChange{
+			{Path: "new.go"},
+			{Path: "main.go"},
+		}))
+	})
+
+	It("retrieves the union of the files changed by the given commits", func() {
+		vcsMock.On("Log", "-1", "--format=%P", "cafebabe").Return("deadbeef\n", nil)
+		vcsMock.On("Diff", "--name-status", "-z", "--ignore-submodules", "deadbeef", "cafebabe").
+			Return("M\x00main.go\x00A\x00api.go\x00", nil)
+		vcsMock.On("Log", "-1", "--format=%P", "f00dcafe").Return("cafebabe 8badf00d\n", nil)
+		vcsMock.On("Diff", "--name-status", "-z", "--ignore-submodules", "cafebabe", "f00dcafe").
+			Return("M\x00api.go\x00D\x00old.go\x00", nil)
+
+		changes, err := ChangesInCommits(vcs, []string{"cafebabe", "f00dcafe"}, ChangeOptions{})
+
+		Expect(err).To(BeNil())
+		Expect(changes).To(Equal([]FileChange{{Path: "main.go"}, {Path: "api.go"}}))
+	})
+
+	It("retrieves the files changed by root commits and commit ranges", func() {
+		vcsMock.On("Log", "-1", "--format=%P", "cafebabe").Return("\n", nil)
+		vcsMock.On("Diff", "--name-status", "-z", "--ignore-submodules", "4b825dc642cb6eb9a060e54bf8d69288fbee4904", "cafebabe").
+			Return("A\x00main.go\x00", nil)
+		vcsMock.On("Diff", "--name-status", "-z", "--ignore-submodules", "origin/main..pr/42").
+			Return("A\x00api.go\x00", nil)
+
+		changes, err := ChangesInCommits(vcs, []string{"cafebabe", "origin/main..pr/42"}, ChangeOptions{})
+
+		Expect(err).To(BeNil())
+		Expect(changes).To(Equal([]FileChange{{Path: "main.go"}, {Path: "api.go"}}))
+	})
+
+	It("retrieves all tracked files", func() {
+		vcsMock.On("LsFiles", "-z").Return("main.go\x00"+
+			"docs/with space.go\x00"+
+			"vendor/lib.go\x00", nil)
+
+		files, err := GetTrackedFiles(vcs)
+
+		Expect(err).To(BeNil())
+		Expect(files).To(Equal([]FileChange{
+			{Path: "main.go"},
+			{Path: "docs/with space.go"},
+			{Path: "vendor/lib.go"},
+		}))
+	})
+
+	It("retrieves the copyright years of the given files", func() {
+		logArguments := []interface{}{"--follow", "--name-status", "--use-mailmap", "--format=%at%x00%aN", "--"}
+		vcsMock.On("Log", append(logArguments, "main.go")...).Return("1530000000\nM\tmain.go\n1499817600\nA\tmain.go\n", nil)
+		vcsMock.On("Log", append(logArguments, "docs/with space.go")...).Return("1420070400\nA\tdocs/with space.go\n", nil)
+
+		changes, err := ChangesForPaths(&Client{Vcs: vcs}, []string{"main.go", "docs/with space.go"}, FakeTime{}, HistoryOptions{})
+
+		Expect(err).To(BeNil())
+		Expect(changes).To(Equal([]FileChange{
+			{Path: "main.go", CreationYear: 2017, LastEditionYear: 2018,
+				CreationTime: time.Unix(1499817600, 0), LastEditionTime: time.Unix(1530000000, 0)},
+			{Path: "docs/with space.go", CreationYear: 2015, LastEditionYear: 2015,
+				CreationTime: time.Unix(1420070400, 0), LastEditionTime: time.Unix(1420070400, 0)},
+		}))
+	})
+
 	It("retrieves no changes when everything is committed", func() {
-		vcsMock.On("Status", "--porcelain").Return(` M Gopkg.lock
- D main.go
-?? build.sh
-?? git.go
-`, nil)
+		vcsMock.On("Status", "--porcelain", "-z", "--ignore-submodules").Return(" M Gopkg.lock\x00"+
+			" D main.go\x00"+
+			"?? build.sh\x00"+
+			"?? git.go\x00", nil)
 
-		changes, err := GetUncommittedChanges(vcs)
+		changes, err := GetUncommittedChanges(vcs, ChangeOptions{})
 
 		Expect(err).To(BeNil())
 		Expect(changes).To(Equal([]FileChange{
@@ -97,6 +360,106 @@ A	license-header.txt
 		}))
 	})
 
+	It("resolves the base of changes once and reuses it", func() {
+		vcsMock.On("Log", "-1", "--format=%H", "origin/main").Return("cafebabe\n", nil).Once()
+		vcsMock.On("Log", "-1", "--format=%H", "origin/release").Return("deadbeef\n", nil).Once()
+		vcsMock.On("Diff", "--name-status", "-z", "--ignore-submodules", "cafebabe..HEAD").Return("M\x00main.go\x00", nil).Twice()
+		vcsMock.On("Diff", "--name-status", "-z", "--ignore-submodules", "deadbeef...HEAD").Return("M\x00main.go\x00", nil).Twice()
+		vcsMock.On("Status", "--porcelain", "-z", "--ignore-submodules").Return("", nil).Twice()
+		client := &Client{Vcs: vcs, Bases: &BaseCache{}}
+
+		for i := 0; i < 2; i++ {
+			changes, err := client.GetChanges("origin/main", ChangeOptions{ForkPointBranch: "origin/release"})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(changes).To(Equal([]FileChange{{Path: "main.go"}}))
+		}
+	})
+
+	It("fails to compute changes from bases which cannot be resolved", func() {
+		vcsMock.On("Log", "-1", "--format=%H", "origin/main").Return("", errors.New("unknown revision")).Once()
+		client := &Client{Vcs: vcs, Bases: &BaseCache{}}
+
+		_, err := client.GetChanges("origin/main", ChangeOptions{})
+
+		Expect(err).To(MatchError("unknown revision"))
+	})
+
+	Describe("computing the difference of change sets", func() {
+
+		It("keeps the changes absent from the previous ones, whatever their years", func() {
+			changes := []FileChange{
+				{Path: "c.go", CreationYear: 2019, LastEditionYear: 2020},
+				{Path: "a.go", CreationYear: 2018, LastEditionYear: 2020},
+				{Path: "b.go", CreationYear: 2020, LastEditionYear: 2020},
+			}
+			previousChanges := []FileChange{
+				{Path: "a.go", CreationYear: 2018, LastEditionYear: 2019},
+				{Path: "d.go", CreationYear: 2017, LastEditionYear: 2017},
+			}
+
+			Expect(Difference(changes, previousChanges)).To(Equal([]FileChange{
+				{Path: "c.go", CreationYear: 2019, LastEditionYear: 2020},
+				{Path: "b.go", CreationYear: 2020, LastEditionYear: 2020},
+			}))
+		})
+
+		It("keeps all the changes without previous ones", func() {
+			changes := []FileChange{{Path: "a.go"}, {Path: "b.go"}}
+
+			Expect(Difference(changes, nil)).To(Equal(changes))
+		})
+
+		It("keeps no change when all were there previously", func() {
+			changes := []FileChange{{Path: "a.go"}, {Path: "b.go"}}
+
+			Expect(Difference(changes, []FileChange{{Path: "b.go"}, {Path: "a.go"}, {Path: "c.go"}})).To(BeEmpty())
+		})
+	})
+
+	Describe("adding metadata", func() {
+
+		var logArguments []interface{}
+
+		BeforeEach(func() {
+			logArguments = []interface{}{"--follow", "--name-status", "--use-mailmap", "--format=%at%x00%aN", "--"}
+		})
+
+		It("reports the failures of all files while adding the years of the others", func() {
+			logError := errors.New("log failed")
+			vcsMock.On("Log", append(logArguments, "failing.go")...).Return("", logError)
+			vcsMock.On("Log", append(logArguments, "main.go")...).Return("1537974554\x00Jane\nM\tmain.go\n1499817600\x00John\nA\tmain.go\n", nil)
+			vcsMock.On("Log", append(logArguments, "garbled.go")...).Return("not a timestamp\nM\tgarbled.go\n", nil)
+			client := &Client{Vcs: vcs}
+
+			changes, err := client.AddMetadata([]FileChange{{Path: "failing.go"}, {Path: "main.go"}, {Path: "garbled.go"}}, FakeTime{}, HistoryOptions{})
+
+			Expect(err).To(BeAssignableToTypeOf(&MultiError{}))
+			multiError := err.(*MultiError)
+			Expect(multiError.Paths()).To(Equal([]string{"failing.go", "garbled.go"}))
+			Expect(multiError.Unwrap()).To(HaveLen(2))
+			Expect(multiError.Failures[0].Err).To(Equal(logError))
+			Expect(err.Error()).To(HavePrefix("2 file(s) failed\n\tfailing.go: log failed\n\tgarbled.go: could not parse timestamp"))
+			Expect(changes).To(Equal([]FileChange{
+				{Path: "failing.go"},
+				{Path: "main.go", CreationYear: 2017, LastEditionYear: 2018,
+					CreationTime: time.Unix(1499817600, 0), LastEditionTime: time.Unix(1537974554, 0)},
+				{Path: "garbled.go"},
+			}))
+		})
+
+		It("does not fail when every file succeeds", func() {
+			vcsMock.On("Log", append(logArguments, "main.go")...).Return("1499817600\x00John\nA\tmain.go\n", nil)
+			client := &Client{Vcs: vcs}
+
+			changes, err := client.AddMetadata([]FileChange{{Path: "main.go"}}, FakeTime{}, HistoryOptions{})
+
+			Expect(err).To(BeNil())
+			Expect(changes).To(Equal([]FileChange{{Path: "main.go", CreationYear: 2017, LastEditionYear: 2017,
+				CreationTime: time.Unix(1499817600, 0), LastEditionTime: time.Unix(1499817600, 0)}}))
+		})
+	})
+
 	Describe("retrieves file history", func() {
 
 		var (
@@ -105,7 +468,7 @@ A	license-header.txt
 		)
 
 		BeforeEach(func() {
-			logArguments = []interface{}{"--follow", "--name-status", "--format=%at", "--"}
+			logArguments = []interface{}{"--follow", "--name-status", "--use-mailmap", "--format=%at%x00%aN", "--"}
 			fakeTime = FakeTime{timestamp: fakeNow}
 		})
 
@@ -121,22 +484,56 @@ M	somefile.go
 A	cmd/commands/ginkgo_suite_test.go
 `, nil)
 
-			history, err := GetFileHistory(vcs, "somefile.go", FakeTime{})
+			history, err := GetFileHistory(vcs, "somefile.go", FakeTime{}, HistoryOptions{})
 
 			Expect(err).To(BeNil())
 			Expect(history.CreationYear).To(Equal(2017))
 			Expect(history.LastEditionYear).To(Equal(2018))
+			Expect(history.CreationTime).To(Equal(time.Unix(1499817600, 0)))
+			Expect(history.LastEditionTime).To(Equal(time.Unix(1537974554, 0)))
+		})
+
+		It("leaves the commits of excluded authors out of the last edition year", func() {
+			vcsMock.On("Log", append(logArguments, "vendored.go")...).Return("1700000000\x00sync-bot[bot]\nM\tvendored.go\n"+
+				"1640995200\x00sync-bot[bot]\nM\tvendored.go\n"+
+				"1530000000\x00Jane\nM\tvendored.go\n"+
+				"1499817600\x00John\nA\tvendored.go\n", nil)
+
+			history, err := GetFileHistory(vcs, "vendored.go", FakeTime{}, HistoryOptions{
+				EditionExcludedAuthors: regexp.MustCompile(`\[bot\]$`),
+			})
+
+			Expect(err).To(BeNil())
+			Expect(history.CreationYear).To(Equal(2017))
+			Expect(history.LastEditionYear).To(Equal(2018))
+			Expect(history.LastEditionTime).To(Equal(time.Unix(1530000000, 0)))
+			Expect(history.Authors).To(Equal([]string{"sync-bot[bot]", "Jane", "John"}))
+		})
+
+		It("keeps the creation year as last edition year of files only committed by excluded authors", func() {
+			vcsMock.On("Log", append(logArguments, "vendored.go")...).Return("1700000000\x00sync-bot[bot]\nM\tvendored.go\n"+
+				"1499817600\x00sync-bot[bot]\nA\tvendored.go\n", nil)
+
+			history, err := GetFileHistory(vcs, "vendored.go", FakeTime{}, HistoryOptions{
+				EditionExcludedAuthors: regexp.MustCompile(`\[bot\]$`),
+			})
+
+			Expect(err).To(BeNil())
+			Expect(history.CreationYear).To(Equal(2017))
+			Expect(history.LastEditionYear).To(Equal(2017))
 		})
 
 		It("returns current year for unversioned files", func() {
 			vcsMock.On("Log", append(logArguments, "somefile.go")...).Return(``, nil)
 			currentYear := fakeTime.Now().Year()
 
-			history, err := GetFileHistory(vcs, "somefile.go", fakeTime)
+			history, err := GetFileHistory(vcs, "somefile.go", fakeTime, HistoryOptions{})
 
 			Expect(err).To(BeNil())
 			Expect(history.CreationYear).To(Equal(currentYear))
 			Expect(history.LastEditionYear).To(Equal(currentYear))
+			Expect(history.CreationTime).To(Equal(fakeTime.Now()))
+			Expect(history.LastEditionTime).To(Equal(fakeTime.Now()))
 		})
 
 		It("returns the commit year for both creation and last edition year when file has been committed only once", func() {
@@ -144,7 +541,7 @@ A	cmd/commands/ginkgo_suite_test.go
 
 A	somefile.go
 `, nil)
-			history, err := GetFileHistory(vcs, "somefile.go", fakeTime)
+			history, err := GetFileHistory(vcs, "somefile.go", fakeTime, HistoryOptions{})
 
 			Expect(err).To(BeNil())
 			Expect(history.CreationYear).To(Equal(1982))
@@ -160,7 +557,7 @@ R100	cmd/commands/ginkgo_suite_test.go	pkg/core/ginkgo_suite_test.go
 
 A	cmd/commands/ginkgo_suite_test.go
 `, nil)
-			history, err := GetFileHistory(vcs, "pkg/core/ginkgo_suite_test.go", fakeTime)
+			history, err := GetFileHistory(vcs, "pkg/core/ginkgo_suite_test.go", fakeTime, HistoryOptions{})
 
 			Expect(err).To(BeNil())
 			Expect(history.CreationYear).To(Equal(2018))
@@ -176,19 +573,211 @@ C100	cmd/commands/ginkgo_suite_test.go	pkg/core/ginkgo_suite_test.go
 
 A	cmd/commands/ginkgo_suite_test.go
 `, nil)
-			history, err := GetFileHistory(vcs, "pkg/core/ginkgo_suite_test.go", fakeTime)
+			history, err := GetFileHistory(vcs, "pkg/core/ginkgo_suite_test.go", fakeTime, HistoryOptions{})
 
 			Expect(err).To(BeNil())
 			Expect(history.CreationYear).To(Equal(2018))
 			Expect(history.LastEditionYear).To(Equal(2018))
 		})
 
+		It("clamps years before the minimum year", func() {
+			vcsMock.On("Log", append(logArguments, "somefile.go")...).Return(`1537974554
+M	somefile.go
+0
+A	somefile.go
+`, nil)
+
+			history, err := GetFileHistory(vcs, "somefile.go", fakeTime, HistoryOptions{MinYear: 2012, MaxYear: 2020})
+
+			Expect(err).To(BeNil())
+			Expect(history.CreationYear).To(Equal(2012))
+			Expect(history.LastEditionYear).To(Equal(2018))
+		})
+
+		It("clamps epoch-zero commits to the default minimum year", func() {
+			vcsMock.On("Log", append(logArguments, "somefile.go")...).Return(`1537974554
+M	somefile.go
+0
+A	somefile.go
+`, nil)
+
+			history, err := GetFileHistory(vcs, "somefile.go", fakeTime, HistoryOptions{MinYear: DefaultMinYear, MaxYear: 2020})
+
+			Expect(err).To(BeNil())
+			Expect(history.CreationYear).To(Equal(1971))
+			Expect(history.LastEditionYear).To(Equal(2018))
+		})
+
+		It("clamps years after the maximum year", func() {
+			vcsMock.On("Log", append(logArguments, "somefile.go")...).Return(`4070908800
+M	somefile.go
+1499817600
+A	somefile.go
+`, nil)
+
+			history, err := GetFileHistory(vcs, "somefile.go", fakeTime, HistoryOptions{MinYear: 1970, MaxYear: 2020})
+
+			Expect(err).To(BeNil())
+			Expect(history.CreationYear).To(Equal(2017))
+			Expect(history.LastEditionYear).To(Equal(2020))
+		})
+
+		It("sets the last edition year to the current year when touching files", func() {
+			vcsMock.On("Log", append(logArguments, "somefile.go")...).Return(`405561600
+M	somefile.go
+373420800
+A	somefile.go
+`, nil)
+
+			history, err := GetFileHistory(vcs, "somefile.go", fakeTime, HistoryOptions{Touch: true})
+
+			Expect(err).To(BeNil())
+			Expect(history.CreationYear).To(Equal(1981))
+			Expect(history.LastEditionYear).To(Equal(fakeTime.Now().Year()))
+		})
+
+		It("retrieves the commit years and authors in a single pass", func() {
+			vcsMock.On("Log", append(logArguments, "somefile.go")...).Return("1537974554\x00Tab\tSeparated\n"+
+				"\n"+
+				"M\tsomefile.go\n"+
+				"1537844925\x00 1337 \x01Spaced\n"+
+				"\n"+
+				"M\tsomefile.go\n"+
+				"1499817600\x00Tab\tSeparated\n"+
+				"\n"+
+				"A\tsomefile.go\n", nil)
+
+			history, err := GetFileHistory(vcs, "somefile.go", FakeTime{}, HistoryOptions{})
+
+			Expect(err).To(BeNil())
+			Expect(history.CreationYear).To(Equal(2017))
+			Expect(history.LastEditionYear).To(Equal(2018))
+			Expect(history.Authors).To(Equal([]string{"Tab\tSeparated", " 1337 \x01Spaced"}))
+		})
+
+		It("uses the year of the release tag containing the last commit when asked to", func() {
+			vcsMock.On("Log", append(logArguments, "somefile.go")...).Return(`1530000000
+M	somefile.go
+1499817600
+A	somefile.go
+`, nil)
+			vcsMock.On("LatestRevision", "somefile.go").Return("cafebabe", nil)
+			vcsMock.On("Describe", "--contains", "--tags", "cafebabe").Return("v1.2.0~3\n", nil)
+			vcsMock.On("Log", "-1", "--format=%at", "v1.2.0").Return("1551657600\n", nil)
+
+			history, err := GetFileHistory(vcs, "somefile.go", fakeTime, HistoryOptions{ReleaseYears: true})
+
+			Expect(err).To(BeNil())
+			Expect(history.CreationYear).To(Equal(2017))
+			Expect(history.LastEditionYear).To(Equal(2019))
+		})
+
+		It("keeps the last commit year of unreleased files when asked to use release years", func() {
+			vcsMock.On("Log", append(logArguments, "somefile.go")...).Return(`1530000000
+M	somefile.go
+1499817600
+A	somefile.go
+`, nil)
+			vcsMock.On("LatestRevision", "somefile.go").Return("cafebabe", nil)
+			vcsMock.On("Describe", "--contains", "--tags", "cafebabe").
+				Return("", errors.New("fatal: cannot describe 'cafebabe'"))
+
+			history, err := GetFileHistory(vcs, "somefile.go", fakeTime, HistoryOptions{ReleaseYears: true})
+
+			Expect(err).To(BeNil())
+			Expect(history.CreationYear).To(Equal(2017))
+			Expect(history.LastEditionYear).To(Equal(2018))
+		})
+
+		It("uses the year of the last commit of the whole history by default", func() {
+			vcsMock.On("Log", append(logArguments, "somefile.go")...).Return(`1551657600
+M	somefile.go
+1530000000
+M	somefile.go
+1499817600
+A	somefile.go
+`, nil)
+
+			history, err := GetFileHistory(vcs, "somefile.go", fakeTime, HistoryOptions{})
+
+			Expect(err).To(BeNil())
+			Expect(history.CreationYear).To(Equal(2017))
+			Expect(history.LastEditionYear).To(Equal(2019))
+		})
+
+		It("uses the year of the latest commit since the edition revision when asked to", func() {
+			vcsMock.On("Log", append(logArguments, "somefile.go")...).Return(`1551657600
+M	somefile.go
+1530000000
+M	somefile.go
+1499817600
+A	somefile.go
+`, nil)
+			vcsMock.On("Log", "--format=%at", "base..HEAD", "--", "somefile.go").Return("1499817600\n1530000000\n", nil)
+
+			history, err := GetFileHistory(vcs, "somefile.go", fakeTime, HistoryOptions{EditionRevision: "base"})
+
+			Expect(err).To(BeNil())
+			Expect(history.CreationYear).To(Equal(2017))
+			Expect(history.LastEditionYear).To(Equal(2018))
+		})
+
+		It("keeps the last commit year of files unchanged since the edition revision", func() {
+			vcsMock.On("Log", append(logArguments, "somefile.go")...).Return(`1530000000
+M	somefile.go
+1499817600
+A	somefile.go
+`, nil)
+			vcsMock.On("Log", "--format=%at", "base..HEAD", "--", "somefile.go").Return("", nil)
+
+			history, err := GetFileHistory(vcs, "somefile.go", fakeTime, HistoryOptions{EditionRevision: "base"})
+
+			Expect(err).To(BeNil())
+			Expect(history.CreationYear).To(Equal(2017))
+			Expect(history.LastEditionYear).To(Equal(2018))
+		})
+
+		It("uses the creation year of files with a thin history by default", func() {
+			vcsMock.On("Log", append(logArguments, "pkg/tiny.go")...).Return("1530000000\nA\tpkg/tiny.go\n", nil)
+
+			history, err := GetFileHistory(vcs, "pkg/tiny.go", fakeTime, HistoryOptions{})
+
+			Expect(err).To(BeNil())
+			Expect(history.CreationYear).To(Equal(2018))
+			Expect(history.LastEditionYear).To(Equal(2018))
+		})
+
+		It("uses the creation year of the directory of files with a thin history when asked to", func() {
+			vcsMock.On("Log", append(logArguments, "pkg/tiny.go")...).Return("1530000000\nA\tpkg/tiny.go\n", nil)
+			vcsMock.On("Log", "--format=%at", "--", "pkg").Return("1530000000\n1499817600\n1420070400\n", nil)
+
+			history, err := GetFileHistory(vcs, "pkg/tiny.go", fakeTime, HistoryOptions{DirectoryHistoryThreshold: 2})
+
+			Expect(err).To(BeNil())
+			Expect(history.CreationYear).To(Equal(2015))
+			Expect(history.LastEditionYear).To(Equal(2018))
+		})
+
+		It("keeps the creation year of files with enough history when asked to use the directory history", func() {
+			vcsMock.On("Log", append(logArguments, "pkg/main.go")...).Return(`1530000000
+M	pkg/main.go
+1499817600
+A	pkg/main.go
+`, nil)
+
+			history, err := GetFileHistory(vcs, "pkg/main.go", fakeTime, HistoryOptions{DirectoryHistoryThreshold: 2})
+
+			Expect(err).To(BeNil())
+			Expect(history.CreationYear).To(Equal(2017))
+			Expect(history.LastEditionYear).To(Equal(2018))
+		})
+
 		It("should fail on invalid output", func() {
 			vcsMock.On("Log", append(logArguments, "somefile.go")...).Return(`wat
 saywat
 `, nil)
 
-			_, err := GetFileHistory(vcs, "somefile.go", fakeTime)
+			_, err := GetFileHistory(vcs, "somefile.go", fakeTime, HistoryOptions{})
 
 			Expect(err).To(MatchError("could not parse timestamp (line 1) of file \"somefile.go\" history. Full commit log below\nwat\nsaywat\n"))
 		})
@@ -11,13 +11,13 @@ type VersioningClient struct {
 	mock.Mock
 }
 
-// AddMetadata provides a mock function with given fields: changes, clock
-func (_m *VersioningClient) AddMetadata(changes []vcs.FileChange, clock helper.Clock) ([]vcs.FileChange, error) {
-	ret := _m.Called(changes, clock)
+// AddMetadata provides a mock function with given fields: changes, clock, options
+func (_m *VersioningClient) AddMetadata(changes []vcs.FileChange, clock helper.Clock, options vcs.HistoryOptions) ([]vcs.FileChange, error) {
+	ret := _m.Called(changes, clock, options)
 
 	var r0 []vcs.FileChange
-	if rf, ok := ret.Get(0).(func([]vcs.FileChange, helper.Clock) []vcs.FileChange); ok {
-		r0 = rf(changes, clock)
+	if rf, ok := ret.Get(0).(func([]vcs.FileChange, helper.Clock, vcs.HistoryOptions) []vcs.FileChange); ok {
+		r0 = rf(changes, clock, options)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]vcs.FileChange)
@@ -25,8 +25,8 @@ func (_m *VersioningClient) AddMetadata(changes []vcs.FileChange, clock helper.C
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func([]vcs.FileChange, helper.Clock) error); ok {
-		r1 = rf(changes, clock)
+	if rf, ok := ret.Get(1).(func([]vcs.FileChange, helper.Clock, vcs.HistoryOptions) error); ok {
+		r1 = rf(changes, clock, options)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -34,13 +34,13 @@ func (_m *VersioningClient) AddMetadata(changes []vcs.FileChange, clock helper.C
 	return r0, r1
 }
 
-// GetChanges provides a mock function with given fields: revision
-func (_m *VersioningClient) GetChanges(revision string) ([]vcs.FileChange, error) {
-	ret := _m.Called(revision)
+// GetChanges provides a mock function with given fields: revision, options
+func (_m *VersioningClient) GetChanges(revision string, options vcs.ChangeOptions) ([]vcs.FileChange, error) {
+	ret := _m.Called(revision, options)
 
 	var r0 []vcs.FileChange
-	if rf, ok := ret.Get(0).(func(string) []vcs.FileChange); ok {
-		r0 = rf(revision)
+	if rf, ok := ret.Get(0).(func(string, vcs.ChangeOptions) []vcs.FileChange); ok {
+		r0 = rf(revision, options)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]vcs.FileChange)
@@ -48,8 +48,8 @@ func (_m *VersioningClient) GetChanges(revision string) ([]vcs.FileChange, error
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(string) error); ok {
-		r1 = rf(revision)
+	if rf, ok := ret.Get(1).(func(string, vcs.ChangeOptions) error); ok {
+		r1 = rf(revision, options)
 	} else {
 		r1 = ret.Error(1)
 	}